@@ -2,74 +2,308 @@ package main
 
 import (
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"time"
 
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
+// every pump.fun bonding curve starts with these reserves
+var (
+	initialVirtualTokenReserves uint64 = 1073000000000000
+	initialVirtualSolReserves   uint64 = 30000000000
+	initialRealTokenReserves    uint64 = 793100000000000
+	tokenTotalSupply            uint64 = 1000000000000000
+)
+
+// raw units in a whole token, pump tokens have 6 decimals
+const tokenUnit = 1_000_000
+
+var (
+	errNotEnoughTokens      = errors.New("Bonding Curve Has Insufficient Tokens")
+	errBondingCurveComplete = errors.New("Bonding Curve Complete")
+	errCurveTooFarAlong     = errors.New("Bonding Curve Too Far Along")
+	errBondingCurveNotFound = errors.New("FBCD: bonding curve account not found")
+	errStaleBondingCurve    = errors.New("Bonding Curve Read Is Stale")
+)
+
 // BondingCurveData holds the relevant information decoded from the on-chain data.
 type BondingCurveData struct {
 	RealTokenReserves    *big.Int
 	VirtualTokenReserves *big.Int
 	VirtualSolReserves   *big.Int
+	RealSolReserves      *big.Int
+	TokenTotalSupply     *big.Int
+	Complete             bool // the curve sold out, trading moves to Raydium
+
+	// MigrationThreshold is the real SOL reserves at which the curve completes, 0 for `defaultMigrationThreshold`
+	MigrationThreshold uint64
+
+	// Slot is the slot the RPC read the curve at, 0 if it wasn't read from chain (e.g. rebuilt from a trade)
+	Slot uint64
+}
+
+// Progress is how far (percent, 0-100) the curve is toward completing and migrating, by the real SOL
+// it holds versus its migration threshold
+func (b *BondingCurveData) Progress() float64 {
+	if b.Complete {
+		return 100
+	}
+
+	threshold := b.MigrationThreshold
+	if threshold == 0 {
+		threshold = defaultMigrationThreshold
+	}
+
+	if b.RealSolReserves == nil || threshold == 0 {
+		return 0
+	}
+
+	realSol, _ := new(big.Float).SetInt(b.RealSolReserves).Float64()
+	return min(max(100*realSol/float64(threshold), 0), 100)
+}
+
+// SpotPrice is the marginal price of a whole token in lamports, from the virtual reserves. kept
+// as an exact ratio, since a token is only worth a few dozen lamports early in the curve
+func (b *BondingCurveData) SpotPrice() *big.Rat {
+	if b.VirtualTokenReserves == nil || b.VirtualTokenReserves.Sign() <= 0 {
+		return new(big.Rat)
+	}
+
+	lamports := new(big.Int).Mul(b.VirtualSolReserves, big.NewInt(tokenUnit))
+	return new(big.Rat).SetFrac(lamports, b.VirtualTokenReserves)
 }
 
 func (b *BondingCurveData) String() string {
-	return fmt.Sprintf("RealTokenReserves=%s, VirtualTokenReserves=%s, VirtualSolReserves=%s", b.RealTokenReserves, b.VirtualTokenReserves, b.VirtualSolReserves)
+	return fmt.Sprintf("RealTokenReserves=%s, VirtualTokenReserves=%s, VirtualSolReserves=%s, RealSolReserves=%s, TokenTotalSupply=%s, Complete=%t",
+		b.RealTokenReserves, b.VirtualTokenReserves, b.VirtualSolReserves, b.RealSolReserves, b.TokenTotalSupply, b.Complete)
+}
+
+// curveAfterCreatorBuy returns the state of a brand new bonding curve
+// after the creator bought `creatorTokens` in the launch tx
+func curveAfterCreatorBuy(creatorTokens uint64) *BondingCurveData {
+	virtualTokenReserves := new(big.Int).SetUint64(initialVirtualTokenReserves)
+	virtualSolReserves := new(big.Int).SetUint64(initialVirtualSolReserves)
+	invariant := new(big.Int).Mul(virtualTokenReserves, virtualSolReserves)
+
+	newVirtualTokenReserves := new(big.Int).Sub(virtualTokenReserves, new(big.Int).SetUint64(creatorTokens))
+
+	newVirtualSolReserves := new(big.Int).Div(invariant, newVirtualTokenReserves)
+
+	return &BondingCurveData{
+		RealTokenReserves:    new(big.Int).SetUint64(initialRealTokenReserves - creatorTokens),
+		VirtualTokenReserves: newVirtualTokenReserves,
+		VirtualSolReserves:   newVirtualSolReserves,
+		RealSolReserves:      new(big.Int).Sub(newVirtualSolReserves, virtualSolReserves),
+		TokenTotalSupply:     new(big.Int).SetUint64(tokenTotalSupply),
+	}
 }
 
 // fetchBondingCurve fetches the bonding curve data from the blockchain and decodes it.
+// a missing account is retried up to `bondingCurveRetries` times, since a brand new
+// bonding curve may not be visible yet at processed commitment
 func (b *Bot) fetchBondingCurve(bondingCurvePubKey solana.PublicKey) (*BondingCurveData, error) {
-	accountInfo, err := b.rpcClient.GetAccountInfoWithOpts(context.TODO(), bondingCurvePubKey, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentProcessed})
-	if err != nil || accountInfo.Value == nil {
-		return nil, fmt.Errorf("FBCD: failed to get account info: %w", err)
+	var accountInfo *rpc.GetAccountInfoResult
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		// solana-go reports a nil account value as rpc.ErrNotFound
+		accountInfo, err = b.rpcClient.GetAccountInfoWithOpts(context.TODO(), bondingCurvePubKey, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentProcessed})
+		if err == nil && accountInfo.Value != nil {
+			break
+		}
+
+		if err != nil && !errors.Is(err, rpc.ErrNotFound) {
+			return nil, fmt.Errorf("FBCD: failed to get account info: %w", err)
+		}
+
+		// our node may just not have applied the create yet, another one might have
+		if accountInfo = b.fetchBondingCurveFallback(bondingCurvePubKey); accountInfo != nil {
+			break
+		}
+
+		if attempt >= b.bondingCurveRetries {
+			return nil, fmt.Errorf("%w after %d attempts", errBondingCurveNotFound, attempt+1)
+		}
+
+		time.Sleep(b.bondingCurveRetryDelay)
+	}
+
+	curve, err := decodeBondingCurve(accountInfo.Value.Data.GetBinary())
+	if err != nil {
+		return nil, err
+	}
+
+	curve.MigrationThreshold = b.currentMigrationThreshold()
+	curve.Slot = accountInfo.Context.Slot
+	return curve, nil
+}
+
+// fetchBondingCurveFallback fetches the bonding curve account through `bondingCurveFallbackClient`, nil without
+// one or if it doesn't see the account either. its errors only get logged, our own RPC's answer stands
+func (b *Bot) fetchBondingCurveFallback(bondingCurvePubKey solana.PublicKey) *rpc.GetAccountInfoResult {
+	if b.bondingCurveFallbackClient == nil {
+		return nil
+	}
+
+	accountInfo, err := b.bondingCurveFallbackClient.GetAccountInfoWithOpts(context.TODO(), bondingCurvePubKey, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentProcessed})
+	if err != nil {
+		if !errors.Is(err, rpc.ErrNotFound) {
+			b.statusr("FBCD: fallback RPC failed to get account info: " + err.Error())
+		}
+
+		return nil
+	}
+
+	return accountInfo
+}
+
+// fetchFreshBondingCurve is fetchBondingCurve, refetching once if a lagging RPC node served a stale curve
+// (see curveStale). a curve that's still stale fails with errStaleBondingCurve
+func (b *Bot) fetchFreshBondingCurve(bondingCurvePubKey solana.PublicKey) (*BondingCurveData, error) {
+	for attempt := 0; ; attempt++ {
+		curve, err := b.fetchBondingCurve(bondingCurvePubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		lag, stale := b.curveStale(curve)
+		if !stale {
+			return curve, nil
+		}
+
+		if attempt >= 1 {
+			return nil, fmt.Errorf("%w: read %d slots behind", errStaleBondingCurve, lag)
+		}
+	}
+}
+
+// curveStale checks if `curve` was read over `maxCurveSlotLag` slots before the current slot, counting it
+// if so. curves without a slot, or while we don't know the current slot, are never stale
+func (b *Bot) curveStale(curve *BondingCurveData) (lag uint64, stale bool) {
+	current := b.currentSlot()
+	if b.maxCurveSlotLag == 0 || curve.Slot == 0 || current <= curve.Slot {
+		return 0, false
+	}
+
+	lag = current - curve.Slot
+	if lag <= b.maxCurveSlotLag {
+		return lag, false
+	}
+
+	staleCurveReads.Inc()
+	return lag, true
+}
+
+// currentSlot is the latest slot the jito manager observed, 0 without one
+func (b *Bot) currentSlot() uint64 {
+	if b.jitoManager == nil {
+		return 0
 	}
 
-	data := accountInfo.Value.Data.GetBinary()
-	if len(data) < 24 {
-		return nil, fmt.Errorf("FBCD: insufficient data length")
+	return b.jitoManager.slot()
+}
+
+// curveAfterTrade is the bonding curve right after `trade`. trades only log the virtual reserves,
+// the real ones are what was added to / taken from the launch reserves
+func (b *Bot) curveAfterTrade(trade *TradeEvent) *BondingCurveData {
+	launchVirtualTokens, launchVirtualSol, launchRealTokens := b.currentLaunchReserves()
+
+	virtualSol := new(big.Int).SetUint64(trade.VirtualSolReserves)
+	virtualTokens := new(big.Int).SetUint64(trade.VirtualTokenReserves)
+	tokensSold := new(big.Int).Sub(new(big.Int).SetUint64(launchVirtualTokens), virtualTokens)
+	realTokens := new(big.Int).Sub(new(big.Int).SetUint64(launchRealTokens), tokensSold)
+
+	return &BondingCurveData{
+		VirtualSolReserves:   virtualSol,
+		VirtualTokenReserves: virtualTokens,
+		RealSolReserves:      new(big.Int).Sub(virtualSol, new(big.Int).SetUint64(launchVirtualSol)),
+		RealTokenReserves:    realTokens,
+		Complete:             realTokens.Sign() <= 0,
+		MigrationThreshold:   migrationThreshold(launchVirtualTokens, launchVirtualSol, launchRealTokens),
 	}
+}
 
-	// Decode the bonding curve data assuming it follows little-endian format
-	realTokenReserves := big.NewInt(0).SetUint64(binary.LittleEndian.Uint64(data[0:8]))
-	virtualTokenReserves := big.NewInt(0).SetUint64(binary.LittleEndian.Uint64(data[8:16]))
-	virtualSolReserves := big.NewInt(0).SetUint64(binary.LittleEndian.Uint64(data[16:24]))
+// decodeBondingCurve decodes a bonding curve account, which starts with its 8 byte anchor discriminator
+func decodeBondingCurve(data []byte) (*BondingCurveData, error) {
+	var curve pump.BondingCurve
+	if err := curve.UnmarshalWithDecoder(bin.NewBorshDecoder(data)); err != nil {
+		return nil, fmt.Errorf("FBCD: failed to decode bonding curve: %w", err)
+	}
 
 	return &BondingCurveData{
-		RealTokenReserves:    realTokenReserves,
-		VirtualTokenReserves: virtualTokenReserves,
-		VirtualSolReserves:   virtualSolReserves,
+		RealTokenReserves:    new(big.Int).SetUint64(curve.RealTokenReserves),
+		VirtualTokenReserves: new(big.Int).SetUint64(curve.VirtualTokenReserves),
+		VirtualSolReserves:   new(big.Int).SetUint64(curve.VirtualSolReserves),
+		RealSolReserves:      new(big.Int).SetUint64(curve.RealSolReserves),
+		TokenTotalSupply:     new(big.Int).SetUint64(curve.TokenTotalSupply),
+		Complete:             curve.Complete,
 	}, nil
 }
 
 // calculateBuyQuote calculates how many tokens can be purchased given a specific amount of SOL, bonding curve data, and percentage.
+// integer math only, rounding down once at the end, so the quote never asks for more than the exact amount `solAmount` buys
 func calculateBuyQuote(solAmount uint64, bondingCurve *BondingCurveData, percentage float64) *big.Int {
-	// Convert solAmount to *big.Int
-	solAmountBig := big.NewInt(int64(solAmount))
+	// the percentage (e.g. 0.98) as the exact fraction its float64 holds: mantissa / 2^(53-exp)
+	frac, exp := math.Frexp(percentage)
+	mantissa := new(big.Int).SetUint64(uint64(frac * (1 << 53)))
+
+	// tokens = virtualTokens - invariant / (virtualSol + sol), which is virtualTokens * sol / (virtualSol + sol).
+	// the mantissa multiplies in before dividing, and flooring twice is flooring once, so only the result is rounded
+	solAmountBig := new(big.Int).SetUint64(solAmount)
 
-	// Clone bonding curve data to avoid mutations
-	virtualSolReserves := new(big.Int).Set(bondingCurve.VirtualSolReserves)
-	virtualTokenReserves := new(big.Int).Set(bondingCurve.VirtualTokenReserves)
+	tokens := new(big.Int).Mul(bondingCurve.VirtualTokenReserves, solAmountBig)
+	tokens.Mul(tokens, mantissa)
+	tokens.Quo(tokens, solAmountBig.Add(solAmountBig, bondingCurve.VirtualSolReserves))
 
-	// Compute the new virtual reserves
-	newVirtualSolReserves := new(big.Int).Add(virtualSolReserves, solAmountBig)
-	invariant := new(big.Int).Mul(virtualSolReserves, virtualTokenReserves)
-	newVirtualTokenReserves := new(big.Int).Div(invariant, newVirtualSolReserves)
+	// only percentages of 2^53 and up are scaled up rather than down
+	shift := 53 - exp
+	if shift < 0 {
+		return tokens.Lsh(tokens, uint(-shift))
+	}
+
+	return tokens.Rsh(tokens, uint(shift))
+}
+
+// calculateSellQuote calculates how many lamports selling `tokenAmount` tokens into the bonding curve
+// returns, after pump takes its fee of `feeBasisPoints`. integer math rounding down like the pump program,
+// so the quote can be used as a min sol output
+func calculateSellQuote(tokenAmount uint64, bondingCurve *BondingCurveData, feeBasisPoints uint64) *big.Int {
+	tokenAmountBig := new(big.Int).SetUint64(tokenAmount)
+
+	// sol out = virtualSol * tokens / (virtualTokens + tokens)
+	solOut := new(big.Int).Mul(bondingCurve.VirtualSolReserves, tokenAmountBig)
+	solOut.Div(solOut, new(big.Int).Add(bondingCurve.VirtualTokenReserves, tokenAmountBig))
 
-	// Calculate the tokens to buy
-	tokensToBuy := new(big.Int).Sub(virtualTokenReserves, newVirtualTokenReserves)
+	fee := new(big.Int).Mul(solOut, new(big.Int).SetUint64(feeBasisPoints))
+	fee.Div(fee, big.NewInt(10_000))
+
+	return solOut.Sub(solOut, fee)
+}
+
+// calculateBuyCost is the inverse of calculateBuyQuote, calculating how many lamports it costs
+// to buy `tokenAmount` tokens. The cost is divided by percentage (e.g. 0.98) so the result can be
+// used as a max sol cost that still fills if the price moves against us
+func calculateBuyCost(tokenAmount uint64, bondingCurve *BondingCurveData, percentage float64) (*big.Int, error) {
+	tokenAmountBig := new(big.Int).SetUint64(tokenAmount)
+	if tokenAmountBig.Cmp(bondingCurve.RealTokenReserves) >= 0 || tokenAmountBig.Cmp(bondingCurve.VirtualTokenReserves) >= 0 {
+		return nil, errNotEnoughTokens
+	}
 
-	// Apply the percentage reduction (e.g., 95% or 0.95)
-	// Convert the percentage to a multiplier (0.95) and apply to tokensToBuy
-	percentageMultiplier := big.NewFloat(percentage)
-	tokensToBuyFloat := new(big.Float).SetInt(tokensToBuy)
-	finalTokens := new(big.Float).Mul(tokensToBuyFloat, percentageMultiplier)
+	// sol cost = virtualSol * tokens / (virtualTokens - tokens), rounded up like the pump program does
+	newVirtualTokenReserves := new(big.Int).Sub(bondingCurve.VirtualTokenReserves, tokenAmountBig)
+	solCost := new(big.Int).Mul(bondingCurve.VirtualSolReserves, tokenAmountBig)
+	solCost.Div(solCost, newVirtualTokenReserves)
+	solCost.Add(solCost, big.NewInt(1))
 
-	// Convert the result back to *big.Int
-	finalTokensBig, _ := finalTokens.Int(nil)
+	solCostFloat := new(big.Float).SetInt(solCost)
+	maxSolCost, _ := new(big.Float).Quo(solCostFloat, big.NewFloat(percentage)).Int(nil)
 
-	return finalTokensBig
+	return maxSolCost, nil
 }
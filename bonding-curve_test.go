@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// bondingCurveAccount encodes `curve` as a getAccountInfo result
+func bondingCurveAccount(t *testing.T, curve *BondingCurveData) map[string]interface{} {
+	var buf bytes.Buffer
+	err := pump.BondingCurve{
+		VirtualTokenReserves: curve.VirtualTokenReserves.Uint64(),
+		VirtualSolReserves:   curve.VirtualSolReserves.Uint64(),
+		RealTokenReserves:    curve.RealTokenReserves.Uint64(),
+		RealSolReserves:      curve.RealSolReserves.Uint64(),
+		TokenTotalSupply:     curve.TokenTotalSupply.Uint64(),
+		Complete:             curve.Complete,
+	}.MarshalWithEncoder(bin.NewBorshEncoder(&buf))
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": 1},
+		"value": map[string]interface{}{
+			"lamports":   1,
+			"owner":      pumpProgramID.String(),
+			"data":       []string{base64.StdEncoding.EncodeToString(data), "base64"},
+			"executable": false,
+			"rentEpoch":  0,
+		},
+	}
+}
+
+func TestFetchBondingCurveRetriesMissingAccount(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+	bondingCurve := solana.NewWallet().PublicKey()
+
+	// account only becomes visible on the third call
+	var calls int
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		calls++
+		if calls < 3 {
+			return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": nil}, nil
+		}
+		return bondingCurveAccount(t, curve), nil
+	})
+
+	b := &Bot{rpcClient: mock.client(), bondingCurveRetries: 3}
+	fetched, err := b.fetchBondingCurve(bondingCurve)
+	require.NoError(t, err)
+	require.Equal(t, curve.VirtualSolReserves, fetched.VirtualSolReserves)
+	require.Len(t, mock.callsTo("getAccountInfo"), 3)
+
+	// out of retries
+	calls = 0
+	b.bondingCurveRetries = 1
+	_, err = b.fetchBondingCurve(bondingCurve)
+	require.ErrorIs(t, err, errBondingCurveNotFound)
+	require.Contains(t, err.Error(), "after 2 attempts")
+
+	// a fallback RPC which already sees the account saves the retries
+	calls = 0
+	fallback := newMockRPC(t)
+	fallback.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curve), nil
+	})
+	b.bondingCurveFallbackClient = fallback.client()
+	before := len(mock.callsTo("getAccountInfo"))
+	fetched, err = b.fetchBondingCurve(bondingCurve)
+	require.NoError(t, err)
+	require.Equal(t, curve.VirtualSolReserves, fetched.VirtualSolReserves)
+	require.Len(t, mock.callsTo("getAccountInfo"), before+1)
+	require.Len(t, fallback.callsTo("getAccountInfo"), 1)
+
+	// rpc errors aren't retried
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return nil, errors.New("node is behind")
+	})
+	before = len(mock.callsTo("getAccountInfo"))
+	_, err = b.fetchBondingCurve(bondingCurve)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errBondingCurveNotFound)
+	require.Len(t, mock.callsTo("getAccountInfo"), before+1)
+}
+
+func TestFetchFreshBondingCurveRefetchesStaleReads(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	// the first node we hit lags 20 slots behind, the next one is caught up
+	var slots []int
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		account := bondingCurveAccount(t, curve)
+		account["context"] = map[string]interface{}{"slot": slots[0]}
+		slots = slots[1:]
+		return account, nil
+	})
+
+	// the jito manager is at slot 100
+	b := &Bot{rpcClient: mock.client(), jitoManager: newTestJitoManager(t, true, solana.NewWallet().PublicKey()), maxCurveSlotLag: 10}
+
+	staleBefore := staleCurveReads.value.Load()
+	slots = []int{80, 98}
+	fetched, err := b.fetchFreshBondingCurve(solana.NewWallet().PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, uint64(98), fetched.Slot)
+	require.Len(t, mock.callsTo("getAccountInfo"), 2)
+	require.Equal(t, staleBefore+1, staleCurveReads.value.Load())
+
+	// still stale after the refetch
+	slots = []int{80, 85}
+	_, err = b.fetchFreshBondingCurve(solana.NewWallet().PublicKey())
+	require.ErrorIs(t, err, errStaleBondingCurve)
+	require.Equal(t, staleBefore+3, staleCurveReads.value.Load())
+
+	// disabled, any read goes
+	b.maxCurveSlotLag = 0
+	slots = []int{80}
+	fetched, err = b.fetchFreshBondingCurve(solana.NewWallet().PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, uint64(80), fetched.Slot)
+}
+
+func TestDecodeBondingCurve(t *testing.T) {
+	// account data of a brand new mainnet curve, before the creator's buy
+	data, err := base64.StdEncoding.DecodeString("F7f4N2DYrGAAENhH488DAACsI/wGAAAAAHjF+1HRAgAAAAAAAAAAAACAxqR+jQMAAA==")
+	require.NoError(t, err)
+
+	curve, err := decodeBondingCurve(data)
+	require.NoError(t, err)
+	require.Equal(t, new(big.Int).SetUint64(initialVirtualTokenReserves), curve.VirtualTokenReserves)
+	require.Equal(t, new(big.Int).SetUint64(initialVirtualSolReserves), curve.VirtualSolReserves)
+	require.Equal(t, new(big.Int).SetUint64(initialRealTokenReserves), curve.RealTokenReserves)
+	require.Equal(t, big.NewInt(0), curve.RealSolReserves)
+	require.Equal(t, new(big.Int).SetUint64(tokenTotalSupply), curve.TokenTotalSupply)
+	require.False(t, curve.Complete)
+
+	// the discriminator isn't mistaken for a reserve
+	_, err = calculateBuyCost(initialRealTokenReserves, curve, 0.98)
+	require.ErrorIs(t, err, errNotEnoughTokens)
+
+	// anything but a bonding curve is rejected
+	_, err = decodeBondingCurve(make([]byte, len(data)))
+	require.Error(t, err)
+
+	_, err = decodeBondingCurve(data[:24])
+	require.Error(t, err)
+}
+
+func TestFetchBondingCurveRoundTrip(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+	curve.Complete = true
+	curve.MigrationThreshold = defaultMigrationThreshold
+	curve.Slot = 1 // bondingCurveAccount's context slot
+
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curve), nil
+	})
+
+	b := &Bot{rpcClient: mock.client()}
+	fetched, err := b.fetchBondingCurve(solana.NewWallet().PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, curve, fetched)
+}
+
+func TestMigrationThreshold(t *testing.T) {
+	// pump's launch reserves complete a curve at ~85 SOL raised
+	require.InDelta(t, 85.005, float64(defaultMigrationThreshold)/float64(solana.LAMPORTS_PER_SOL), 0.001)
+
+	// follows the Global account once fetched
+	b := &Bot{}
+	require.Equal(t, defaultMigrationThreshold, b.currentMigrationThreshold())
+
+	b.globalParams.Store(&pump.Global{InitialVirtualTokenReserves: 1_000, InitialVirtualSolReserves: 100, InitialRealTokenReserves: 500})
+	require.Equal(t, uint64(100), b.currentMigrationThreshold())
+}
+
+func TestBondingCurveProgress(t *testing.T) {
+	require.Zero(t, curveAfterCreatorBuy(0).Progress())
+
+	half := &BondingCurveData{RealSolReserves: new(big.Int).SetUint64(defaultMigrationThreshold / 2)}
+	require.InDelta(t, 50, half.Progress(), 0.01)
+
+	// a curve's own threshold wins over the default
+	half.MigrationThreshold = defaultMigrationThreshold / 4
+	require.Equal(t, 100.0, half.Progress())
+
+	require.Equal(t, 100.0, (&BondingCurveData{Complete: true}).Progress())
+}
+
+func TestCurveAfterTrade(t *testing.T) {
+	creatorTokens := uint64(30_000_000_000000)
+	launch := curveAfterCreatorBuy(creatorTokens)
+
+	b := &Bot{}
+	curve := b.curveAfterTrade(&TradeEvent{
+		VirtualSolReserves:   launch.VirtualSolReserves.Uint64(),
+		VirtualTokenReserves: launch.VirtualTokenReserves.Uint64(),
+	})
+
+	// the real reserves are recovered from the virtual ones a trade logs
+	require.Equal(t, launch.RealTokenReserves, curve.RealTokenReserves)
+	require.Equal(t, launch.RealSolReserves, curve.RealSolReserves)
+	require.False(t, curve.Complete)
+
+	// every real token sold
+	finalVirtualTokens := initialVirtualTokenReserves - initialRealTokenReserves
+	curve = b.curveAfterTrade(&TradeEvent{
+		VirtualSolReserves:   initialVirtualSolReserves + defaultMigrationThreshold,
+		VirtualTokenReserves: finalVirtualTokens,
+	})
+	require.True(t, curve.Complete)
+	require.Equal(t, 100.0, curve.Progress())
+}
+
+func TestCalculateSellQuoteVectors(t *testing.T) {
+	// the creator's 1 SOL buy in the create fixture, which the rug fixture sells in full
+	create, _ := decodeTxFixture(t, "create-tx.json")
+	creatorTokens := uint64(34_612_903_225_806)
+	require.Equal(t, "34612903225806", create.Meta.PostTokenBalances[0].UiTokenAmount.Amount)
+
+	curve := curveAfterCreatorBuy(creatorTokens)
+
+	// selling the tokens straight back returns the 1 SOL paid, less rounding & pump's 1% fee
+	require.Equal(t, big.NewInt(999_999_999), calculateSellQuote(creatorTokens, curve, 0))
+	require.Equal(t, big.NewInt(990_000_000), calculateSellQuote(creatorTokens, curve, defaultFeeBasisPoints))
+
+	require.Zero(t, calculateSellQuote(0, curve, defaultFeeBasisPoints).Sign())
+
+	// quoting doesn't move the curve
+	require.Equal(t, curveAfterCreatorBuy(creatorTokens), curve)
+}
+
+func TestSpotPrice(t *testing.T) {
+	launch := &BondingCurveData{
+		VirtualSolReserves:   new(big.Int).SetUint64(initialVirtualSolReserves),
+		VirtualTokenReserves: new(big.Int).SetUint64(initialVirtualTokenReserves),
+	}
+	require.Equal(t, big.NewRat(30_000, 1_073), launch.SpotPrice())
+
+	// a 1 SOL creator buy moves the price ~7%
+	price, _ := curveAfterCreatorBuy(34_612_903_225_806).SpotPrice().Float64()
+	require.InDelta(t, 29.854, price, 0.001)
+
+	require.Zero(t, (&BondingCurveData{}).SpotPrice().Sign())
+}
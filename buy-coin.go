@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"strings"
 	"time"
@@ -13,13 +12,37 @@ import (
 	"github.com/gagliardetto/solana-go"
 	associatedtokenaccount "github.com/gagliardetto/solana-go/programs/associated-token-account"
 	cb "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/rpc"
 )
 
 var (
 	// compute units never seem to get close to exceeding 70,000 so no need to set higher
-	computeUnitLimits uint32 = 70000
-	errNilCoin               = errors.New("Nil Coin")
-	errLateToCoin            = errors.New("Coin has multiple buyers (BCD)")
+	computeUnitLimits         uint32 = 70000
+	errNilCoin                       = errors.New("Nil Coin")
+	errLateToCoin                    = errors.New("Coin has multiple buyers (BCD)")
+	errBuyCostAboveMax               = errors.New("Token buy cost exceeds max SOL")
+	errATANotCreated                 = errors.New("ATA missing after create transaction")
+	errTooFewSlotsSinceCreate        = errors.New("Too few slots since coin was created")
+	errShadowBuy                     = errors.New("Shadow buy, not sent")
+	errCreatorSoldDuringBuy          = errors.New("Creator sold before the buy was sent")
+	errBelowReserve                  = errors.New("Buy would dip the wallet below its reserve SOL")
+)
+
+// buySlippage is the share of the quote we must get at least (buying by SOL), or the quote's cost is divided
+// by (buying by tokens): 2% max slippage, so we ensure we enter in position as second buyer
+const buySlippage = 0.98
+
+// how many slots (of ~400ms) longer than the remaining `minSlotsBeforeBuy` we wait on the current slot
+// before giving up on the buy, in case slot tracking stalled
+const minSlotsWaitGrace = 2
+
+// tokenAccountRentLamports is the rent-exempt minimum of an SPL token account (165 bytes), paid creating our ATA
+const tokenAccountRentLamports = 2_039_280
+
+// buy modes, see `Bot.buyMode`
+const (
+	buyModeSolAmount   = "solAmount"
+	buyModeTokenAmount = "tokenAmount"
 )
 
 // BuyCoin handles the code for purchasing a single coin, updating program
@@ -38,6 +61,14 @@ func (b *Bot) BuyCoin(coin *Coin) error {
 	buyStatus := fmt.Sprintf("Attempting to buy %s (%v)", coin.mintAddr.String(), time.Since(coin.pickupTime))
 	b.status(buyStatus)
 
+	// listenCreatorSell is already running, a creator sell from here until we send aborts the buy
+	buyCtx, releaseBuy := b.cancellableBuy(coin)
+	defer releaseBuy()
+
+	mempoolCtx, stopMempool := context.WithCancel(context.Background())
+	defer stopMempool()
+	competingBuy := b.startMempoolMonitor(mempoolCtx, coin)
+
 	ataAddress, err := b.calculateATAAddress(coin)
 	if err != nil {
 		return err
@@ -53,78 +84,371 @@ func (b *Bot) BuyCoin(coin *Coin) error {
 		}
 	}
 
-	coin.status("Fetching bonding curve")
-	bcd, err := b.fetchBondingCurve(coin.tokenBondingCurve)
-	if err != nil {
+	// a shadow buy sends nothing, the ATA is planned into the buy instead
+	if shouldCreateATA && b.separateATATx && !b.shadowBuy {
+		if err := b.createATAAndVerify(coin, ataAddress); err != nil {
+			return err
+		}
+		shouldCreateATA = false
+	}
+
+	if err := b.waitForMinSlots(coin); err != nil {
+		return err
+	}
+
+	if err := context.Cause(buyCtx); err != nil {
 		return err
 	}
 
+	// a curve kept current from the coin's trades saves the fetch
+	bcd := b.localCurve(coin)
+	if bcd == nil {
+		coin.status("Fetching bonding curve")
+		bcd, err = b.fetchFreshBondingCurve(coin.tokenBondingCurve)
+		if err != nil {
+			return err
+		}
+	}
+
 	// protect us from stale data, bad buy price
 	// by checking if someone else has already purchased through BCD
 	coin.status(fmt.Sprintf("Fetched bonding curve, (%s)", bcd.String()))
-	if coin.lateToBuy(bcd) {
-		return errLateToCoin
+	if bcd.Complete {
+		return errBondingCurveComplete
 	}
 
-	// determine num tokens to buy based on sol buy amount,
-	// set very low slippage tolerance (2% max slippage) so we ensure we
-	// enter in position as second buyer
-	coin.buyPrice = b.buyAmountLamport
-	tokensToBuy := calculateBuyQuote(b.buyAmountLamport, bcd, 0.98)
-	buyInstruction := b.createBuyInstruction(tokensToBuy, coin, *ataAddress)
-
-	// create priority fee instructions
-	culInst := cb.NewSetComputeUnitLimitInstruction(uint32(computeUnitLimits))
-	cupInst := cb.NewSetComputeUnitPriceInstruction(b.feeMicroLamport)
+	if b.maxBuyCurveProgress > 0 && bcd.Progress() >= b.maxBuyCurveProgress {
+		return errCurveTooFarAlong
+	}
 
-	if shouldCreateATA {
-		_, createAtaInstruction, err := b.createATA(coin)
-		if err != nil {
-			return err
-		}
-		instructions = []solana.Instruction{cupInst.Build(), culInst.Build(), createAtaInstruction, buyInstruction.Build()}
-	} else {
-		instructions = []solana.Instruction{cupInst.Build(), culInst.Build(), buyInstruction.Build()}
+	if externalSol, late := b.lateToBuy(coin, bcd); late {
+		return fmt.Errorf("%w: %.4f SOL bought in after the creator", errLateToCoin, externalSol)
 	}
 
-	enableJito := b.jitoManager.isJitoLeader()
-	if enableJito {
-		coin.status("Jito leader, setting tip & removing priority fee inst")
-		tipInst, err := b.jitoManager.generateTipInstruction()
-		if err != nil {
-			log.Fatal(err)
-		}
+	tokensToBuy, maxSolCost, err := b.buyQuote(bcd)
+	if err != nil {
+		return err
+	}
 
-		instructions = append(instructions, tipInst)
+	coin.buyPrice = maxSolCost
+	buyInstruction := b.createBuyInstruction(tokensToBuy, maxSolCost, coin, *ataAddress)
 
-		// IMPORTANT: remove priority fee when we jito tip
-		instructions = instructions[1:]
+	instructions, err = b.buyInstructions(buyInstruction, coin, shouldCreateATA)
+	if err != nil {
+		return err
 	}
 
+	vanillaInstructions := instructions
+	instructions, enableJito := b.addJitoTip(coin, instructions, b.tipOnBuy)
+
 	coin.status("Creating transaction")
 	tx, err := b.createTransaction(instructions...)
 	if err != nil {
 		return err
 	}
 
+	// keeps the priority fee the jito tx dropped for its tip
+	fallbackTx, err := b.createJitoFallbackTx(enableJito, vanillaInstructions)
+	if err != nil {
+		return err
+	}
+
+	if b.shadowBuy {
+		b.logShadowBuy(coin, tx, enableJito, tokensToBuy, bcd, shouldCreateATA)
+		return errShadowBuy
+	}
+
+	release, err := b.checkWalletReserve(coin, tx, enableJito, fallbackTx, shouldCreateATA)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// someone else is already buying, we would no longer be the second buyer
+	if competingBuyPending(competingBuy) {
+		return errCompetingBuy
+	}
+
+	// once sent, the buy is seen through & a creator sell is left to the coin's exits, since
+	// abandoning its confirmation could leave us holding tokens we don't track
+	if err := context.Cause(buyCtx); err != nil {
+		return err
+	}
+
 	coin.status("Sending transaction")
-	if _, err = b.signAndSendTx(tx, enableJito); err != nil {
+	b.logEvent(coin, eventBuySent, sendRoute(enableJito))
+	sentAt := time.Now()
+	buySig, err := b.signAndSendTxWithFallback(context.TODO(), tx, enableJito, fallbackTx)
+	if err != nil {
 		if !strings.Contains(err.Error(), "transaction has already been processed") {
 			return err
 		}
+
+		buySig = &tx.Signatures[0]
 	}
 
 	// notify chans we have purchased & set amount of owned tokens
 	coin.botPurchased = true
 	coin.tokensHeld = tokensToBuy
 	coin.associatedTokenAccount = *ataAddress
-	coin.buyTransactionSignature = &tx.Signatures[0]
+	coin.buyTransactionSignature = buySig
+	coin.buySolUSD = b.solUSD()
+	b.logEvent(coin, eventBuyConfirmed, buySig.String())
+	coin.status(fmt.Sprintf("Bought %s tokens for up to %s", tokensToBuy.String(), formatSol(int64(coin.buyPrice), coin.buySolUSD)))
+
+	// sells are armed from here on, the position only counts as open once the buy is final enough
+	coin.positionSettled = make(chan struct{})
+	go b.openPosition(coin, *buySig)
+
+	var detectToSend time.Duration
+	if !coin.pickupTime.IsZero() {
+		detectToSend = sentAt.Sub(coin.pickupTime)
+	}
+	go b.recordTradeLeg(coin, tradeSideBuy, *buySig, detectToSend, time.Since(sentAt))
+	go b.checkPeerBots(coin, *buySig)
+
+	return nil
+}
+
+// openPosition marks our position in the coin open for accounting once the buy reaches
+// `buyAccountingCommitment`. at confirmed (the commitment we send at) that's right away
+func (b *Bot) openPosition(coin *Coin, buySig solana.Signature) {
+	defer close(coin.positionSettled)
+
+	commitment := b.buyAccountingCommitment
+	if commitment != "" && commitment != rpc.CommitmentConfirmed {
+		if err := b.waitForCommitment(coin.context(), buySig, commitment); err != nil {
+			b.statusr(fmt.Sprintf("Buy %s of %s never reached %s: %s", buySig.String(), coin.mintAddr.String(), commitment, err))
+			return
+		}
+	} else {
+		commitment = rpc.CommitmentConfirmed
+	}
+
+	b.pendingCoinsLock.Lock()
+	coin.positionOpen = true
+	b.pendingCoinsLock.Unlock()
+
+	positionsOpened.Inc()
+	coin.status(fmt.Sprintf("Position open (buy %s)", commitment))
+}
+
+// isPositionOpen reports whether openPosition has counted our buy of the coin
+func (b *Bot) isPositionOpen(coin *Coin) bool {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	return coin.positionOpen
+}
+
+// positionCounts waits for openPosition to settle the coin's position, reporting whether it opened. the legs,
+// round trip & daily loss of a buy which never reached `buyAccountingCommitment` aren't accounted at all
+func (b *Bot) positionCounts(coin *Coin) bool {
+	if coin.positionSettled != nil {
+		<-coin.positionSettled
+	}
+
+	return b.isPositionOpen(coin)
+}
+
+// logShadowBuy logs the buy `tx` we would have sent for `tokens` of the coin in `shadowBuy` mode: what it pays
+// for them at most, the slippage, route, tip & fees
+func (b *Bot) logShadowBuy(coin *Coin, tx *solana.Transaction, jito bool, tokens *big.Int, bcd *BondingCurveData, createATA bool) {
+	tip, priorityFee, baseFee := b.buyTxFees(tx, jito)
+
+	coin.status(fmt.Sprintf("Shadow buy: %s tokens for up to %d lamports (%.0f%% slippage, curve %.1f%% filled), route %s, tip %d, priority fee %d, base fee %d, create ATA %t, total up to %s",
+		tokens.String(), coin.buyPrice, 100*(1-buySlippage), bcd.Progress(), sendRoute(jito), tip, priorityFee, baseFee, createATA,
+		formatSol(int64(coin.buyPrice+tip+priorityFee+baseFee), b.solUSD())))
+}
+
+// buyTxFees is what a buy tx costs us on top of the buy itself, most we spend on the curve
+func (b *Bot) buyTxFees(tx *solana.Transaction, jito bool) (tip, priorityFee, baseFee uint64) {
+	// jito txs drop the priority fee for the tip
+	if !jito {
+		priorityFee = b.feeMicroLamport * uint64(computeUnitLimits) / 1_000_000
+	}
+
+	baseFee = lamportsPerSignature * uint64(tx.Message.Header.NumRequiredSignatures)
+	tip = jitoTipLamports(tx, b.privateKey.PublicKey())
+	return tip, priorityFee, baseFee
+}
+
+// checkWalletReserve holds the most the buy can cost (of `tx`, or of `fallback` if jito rejects it, with the rent of
+// our ATA if we create it) against our cached `walletBalance`, failing with errBelowReserve if that would leave less
+// than `reserveLamports`. the returned release is called once the buy's send returned
+func (b *Bot) checkWalletReserve(coin *Coin, tx *solana.Transaction, jito bool, fallback *solana.Transaction, createATA bool) (func(), error) {
+	if b.reserveLamports == 0 {
+		return func() {}, nil
+	}
+
+	cost := func(tx *solana.Transaction, jito bool) uint64 {
+		tip, priorityFee, baseFee := b.buyTxFees(tx, jito)
+		total := coin.buyPrice + tip + priorityFee + baseFee
+		if createATA {
+			total += tokenAccountRentLamports
+		}
+		return total
+	}
+
+	maxCost := cost(tx, jito)
+	if fallback != nil {
+		maxCost = max(maxCost, cost(fallback, false))
+	}
+
+	release, ok := b.walletBalance.hold(maxCost, b.reserveLamports)
+	if !ok {
+		available := b.walletBalance.available(b.reserveLamports)
+		return nil, fmt.Errorf("%w: costs up to %s, %s available above the %s reserve & pending buys", errBelowReserve,
+			formatSol(int64(maxCost), b.solUSD()), formatSol(int64(available), b.solUSD()), formatSol(int64(b.reserveLamports), b.solUSD()))
+	}
+
+	return release, nil
+}
+
+// slotsSinceCreate is how many slots passed between the coin's create and `current`, false if either is unknown
+func (c *Coin) slotsSinceCreate(current uint64) (uint64, bool) {
+	if c.createSlot == 0 || current == 0 {
+		return 0, false
+	}
+
+	if current <= c.createSlot {
+		return 0, true
+	}
+
+	return current - c.createSlot, true
+}
+
+// waitForMinSlots holds the buy until `minSlotsBeforeBuy` slots passed since the coin's create. coins whose
+// create slot we don't know, or while we don't know the current slot, aren't held
+func (b *Bot) waitForMinSlots(coin *Coin) error {
+	if b.minSlotsBeforeBuy == 0 {
+		return nil
+	}
+
+	var deadline time.Time
+	for {
+		passed, known := coin.slotsSinceCreate(b.currentSlot())
+		if !known || passed >= b.minSlotsBeforeBuy {
+			return nil
+		}
+
+		if deadline.IsZero() {
+			coin.status(fmt.Sprintf("Waiting until %d slots since create (%d passed)", b.minSlotsBeforeBuy, passed))
+			remaining := b.minSlotsBeforeBuy - passed + minSlotsWaitGrace
+			deadline = time.Now().Add(time.Duration(remaining) * slotPollInterval)
+		} else if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %d of %d slots", errTooFewSlotsSinceCreate, passed, b.minSlotsBeforeBuy)
+		}
+
+		time.Sleep(slotPollInterval / 4)
+	}
+}
+
+// buyQuote determines how many tokens to buy and the max lamports we pay for them, within `buySlippage`
+func (b *Bot) buyQuote(bcd *BondingCurveData) (*big.Int, uint64, error) {
+	if b.buyMode != buyModeTokenAmount {
+		buyLamports := b.buyLamports()
+		return calculateBuyQuote(buyLamports, bcd, buySlippage), buyLamports, nil
+	}
+
+	maxSolCost, err := calculateBuyCost(b.buyTokenAmount, bcd, buySlippage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !maxSolCost.IsUint64() || maxSolCost.Uint64() > b.maxBuyLamport {
+		return nil, 0, errBuyCostAboveMax
+	}
+
+	return new(big.Int).SetUint64(b.buyTokenAmount), maxSolCost.Uint64(), nil
+}
+
+// buyInstructions returns the priority fee & buy instructions for a coin,
+// creating our ATA in the same tx if `includeATA` is set
+func (b *Bot) buyInstructions(buyInstruction *pump.Buy, coin *Coin, includeATA bool) ([]solana.Instruction, error) {
+	// create priority fee instructions
+	culInst := cb.NewSetComputeUnitLimitInstruction(uint32(computeUnitLimits))
+	cupInst := cb.NewSetComputeUnitPriceInstruction(b.feeMicroLamport)
+
+	if !includeATA {
+		return []solana.Instruction{cupInst.Build(), culInst.Build(), buyInstruction.Build()}, nil
+	}
+
+	_, createAtaInstruction, err := b.createATA(coin)
+	if err != nil {
+		return nil, err
+	}
+
+	return []solana.Instruction{cupInst.Build(), culInst.Build(), createAtaInstruction, buyInstruction.Build()}, nil
+}
+
+// createATATransaction builds a standalone transaction creating our ATA for the coin
+func (b *Bot) createATATransaction(coin *Coin) (*solana.Transaction, error) {
+	_, createAtaInstruction, err := b.createATA(coin)
+	if err != nil {
+		return nil, err
+	}
+
+	cupInst := cb.NewSetComputeUnitPriceInstruction(b.feeMicroLamport)
+	return b.createTransaction(cupInst.Build(), createAtaInstruction)
+}
+
+// createATAAndVerify sends the ATA create in its own transaction and waits for it to confirm,
+// then waits `ataConfirmDelay` and checks the ATA actually exists before we buy into it.
+// slower than bundling it with the buy, but avoids launches where create ATA + buy in one tx fails
+func (b *Bot) createATAAndVerify(coin *Coin, ataAddress *solana.PublicKey) error {
+	coin.status("Creating associated token account in separate transaction")
+
+	tx, err := b.createATATransaction(coin)
+	if err != nil {
+		return err
+	}
+
+	if _, err = b.signAndSendTx(context.TODO(), tx, false); err != nil {
+		if !strings.Contains(err.Error(), "transaction has already been processed") {
+			return err
+		}
+	}
+
+	time.Sleep(b.ataConfirmDelay)
+
+	shouldCreateATA, err := b.shouldCreateATA(ataAddress)
+	if err != nil {
+		return err
+	}
+
+	if shouldCreateATA {
+		return errATANotCreated
+	}
 
 	return nil
 }
 
+// cancellableBuy returns the context of a buy of the coin, cancelled with errCreatorSoldDuringBuy as soon as the
+// creator is seen selling (or right away if they already have), and the func to call once the buy is done with it
+func (b *Bot) cancellableBuy(coin *Coin) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	b.pendingCoinsLock.Lock()
+	if coin.creatorSold {
+		cancel(errCreatorSoldDuringBuy)
+	} else {
+		coin.cancelBuy = cancel
+	}
+	b.pendingCoinsLock.Unlock()
+
+	return ctx, func() {
+		b.pendingCoinsLock.Lock()
+		coin.cancelBuy = nil
+		b.pendingCoinsLock.Unlock()
+
+		cancel(nil)
+	}
+}
+
 func (c *Coin) setExitedBuyCoinTrue() {
 	c.exitedBuyCoin = true
+	c.signalSellCheck()
 }
 
 // calculateATAAddress calculates the associated token account address for the bot's public key and the coin's mint address.
@@ -175,12 +499,12 @@ func (b *Bot) createATA(coin *Coin) (solana.PublicKey, *associatedtokenaccount.I
 	return ata, createATAInstruction, nil
 }
 
-func (b *Bot) createBuyInstruction(tokensToBuy *big.Int, coin *Coin, ata solana.PublicKey) *pump.Buy {
+func (b *Bot) createBuyInstruction(tokensToBuy *big.Int, maxSolCost uint64, coin *Coin, ata solana.PublicKey) *pump.Buy {
 	return pump.NewBuyInstruction(
 		tokensToBuy.Uint64(),
-		b.buyAmountLamport,
+		maxSolCost,
 		globalAddr,
-		feeRecipient,
+		b.currentFeeRecipient(),
 		coin.mintAddr,
 		coin.tokenBondingCurve,
 		coin.associatedBondingCurve,
@@ -194,11 +518,47 @@ func (b *Bot) createBuyInstruction(tokensToBuy *big.Int, coin *Coin, ata solana.
 	)
 }
 
+// pumpAccount is the account pump expects at a given position of an instruction
+type pumpAccount struct {
+	name     string
+	key      solana.PublicKey
+	writable bool
+	signer   bool
+}
+
+// pumpBuyLayout is the account list of pump's buy instruction, in order
+func pumpBuyLayout(coin *Coin, ata, user, feeRecipient solana.PublicKey) []pumpAccount {
+	return []pumpAccount{
+		{name: "global", key: globalAddr},
+		{name: "feeRecipient", key: feeRecipient, writable: true},
+		{name: "mint", key: coin.mintAddr},
+		{name: "bondingCurve", key: coin.tokenBondingCurve, writable: true},
+		{name: "associatedBondingCurve", key: coin.associatedBondingCurve, writable: true},
+		{name: "associatedUser", key: ata, writable: true},
+		{name: "user", key: user, writable: true, signer: true},
+		{name: "systemProgram", key: solana.SystemProgramID},
+		{name: "tokenProgram", key: solana.TokenProgramID},
+		{name: "rent", key: rent},
+		{name: "eventAuthority", key: coin.eventAuthority},
+		{name: "program", key: pumpProgramID},
+	}
+}
+
 func (b *Bot) createTransaction(instructions ...solana.Instruction) (*solana.Transaction, error) {
+	// a tx built on an expiring blockhash could never land
+	b.refreshExpiringBlockhash()
+
+	opts := []solana.TransactionOption{solana.TransactionPayer(b.privateKey.PublicKey())}
+
+	// with a lookup table loaded, the static pump accounts are looked up instead of encoded inline (v0 tx)
+	if len(b.addressTables) > 0 {
+		opts = append(opts, solana.TransactionAddressTables(b.addressTables))
+	}
+
 	// Prepare the transaction with both the associated token account creation and the buy instructions
 	return solana.NewTransaction(
 		instructions,
-		*b.blockhash,
-		solana.TransactionPayer(b.privateKey.PublicKey()),
+		*b.blockhash.Load(),
+		opts...,
 	)
 }
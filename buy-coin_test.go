@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	jito_go "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateBuyCostInvertsBuyQuote(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	for _, tokens := range []uint64{1_000000, 5_000_000_000000, 50_000_000_000000} {
+		cost, err := calculateBuyCost(tokens, curve, 1)
+		require.NoError(t, err)
+
+		// spending the cost must get us at least the tokens we asked for, one lamport less must not
+		require.GreaterOrEqual(t, calculateBuyQuote(cost.Uint64(), curve, 1).Uint64(), tokens)
+		require.Less(t, calculateBuyQuote(cost.Uint64()-1, curve, 1).Uint64(), tokens)
+	}
+
+	// slippage raises the max we are willing to pay
+	exact, err := calculateBuyCost(5_000_000_000000, curve, 1)
+	require.NoError(t, err)
+
+	withSlippage, err := calculateBuyCost(5_000_000_000000, curve, 0.98)
+	require.NoError(t, err)
+	require.Equal(t, 1, withSlippage.Cmp(exact))
+
+	_, err = calculateBuyCost(initialRealTokenReserves, curve, 0.98)
+	require.ErrorIs(t, err, errNotEnoughTokens)
+}
+
+func TestBuyQuoteTokenMode(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	b := &Bot{
+		buyMode:        buyModeTokenAmount,
+		buyTokenAmount: 5_000_000_000000,
+		maxBuyLamport:  1_000_000_000,
+	}
+
+	tokens, maxSolCost, err := b.buyQuote(curve)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(5_000_000_000000), tokens)
+	require.LessOrEqual(t, maxSolCost, b.maxBuyLamport)
+
+	// same target, but the cap is below what the tokens cost
+	b.maxBuyLamport = maxSolCost - 1
+	_, _, err = b.buyQuote(curve)
+	require.ErrorIs(t, err, errBuyCostAboveMax)
+
+	// sol mode ignores the cap and spends buyAmountLamport
+	b.buyMode = buyModeSolAmount
+	b.buyAmountLamport = 50_000_000
+	tokens, maxSolCost, err = b.buyQuote(curve)
+	require.NoError(t, err)
+	require.Equal(t, uint64(50_000_000), maxSolCost)
+	require.Equal(t, calculateBuyQuote(50_000_000, curve, 0.98), tokens)
+}
+
+func TestSeparateATATransactions(t *testing.T) {
+	fixture := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:               fixture.mint,
+		tokenBondingCurve:      fixture.bondingCurve,
+		associatedBondingCurve: fixture.associatedBondingCurve,
+		eventAuthority:         fixture.eventAuthority,
+	}
+
+	b := &Bot{
+		privateKey:      solana.NewWallet().PrivateKey,
+		feeMicroLamport: 200000,
+		separateATATx:   true,
+	}
+	b.blockhash.Store(&solana.Hash{})
+
+	ata, err := b.calculateATAAddress(coin)
+	require.NoError(t, err)
+
+	programIDs := func(tx *solana.Transaction) []solana.PublicKey {
+		var ids []solana.PublicKey
+		for _, inst := range tx.Message.Instructions {
+			id, err := tx.ResolveProgramIDIndex(inst.ProgramIDIndex)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	ataTx, err := b.createATATransaction(coin)
+	require.NoError(t, err)
+	require.Equal(t, []solana.PublicKey{solana.ComputeBudget, solana.SPLAssociatedTokenAccountProgramID}, programIDs(ataTx))
+
+	buyInsts, err := b.buyInstructions(b.createBuyInstruction(big.NewInt(1000), 50_000_000, coin, *ata), coin, false)
+	require.NoError(t, err)
+
+	buyTx, err := b.createTransaction(buyInsts...)
+	require.NoError(t, err)
+	require.Equal(t, []solana.PublicKey{solana.ComputeBudget, solana.ComputeBudget, pumpProgramID}, programIDs(buyTx))
+
+	// bundled path still creates the ATA alongside the buy
+	bundledInsts, err := b.buyInstructions(b.createBuyInstruction(big.NewInt(1000), 50_000_000, coin, *ata), coin, true)
+	require.NoError(t, err)
+	require.Len(t, bundledInsts, 4)
+	require.Equal(t, solana.SPLAssociatedTokenAccountProgramID, bundledInsts[2].ProgramID())
+}
+
+func TestCalculateBuyQuote(t *testing.T) {
+	// 1 SOL into a fresh curve: 1073e12 - (30 * 1073e12 / 31) = 34_612_903_225806.45, rounded down
+	require.Equal(t, big.NewInt(34_612_903_225806), calculateBuyQuote(1_000_000_000, curveAfterCreatorBuy(0), 1))
+
+	// slippage only shrinks what we ask for
+	require.Equal(t, big.NewInt(33_920_645_161290), calculateBuyQuote(1_000_000_000, curveAfterCreatorBuy(0), 0.98))
+
+	// buying after the recorded creator buy gets us fewer tokens for the same SOL
+	coin := fixtureCoin(t)
+	afterCreator := calculateBuyQuote(1_000_000_000, curveAfterCreatorBuy(coin.creatorTokenBalance), 1)
+	require.Equal(t, -1, afterCreator.Cmp(big.NewInt(34_612_903_225806)))
+}
+
+func TestCalculateBuyQuoteNeverExceedsExact(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for range 10_000 {
+		curve := curveAfterCreatorBuy(rng.Uint64N(700_000_000_000000))
+		solAmount := 1 + rng.Uint64N(10*solana.LAMPORTS_PER_SOL)
+		percentage := 0.5 + rng.Float64()/2
+
+		// virtualTokens * sol / (virtualSol + sol) * percentage, without rounding
+		exact := new(big.Rat).SetFrac(
+			new(big.Int).Mul(curve.VirtualTokenReserves, new(big.Int).SetUint64(solAmount)),
+			new(big.Int).Add(curve.VirtualSolReserves, new(big.Int).SetUint64(solAmount)),
+		)
+		exact.Mul(exact, new(big.Rat).SetFloat64(percentage))
+
+		quote := new(big.Rat).SetInt(calculateBuyQuote(solAmount, curve, percentage))
+		require.LessOrEqual(t, quote.Cmp(exact), 0, "quote of %d lamports at %v overshoots", solAmount, percentage)
+
+		// within a raw unit, let alone a whole token
+		shortfall := new(big.Rat).Sub(exact, quote)
+		require.Equal(t, -1, shortfall.Cmp(big.NewRat(1, 1)), "quote of %d lamports at %v is %s short", solAmount, percentage, shortfall.FloatString(6))
+	}
+}
+
+func BenchmarkCalculateBuyQuote(b *testing.B) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	b.ReportAllocs()
+	for range b.N {
+		calculateBuyQuote(50_000_000, curve, 0.98)
+	}
+}
+
+func TestOpenPositionWaitsForAccountingCommitment(t *testing.T) {
+	finalize := make(chan struct{})
+	commitments := make(chan string, 1)
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		var opts struct {
+			Commitment string `json:"commitment"`
+		}
+		require.NoError(t, json.Unmarshal(params[1], &opts))
+		commitments <- opts.Commitment
+
+		<-finalize
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), positionSettled: make(chan struct{})}
+	b := &Bot{wsPool: newWsPoolFromClients(wsMock.client(t)), buyAccountingCommitment: rpc.CommitmentFinalized}
+
+	done := make(chan struct{})
+	go func() {
+		b.openPosition(coin, solana.Signature{1})
+		close(done)
+	}()
+
+	require.Equal(t, string(rpc.CommitmentFinalized), <-commitments)
+	require.Never(t, func() bool { return b.isPositionOpen(coin) }, 200*time.Millisecond, 20*time.Millisecond)
+
+	close(finalize)
+	<-done
+	require.True(t, b.positionCounts(coin))
+
+	// at confirmed, the buy confirming already opened the position
+	confirmedCoin := &Coin{mintAddr: solana.NewWallet().PublicKey(), positionSettled: make(chan struct{})}
+	b.buyAccountingCommitment = rpc.CommitmentConfirmed
+	b.openPosition(confirmedCoin, solana.Signature{2})
+	require.True(t, b.isPositionOpen(confirmedCoin))
+	require.Empty(t, commitments)
+}
+
+func TestWaitForMinSlots(t *testing.T) {
+	coin := &Coin{createSlot: 98}
+
+	passed, known := coin.slotsSinceCreate(100)
+	require.True(t, known)
+	require.EqualValues(t, 2, passed)
+
+	// a lagging current slot counts as none passed, an unknown slot isn't counted at all
+	passed, known = coin.slotsSinceCreate(97)
+	require.True(t, known)
+	require.Zero(t, passed)
+
+	_, known = coin.slotsSinceCreate(0)
+	require.False(t, known)
+	_, known = (&Coin{}).slotsSinceCreate(100)
+	require.False(t, known)
+
+	// the jito manager is at slot 100, the buy waits until the slot reaches 101
+	jitoManager := newTestJitoManager(t, false, solana.NewWallet().PublicKey())
+	b := &Bot{jitoManager: jitoManager, minSlotsBeforeBuy: 3}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		jitoManager.lock.Lock()
+		jitoManager.currentSlot = 101
+		jitoManager.lock.Unlock()
+	}()
+
+	start := time.Now()
+	require.NoError(t, b.waitForMinSlots(coin))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// coins without a create slot aren't held
+	require.NoError(t, b.waitForMinSlots(&Coin{}))
+
+	// the buy is given up once the slot stops advancing
+	b.minSlotsBeforeBuy = 4
+	err := b.waitForMinSlots(coin)
+	require.ErrorIs(t, err, errTooFewSlotsSinceCreate)
+}
+
+func TestShadowBuyLogsPlanWithoutSending(t *testing.T) {
+	coin := fixtureCoin(t)
+
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curveAfterCreatorBuy(coin.creatorTokenBalance)), nil
+	})
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		t.Error("shadow buy sent a transaction")
+		return nil, nil
+	})
+
+	b := newBaseBot()
+	b.rpcClient = mock.client()
+	b.privateKey = solana.NewWallet().PrivateKey
+	b.jitoManager = newTestJitoManager(t, true, jito_go.MainnetTipAccounts[0])
+	b.jitoManager.privateKey = b.privateKey
+	b.blockhash.Store(&solana.Hash{})
+	b.skipATALookup = true
+	b.separateATATx = true
+	b.shadowBuy = true
+	b.buyAmountLamport = 50_000_000
+
+	buf := captureLogs(t)
+	require.ErrorIs(t, b.BuyCoin(coin), errShadowBuy)
+
+	tokens := calculateBuyQuote(50_000_000, curveAfterCreatorBuy(coin.creatorTokenBalance), buySlippage)
+	logged := buf.String()
+	require.Contains(t, logged, "Shadow buy: "+tokens.String()+" tokens for up to 50000000 lamports (2% slippage")
+	require.Contains(t, logged, "route jito, tip 2000000, priority fee 0, base fee 5000, create ATA true")
+	require.Contains(t, logged, "total up to 0.05201 SOL")
+
+	require.Zero(t, mock.callsTo("sendTransaction"))
+	require.False(t, coin.botPurchased)
+}
+
+func TestCreatorSellDuringBuyAbortsSend(t *testing.T) {
+	coin := fixtureCoin(t)
+
+	b := newBaseBot()
+	b.store = newMemoryStore()
+
+	// the creator dumps while we fetch the curve, after the buy started
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		b.setCreatorSold(coin)
+		return bondingCurveAccount(t, curveAfterCreatorBuy(coin.creatorTokenBalance)), nil
+	})
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		t.Error("buy was sent after the creator sold")
+		return nil, nil
+	})
+
+	b.rpcClient = mock.client()
+	b.privateKey = solana.NewWallet().PrivateKey
+	b.jitoManager = newTestJitoManager(t, true, jito_go.MainnetTipAccounts[0])
+	b.jitoManager.privateKey = b.privateKey
+	b.blockhash.Store(&solana.Hash{})
+	b.skipATALookup = true
+	b.buyAmountLamport = 50_000_000
+	b.addNewPendingCoin(coin)
+
+	require.ErrorIs(t, b.BuyCoin(coin), errCreatorSoldDuringBuy)
+	require.Zero(t, mock.callsTo("sendTransaction"))
+	require.False(t, coin.botPurchased)
+	require.Nil(t, coin.cancelBuy)
+
+	// a creator who sold before the buy started aborts it as well
+	require.ErrorIs(t, b.BuyCoin(coin), errCreatorSoldDuringBuy)
+}
+
+func TestBuyBelowReserveRejected(t *testing.T) {
+	coin := fixtureCoin(t)
+
+	// 0.06 SOL covers the 0.05 SOL buy, its tip & ATA rent, not those and the 0.01 SOL reserve
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curveAfterCreatorBuy(coin.creatorTokenBalance)), nil
+	})
+	mock.handle("getBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": 60_000_000}, nil
+	})
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		t.Error("buy dipping below the reserve was sent")
+		return nil, nil
+	})
+
+	b := newBaseBot()
+	b.rpcClient = mock.client()
+	b.privateKey = solana.NewWallet().PrivateKey
+	b.jitoManager = newTestJitoManager(t, true, jito_go.MainnetTipAccounts[0])
+	b.jitoManager.privateKey = b.privateKey
+	b.blockhash.Store(&solana.Hash{})
+	b.skipATALookup = true
+	b.buyAmountLamport = 50_000_000
+	b.reserveLamports = 10_000_000
+	require.NoError(t, b.refreshWalletBalance())
+
+	// checked against the cached balance, never fetching it mid-buy
+	require.ErrorIs(t, b.BuyCoin(coin), errBelowReserve)
+	require.Zero(t, mock.callsTo("sendTransaction"))
+	require.Len(t, mock.callsTo("getBalance"), 1)
+	require.False(t, coin.botPurchased)
+
+	// the same balance affords the buy with a smaller reserve
+	tx, err := b.createTransaction(solana.NewInstruction(solana.SystemProgramID, nil, nil))
+	require.NoError(t, err)
+	b.reserveLamports = 1_000_000
+	release, err := b.checkWalletReserve(coin, tx, false, nil, true)
+	require.NoError(t, err)
+	release()
+}
+
+func TestWalletBalanceHoldsPendingBuys(t *testing.T) {
+	w := &walletBalance{}
+	w.update(100, time.Now())
+
+	release, ok := w.hold(60, 10)
+	require.True(t, ok)
+	require.EqualValues(t, 30, w.available(10))
+
+	// a second buy can't spend what the first may still take
+	_, ok = w.hold(60, 10)
+	require.False(t, ok)
+
+	// the first buy's spend stays held until a balance fetched after its send returned
+	fetchedAt := time.Now()
+	release()
+	w.update(100, fetchedAt)
+	require.EqualValues(t, 30, w.available(10))
+
+	w.update(40, time.Now())
+	require.EqualValues(t, 30, w.available(10))
+
+	_, ok = w.hold(30, 10)
+	require.True(t, ok)
+}
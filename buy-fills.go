@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// buyFill is a buy which landed on chain: the curve right before it, the SOL it paid into the curve and the
+// tokens it got, from the TradeEvent pump logged for it. testdata/buy-fills.json holds the ones calculateBuyQuote
+// is checked against, regenerated with `--record-buy-fills`
+type buyFill struct {
+	Signature            string `json:"signature"`
+	VirtualSolReserves   uint64 `json:"virtual_sol_reserves"`   // before the buy
+	VirtualTokenReserves uint64 `json:"virtual_token_reserves"` // before the buy
+	SolIn                uint64 `json:"sol_in"`                 // lamports into the curve, pump's fee excluded
+	TokensOut            uint64 `json:"tokens_out"`
+}
+
+// curve is the bonding curve the fill bought from, as far as quoting goes
+func (f *buyFill) curve() *BondingCurveData {
+	return &BondingCurveData{
+		VirtualSolReserves:   new(big.Int).SetUint64(f.VirtualSolReserves),
+		VirtualTokenReserves: new(big.Int).SetUint64(f.VirtualTokenReserves),
+	}
+}
+
+// sellFill is a sell which landed on chain: the curve right before it, the tokens it sold and the SOL the curve
+// paid out for them, from the TradeEvent pump logged for it. testdata/sell-fills.json holds the ones
+// calculateSellQuote is checked against, recorded along with the buys
+type sellFill struct {
+	Signature            string `json:"signature"`
+	VirtualSolReserves   uint64 `json:"virtual_sol_reserves"`   // before the sell
+	VirtualTokenReserves uint64 `json:"virtual_token_reserves"` // before the sell
+	TokensIn             uint64 `json:"tokens_in"`
+	SolOut               uint64 `json:"sol_out"` // lamports out of the curve, before pump's fee
+}
+
+// curve is the bonding curve the fill sold into, as far as quoting goes
+func (f *sellFill) curve() *BondingCurveData {
+	return &BondingCurveData{
+		VirtualSolReserves:   new(big.Int).SetUint64(f.VirtualSolReserves),
+		VirtualTokenReserves: new(big.Int).SetUint64(f.VirtualTokenReserves),
+	}
+}
+
+// buyFillsFromLogs turns the buys pump logged in tx `sig` into fills, undoing each buy on the reserves
+// the TradeEvent reports after it to get the curve before
+func buyFillsFromLogs(sig solana.Signature, logs []string) []buyFill {
+	var fills []buyFill
+
+	for _, trade := range parseTradeEvents(logs) {
+		if !trade.IsBuy || trade.VirtualSolReserves < trade.SolAmount {
+			continue
+		}
+
+		fills = append(fills, buyFill{
+			Signature:            sig.String(),
+			VirtualSolReserves:   trade.VirtualSolReserves - trade.SolAmount,
+			VirtualTokenReserves: trade.VirtualTokenReserves + trade.TokenAmount,
+			SolIn:                trade.SolAmount,
+			TokensOut:            trade.TokenAmount,
+		})
+	}
+
+	return fills
+}
+
+// sellFillsFromLogs turns the sells pump logged in tx `sig` into fills, undoing each sell on the reserves
+// the TradeEvent reports after it to get the curve before
+func sellFillsFromLogs(sig solana.Signature, logs []string) []sellFill {
+	var fills []sellFill
+
+	for _, trade := range parseTradeEvents(logs) {
+		if trade.IsBuy || trade.VirtualTokenReserves < trade.TokenAmount {
+			continue
+		}
+
+		fills = append(fills, sellFill{
+			Signature:            sig.String(),
+			VirtualSolReserves:   trade.VirtualSolReserves + trade.SolAmount,
+			VirtualTokenReserves: trade.VirtualTokenReserves - trade.TokenAmount,
+			TokensIn:             trade.TokenAmount,
+			SolOut:               trade.SolAmount,
+		})
+	}
+
+	return fills
+}
+
+// recordFills fetches the txs of `sigs`, collecting the fills of every buy & sell in them
+func (b *Bot) recordFills(ctx context.Context, sigs []solana.Signature) ([]buyFill, []sellFill, error) {
+	buys := []buyFill{}
+	sells := []sellFill{}
+
+	for _, sig := range sigs {
+		tx, err := b.getTransaction(ctx, sig, rpc.CommitmentConfirmed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch %s: %w", sig, err)
+		}
+
+		if tx.Meta == nil || tx.Meta.Err != nil {
+			b.statusy(fmt.Sprintf("Skipping %s, it failed or has no meta", sig))
+			continue
+		}
+
+		foundBuys := buyFillsFromLogs(sig, tx.Meta.LogMessages)
+		foundSells := sellFillsFromLogs(sig, tx.Meta.LogMessages)
+		if len(foundBuys) == 0 && len(foundSells) == 0 {
+			b.statusy(fmt.Sprintf("Skipping %s, pump logged no trade in it", sig))
+		}
+
+		buys = append(buys, foundBuys...)
+		sells = append(sells, foundSells...)
+	}
+
+	return buys, sells, nil
+}
+
+// writeFills writes recorded `fills` to `outPath` as indented JSON
+func writeFills(fills interface{}, outPath string) error {
+	data, err := json.MarshalIndent(fills, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(outPath, append(data, '\n'), 0644)
+}
+
+// startBuyFillRecording records the buys & sells of the signatures listed (one per line) in `sigsPath` through
+// `rpcEndpoint`, writing them to `buysPath` and `sellsPath` for the quote tests
+func startBuyFillRecording(rpcEndpoint, sigsPath, buysPath, sellsPath string) error {
+	file, err := os.Open(sigsPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var sigs []solana.Signature
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sig, err := solana.SignatureFromBase58(line)
+		if err != nil {
+			return fmt.Errorf("bad signature %q: %w", line, err)
+		}
+
+		sigs = append(sigs, sig)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b := &Bot{rpcClient: rpc.New(rpcEndpoint)}
+	buys, sells, err := b.recordFills(context.Background(), sigs)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFills(buys, buysPath); err != nil {
+		return err
+	}
+
+	if err := writeFills(sells, sellsPath); err != nil {
+		return err
+	}
+
+	b.status(fmt.Sprintf("Recorded %d buys to %s and %d sells to %s from %d txs", len(buys), buysPath, len(sells), sellsPath, len(sigs)))
+	return nil
+}
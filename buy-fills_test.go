@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateBuyQuoteMatchesRecordedFills(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "buy-fills.json"))
+	require.NoError(t, err)
+
+	var fills []buyFill
+	require.NoError(t, json.Unmarshal(data, &fills))
+	if len(fills) == 0 {
+		// testdata/buy-fills.json ships empty, it needs buys recorded from mainnet
+		t.Skip("no recorded buys in testdata/buy-fills.json, run with --record-buy-fills to record some")
+	}
+
+	// quoting the SOL a buy paid must give exactly the tokens it got, or we'd need slack to land
+	for _, fill := range fills {
+		t.Run(fill.Signature, func(t *testing.T) {
+			require.Equal(t, fill.TokensOut, calculateBuyQuote(fill.SolIn, fill.curve(), 1).Uint64())
+		})
+	}
+}
+
+func TestBuyFillsFromLogs(t *testing.T) {
+	sig := solana.Signature{1}
+	mint := solana.NewWallet().PublicKey()
+
+	// the creator buys into a fresh curve, then someone sells
+	buy := &TradeEvent{
+		Mint:                 mint,
+		User:                 solana.NewWallet().PublicKey(),
+		SolAmount:            1_000_000_000,
+		TokenAmount:          34_612_903_225806,
+		IsBuy:                true,
+		VirtualSolReserves:   31_000_000_000,
+		VirtualTokenReserves: 1_038_387_096_774194,
+	}
+	sell := &TradeEvent{Mint: mint, User: solana.NewWallet().PublicKey(), SolAmount: 1, TokenAmount: 1, VirtualSolReserves: 1, VirtualTokenReserves: 1}
+
+	fills := buyFillsFromLogs(sig, pumpLogs(tradeEventLog(buy), tradeEventLog(sell)))
+	require.Equal(t, []buyFill{{
+		Signature:            sig.String(),
+		VirtualSolReserves:   30_000_000_000,
+		VirtualTokenReserves: 1_073_000_000_000000,
+		SolIn:                1_000_000_000,
+		TokensOut:            34_612_903_225806,
+	}}, fills)
+
+	// the fill quotes back to what it got
+	require.Equal(t, fills[0].TokensOut, calculateBuyQuote(fills[0].SolIn, fills[0].curve(), 1).Uint64())
+}
+
+func TestCalculateSellQuoteMatchesRecordedFills(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sell-fills.json"))
+	require.NoError(t, err)
+
+	var fills []sellFill
+	require.NoError(t, json.Unmarshal(data, &fills))
+	if len(fills) == 0 {
+		// testdata/sell-fills.json ships empty, it needs sells recorded from mainnet
+		t.Skip("no recorded sells in testdata/sell-fills.json, run with --record-buy-fills to record some")
+	}
+
+	// quoting the tokens a sell paid in must give exactly the SOL the curve paid out, fee aside
+	for _, fill := range fills {
+		t.Run(fill.Signature, func(t *testing.T) {
+			require.Equal(t, fill.SolOut, calculateSellQuote(fill.TokensIn, fill.curve(), 0).Uint64())
+		})
+	}
+}
+
+func TestSellFillsFromLogs(t *testing.T) {
+	sig := solana.Signature{1}
+	mint := solana.NewWallet().PublicKey()
+
+	// the creator sells their 1 SOL buy straight back, after someone else bought
+	buy := &TradeEvent{Mint: mint, User: solana.NewWallet().PublicKey(), SolAmount: 1, TokenAmount: 1, IsBuy: true, VirtualSolReserves: 1, VirtualTokenReserves: 1}
+	sell := &TradeEvent{
+		Mint:                 mint,
+		User:                 solana.NewWallet().PublicKey(),
+		SolAmount:            999_999_999,
+		TokenAmount:          34_612_903_225806,
+		VirtualSolReserves:   30_000_000_001,
+		VirtualTokenReserves: 1_073_000_000_000000,
+	}
+
+	fills := sellFillsFromLogs(sig, pumpLogs(tradeEventLog(buy), tradeEventLog(sell)))
+	require.Equal(t, []sellFill{{
+		Signature:            sig.String(),
+		VirtualSolReserves:   31_000_000_000,
+		VirtualTokenReserves: 1_038_387_096_774194,
+		TokensIn:             34_612_903_225806,
+		SolOut:               999_999_999,
+	}}, fills)
+
+	// the fill quotes back to what it got
+	require.Equal(t, fills[0].SolOut, calculateSellQuote(fills[0].TokensIn, fills[0].curve(), 0).Uint64())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// minCoordinatedBuyers is how many same-block buyers sharing a funder with the creator flag a launch
+	minCoordinatedBuyers = 2
+
+	// most same-block buyers whose funders we look up per launch, a crowded block can't flood the RPC
+	maxCoordinatedBuyersChecked = 5
+)
+
+// detectMultiWalletCoordinatedBuy looks for wallets buying in the same block as the create which share
+// a funder with the creator (or were funded by the creator), a way rug creators fake independent demand.
+// sets coin.coordinatedLaunch if `minCoordinatedBuyers` or more such buyers are found
+func (b *Bot) detectMultiWalletCoordinatedBuy(coin *Coin, createSlot uint64, createSig solana.Signature) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, curveTransResps, err := b.fetchTransUntil(ctx, b.coordinatedBuyLookbackSigs, coin.tokenBondingCurve.String(), solana.Signature{})
+	if err != nil {
+		return err
+	}
+
+	var sameBlockTxs []*solana.Transaction
+	for _, resp := range curveTransResps {
+		var transResult *rpc.GetTransactionResult = &rpc.GetTransactionResult{}
+		if err := resp.GetObject(&transResult); err != nil {
+			continue
+		}
+
+		if transResult == nil || transResult.Transaction == nil || transResult.Slot != createSlot {
+			continue
+		}
+
+		tx, err := transResult.Transaction.GetTransaction()
+		if err != nil || len(tx.Signatures) == 0 || tx.Signatures[0].Equals(createSig) {
+			continue
+		}
+
+		sameBlockTxs = append(sameBlockTxs, tx)
+	}
+
+	buyers := findBuyers(sameBlockTxs, coin)
+	if len(buyers) < minCoordinatedBuyers {
+		return nil
+	}
+	buyers = buyers[:min(len(buyers), maxCoordinatedBuyersChecked)]
+
+	creator := coin.creator.String()
+	creatorFunders, err := b.fetchFundersBounded(ctx, creator)
+	if err != nil {
+		return err
+	}
+
+	// funders the creator is linked to, including the creator funding buyers directly
+	linkedFunders := map[string]bool{creator: true}
+	for _, funder := range creatorFunders {
+		linkedFunders[funder] = true
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var linkedBuyers int
+
+	for _, buyer := range buyers {
+		wg.Add(1)
+		go func(buyer string) {
+			defer wg.Done()
+
+			buyerFunders, err := b.fetchFundersBounded(ctx, buyer)
+			if err != nil {
+				return
+			}
+
+			for _, funder := range buyerFunders {
+				if linkedFunders[funder] {
+					lock.Lock()
+					linkedBuyers++
+					lock.Unlock()
+					return
+				}
+			}
+		}(buyer)
+	}
+
+	wg.Wait()
+
+	if linkedBuyers >= minCoordinatedBuyers {
+		coin.coordinatedLaunch = true
+		coin.status(fmt.Sprintf("%d same-block buyers share a funder with the creator", linkedBuyers))
+	}
+
+	return nil
+}
+
+// fetchFundersBounded is fetchCreatorFunders of `address`, holding a funder check slot (see acquireFunderCheck)
+// so our lookups share the limit on funder checks running at once
+func (b *Bot) fetchFundersBounded(ctx context.Context, address string) ([]string, error) {
+	release := b.acquireFunderCheck()
+	defer release()
+
+	return b.fetchCreatorFunders(address, ctx)
+}
+
+// findBuyers returns the unique wallets, other than the creator, buying the coin in `txs`
+func findBuyers(txs []*solana.Transaction, coin *Coin) []string {
+	var buyers []string
+	seen := make(map[string]bool)
+
+	for _, tx := range txs {
+		for _, inst := range decodeInstructions(tx) {
+			if inst.pumpName() != "buy" {
+				continue
+			}
+
+			buy, ok := inst.pump.Impl.(*pump.Buy)
+			if !ok {
+				continue
+			}
+
+			mint, user := buy.GetMintAccount(), buy.GetUserAccount()
+			if mint == nil || user == nil || !mint.PublicKey.Equals(coin.mintAddr) || user.PublicKey.Equals(coin.creator) {
+				continue
+			}
+
+			buyer := user.PublicKey.String()
+			if !seen[buyer] {
+				seen[buyer] = true
+				buyers = append(buyers, buyer)
+			}
+		}
+	}
+
+	return buyers
+}
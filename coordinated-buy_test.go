@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/stretchr/testify/require"
+)
+
+// chainHistory serves getSignaturesForAddress & getTransaction from a fixed set of txs, indexed by
+// the accounts each tx touches. txs are stored newest first per address
+type chainHistory struct {
+	byAddress map[string][]solana.Signature
+	txs       map[string]map[string]interface{}
+	slots     map[string]uint64
+}
+
+func newChainHistory() *chainHistory {
+	return &chainHistory{
+		byAddress: make(map[string][]solana.Signature),
+		txs:       make(map[string]map[string]interface{}),
+		slots:     make(map[string]uint64),
+	}
+}
+
+func (h *chainHistory) add(t *testing.T, slot uint64, tx *solana.Transaction) {
+	sig, err := solana.NewWallet().PrivateKey.Sign([]byte{byte(len(h.txs))})
+	require.NoError(t, err)
+	tx.Signatures = []solana.Signature{sig}
+
+	result := txResult(t, tx)
+	result["slot"] = slot
+	h.txs[sig.String()] = result
+	h.slots[sig.String()] = slot
+
+	for _, key := range tx.Message.AccountKeys {
+		h.byAddress[key.String()] = append([]solana.Signature{sig}, h.byAddress[key.String()]...)
+	}
+}
+
+func (h *chainHistory) mockRPC(t *testing.T) *mockRPC {
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		var address string
+		require.NoError(t, json.Unmarshal(params[0], &address))
+
+		result := []map[string]interface{}{}
+		for _, sig := range h.byAddress[address] {
+			result = append(result, map[string]interface{}{"signature": sig.String(), "slot": h.slots[sig.String()]})
+		}
+
+		return result, nil
+	})
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var sig string
+		require.NoError(t, json.Unmarshal(params[0], &sig))
+
+		return h.txs[sig], nil
+	})
+
+	return mock
+}
+
+func buyerInst(f *launchFixture, buyer solana.PublicKey) solana.Instruction {
+	buyerATA, _, _ := solana.FindAssociatedTokenAddress(buyer, f.mint)
+
+	return pump.NewBuyInstruction(1000, 1e9, globalAddr, feeRecipient, f.mint, f.bondingCurve, f.associatedBondingCurve,
+		buyerATA, buyer, solana.SystemProgramID, solana.TokenProgramID, rent, f.eventAuthority, pumpProgramID).Build()
+}
+
+func TestDetectMultiWalletCoordinatedBuy(t *testing.T) {
+	tests := []struct {
+		name        string
+		linked      int // same-block buyers funded by the creator's funder
+		independent int // same-block buyers with their own funders
+		coordinated bool
+	}{
+		{name: "two linked buyers", linked: 2, coordinated: true},
+		{name: "one linked buyer", linked: 1, independent: 2},
+		{name: "independent buyers", independent: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLaunchFixture(t)
+			funder := solana.NewWallet().PublicKey()
+			history := newChainHistory()
+
+			history.add(t, 50, newTestTx(t, funder, system.NewTransferInstruction(2e9, funder, f.creator).Build()))
+
+			create := newTestTx(t, f.creator, f.createInst(), f.buyInst(1000, 1e9))
+			history.add(t, 100, create)
+
+			fundAndBuy := func(buyerFunder solana.PublicKey, slot uint64) {
+				buyer := solana.NewWallet().PublicKey()
+				history.add(t, 60, newTestTx(t, buyerFunder, system.NewTransferInstruction(1e9, buyerFunder, buyer).Build()))
+				history.add(t, slot, newTestTx(t, buyer, buyerInst(f, buyer)))
+			}
+
+			for i := 0; i < tt.linked; i++ {
+				fundAndBuy(funder, 100)
+			}
+
+			for i := 0; i < tt.independent; i++ {
+				fundAndBuy(solana.NewWallet().PublicKey(), 100)
+			}
+
+			// linked buyers outside the create's block don't count
+			fundAndBuy(funder, 101)
+
+			mock := history.mockRPC(t)
+			b := &Bot{
+				rpcClient:                  mock.client(),
+				jrpcClient:                 mock.jsonrpcClient(),
+				funderLookbackSigs:         30,
+				coordinatedBuyLookbackSigs: 20,
+			}
+
+			coin := &Coin{mintAddr: f.mint, creator: f.creator, tokenBondingCurve: f.bondingCurve, programID: pumpProgramID}
+			require.NoError(t, b.detectMultiWalletCoordinatedBuy(coin, 100, create.Signatures[0]))
+			require.Equal(t, tt.coordinated, coin.coordinatedLaunch)
+
+			if tt.coordinated {
+				require.False(t, b.shouldBuyCoin(coin))
+				require.Equal(t, "coordinated launch", coin.rejectReason)
+			}
+		})
+	}
+}
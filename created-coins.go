@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// most creates written to the coins table in a single insert
+	createdCoinBatchSize = 100
+
+	// creates queued for the coins table before new ones are dropped
+	createdCoinQueueSize = 1000
+)
+
+// CreatedCoin is a create we decoded, as stored in the coins table addressCreatedCoin queries
+type CreatedCoin struct {
+	Mint      string
+	Creator   string
+	Name      string
+	Symbol    string
+	Signature string // of the create tx, empty if we didn't see it
+	CreatedAt time.Time
+}
+
+// createdCoinRecorder writes every create we decode to the coins table, bought or not, so later launches
+// of the same creator are caught. creates are queued and inserted in batches, off the hot path
+type createdCoinRecorder struct {
+	store         Store
+	queue         chan *CreatedCoin
+	flushInterval time.Duration
+}
+
+func newCreatedCoinRecorder(store Store, flushInterval time.Duration) *createdCoinRecorder {
+	return &createdCoinRecorder{
+		store:         store,
+		queue:         make(chan *CreatedCoin, createdCoinQueueSize),
+		flushInterval: flushInterval,
+	}
+}
+
+// record queues `coin` for the next batch, dropping it rather than blocking if the queue is full
+func (r *createdCoinRecorder) record(coin *CreatedCoin) {
+	select {
+	case r.queue <- coin:
+	default:
+		createdCoinsDropped.Inc()
+	}
+}
+
+// run inserts the queued creates each `flushInterval`, or as soon as a full batch is queued,
+// until `ctx` is done
+func (r *createdCoinRecorder) run(ctx context.Context) {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*CreatedCoin, 0, createdCoinBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := r.store.RecordCoins(batch); err != nil {
+			logStatus(levelError, "coins", "", "Coins (R)", "Failed to record created coins: "+err.Error())
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case coin := <-r.queue:
+			batch = append(batch, coin)
+			if len(batch) >= createdCoinBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// recordCreatedCoin queues the coin's create for the coins table, if we record creates
+func (b *Bot) recordCreatedCoin(coin *Coin) {
+	if b.createdCoins == nil {
+		return
+	}
+
+	created := &CreatedCoin{
+		Mint:      coin.mintAddr.String(),
+		Creator:   coin.creator.String(),
+		Name:      coin.name,
+		Symbol:    coin.symbol,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if !coin.createSignature.IsZero() {
+		created.Signature = coin.createSignature.String()
+	}
+
+	b.createdCoins.record(created)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// batchStore records the size of every RecordCoins batch
+type batchStore struct {
+	*memoryStore
+
+	lock    sync.Mutex
+	batches []int
+}
+
+func (s *batchStore) RecordCoins(coins []*CreatedCoin) error {
+	s.lock.Lock()
+	s.batches = append(s.batches, len(coins))
+	s.lock.Unlock()
+
+	return s.memoryStore.RecordCoins(coins)
+}
+
+func (s *batchStore) batchSizes() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]int(nil), s.batches...)
+}
+
+func TestCreatedCoinRecorderBatches(t *testing.T) {
+	store := &batchStore{memoryStore: newMemoryStore()}
+	recorder := newCreatedCoinRecorder(store, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		recorder.run(ctx)
+		close(done)
+	}()
+
+	for i := range createdCoinBatchSize + 20 {
+		recorder.record(&CreatedCoin{Mint: fmt.Sprintf("mint-%d", i), Creator: "creator"})
+	}
+
+	// a redelivered create doesn't add a row
+	recorder.record(&CreatedCoin{Mint: "mint-0", Creator: "creator"})
+
+	// a full batch is written right away, the rest once the recorder stops
+	require.Eventually(t, func() bool { return len(store.batchSizes()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []int{createdCoinBatchSize}, store.batchSizes())
+
+	cancel()
+	<-done
+	require.Equal(t, []int{createdCoinBatchSize, 21}, store.batchSizes())
+	require.Len(t, store.createdCoins(), createdCoinBatchSize+20)
+}
+
+func TestRecordedCreatesCatchRepeatCreators(t *testing.T) {
+	store := newMemoryStore()
+	coin := fixtureCoin(t)
+	coin.createSignature = solana.Signature{1}
+
+	b := &Bot{store: store, createdCoins: newCreatedCoinRecorder(store, time.Millisecond)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.createdCoins.run(ctx)
+
+	b.recordCreatedCoin(coin)
+	require.Eventually(t, func() bool { return len(store.createdCoins()) == 1 }, time.Second, time.Millisecond)
+
+	created := store.createdCoins()[0]
+	require.Equal(t, coin.mintAddr.String(), created.Mint)
+	require.Equal(t, coin.creator.String(), created.Creator)
+	require.Equal(t, coin.name, created.Name)
+	require.Equal(t, coin.symbol, created.Symbol)
+	require.Equal(t, coin.createSignature.String(), created.Signature)
+
+	// the coin's own row doesn't count against its creator, their next launch does
+	require.False(t, b.addressCreatedCoin(coin.creator.String(), coin.mintAddr.String()))
+	require.True(t, b.addressCreatedCoin(coin.creator.String(), solana.NewWallet().PublicKey().String()))
+	require.False(t, b.addressCreatedCoin(solana.NewWallet().PublicKey().String(), ""))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CreatorStats is what we've learned about a creator from the coins of theirs we tracked
+type CreatorStats struct {
+	Launches    int // coins of theirs we tracked
+	Rugs        int // coins where we detected them selling / moving their tokens
+	Graduations int // coins which graduated to Raydium
+
+	MedianTimeToSell time.Duration // from launch to their sell
+	MedianDumpShare  float64       // share (0-1) of their peak holdings sold at once
+}
+
+// rugRate is the share of tracked launches the creator sold out of
+func (s *CreatorStats) rugRate() float64 {
+	// a sell can be recorded for a launch we didn't count (e.g. stats cleared mid-coin)
+	launches := max(s.Launches, s.Rugs)
+	if launches == 0 {
+		return 0
+	}
+
+	return float64(s.Rugs) / float64(launches)
+}
+
+// CreatorSell is a single creator sell we detected
+type CreatorSell struct {
+	Creator    string
+	Mint       string
+	TimeToSell time.Duration // since we picked up the launch
+	DumpShare  float64       // share (0-1) of their peak holdings gone at detection
+	Pumped     bool          // whether the curve held more SOL than at launch after their sell
+}
+
+// summarizeCreatorSells computes rug count & medians over all sells of one creator
+func summarizeCreatorSells(sells []*CreatorSell) *CreatorStats {
+	stats := &CreatorStats{Rugs: len(sells)}
+	if len(sells) == 0 {
+		return stats
+	}
+
+	timesToSell := make([]float64, len(sells))
+	dumpShares := make([]float64, len(sells))
+	for i, sell := range sells {
+		timesToSell[i] = float64(sell.TimeToSell)
+		dumpShares[i] = sell.DumpShare
+	}
+
+	stats.MedianTimeToSell = time.Duration(median(timesToSell))
+	stats.MedianDumpShare = median(dumpShares)
+	return stats
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return sorted[mid]
+}
+
+// newCreatorSell captures a creator sell of `coin` at detection time
+func newCreatorSell(coin *Coin) *CreatorSell {
+	sell := &CreatorSell{
+		Creator:    coin.creator.String(),
+		Mint:       coin.mintAddr.String(),
+		TimeToSell: time.Since(coin.pickupTime),
+		DumpShare:  1,
+	}
+
+	// a closed ATA / unknown balance is treated as a full dump
+	if coin.creatorBalanceKnown && coin.creatorPeakBalance > 0 && coin.creatorTokenBalance <= coin.creatorPeakBalance {
+		sell.DumpShare = float64(coin.creatorPeakBalance-coin.creatorTokenBalance) / float64(coin.creatorPeakBalance)
+	}
+
+	return sell
+}
+
+// recordCreatorLaunch counts a launch of the coin's creator. runs off the hot path
+func (b *Bot) recordCreatorLaunch(coin *Coin) {
+	if !b.recordCreatorStats {
+		return
+	}
+
+	if err := b.store.RecordCreatorLaunch(coin.creator.String()); err != nil {
+		b.statusr("Failed to record creator launch: " + err.Error())
+	}
+}
+
+// recordCreatorSell stores a creator sell, checking whether the coin had pumped first
+func (b *Bot) recordCreatorSell(coin *Coin, sell *CreatorSell) {
+	if !b.recordCreatorStats {
+		return
+	}
+
+	if bcd, err := b.fetchBondingCurve(coin.tokenBondingCurve); err == nil {
+		launchCurve := curveAfterCreatorBuy(coin.creatorPeakBalance)
+		sell.Pumped = bcd.VirtualSolReserves.Cmp(launchCurve.VirtualSolReserves) > 0
+	}
+
+	if err := b.store.RecordCreatorSell(sell); err != nil {
+		b.statusr("Failed to record creator sell: " + err.Error())
+	}
+}
+
+// recordCreatorGraduation counts a graduated coin of the coin's creator
+func (b *Bot) recordCreatorGraduation(coin *Coin) {
+	if !b.recordCreatorStats {
+		return
+	}
+
+	if err := b.store.RecordCreatorGraduation(coin.creator.String()); err != nil {
+		b.statusr("Failed to record creator graduation: " + err.Error())
+	}
+}
+
+// creatorStatsRejectReason checks a creator's history against our limits,
+// returning why we should pass on their coin (empty if we shouldn't)
+func (b *Bot) creatorStatsRejectReason(creator string) string {
+	stats, err := b.store.CreatorStats(creator)
+	if err != nil {
+		b.statusr("Error fetching creator stats: " + err.Error())
+		return "error fetching creator stats"
+	}
+
+	if stats == nil || stats.Rugs == 0 {
+		return ""
+	}
+
+	if b.creatorMaxRugRate > 0 && stats.rugRate() >= b.creatorMaxRugRate {
+		return fmt.Sprintf("creator rugged %d of %d launches", stats.Rugs, max(stats.Launches, stats.Rugs))
+	}
+
+	if stats.MedianTimeToSell < b.creatorMinMedianSellTime {
+		return fmt.Sprintf("creator sells fast (median %s)", stats.MedianTimeToSell.Round(time.Second))
+	}
+
+	return ""
+}
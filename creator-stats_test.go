@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeCreatorSells(t *testing.T) {
+	stats := summarizeCreatorSells([]*CreatorSell{
+		{TimeToSell: 10 * time.Second, DumpShare: 1},
+		{TimeToSell: 2 * time.Minute, DumpShare: 0.5},
+		{TimeToSell: 30 * time.Second, DumpShare: 0.2},
+		{TimeToSell: 20 * time.Second, DumpShare: 0.9},
+	})
+
+	require.Equal(t, 4, stats.Rugs)
+	require.Equal(t, 25*time.Second, stats.MedianTimeToSell)
+	require.InDelta(t, 0.7, stats.MedianDumpShare, 1e-9)
+
+	require.Zero(t, summarizeCreatorSells(nil).MedianTimeToSell)
+}
+
+func TestNewCreatorSellDumpShare(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:            f.mint,
+		creator:             f.creator,
+		pickupTime:          time.Now().Add(-time.Minute),
+		creatorBalanceKnown: true,
+		creatorPeakBalance:  1000,
+		creatorTokenBalance: 250,
+	}
+
+	sell := newCreatorSell(coin)
+	require.Equal(t, f.creator.String(), sell.Creator)
+	require.InDelta(t, 0.75, sell.DumpShare, 1e-9)
+	require.GreaterOrEqual(t, sell.TimeToSell, time.Minute)
+
+	// without a known balance, assume they dumped everything
+	coin.creatorBalanceKnown = false
+	require.Equal(t, 1.0, newCreatorSell(coin).DumpShare)
+}
+
+func TestCreatorStatsRejectReason(t *testing.T) {
+	store := newMemoryStore()
+	b := &Bot{store: store, creatorMaxRugRate: 0.5, creatorMinMedianSellTime: time.Minute}
+
+	// unknown creator
+	require.Empty(t, b.creatorStatsRejectReason("creator"))
+
+	// launched twice, never sold
+	store.RecordCreatorLaunch("creator")
+	store.RecordCreatorLaunch("creator")
+	require.Empty(t, b.creatorStatsRejectReason("creator"))
+
+	// one slow sell out of two launches
+	store.RecordCreatorSell(&CreatorSell{Creator: "creator", Mint: "mint-1", TimeToSell: 10 * time.Minute, DumpShare: 1})
+	require.Equal(t, "creator rugged 1 of 2 launches", b.creatorStatsRejectReason("creator"))
+
+	// under the rug rate, but sells fast
+	store.RecordCreatorLaunch("creator")
+	store.RecordCreatorLaunch("creator")
+	store.RecordCreatorLaunch("creator")
+	store.RecordCreatorSell(&CreatorSell{Creator: "creator", Mint: "mint-2", TimeToSell: 5 * time.Second, DumpShare: 1})
+	store.RecordCreatorSell(&CreatorSell{Creator: "creator", Mint: "mint-3", TimeToSell: 8 * time.Second, DumpShare: 1})
+	require.Equal(t, 0.6, mustCreatorStats(t, store, "creator").rugRate())
+	b.creatorMaxRugRate = 0.8
+	require.Equal(t, "creator sells fast (median 8s)", b.creatorStatsRejectReason("creator"))
+}
+
+func TestCreatorStatsRecordedOnSellAndGraduation(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, pickupTime: time.Now()}
+
+	store := newMemoryStore()
+	mock := newMockRPC(t)
+	b := &Bot{
+		store:              store,
+		rpcClient:          mock.client(),
+		recordCreatorStats: true,
+		pendingCoins:       map[string]*Coin{f.mint.String(): coin},
+	}
+
+	b.recordCreatorLaunch(coin)
+
+	// detections are recorded once, no matter how many listeners fire
+	b.setCreatorSold(coin)
+	b.setCreatorSoldReason(coin, exitReasonCreatorClosedATA)
+	b.setGraduated(coin)
+	b.setGraduated(coin)
+
+	require.Eventually(t, func() bool {
+		stats := mustCreatorStats(t, store, f.creator.String())
+		return stats.Rugs == 1 && stats.Graduations == 1
+	}, time.Second, 10*time.Millisecond)
+
+	stats := mustCreatorStats(t, store, f.creator.String())
+	require.Equal(t, 1, stats.Launches)
+	require.Equal(t, 1, stats.Rugs)
+	require.Equal(t, 1, stats.Graduations)
+}
+
+func mustCreatorStats(t *testing.T, store Store, creator string) *CreatorStats {
+	stats, err := store.CreatorStats(creator)
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+
+	return stats
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// most accounts getMultipleAccounts takes in one call
+const curvePollBatchSize = 100
+
+// JSON-RPC's "method not found" error code
+const rpcMethodNotFound = -32601
+
+// PollCurves runs as goroutine, fetching the bonding curve of every coin in pendingCoins each `curvePollInterval`
+// and passing it to the coin's curve monitors, in one getMultipleAccounts call rather than a call per coin
+func (b *Bot) PollCurves(ctx context.Context) {
+	ticker := time.NewTicker(b.curvePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.pollCurves(ctx); err != nil {
+			b.statusr("Failed to poll bonding curves: " + err.Error())
+		}
+	}
+}
+
+// pollCurves fetches the bonding curves of every pending coin and updates each coin with its own.
+// curves which no longer exist (migrated coins) or were read stale are skipped
+func (b *Bot) pollCurves(ctx context.Context) error {
+	b.pendingCoinsLock.Lock()
+	coins := make([]*Coin, 0, len(b.pendingCoins))
+	for _, coin := range b.pendingCoins {
+		coins = append(coins, coin)
+	}
+	b.pendingCoinsLock.Unlock()
+
+	for start := 0; start < len(coins); start += curvePollBatchSize {
+		batch := coins[start:min(start+curvePollBatchSize, len(coins))]
+
+		keys := make([]solana.PublicKey, len(batch))
+		for i, coin := range batch {
+			keys[i] = coin.tokenBondingCurve
+		}
+
+		curves, err := b.fetchBondingCurves(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		for i, curve := range curves {
+			if curve == nil {
+				continue
+			}
+
+			// a lagging node's curve would move the coin back in time, the next poll refetches it
+			if _, stale := b.curveStale(curve); stale {
+				continue
+			}
+
+			b.updateCurve(batch[i], curve)
+			b.checkCurveExits(batch[i])
+		}
+	}
+
+	return nil
+}
+
+// fetchBondingCurves fetches & decodes the bonding curves at `keys` with getMultipleAccounts, or one by one
+// if the RPC doesn't support it. curves[i] is nil if `keys[i]` doesn't exist or doesn't decode
+func (b *Bot) fetchBondingCurves(ctx context.Context, keys []solana.PublicKey) ([]*BondingCurveData, error) {
+	if b.batchCurveFetchRejected.Load() {
+		return b.fetchBondingCurvesOneByOne(ctx, keys)
+	}
+
+	result, err := b.rpcClient.GetMultipleAccountsWithOpts(ctx, keys, &rpc.GetMultipleAccountsOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		if !isUnsupportedMethodErr(err) {
+			return nil, fmt.Errorf("failed to get bonding curves: %w", err)
+		}
+
+		if !b.batchCurveFetchRejected.Swap(true) {
+			b.statusy("RPC doesn't support getMultipleAccounts, fetching bonding curves one by one from now on")
+		}
+
+		return b.fetchBondingCurvesOneByOne(ctx, keys)
+	}
+
+	curves := make([]*BondingCurveData, len(keys))
+	for i, account := range result.Value {
+		if i < len(curves) && account != nil {
+			curves[i] = b.decodePolledCurve(account.Data.GetBinary(), result.Context.Slot)
+		}
+	}
+
+	return curves, nil
+}
+
+func (b *Bot) fetchBondingCurvesOneByOne(ctx context.Context, keys []solana.PublicKey) ([]*BondingCurveData, error) {
+	curves := make([]*BondingCurveData, len(keys))
+
+	for i, key := range keys {
+		accountInfo, err := b.rpcClient.GetAccountInfoWithOpts(ctx, key, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentConfirmed})
+		if errors.Is(err, rpc.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get bonding curve %s: %w", key, err)
+		}
+
+		if accountInfo.Value != nil {
+			curves[i] = b.decodePolledCurve(accountInfo.Value.Data.GetBinary(), accountInfo.Context.Slot)
+		}
+	}
+
+	return curves, nil
+}
+
+// decodePolledCurve decodes a polled bonding curve account read at `slot`, nil if it isn't one
+func (b *Bot) decodePolledCurve(data []byte, slot uint64) *BondingCurveData {
+	curve, err := decodeBondingCurve(data)
+	if err != nil {
+		return nil
+	}
+
+	curve.MigrationThreshold = b.currentMigrationThreshold()
+	curve.Slot = slot
+	return curve
+}
+
+// isUnsupportedMethodErr checks if an RPC doesn't implement the method we called
+func isUnsupportedMethodErr(err error) bool {
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == rpcMethodNotFound {
+		return true
+	}
+
+	return strings.Contains(strings.ToLower(err.Error()), "method not found")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollCurves(t *testing.T) {
+	held := &Coin{mintAddr: solana.NewWallet().PublicKey(), tokenBondingCurve: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	migrated := &Coin{mintAddr: solana.NewWallet().PublicKey(), tokenBondingCurve: solana.NewWallet().PublicKey()}
+
+	// close enough to migration to exit
+	curve := curveAfterCreatorBuy(780_000_000_000000)
+	accounts := map[solana.PublicKey]interface{}{held.tokenBondingCurve: bondingCurveAccount(t, curve)["value"], migrated.tokenBondingCurve: nil}
+
+	mock := newMockRPC(t)
+	mock.handle("getMultipleAccounts", func(params []json.RawMessage) (interface{}, error) {
+		var keys []solana.PublicKey
+		require.NoError(t, json.Unmarshal(params[0], &keys))
+
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = accounts[key]
+		}
+
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": values}, nil
+	})
+
+	b := &Bot{
+		rpcClient:         mock.client(),
+		exitCurveProgress: 90,
+		pendingCoins:      map[string]*Coin{held.mintAddr.String(): held, migrated.mintAddr.String(): migrated},
+	}
+
+	require.NoError(t, b.pollCurves(context.Background()))
+	require.Len(t, mock.callsTo("getMultipleAccounts"), 1)
+	require.Empty(t, mock.callsTo("getAccountInfo"))
+
+	require.Equal(t, curve.VirtualSolReserves, held.curve.Load().VirtualSolReserves)
+	require.Equal(t, b.currentMigrationThreshold(), held.curve.Load().MigrationThreshold)
+	require.Equal(t, exitReasonNearCompletion, held.exitReason)
+
+	// the migrated coin's curve is gone, nothing to update
+	require.Nil(t, migrated.curve.Load())
+	require.Empty(t, migrated.exitReason)
+}
+
+func TestPollCurvesWithoutGetMultipleAccounts(t *testing.T) {
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), tokenBondingCurve: solana.NewWallet().PublicKey()}
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	// no getMultipleAccounts handler, the mock answers "method not found"
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curve), nil
+	})
+
+	b := &Bot{rpcClient: mock.client(), pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	require.NoError(t, b.pollCurves(context.Background()))
+	require.True(t, b.batchCurveFetchRejected.Load())
+	require.Equal(t, curve.VirtualSolReserves, coin.curve.Load().VirtualSolReserves)
+
+	// later polls don't try the batch call again
+	coin.curve.Store(nil)
+	require.NoError(t, b.pollCurves(context.Background()))
+	require.Len(t, mock.callsTo("getMultipleAccounts"), 1)
+	require.Len(t, mock.callsTo("getAccountInfo"), 2)
+	require.NotNil(t, coin.curve.Load())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// dailyLoss is the SOL lost on the positions we closed since midnight UTC. the zero value is ready to use
+type dailyLoss struct {
+	day      atomic.Int64 // days since the unix epoch the loss is counted over
+	lamports atomic.Int64
+}
+
+// add counts a realized loss (positive lamports) closed at `now`, starting over on a new day.
+// returns the day's loss so far
+func (d *dailyLoss) add(lamports int64, now time.Time) int64 {
+	today := now.UTC().Unix() / int64(24*time.Hour/time.Second)
+	if day := d.day.Load(); day != today && d.day.CompareAndSwap(day, today) {
+		d.lamports.Store(0)
+	}
+
+	return d.lamports.Add(lamports)
+}
+
+func (d *dailyLoss) reset() {
+	d.lamports.Store(0)
+}
+
+// recordDailyPnL adds a closed position's realized P&L to the day's loss, halting new buys (and
+// notifying the operator) once the loss exceeds `maxDailyLossSol`. held coins keep being sold
+func (b *Bot) recordDailyPnL(pnlLamports int64) {
+	if b.maxDailyLossSol <= 0 || pnlLamports >= 0 {
+		return
+	}
+
+	lost := b.dailyLoss.add(-pnlLamports, time.Now())
+	if float64(lost) <= b.maxDailyLossSol*float64(solana.LAMPORTS_PER_SOL) {
+		return
+	}
+
+	// only the trade crossing the limit notifies
+	if !b.tradingHalted.CompareAndSwap(false, true) {
+		return
+	}
+
+	msg := fmt.Sprintf("Daily loss limit reached: lost %s today (limit %.5f SOL), buys halted until POST /resume",
+		formatSol(lost, b.solUSD()), b.maxDailyLossSol)
+	b.statusr(msg)
+	b.notify(msg)
+}
+
+// resumeTrading clears a daily loss halt, counting the day's loss from zero again
+func (b *Bot) resumeTrading() {
+	b.dailyLoss.reset()
+	if b.tradingHalted.Swap(false) {
+		b.statusg("Trading resumed")
+	}
+}
+
+// handleResume resumes trading after a daily loss halt (or a panic sell)
+func (b *Bot) handleResume(w http.ResponseWriter, r *http.Request) {
+	if !b.authorizeControl(w, r) {
+		return
+	}
+
+	b.resumeTrading()
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorizeControl checks a control endpoint request is a POST with `Authorization: Bearer <controlToken>`,
+// answering it with an error if not. control endpoints are disabled while no control token is set
+func (b *Bot) authorizeControl(w http.ResponseWriter, r *http.Request) bool {
+	return authorizeBearer(w, r, b.controlToken)
+}
+
+// authorizeBearer checks a request is a POST with `Authorization: Bearer <want>`, answering it with an error
+// if not. an empty `want` authorizes nothing
+func authorizeBearer(w http.ResponseWriter, r *http.Request, want string) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if want == "" || !found || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	lock sync.Mutex
+	msgs []string
+}
+
+func (n *recordingNotifier) Send(msg string) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.msgs = append(n.msgs, msg)
+	return nil
+}
+
+func (n *recordingNotifier) sent() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return slices.Clone(n.msgs)
+}
+
+func TestRecordDailyPnLHaltsTrading(t *testing.T) {
+	notifier := &recordingNotifier{}
+	b := &Bot{maxDailyLossSol: 0.1, notifier: notifier}
+
+	// profits don't offset losses
+	b.recordDailyPnL(int64(solana.LAMPORTS_PER_SOL))
+	b.recordDailyPnL(-60_000_000)
+	b.recordDailyPnL(-40_000_000)
+	require.False(t, b.tradingHalted.Load())
+	require.Empty(t, notifier.sent())
+
+	b.recordDailyPnL(-1)
+	require.True(t, b.tradingHalted.Load())
+	require.Len(t, notifier.sent(), 1)
+	require.Contains(t, notifier.sent()[0], "Daily loss limit reached")
+
+	// halted mints are never looked at
+	mock := newMockRPC(t)
+	b.rpcClient = mock.client()
+	b.checkAndSignalBuyCoin(solana.Signature{1}, time.Now())
+	require.Empty(t, mock.callsTo("getTransaction"))
+
+	// further losses don't notify again
+	b.recordDailyPnL(-1)
+	require.Len(t, notifier.sent(), 1)
+}
+
+func TestDailyLossStartsOverEachDay(t *testing.T) {
+	var loss dailyLoss
+	day := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+
+	require.EqualValues(t, 5, loss.add(5, day))
+	require.EqualValues(t, 8, loss.add(3, day.Add(59*time.Minute)))
+	require.EqualValues(t, 2, loss.add(2, day.Add(time.Hour)))
+}
+
+func TestHandleResume(t *testing.T) {
+	b := &Bot{controlToken: "secret"}
+	b.tradingHalted.Store(true)
+	b.dailyLoss.add(100, time.Now())
+
+	resume := func(method, auth string) int {
+		req := httptest.NewRequest(method, "/resume", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		rec := httptest.NewRecorder()
+		b.handleResume(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, resume(http.MethodGet, "Bearer secret"))
+	require.Equal(t, http.StatusUnauthorized, resume(http.MethodPost, ""))
+	require.Equal(t, http.StatusUnauthorized, resume(http.MethodPost, "Bearer wrong"))
+	require.True(t, b.tradingHalted.Load())
+
+	require.Equal(t, http.StatusOK, resume(http.MethodPost, "Bearer secret"))
+	require.False(t, b.tradingHalted.Load())
+	require.Zero(t, b.dailyLoss.lamports.Load())
+
+	// without a control token nobody can resume
+	b.controlToken = ""
+	require.Equal(t, http.StatusUnauthorized, resume(http.MethodPost, "Bearer "))
+}
+
+func TestTelegramNotifierSend(t *testing.T) {
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/bottoken/sendMessage", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	n := newTelegramNotifier("token", "42")
+	n.apiURL = server.URL
+
+	require.NoError(t, n.Send("hello"))
+	require.Equal(t, map[string]string{"chat_id": "42", "text": "hello"}, body)
+}
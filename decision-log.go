@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// types of the events in the decision log
+const (
+	eventMintDetected  = "mint_detected"
+	eventDecision      = "decision"
+	eventBuySent       = "buy_sent"
+	eventBuyConfirmed  = "buy_confirmed"
+	eventCreatorSold   = "creator_sold"
+	eventSellSent      = "sell_sent"
+	eventSellConfirmed = "sell_confirmed"
+
+	// a known competitor bot bought the coin in the block our buy landed in, see checkPeerBots
+	eventCompetedWithBot = "competed_with_known_bot"
+)
+
+// DecisionEvent is one entry of the decision log, along with the coin's state when it happened
+type DecisionEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Mint   string    `json:"mint"`
+	Detail string    `json:"detail,omitempty"` // e.g. why a coin was skipped, the signature confirmed
+	Coin   coinState `json:"coin"`
+}
+
+// coinState is a snapshot of the coin a decision event is about
+type coinState struct {
+	Creator            string  `json:"creator"`
+	CreatorPurchaseSol float64 `json:"creator_purchase_sol"`
+	CreatorSold        bool    `json:"creator_sold"`
+	BotPurchased       bool    `json:"bot_purchased"`
+	TokensHeld         string  `json:"tokens_held,omitempty"`
+	BuyPrice           uint64  `json:"buy_price,omitempty"`
+	ExitReason         string  `json:"exit_reason,omitempty"`
+	EvalCurveFill      float64 `json:"eval_curve_fill,omitempty"` // percent, see maxEvalCurveFill
+}
+
+// EventLog is an append-only log of every decision the bot takes, for debugging & auditing
+type EventLog interface {
+	Append(event *DecisionEvent) error
+}
+
+// fileEventLog appends events to a file as JSON lines, see readDecisionEvents
+type fileEventLog struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func openFileEventLog(path string) (*fileEventLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileEventLog{file: file}, nil
+}
+
+func (l *fileEventLog) Append(event *DecisionEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *fileEventLog) Close() error {
+	return l.file.Close()
+}
+
+// readDecisionEvents reads a decision log written by fileEventLog back, in the order it was written
+func readDecisionEvents(r io.Reader) ([]*DecisionEvent, error) {
+	var events []*DecisionEvent
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event DecisionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, scanner.Err()
+}
+
+// sendRoute describes how a tx was sent, for the event log
+func sendRoute(jito bool) string {
+	if jito {
+		return "jito"
+	}
+
+	return "vanilla"
+}
+
+// logEvent appends an event about `coin` to our event log, if one is configured
+func (b *Bot) logEvent(coin *Coin, eventType, detail string) {
+	if b.eventLog == nil {
+		return
+	}
+
+	b.pendingCoinsLock.Lock()
+	state := coin.state()
+	b.pendingCoinsLock.Unlock()
+
+	b.appendEvent(coin, eventType, detail, state)
+}
+
+// logEventLocked is logEvent, with pendingCoinsLock already held
+func (b *Bot) logEventLocked(coin *Coin, eventType, detail string) {
+	if b.eventLog == nil {
+		return
+	}
+
+	b.appendEvent(coin, eventType, detail, coin.state())
+}
+
+func (b *Bot) appendEvent(coin *Coin, eventType, detail string, state coinState) {
+	event := &DecisionEvent{
+		Time:   time.Now().UTC(),
+		Type:   eventType,
+		Mint:   coin.mintAddr.String(),
+		Detail: detail,
+		Coin:   state,
+	}
+
+	if err := b.eventLog.Append(event); err != nil {
+		b.statusr("Failed to append to event log: " + err.Error())
+	}
+}
+
+// state snapshots the coin for the event log, pendingCoinsLock must be held once the coin is pending
+func (c *Coin) state() coinState {
+	state := coinState{
+		Creator:            c.creator.String(),
+		CreatorPurchaseSol: c.creatorPurchaseSol,
+		CreatorSold:        c.creatorSold,
+		BotPurchased:       c.botPurchased,
+		BuyPrice:           c.buyPrice,
+		ExitReason:         c.exitReason,
+		EvalCurveFill:      c.evalCurveFill,
+	}
+
+	if c.tokensHeld != nil {
+		state.TokensHeld = c.tokensHeld.String()
+	}
+
+	return state
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionLogBuyThenSell(t *testing.T) {
+	coin := fixtureCoin(t)
+
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curveAfterCreatorBuy(coin.creatorTokenBalance)), nil
+	})
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var encoded string
+		require.NoError(t, json.Unmarshal(params[0], &encoded))
+
+		tx, err := solana.TransactionFromBase64(encoded)
+		require.NoError(t, err)
+		return tx.Signatures[0].String(), nil
+	})
+	mock.handle("getTokenAccountBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"amount": "0", "decimals": 6, "uiAmountString": "0"},
+		}, nil
+	})
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	eventLog, err := openFileEventLog(path)
+	require.NoError(t, err)
+
+	b := newBaseBot()
+	b.rpcClient = mock.client()
+	b.wsPool = newWsPoolFromClients(wsMock.client(t))
+	b.privateKey = solana.NewWallet().PrivateKey
+	b.blockhash.Store(&solana.Hash{})
+	b.store = newMemoryStore()
+	b.skipATALookup = true
+	b.tipOnBuy, b.tipOnSell = false, false
+	b.eventLog = eventLog
+	b.addNewPendingCoin(coin)
+
+	require.NoError(t, b.BuyCoin(coin))
+	b.setCreatorSold(coin)
+	b.SellCoinFast(coin)
+	require.NoError(t, eventLog.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	events, err := readDecisionEvents(file)
+	require.NoError(t, err)
+
+	// sells are spammed until one confirms, each attempt is logged
+	var types []string
+	for _, event := range events {
+		require.Equal(t, coin.mintAddr.String(), event.Mint)
+		if len(types) == 0 || types[len(types)-1] != event.Type {
+			types = append(types, event.Type)
+		}
+	}
+	require.Equal(t, []string{eventBuySent, eventBuyConfirmed, eventCreatorSold, eventSellSent, eventSellConfirmed}, types)
+
+	// each event carries the coin's state as it was then
+	require.False(t, events[0].Coin.BotPurchased)
+	require.True(t, events[1].Coin.BotPurchased)
+	require.Equal(t, coin.tokensHeld.String(), events[1].Coin.TokensHeld)
+	require.Equal(t, exitReasonCreatorSold, events[2].Detail)
+	require.True(t, events[2].Coin.CreatorSold)
+	require.Equal(t, coin.sellTransactionSignature.String(), events[len(events)-1].Detail)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// createEventDiscriminator prefixes every CreateEvent pump logs, per anchor's `event:<name>` convention
+var createEventDiscriminator = anchorEventDiscriminator("CreateEvent")
+
+// CreateEvent is a new coin launched on pump.fun, decoded from the program's logs
+type CreateEvent struct {
+	Signature solana.Signature
+
+	Name         string
+	Symbol       string
+	URI          string
+	Mint         solana.PublicKey
+	BondingCurve solana.PublicKey
+	User         solana.PublicKey // the creator
+}
+
+// createEventLayout is CreateEvent's borsh layout
+type createEventLayout struct {
+	Name         string
+	Symbol       string
+	URI          string
+	Mint         solana.PublicKey
+	BondingCurve solana.PublicKey
+	User         solana.PublicKey
+}
+
+func decodeCreateEvent(data []byte) (*CreateEvent, error) {
+	var layout createEventLayout
+	if err := bin.NewBorshDecoder(data).Decode(&layout); err != nil {
+		return nil, err
+	}
+
+	return &CreateEvent{
+		Name:         layout.Name,
+		Symbol:       layout.Symbol,
+		URI:          layout.URI,
+		Mint:         layout.Mint,
+		BondingCurve: layout.BondingCurve,
+		User:         layout.User,
+	}, nil
+}
+
+// PumpFunEventStream is every CreateEvent & TradeEvent pump logged in one tx, in order
+type PumpFunEventStream struct {
+	Creates []*CreateEvent
+	Trades  []*TradeEvent
+}
+
+// parsePumpFunEventStream decodes the CreateEvents & TradeEvents pump logged in a tx's logs (see pumpProgramData),
+// stamping them with the tx's signature. other events & garbage are skipped
+func parsePumpFunEventStream(sig solana.Signature, logs []string) *PumpFunEventStream {
+	events := &PumpFunEventStream{}
+
+	for _, data := range pumpProgramData(logs) {
+		if len(data) < 8 {
+			continue
+		}
+
+		switch [8]byte(data[:8]) {
+		case createEventDiscriminator:
+			if create, err := decodeCreateEvent(data[8:]); err == nil {
+				create.Signature = sig
+				events.Creates = append(events.Creates, create)
+			}
+		case tradeEventDiscriminator:
+			if trade, err := decodeTradeEvent(data[8:]); err == nil {
+				trade.Signature = sig
+				events.Trades = append(events.Trades, trade)
+			}
+		}
+	}
+
+	return events
+}
+
+// creatorBuy is the creator's buy of `create`'s coin in the launch tx, nil if they didn't buy
+func (s *PumpFunEventStream) creatorBuy(create *CreateEvent) *TradeEvent {
+	for _, trade := range s.Trades {
+		if trade.IsBuy && trade.Mint.Equals(create.Mint) && trade.User.Equals(create.User) {
+			return trade
+		}
+	}
+
+	return nil
+}
+
+// EventStreamListener runs as goroutine, subscribing to the logs of every tx passing pump's event authority
+// (every create, buy & sell) and decoding the events pump emits. a CreateEvent and the creator's TradeEvent
+// carry everything fetchMintDetails would fetch, so new coins are checked without an RPC call, and trades
+// keep the curve estimate of our pending coins current
+func (b *Bot) EventStreamListener(ctx context.Context) {
+	fmt.Println("Listening for new mints (events)...")
+
+	// the event authority holds no data, the events it signs only show up in the tx logs
+	client := b.wsPool.client(mintConn)
+	sub, err := client.LogsSubscribeMentions(pumpEventAuthority, rpc.CommitmentProcessed)
+	if err != nil {
+		log.Fatalf("Failed to subscribe to pump event authority logs: %v", err)
+	}
+	defer func() { sub.Unsubscribe() }()
+
+	for ctx.Err() == nil {
+		msg, err := sub.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Error receiving event logs, resubscribing: %v\n", err)
+			client, sub = b.resubscribeEventStream(client)
+			continue
+		}
+
+		if msg.Value.Err != nil {
+			continue
+		}
+
+		b.processEventLogs(msg)
+	}
+}
+
+// resubscribeEventStream redials the mint connection after `failed` dropped and subscribes to the event
+// authority logs again, retrying until it works since we can't detect mints without it
+func (b *Bot) resubscribeEventStream(failed *ws.Client) (*ws.Client, *ws.LogSubscription) {
+	for {
+		client, sub, err := b.wsPool.resubscribeLogs(mintConn, failed, pumpEventAuthority)
+		if err == nil {
+			return client, sub
+		}
+
+		// if the redialed connection is the one failing, redial it again next time
+		failed = b.wsPool.client(mintConn)
+
+		log.Printf("Failed to resubscribe to pump event authority logs: %v\n", err)
+		time.Sleep(time.Second)
+	}
+}
+
+// processEventLogs launches the buy checks for every coin created in a tx, and updates the curve
+// estimate of pending coins traded in it
+func (b *Bot) processEventLogs(msg *ws.LogResult) {
+	// a fee change would fail every trade built with the old params
+	if hasSetParamsLog(msg) {
+		go b.refreshGlobalParamsAfterSetParams()
+	}
+
+	events := parsePumpFunEventStream(msg.Value.Signature, msg.Value.Logs)
+
+	for _, create := range events.Creates {
+		b.lastMintSeen.Store(time.Now().UnixNano())
+
+		if !b.markMintDetected(create.Signature) {
+			continue
+		}
+
+		coin, err := b.coinFromCreateEvent(create, events.creatorBuy(create))
+		if err != nil {
+			b.statusr(fmt.Sprintf("Bad CreateEvent in %s: %v", create.Signature, err))
+			continue
+		}
+
+		coin.createSlot = msg.Context.Slot
+
+		b.status(fmt.Sprintf("Detected Mint (%s) in slot %d", create.Signature, msg.Context.Slot))
+		slot, sig := msg.Context.Slot, create.Signature
+		b.goMintCheck(func(detectedAt time.Time) { b.checkAndSignalBuyCoinFromEvent(coin, slot, sig, detectedAt) })
+	}
+
+	for _, trade := range events.Trades {
+		b.updateCurveEstimate(trade)
+	}
+}
+
+// coinFromCreateEvent builds the coin launched by `create`, with the creator's buy from `creatorBuy` (nil if they
+// didn't buy). the account the creator bought into isn't in the events, their canonical ATA is watched for sells
+func (b *Bot) coinFromCreateEvent(create *CreateEvent, creatorBuy *TradeEvent) (*Coin, error) {
+	associatedBondingCurve, _, err := solana.FindAssociatedTokenAddress(create.BondingCurve, create.Mint)
+	if err != nil {
+		return nil, err
+	}
+
+	creatorATA, _, err := solana.FindAssociatedTokenAddress(create.User, create.Mint)
+	if err != nil {
+		return nil, err
+	}
+
+	coin := &Coin{
+		mintAddr:               create.Mint,
+		tokenBondingCurve:      create.BondingCurve,
+		associatedBondingCurve: associatedBondingCurve,
+		eventAuthority:         pumpEventAuthority,
+		programID:              pumpProgramID,
+		name:                   create.Name,
+		symbol:                 create.Symbol,
+		uri:                    create.URI,
+		creator:                create.User,
+		creatorATA:             creatorATA,
+		creatorATASource:       creatorATASourceCanonical,
+		creatorBalanceKnown:    true,
+		createSignature:        create.Signature,
+	}
+
+	// anything can log an event-shaped line, the curve must still be the mint's
+	if err := coin.validateCurveAccounts(); err != nil {
+		return nil, err
+	}
+
+	if creatorBuy != nil {
+		coin.creatorPurchased = true
+		coin.creatorPurchaseSol = float64(creatorBuy.SolAmount) / float64(solana.LAMPORTS_PER_SOL)
+		coin.creatorTokenBalance = creatorBuy.TokenAmount
+		coin.creatorPeakBalance = creatorBuy.TokenAmount
+		b.updateCurve(coin, b.curveAfterTrade(creatorBuy))
+	}
+
+	return coin, nil
+}
+
+// checkAndSignalBuyCoinFromEvent is checkAndSignalBuyCoin for a coin built from its launch tx's events
+func (b *Bot) checkAndSignalBuyCoinFromEvent(coin *Coin, slot uint64, createSig solana.Signature, detectedAt time.Time) {
+	if b.tradingHalted.Load() {
+		return
+	}
+
+	if b.detectCoordinatedBuys {
+		if err := b.detectMultiWalletCoordinatedBuy(coin, slot, createSig); err != nil {
+			coin.status("Failed to check same-block buyers: " + err.Error())
+		}
+	}
+
+	b.signalIfShouldBuy(coin, detectedAt)
+}
+
+// updateCurveEstimate moves the curve estimate of a pending coin to right after `trade`
+func (b *Bot) updateCurveEstimate(trade *TradeEvent) {
+	b.pendingCoinsLock.Lock()
+	coin, ok := b.pendingCoins[trade.Mint.String()]
+	b.pendingCoinsLock.Unlock()
+
+	if ok {
+		b.updateCurve(coin, b.curveAfterTrade(trade))
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// createEventLog encodes `event` the way pump logs it
+func createEventLog(event *CreateEvent) string {
+	data := append([]byte{}, createEventDiscriminator[:]...)
+	for _, s := range []string{event.Name, event.Symbol, event.URI} {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(s)))
+		data = append(data, s...)
+	}
+	data = append(data, event.Mint.Bytes()...)
+	data = append(data, event.BondingCurve.Bytes()...)
+	data = append(data, event.User.Bytes()...)
+
+	return "Program data: " + base64.StdEncoding.EncodeToString(data)
+}
+
+// launchEvents is a create of `f`'s coin by `creator`, who bought 1 SOL of it in the same tx
+func launchEvents(f *launchFixture, creator solana.PublicKey) (*CreateEvent, *TradeEvent) {
+	create := &CreateEvent{Name: "Test", Symbol: "TST", URI: "https://example.com/tst.json", Mint: f.mint, BondingCurve: f.bondingCurve, User: creator}
+
+	launch := curveAfterCreatorBuy(34_612_903_225806)
+	buy := &TradeEvent{
+		Mint:                 f.mint,
+		User:                 creator,
+		SolAmount:            1_000_000_000,
+		TokenAmount:          34_612_903_225806,
+		IsBuy:                true,
+		VirtualSolReserves:   launch.VirtualSolReserves.Uint64(),
+		VirtualTokenReserves: launch.VirtualTokenReserves.Uint64(),
+	}
+
+	return create, buy
+}
+
+func TestParsePumpFunEventStream(t *testing.T) {
+	f := newLaunchFixture(t)
+	create, buy := launchEvents(f, solana.NewWallet().PublicKey())
+	sig := solana.Signature{3}
+
+	events := parsePumpFunEventStream(sig, []string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: Create",
+		createEventLog(create),
+		"Program log: Instruction: Buy",
+		tradeEventLog(buy),
+		// other events & garbage are skipped
+		"Program data: " + base64.StdEncoding.EncodeToString(append(createEventDiscriminator[:], 1, 2)),
+		"Program data: !!!",
+	})
+
+	create.Signature, buy.Signature = sig, sig
+	require.Equal(t, []*CreateEvent{create}, events.Creates)
+	require.Equal(t, []*TradeEvent{buy}, events.Trades)
+	require.Equal(t, buy, events.creatorBuy(create))
+
+	// someone else's buy isn't the creator's
+	events.Trades[0].User = solana.NewWallet().PublicKey()
+	require.Nil(t, events.creatorBuy(create))
+}
+
+func TestParsePumpFunEventStreamSkipsOtherProgramsData(t *testing.T) {
+	f := newLaunchFixture(t)
+	create, buy := launchEvents(f, solana.NewWallet().PublicKey())
+	forger := solana.NewWallet().PublicKey().String()
+
+	// a program invoked next to (or by) pump logs a create & buy of its own
+	events := parsePumpFunEventStream(solana.Signature{3}, []string{
+		"Program " + forger + " invoke [1]",
+		createEventLog(create),
+		"Program " + pumpProgramID.String() + " invoke [2]",
+		"Program log: Instruction: Buy",
+		"Program " + pumpProgramID.String() + " consumed 30000 of 200000 compute units",
+		"Program " + pumpProgramID.String() + " success",
+		tradeEventLog(buy),
+		"Program " + forger + " success",
+		"Program " + pumpProgramID.String() + " invoke [1]",
+		"Program " + forger + " invoke [2]",
+		tradeEventLog(buy),
+		"Program " + forger + " failed: custom program error: 0x1",
+		"Program " + pumpProgramID.String() + " failed: custom program error: 0x1",
+	})
+
+	require.Empty(t, events.Creates)
+	require.Empty(t, events.Trades)
+}
+
+func TestCoinFromCreateEvent(t *testing.T) {
+	f := newLaunchFixture(t)
+	creator := solana.NewWallet().PublicKey()
+	create, buy := launchEvents(f, creator)
+
+	b := &Bot{}
+	coin, err := b.coinFromCreateEvent(create, buy)
+	require.NoError(t, err)
+
+	creatorATA, _, err := solana.FindAssociatedTokenAddress(creator, f.mint)
+	require.NoError(t, err)
+
+	require.Equal(t, f.mint, coin.mintAddr)
+	require.Equal(t, f.bondingCurve, coin.tokenBondingCurve)
+	require.Equal(t, f.associatedBondingCurve, coin.associatedBondingCurve)
+	require.Equal(t, pumpEventAuthority, coin.eventAuthority)
+	require.Equal(t, creator, coin.creator)
+	require.Equal(t, creatorATA, coin.creatorATA)
+	require.True(t, coin.creatorPurchased)
+	require.Equal(t, 1.0, coin.creatorPurchaseSol)
+	require.Equal(t, buy.TokenAmount, coin.creatorPeakBalance)
+
+	// the curve is known without fetching it, and only the creator is in it
+	require.Equal(t, curveAfterCreatorBuy(buy.TokenAmount).VirtualSolReserves, coin.curve.Load().VirtualSolReserves)
+	externalSol, _ := b.lateToBuy(coin, coin.curve.Load())
+	require.Zero(t, externalSol)
+
+	// no creator buy
+	coin, err = b.coinFromCreateEvent(create, nil)
+	require.NoError(t, err)
+	require.False(t, coin.creatorPurchased)
+	require.Nil(t, coin.curve.Load())
+}
+
+func TestEventStreamListener(t *testing.T) {
+	f := newLaunchFixture(t)
+	create, buy := launchEvents(f, solana.NewWallet().PublicKey())
+	createSig := solana.Signature{4}
+
+	// a trade on a coin we're waiting on
+	pending := &Coin{mintAddr: solana.NewWallet().PublicKey()}
+	trade := &TradeEvent{Mint: pending.mintAddr, User: solana.NewWallet().PublicKey(), SolAmount: 1e9, IsBuy: true, VirtualSolReserves: 40_000_000_000, VirtualTokenReserves: 800_000_000_000000}
+
+	subscribed := make(chan []json.RawMessage, 1)
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		subscribed <- params
+		return []interface{}{
+			map[string]interface{}{
+				"context": map[string]interface{}{"slot": 1},
+				"value":   map[string]interface{}{"signature": createSig.String(), "err": nil, "logs": pumpLogs(createEventLog(create), tradeEventLog(buy))},
+			},
+			map[string]interface{}{
+				"context": map[string]interface{}{"slot": 2},
+				"value":   map[string]interface{}{"signature": solana.Signature{5}.String(), "err": nil, "logs": pumpLogs(tradeEventLog(trade))},
+			},
+		}
+	})
+
+	b := &Bot{
+		wsPool:       newWsPoolFromClients(wsMock.client(t)),
+		pendingCoins: map[string]*Coin{pending.mintAddr.String(): pending},
+		// rejected first thing, so nothing past detection needs mocking
+		mintDenylist: map[string]bool{f.mint.String(): true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.EventStreamListener(ctx)
+
+	params := <-subscribed
+	require.Len(t, params, 2)
+	require.JSONEq(t, `{"mentions": ["`+pumpEventAuthority.String()+`"]}`, string(params[0]))
+	require.JSONEq(t, `{"commitment": "processed"}`, string(params[1]))
+
+	require.Eventually(t, func() bool {
+		_, detected := b.detectedMints.Load(createSig)
+		return detected && pending.curve.Load() != nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, b.curveAfterTrade(trade), pending.curve.Load())
+}
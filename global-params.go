@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// defaultFeeBasisPoints is pump's 1% trading fee, used until Global is first fetched
+const defaultFeeBasisPoints = 100
+
+// currentFeeRecipient is the fee recipient our buys & sells must pass, from the latest Global account
+// we fetched. falls back to the hardcoded `feeRecipient` until Global is first fetched
+func (b *Bot) currentFeeRecipient() solana.PublicKey {
+	if global := b.globalParams.Load(); global != nil {
+		return global.FeeRecipient
+	}
+
+	return feeRecipient
+}
+
+// currentFeeBasisPoints is pump's trading fee, from the latest Global account we fetched
+func (b *Bot) currentFeeBasisPoints() uint64 {
+	if global := b.globalParams.Load(); global != nil {
+		return global.FeeBasisPoints
+	}
+
+	return defaultFeeBasisPoints
+}
+
+// defaultMigrationThreshold is the real SOL a curve holds once it sells out with pump's launch reserves,
+// used until Global is first fetched
+var defaultMigrationThreshold = migrationThreshold(initialVirtualTokenReserves, initialVirtualSolReserves, initialRealTokenReserves)
+
+// migrationThreshold is how much real SOL a curve launched with these reserves holds once its real
+// tokens sell out, completing it for migration (~85 SOL with pump's launch reserves)
+func migrationThreshold(virtualTokenReserves, virtualSolReserves, realTokenReserves uint64) uint64 {
+	if realTokenReserves >= virtualTokenReserves {
+		return 0
+	}
+
+	invariant := new(big.Int).Mul(new(big.Int).SetUint64(virtualTokenReserves), new(big.Int).SetUint64(virtualSolReserves))
+	finalVirtualSolReserves := invariant.Div(invariant, new(big.Int).SetUint64(virtualTokenReserves-realTokenReserves))
+
+	return finalVirtualSolReserves.Uint64() - virtualSolReserves
+}
+
+// currentLaunchReserves are the reserves pump launches curves with, from the latest Global account we fetched
+func (b *Bot) currentLaunchReserves() (virtualTokenReserves, virtualSolReserves, realTokenReserves uint64) {
+	if global := b.globalParams.Load(); global != nil {
+		return global.InitialVirtualTokenReserves, global.InitialVirtualSolReserves, global.InitialRealTokenReserves
+	}
+
+	return initialVirtualTokenReserves, initialVirtualSolReserves, initialRealTokenReserves
+}
+
+// currentTokenTotalSupply is the supply pump mints every coin with, from the latest Global account we fetched
+func (b *Bot) currentTokenTotalSupply() uint64 {
+	if global := b.globalParams.Load(); global != nil {
+		return global.TokenTotalSupply
+	}
+
+	return tokenTotalSupply
+}
+
+// currentMigrationThreshold is the real SOL at which curves complete, from the latest Global account we fetched
+func (b *Bot) currentMigrationThreshold() uint64 {
+	return migrationThreshold(b.currentLaunchReserves())
+}
+
+// fetchGlobal fetches & decodes pump's Global account
+func (b *Bot) fetchGlobal() (*pump.Global, error) {
+	accountInfo, err := b.rpcClient.GetAccountInfoWithOpts(context.TODO(), globalAddr, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get global account: %w", err)
+	}
+
+	global := &pump.Global{}
+	if err := global.UnmarshalWithDecoder(bin.NewBorshDecoder(accountInfo.Value.Data.GetBinary())); err != nil {
+		return nil, fmt.Errorf("failed to decode global account: %w", err)
+	}
+
+	return global, nil
+}
+
+// refreshGlobalParams re-fetches pump's Global account, swapping in the new params for every
+// instruction we build from now on. warns if params our trades depend on changed
+func (b *Bot) refreshGlobalParams() error {
+	global, err := b.fetchGlobal()
+	if err != nil {
+		return err
+	}
+
+	prev := b.globalParams.Swap(global)
+	if prev == nil {
+		// until now we traded with the hardcoded fee recipient
+		if !global.FeeRecipient.Equals(feeRecipient) {
+			b.statusy(fmt.Sprintf("pump.fun fee recipient changed, updating (%s -> %s)", feeRecipient, global.FeeRecipient))
+		}
+
+		return nil
+	}
+
+	var changes []string
+	if !prev.FeeRecipient.Equals(global.FeeRecipient) {
+		changes = append(changes, fmt.Sprintf("fee recipient %s -> %s", prev.FeeRecipient, global.FeeRecipient))
+	}
+
+	if prev.FeeBasisPoints != global.FeeBasisPoints {
+		changes = append(changes, fmt.Sprintf("fee %d -> %d bps", prev.FeeBasisPoints, global.FeeBasisPoints))
+	}
+
+	if prevThreshold, threshold := migrationThreshold(prev.InitialVirtualTokenReserves, prev.InitialVirtualSolReserves, prev.InitialRealTokenReserves),
+		migrationThreshold(global.InitialVirtualTokenReserves, global.InitialVirtualSolReserves, global.InitialRealTokenReserves); prevThreshold != threshold {
+		changes = append(changes, fmt.Sprintf("migration threshold %d -> %d lamports", prevThreshold, threshold))
+	}
+
+	if len(changes) > 0 {
+		b.statusy(fmt.Sprintf("Pump params changed while holding %d coins: %s", b.countHeldCoins(), strings.Join(changes, ", ")))
+	}
+
+	return nil
+}
+
+// countHeldCoins counts the coins we currently hold tokens of
+func (b *Bot) countHeldCoins() int {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	var held int
+	for _, coin := range b.pendingCoins {
+		if coin.botHoldsTokens() {
+			held++
+		}
+	}
+
+	return held
+}
+
+// RefreshGlobalParams runs as goroutine, refetching pump's Global params every `globalParamsRefreshInterval`
+// in case we missed the SetParams tx changing them (e.g. while our log subscription was down)
+func (b *Bot) RefreshGlobalParams(ctx context.Context) {
+	ticker := time.NewTicker(b.globalParamsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.refreshGlobalParams(); err != nil {
+			b.statusr("Failed to refresh pump params: " + err.Error())
+		}
+	}
+}
+
+// refreshGlobalParamsAfterSetParams refetches pump's Global params once a SetParams tx is seen
+func (b *Bot) refreshGlobalParamsAfterSetParams() {
+	if err := b.refreshGlobalParams(); err != nil {
+		b.statusr("Failed to refresh pump params after SetParams: " + err.Error())
+	}
+}
+
+// hasSetParamsLog checks if a successful tx in the pump log stream changed pump's Global params
+func hasSetParamsLog(msg *ws.LogResult) bool {
+	if msg.Value.Err != nil {
+		return false
+	}
+
+	return containsSetParamsLog(msg.Value.Logs)
+}
+
+func containsSetParamsLog(logs []string) bool {
+	for _, logEntry := range logs {
+		if strings.Contains(logEntry, "Instruction: SetParams") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// globalAccount encodes `global` as a getAccountInfo result
+func globalAccount(t *testing.T, global *pump.Global) map[string]interface{} {
+	var buf bytes.Buffer
+	require.NoError(t, global.MarshalWithEncoder(bin.NewBorshEncoder(&buf)))
+
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": 1},
+		"value": map[string]interface{}{
+			"lamports":   1,
+			"owner":      pumpProgramID.String(),
+			"data":       []string{base64.StdEncoding.EncodeToString(buf.Bytes()), "base64"},
+			"executable": false,
+			"rentEpoch":  0,
+		},
+	}
+}
+
+func TestHasSetParamsLog(t *testing.T) {
+	msg := &ws.LogResult{}
+	msg.Value.Logs = []string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: SetParams",
+	}
+	require.True(t, hasSetParamsLog(msg))
+
+	// failed txs didn't change anything
+	msg.Value.Err = map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}
+	require.False(t, hasSetParamsLog(msg))
+
+	require.False(t, hasSetParamsLog(&ws.LogResult{}))
+}
+
+func TestRefreshGlobalParamsSwapsFeeRecipient(t *testing.T) {
+	global := &pump.Global{Initialized: true, FeeRecipient: feeRecipient, FeeBasisPoints: 100}
+
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return globalAccount(t, global), nil
+	})
+
+	f := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:               f.mint,
+		tokenBondingCurve:      f.bondingCurve,
+		associatedBondingCurve: f.associatedBondingCurve,
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+
+	b := &Bot{rpcClient: mock.client(), privateKey: solana.NewWallet().PrivateKey, pendingCoins: map[string]*Coin{f.mint.String(): coin}}
+
+	// defaults until Global is fetched
+	require.Equal(t, feeRecipient, b.createSellInstruction(coin).GetFeeRecipientAccount().PublicKey)
+
+	require.NoError(t, b.refreshGlobalParams())
+	require.Equal(t, feeRecipient, b.currentFeeRecipient())
+
+	// pump's authority moves the fees while we hold the coin
+	newRecipient := solana.NewWallet().PublicKey()
+	global.FeeRecipient = newRecipient
+	global.FeeBasisPoints = 125
+
+	buf := captureLogs(t)
+	require.NoError(t, b.refreshGlobalParams())
+	require.Contains(t, buf.String(), "Pump params changed while holding 1 coins")
+	require.Contains(t, buf.String(), "fee 100 -> 125 bps")
+
+	require.Equal(t, newRecipient, b.createSellInstruction(coin).GetFeeRecipientAccount().PublicKey)
+	require.Equal(t, newRecipient, b.createBuyInstruction(big.NewInt(1), 1, coin, solana.NewWallet().PublicKey()).GetFeeRecipientAccount().PublicKey)
+}
+
+func TestRefreshGlobalParamsWarnsOfNewFeeRecipientAtStartup(t *testing.T) {
+	// pump moved its fees before we started, off the recipient we hardcode
+	newRecipient := solana.NewWallet().PublicKey()
+	global := &pump.Global{Initialized: true, FeeRecipient: newRecipient, FeeBasisPoints: 100}
+
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return globalAccount(t, global), nil
+	})
+
+	b := &Bot{rpcClient: mock.client(), globalParamsRefreshInterval: 10 * time.Millisecond}
+
+	buf := captureLogs(t)
+	require.NoError(t, b.refreshGlobalParams())
+	require.Contains(t, buf.String(), "pump.fun fee recipient changed, updating")
+	require.Equal(t, newRecipient, b.currentFeeRecipient())
+
+	// and again later, which we'd miss without a SetParams log
+	laterRecipient := solana.NewWallet().PublicKey()
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		changed := *global
+		changed.FeeRecipient = laterRecipient
+		return globalAccount(t, &changed), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.RefreshGlobalParams(ctx)
+
+	require.Eventually(t, func() bool { return b.currentFeeRecipient().Equals(laterRecipient) }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// raydiumAMMProgramID is Raydium's AMM v4 program, which creates the pool of every graduated pump.fun coin
+var raydiumAMMProgramID = solana.MustPublicKeyFromBase58("675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8")
+
+// e.g. `Program log: initialize2: InitializeInstruction2 { nonce: 254, open_time: 0, init_pc_amount: 79005359116, init_coin_amount: 206900000000000 }`
+var raydiumInitializeLogRegex = regexp.MustCompile(`initialize2: InitializeInstruction2 \{ nonce: (\d+), open_time: (\d+), init_pc_amount: (\d+), init_coin_amount: (\d+) \}`)
+
+// raydiumInitializeEvent is the pool creation logged by Raydium's `initialize2` instruction
+type raydiumInitializeEvent struct {
+	Nonce          uint64
+	OpenTime       uint64
+	InitPcAmount   uint64 // lamports of SOL the pool was seeded with
+	InitCoinAmount uint64 // tokens the pool was seeded with
+}
+
+// WatchForGraduation listens for a Raydium pool being created for the coin, which happens once
+// its bonding curve completes. Price dynamics change completely at graduation, so we exit immediately.
+// every pool creation tx mentions the coin's mint, so we subscribe to the mint's logs and look for
+// Raydium AMM's InitializeInstruction2, rather than subscribing to all of Raydium per coin.
+// pump's Withdraw of the curve's liquidity, which comes first, marks the coin as migrating.
+// the coin's trades mention the mint as well, so `exitCurveProgress` is checked on each of them,
+// whether or not the coin has a trade tape or the curve poller is running
+
+func (b *Bot) WatchForGraduation(ctx context.Context, coin *Coin) {
+	conn := b.wsPool.assign()
+	client := b.wsPool.client(conn)
+
+	sub, err := client.LogsSubscribeMentions(coin.mintAddr, rpc.CommitmentConfirmed)
+	if err != nil {
+		log.Printf("Failed to subscribe to mint logs for graduation: %v", err)
+		return
+	}
+
+	defer func() { sub.Unsubscribe() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-sub.Err():
+			log.Printf("Error receiving graduation logs, resubscribing: %v\n", err)
+
+			resubClient, resub, err := b.wsPool.resubscribeLogs(conn, client, coin.mintAddr)
+			if err != nil {
+				log.Printf("Failed to resubscribe to mint logs for graduation: %v", err)
+				return
+			}
+
+			client, sub = resubClient, resub
+		case msg := <-sub.Response():
+			// same exit conditions as the creator ATA listener, plus the coin no longer being tracked
+			if (coin.exitedBuyCoin && !coin.botPurchased) || (coin.botPurchased && !coin.botHoldsTokens()) || !b.isPendingCoin(coin) {
+				return
+			}
+
+			if msg.Value.Err != nil {
+				continue
+			}
+
+			for _, trade := range parseTradeEvents(msg.Value.Logs) {
+				if trade.Mint.Equals(coin.mintAddr) {
+					b.sellOnCurveProgressOf(coin, b.curveAfterTrade(trade))
+				}
+			}
+
+			// the withdraw mentions the mint too, and comes before the pool is created
+			if hasPumpWithdrawLog(msg.Value.Logs) {
+				b.status(fmt.Sprintf("Detected pump withdraw of %s, curve is migrating", coin.mintAddr.String()))
+				b.setMigrating(coin)
+				continue
+			}
+
+			event, ok := parseRaydiumInitialize(msg.Value.Logs)
+			if !ok {
+				continue
+			}
+
+			b.status(fmt.Sprintf("Detected graduation of %s (pool seeded with %d lamports, %d tokens), Marking to sell", coin.mintAddr.String(), event.InitPcAmount, event.InitCoinAmount))
+			b.setGraduated(coin)
+			return
+		}
+	}
+}
+
+// setGraduated marks a pending coin as graduated and triggers an exit
+func (b *Bot) setGraduated(coin *Coin) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	mintAddr := coin.mintAddr.String()
+	if pendingCoin, ok := b.pendingCoins[mintAddr]; ok {
+		if !pendingCoin.graduated {
+			go b.recordCreatorGraduation(pendingCoin)
+		}
+
+		pendingCoin.graduated = true
+		pendingCoin.setExitReason(exitReasonGraduated)
+	}
+}
+
+// parseRaydiumInitialize finds the InitializeInstruction2 event in a transaction's logs,
+// only accepting it if the Raydium AMM program was actually invoked in the tx
+func parseRaydiumInitialize(logs []string) (*raydiumInitializeEvent, bool) {
+	invokedRaydium := false
+	raydiumInvoke := "Program " + raydiumAMMProgramID.String() + " invoke"
+
+	for _, logEntry := range logs {
+		if strings.HasPrefix(logEntry, raydiumInvoke) {
+			invokedRaydium = true
+			continue
+		}
+
+		if !invokedRaydium {
+			continue
+		}
+
+		matches := raydiumInitializeLogRegex.FindStringSubmatch(logEntry)
+		if matches == nil {
+			continue
+		}
+
+		var values [4]uint64
+		for i := range values {
+			value, err := strconv.ParseUint(matches[i+1], 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			values[i] = value
+		}
+
+		return &raydiumInitializeEvent{
+			Nonce:          values[0],
+			OpenTime:       values[1],
+			InitPcAmount:   values[2],
+			InitCoinAmount: values[3],
+		}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRaydiumInitialize(t *testing.T) {
+	logs := []string{
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program ComputeBudget111111111111111111111111111111 success",
+		"Program 675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8 invoke [1]",
+		"Program log: initialize2: InitializeInstruction2 { nonce: 254, open_time: 1718000000, init_pc_amount: 79005359116, init_coin_amount: 206900000000000 }",
+		"Program 675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8 success",
+	}
+
+	event, ok := parseRaydiumInitialize(logs)
+	require.True(t, ok)
+	require.Equal(t, &raydiumInitializeEvent{
+		Nonce:          254,
+		OpenTime:       1718000000,
+		InitPcAmount:   79005359116,
+		InitCoinAmount: 206900000000000,
+	}, event)
+
+	// regular pump trades of the coin
+	_, ok = parseRaydiumInitialize([]string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: Buy",
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P success",
+	})
+	require.False(t, ok)
+
+	// lookalike log printed by some other program
+	_, ok = parseRaydiumInitialize([]string{
+		"Program 11111111111111111111111111111111 invoke [1]",
+		"Program log: initialize2: InitializeInstruction2 { nonce: 1, open_time: 0, init_pc_amount: 1, init_coin_amount: 1 }",
+	})
+	require.False(t, ok)
+}
+
+func TestSetGraduatedTriggersExit(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint}
+	b := &Bot{pendingCoins: map[string]*Coin{f.mint.String(): coin}}
+
+	b.setGraduated(coin)
+	require.True(t, coin.graduated)
+	require.Equal(t, exitReasonGraduated, coin.exitReason)
+}
+
+var withdrawLogs = []string{
+	"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+	"Program log: Instruction: Withdraw",
+	"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P success",
+}
+
+func TestHasPumpWithdrawLog(t *testing.T) {
+	require.True(t, hasPumpWithdrawLog(withdrawLogs))
+
+	require.False(t, hasPumpWithdrawLog([]string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: Sell",
+	}))
+
+	// some other program's withdraw
+	require.False(t, hasPumpWithdrawLog([]string{
+		"Program 11111111111111111111111111111111 invoke [1]",
+		"Program log: Instruction: Withdraw",
+	}))
+
+	// another program's withdraw after pump ran, or in a CPI pump made
+	require.False(t, hasPumpWithdrawLog([]string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: Sell",
+		"Program 11111111111111111111111111111111 invoke [2]",
+		"Program log: Instruction: Withdraw",
+		"Program 11111111111111111111111111111111 success",
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P success",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA invoke [1]",
+		"Program log: Instruction: Withdraw",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA success",
+	}))
+
+	// pump's own withdraw, after a CPI it made returned
+	require.True(t, hasPumpWithdrawLog([]string{
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program ComputeBudget111111111111111111111111111111 success",
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program 11111111111111111111111111111111 invoke [2]",
+		"Program 11111111111111111111111111111111 success",
+		"Program log: Instruction: Withdraw",
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P success",
+	}))
+}
+
+func TestWithdrawForcesExit(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"signature": "1111111111111111111111111111111111111111111111111111111111111111", "err": nil, "logs": withdrawLogs},
+		}}
+	})
+
+	b := &Bot{
+		wsPool:       newWsPoolFromClients(wsMock.client(t)),
+		pendingCoins: map[string]*Coin{f.mint.String(): coin},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.WatchForGraduation(ctx, coin)
+
+	require.Eventually(t, func() bool {
+		b.pendingCoinsLock.Lock()
+		defer b.pendingCoinsLock.Unlock()
+
+		return coin.migrating
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, exitReasonMigrating, coin.exitReason)
+
+	// pump sells can't fill anymore, so the coin is left for a manual exit
+	require.Empty(t, checkCoinsToSell(b))
+	require.True(t, b.isPendingCoin(coin))
+}
+
+func TestGraduationListenerExitsNearCompletion(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+
+	// a trade of another coin in the same tx is ignored
+	other := &TradeEvent{Mint: solana.NewWallet().PublicKey(), VirtualSolReserves: initialVirtualSolReserves + defaultMigrationThreshold, VirtualTokenReserves: initialVirtualTokenReserves / 2}
+	trade := &TradeEvent{Mint: f.mint, VirtualSolReserves: initialVirtualSolReserves + defaultMigrationThreshold/100*95, VirtualTokenReserves: initialVirtualTokenReserves / 2}
+
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"signature": "1111111111111111111111111111111111111111111111111111111111111111", "err": nil, "logs": pumpLogs(tradeEventLog(other), tradeEventLog(trade))},
+		}}
+	})
+
+	// the coin has no trade tape, the listener checks the curve on its own
+	b := &Bot{
+		wsPool:            newWsPoolFromClients(wsMock.client(t)),
+		exitCurveProgress: 90,
+		pendingCoins:      map[string]*Coin{f.mint.String(): coin},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.WatchForGraduation(ctx, coin)
+
+	require.Eventually(t, func() bool {
+		b.pendingCoinsLock.Lock()
+		defer b.pendingCoinsLock.Unlock()
+
+		return coin.exitReason != ""
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, exitReasonNearCompletion, coin.exitReason)
+	require.False(t, coin.migrating)
+}
@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
-
-	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go/rpc/ws"
 )
 
+// SPL token accounts are laid out as mint (32), owner (32), amount (8), ...
+const tokenAccountAmountOffset = 64
+
+var errNoTokenAccountData = errors.New("No Token Account Data")
+
 type instPair struct {
-	tx   *solana.Transaction
-	meta *rpc.TransactionMeta
+	tx    *solana.Transaction
+	meta  *rpc.TransactionMeta
+	insts []*decodedInst
 }
 
 // HandleBuyCoins is run as a goroutine which keeps waiting for
@@ -24,10 +32,61 @@ type instPair struct {
 // with the coin at the same time
 func (b *Bot) HandleBuyCoins() {
 	for coin := range b.coinsToBuy {
+		b.checkPipelineDepth()
+		if b.skipStaleCoinFromChannel(coin) {
+			continue
+		}
+
 		go b.purchaseCoin(coin)
 	}
 }
 
+// skipStaleCoinFromChannel reports whether a coin dequeued from `coinsToBuy` was picked up more than `maxQueueAge`
+// ago, logging it as discarded. signalIfShouldBuy bounds the time to decide on a coin, this the time it then queued
+func (b *Bot) skipStaleCoinFromChannel(coin *Coin) bool {
+	if b.maxQueueAge <= 0 || coin == nil || coin.pickupTime.IsZero() {
+		return false
+	}
+
+	age := time.Since(coin.pickupTime)
+	if age <= b.maxQueueAge {
+		return false
+	}
+
+	staleQueuedCoins.Inc()
+	b.statusy(fmt.Sprintf("Discarding stale queued coin %s (picked up %s ago)", coin.mintAddr.String(), age.Round(time.Millisecond)))
+	b.logEvent(coin, eventDecision, "skip: stale in buy queue")
+	return true
+}
+
+// signalBuyCoin hands a coin off to HandleBuyCoins, tracking how many coins are waiting on it
+func (b *Bot) signalBuyCoin(coin *Coin) {
+	b.waitingBuySends.Add(1)
+	defer b.waitingBuySends.Add(-1)
+
+	b.checkPipelineDepth()
+	b.coinsToBuy <- coin
+}
+
+// checkPipelineDepth updates the depth gauges of the buy / sell channels, warning when either backs up
+// past `pipelineDepthWarning`. buy depth counts buffered coins plus goroutines blocked sending,
+// so the backlog is visible even with unbuffered channels
+func (b *Bot) checkPipelineDepth() bool {
+	buyDepth := len(b.coinsToBuy) + int(b.waitingBuySends.Load())
+	sellDepth := len(b.coinsToSell)
+
+	coinsToBuyDepth.Set(int64(buyDepth))
+	coinsToSellDepth.Set(int64(sellDepth))
+
+	if buyDepth <= b.pipelineDepthWarning && sellDepth <= b.pipelineDepthWarning {
+		return false
+	}
+
+	pipelineSaturation.Inc()
+	b.statusr(fmt.Sprintf("Pipeline saturated (coinsToBuy=%d, coinsToSell=%d, warning=%d)", buyDepth, sellDepth, b.pipelineDepthWarning))
+	return true
+}
+
 func (b *Bot) purchaseCoin(coin *Coin) {
 	if coin == nil {
 		return
@@ -35,108 +94,573 @@ func (b *Bot) purchaseCoin(coin *Coin) {
 
 	// add in new coin to pending coins
 	b.addNewPendingCoin(coin)
+	go b.recordCreatorLaunch(coin)
+
+	// the coin's exits are acted on as they're triggered, not on a schedule
+	b.goCoin(func() { b.manageSellForCoin(coin.context(), coin) })
 
 	// immediately start listening for a creator sell
-	go b.listenCreatorSell(coin)
+	b.goCoin(func() { b.listenCreatorSell(coin) })
+	b.goCoin(func() { b.WatchForGraduation(coin.context(), coin) })
+	if b.watchCreatorWallet {
+		b.goCoin(func() { b.listenCreatorWallet(coin) })
+	}
 
 	if err := b.BuyCoin(coin); err != nil {
-		b.statusy("Error Buying Coin: " + err.Error())
+		if !errors.Is(err, errShadowBuy) {
+			b.statusy("Error Buying Coin: " + err.Error())
+		}
 		return
 	}
 
 	fmt.Println("Purchased Coin", coin.mintAddr.String())
+
+	if b.maxTradeTapes > 0 {
+		b.goCoin(func() { b.WatchTrades(coin) })
+	}
+}
+
+// goCoin runs a per-coin goroutine, counted by the coinGoroutines gauge so leaks show up
+func (b *Bot) goCoin(fn func()) {
+	coinGoroutines.Add(1)
+	go func() {
+		defer coinGoroutines.Add(-1)
+		fn()
+	}()
 }
 
 func (b *Bot) addNewPendingCoin(coin *Coin) {
 	b.pendingCoinsLock.Lock()
 	defer b.pendingCoinsLock.Unlock()
 
+	if coin.ctx == nil {
+		coin.ctx, coin.cancel = context.WithCancel(context.Background())
+	}
+
+	if coin.sellChecks == nil {
+		coin.sellChecks = make(chan struct{}, 1)
+	}
+
 	mintAddr := coin.mintAddr.String()
 	b.pendingCoins[mintAddr] = coin
 }
 
+// removePendingCoin stops tracking a coin, tearing down its listeners. callers hold pendingCoinsLock
+func (b *Bot) removePendingCoin(mintAddr string, coin *Coin, why string) {
+	fmt.Println("Deleting", coin.mintAddr.String(), "because", why, fmt.Sprintf("(%d coin goroutines live)", coinGoroutines.Value()))
+	coin.stop()
+	coin.prices.reset()
+	delete(b.pendingCoins, mintAddr)
+}
+
 func (b *Bot) listenCreatorSell(coin *Coin) {
 	// subscribe to our creator ATA with our ws client
 	defer coin.setExitedCreatorListenerTrue()
 
-	sub, err := b.wsClient.AccountSubscribe(coin.creatorATA, rpc.CommitmentConfirmed)
+	// set where we lose the subscription, see finishCreatorListener
+	var failed bool
+	defer func() { b.finishCreatorListener(coin, failed) }()
+	b.setCreatorListenerState(coin, listenerActive)
+
+	conn := b.wsPool.assign()
+	client := b.wsPool.client(conn)
+
+	sub, err := client.AccountSubscribe(coin.creatorATA, rpc.CommitmentConfirmed)
 	if err != nil {
 		log.Printf("Failed to subscribe to logs: %v", err)
-		b.setCreatorSold(coin)
+		failed = true
 		return
 	}
 
-	defer sub.Unsubscribe()
+	defer func() { sub.Unsubscribe() }()
+
+	coin.status(fmt.Sprintf("Watching %s for creator sells (%s)", coin.creatorATA.String(), coin.creatorATASource))
+
+	// kept across notifications, so we only ever fetch creator ATA txs we haven't checked
+	cursor := &creatorATACursor{}
 
 	for {
 		// act as signal to fetch latest transactions
-		_, err := sub.Recv()
-		if err != nil {
-			log.Printf("Error receiving AccountSubscribe: %v\n", err)
-			b.setCreatorSold(coin)
+		var notification *ws.AccountResult
+		var err error
+		select {
+		case <-coin.done():
 			return
+		case err = <-sub.Err():
+		case notification = <-sub.Response():
+		}
+
+		if err != nil {
+			log.Printf("Error receiving AccountSubscribe, resubscribing: %v\n", err)
+
+			resubClient, resub, err := b.wsPool.resubscribeAccount(conn, client, coin.creatorATA)
+			if err != nil {
+				// without the subscription we're blind to the creator selling. a ws failure says nothing of the
+				// creator though, so no exit is set here: `deadListenerAction` decides once the listener is dead
+				log.Printf("Failed to resubscribe to creator ATA: %v", err)
+				failed = true
+				return
+			}
+
+			client, sub = resubClient, resub
+
+			// catch up on anything the creator did while we were disconnected
+			if reason, _ := b.checkCreatorATATrans(coin, cursor, 0); reason != "" {
+				b.setCreatorSoldReason(coin, reason)
+				return
+			}
+
+			continue
 		}
 
 		// if we exited BuyCoin & didn't purchase, exit listener
 		// alternatively, if we purchased but don't hold tokens any longer, exit listener
 		if (coin.exitedBuyCoin && !coin.botPurchased) || (coin.botPurchased && !coin.botHoldsTokens()) {
-			fmt.Println("No buy recorded or bot already sold tokens, stopping listener")
+			coin.status("No buy recorded or bot already sold tokens, stopping listener")
 			return
 		}
 
-		// variable which allows us to see if we managed to check ATA activity
-		// if we didn't mark as sold since we cannot trust data we have
-
-		// check 10 times to allow catching up with new data / timeouts, if RPC experiencing issues
-		for checkAttempts := 0; checkAttempts < 10; checkAttempts++ {
-			instPairs, err := b.fetchCreatorATATrans(coin)
-			if err != nil {
-				log.Printf("Error Fetching Creator Transactions, continuing to next loop: " + err.Error() + "\n")
-				continue
+		// once closed, the ATA stops getting notifications, so this is our last chance to catch the exit
+		if creatorATAClosed(notification) {
+			reason := exitReasonCreatorClosedATA
+			if closeSig, ok := b.findCreatorATACloseSig(coin); ok {
+				reason = fmt.Sprintf("%s (%s)", exitReasonCreatorClosedATA, closeSig.String())
 			}
 
-			if b.isSellOrTransfer(instPairs, coin) {
-				b.status(fmt.Sprintf("Detected Sale / Transfer, Marking as sold %s", coin.mintAddr.String()))
+			b.status(fmt.Sprintf("Detected creator ATA closed, Marking as sold %s", coin.mintAddr.String()))
+			b.setCreatorSoldReason(coin, reason)
+			return
+		}
+
+		// the notification carries the token account itself, so a balance drop
+		// lets us react without fetching any transactions
+		if sold, decided := b.checkCreatorBalanceDrop(coin, notification); decided {
+			if sold {
+				b.status(fmt.Sprintf("Detected creator balance drop, Marking as sold %s", coin.mintAddr.String()))
 				b.setCreatorSold(coin)
 				return
 			}
 
-			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+
+		reason, conclusive := b.checkCreatorATATrans(coin, cursor, notification.Context.Slot)
+		if reason != "" {
+			b.setCreatorSoldReason(coin, reason)
+			return
 		}
 
-		fmt.Println("Activity for ATA", coin.creatorATA.String(), "was not sell/transfer")
+		if !conclusive {
+			creatorTxCheckMisses.Inc()
+			b.statusy(fmt.Sprintf("Activity for ATA %s of %s was not sell/transfer", coin.creatorATA.String(), coin.mintAddr.String()))
+		}
 	}
 }
 
+// checkCreatorATATrans fetches the creator ATA's new transactions, retrying until they cover the
+// notification at `notificationSlot` (the RPC may lag behind the ws). reason is the exit reason if the creator
+// sold / transferred / closed the ATA. conclusive is false if we never found what changed the account
+func (b *Bot) checkCreatorATATrans(coin *Coin, cursor *creatorATACursor, notificationSlot uint64) (reason string, conclusive bool) {
+	for checkAttempts := 0; checkAttempts < b.creatorTxCheckAttempts; checkAttempts++ {
+		instPairs, err := b.fetchCreatorATATrans(coin, cursor)
+		if err != nil {
+			log.Printf("Error Fetching Creator Transactions, continuing to next loop: " + err.Error() + "\n")
+			continue
+		}
+
+		if closeSig, ok := findATAClose(instPairs, coin); ok {
+			b.status(fmt.Sprintf("Detected creator ATA close, Marking as sold %s", coin.mintAddr.String()))
+			return fmt.Sprintf("%s (%s)", exitReasonCreatorClosedATA, closeSig.String()), true
+		}
+
+		if b.isSellOrTransfer(instPairs, coin) {
+			// dust, wait for the next notification rather than re-fetching
+			if !b.creatorSoldEnough(coin) {
+				return "", true
+			}
+
+			b.status(fmt.Sprintf("Detected Sale / Transfer, Marking as sold %s", coin.mintAddr.String()))
+			return exitReasonCreatorSold, true
+		}
+
+		// we've checked every tx up to the notification, re-fetching won't show us anything new
+		if cursor.slot >= notificationSlot {
+			return "", false
+		}
+
+		time.Sleep(b.creatorTxCheckInterval)
+	}
+
+	return "", false
+}
+
+// checkCreatorBalanceDrop compares the creator ATA balance in an account notification
+// against the last balance we tracked. `decided` is false when the notification alone
+// can't tell us what happened, in which case we fall back to fetching transactions
+func (b *Bot) checkCreatorBalanceDrop(coin *Coin, notification *ws.AccountResult) (sold bool, decided bool) {
+	balance, err := decodeTokenAccountAmount(notification)
+	if err != nil {
+		return false, false
+	}
+
+	b.pendingCoinsLock.Lock()
+	prevBalance := coin.creatorTokenBalance
+	balanceKnown := coin.creatorBalanceKnown
+
+	coin.creatorTokenBalance = balance
+	coin.creatorBalanceKnown = true
+	if balance > coin.creatorPeakBalance {
+		coin.creatorPeakBalance = balance
+	}
+	b.pendingCoinsLock.Unlock()
+
+	if !balanceKnown {
+		return false, false
+	}
+
+	// creator bought more or only lamports changed
+	if balance >= prevBalance {
+		return false, true
+	}
+
+	dropped := float64(prevBalance-balance) / float64(prevBalance)
+	if dropped >= b.creatorSellDropThreshold {
+		return b.creatorSoldEnough(coin), true
+	}
+
+	return false, false
+}
+
+// creatorSoldEnough checks if the creator has sold / moved at least `creatorDustSellShare` of the most
+// tokens we've seen them hold, so we don't exit when a creator moves a sliver of their bag.
+// comparing against the peak means repeated small sells accumulate until they cross the line
+func (b *Bot) creatorSoldEnough(coin *Coin) bool {
+	b.pendingCoinsLock.Lock()
+	balance, peak, balanceKnown := coin.creatorTokenBalance, coin.creatorPeakBalance, coin.creatorBalanceKnown
+	b.pendingCoinsLock.Unlock()
+
+	// without a tracked balance we can't size the sell, exit to be safe
+	if !balanceKnown || peak == 0 {
+		return true
+	}
+
+	if balance >= peak {
+		return false
+	}
+
+	soldShare := float64(peak-balance) / float64(peak)
+	if soldShare >= b.creatorDustSellShare {
+		return true
+	}
+
+	b.status(fmt.Sprintf("Ignoring creator dust sell on %s (%.2f%% of holdings sold in total, exiting at %.2f%%)", coin.mintAddr.String(), soldShare*100, b.creatorDustSellShare*100))
+	return false
+}
+
+// decodeTokenAccountAmount reads the token amount out of an SPL token account notification
+func decodeTokenAccountAmount(notification *ws.AccountResult) (uint64, error) {
+	if notification == nil || notification.Value.Data == nil {
+		return 0, errNoTokenAccountData
+	}
+
+	data := notification.Value.Data.GetBinary()
+	if len(data) < tokenAccountAmountOffset+8 {
+		return 0, errNoTokenAccountData
+	}
+
+	return binary.LittleEndian.Uint64(data[tokenAccountAmountOffset : tokenAccountAmountOffset+8]), nil
+}
+
 func (c *Coin) setExitedCreatorListenerTrue() {
 	c.exitedCreatorListener = true
+	c.signalSellCheck()
+}
+
+// states of a coin's creator listener (listenCreatorSell), empty until it starts
+const (
+	listenerActive             = "active"
+	listenerExitedClean        = "exited-clean"        // reached a verdict, or we no longer hold the coin
+	listenerExitedError        = "exited-error"        // lost its subscription
+	listenerExitedUndetermined = "exited-undetermined" // stopped while we hold the coin, without a verdict
+)
+
+// finishCreatorListener records how the creator listener of a coin exited. unless it's exited-clean,
+// a coin we still hold is no longer protected from the creator selling, see handleDeadListener
+func (b *Bot) finishCreatorListener(coin *Coin, failed bool) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	coin.listenerState = coin.listenerExitState(failed)
+	if coin.listenerState != listenerExitedClean {
+		b.statusr(fmt.Sprintf("Creator listener of %s stopped without a verdict (%s)", coin.mintAddr.String(), coin.listenerState))
+	}
+}
+
+// finishWalletListener records how the creator wallet listener of a coin exited, like finishCreatorListener
+func (b *Bot) finishWalletListener(coin *Coin, failed bool) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	coin.walletListenerState = coin.listenerExitState(failed)
+	if coin.walletListenerState != listenerExitedClean {
+		b.statusr(fmt.Sprintf("Creator wallet listener of %s stopped without a verdict (%s)", coin.mintAddr.String(), coin.walletListenerState))
+	}
+}
+
+// listenerExitState is the state a listener of the coin exited in. callers hold pendingCoinsLock
+func (c *Coin) listenerExitState(failed bool) string {
+	switch {
+	case failed:
+		return listenerExitedError
+	case c.botHoldsTokens() && c.exitReason == "" && c.context().Err() == nil:
+		return listenerExitedUndetermined
+	default:
+		return listenerExitedClean
+	}
+}
+
+func (b *Bot) setCreatorListenerState(coin *Coin, state string) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	coin.listenerState = state
+}
+
+func (b *Bot) creatorListenerState(coin *Coin) string {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	return coin.listenerState
+}
+
+func (b *Bot) setWalletListenerState(coin *Coin, state string) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	coin.walletListenerState = state
+}
+
+func (b *Bot) walletListenerState(coin *Coin) string {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	return coin.walletListenerState
+}
+
+// listenerDead reports whether either creator listener of the coin stopped without a verdict. callers hold pendingCoinsLock
+func (c *Coin) listenerDead() bool {
+	return isDeadListenerState(c.listenerState) || isDeadListenerState(c.walletListenerState)
+}
+
+func isDeadListenerState(state string) bool {
+	return state == listenerExitedError || state == listenerExitedUndetermined
+}
+
+// listenCreatorWallet watches SOL moving through the creator's wallet itself. Creators who sell
+// from a different wallet usually route proceeds back here, or drain the wallet right before dumping
+func (b *Bot) listenCreatorWallet(coin *Coin) {
+	// set where we lose the subscription, see finishWalletListener
+	var failed bool
+	defer func() { b.finishWalletListener(coin, failed) }()
+	b.setWalletListenerState(coin, listenerActive)
+
+	balance, err := b.rpcClient.GetBalance(coin.context(), coin.creator, rpc.CommitmentConfirmed)
+	if err != nil {
+		b.statusr("Failed to fetch creator balance, not watching wallet: " + err.Error())
+		failed = true
+		return
+	}
+
+	conn := b.wsPool.assign()
+	client := b.wsPool.client(conn)
+
+	sub, err := client.AccountSubscribe(coin.creator, rpc.CommitmentConfirmed)
+	if err != nil {
+		log.Printf("Failed to subscribe to creator wallet: %v", err)
+		failed = true
+		return
+	}
+
+	defer func() { sub.Unsubscribe() }()
+
+	prevLamports := balance.Value
+	for {
+		var notification *ws.AccountResult
+		var err error
+		select {
+		case <-coin.done():
+			return
+		case err = <-sub.Err():
+		case notification = <-sub.Response():
+		}
+
+		if err != nil {
+			log.Printf("Error receiving creator wallet AccountSubscribe, resubscribing: %v\n", err)
+
+			// anything moved while we were disconnected still shows against prevLamports
+			resubClient, resub, err := b.wsPool.resubscribeAccount(conn, client, coin.creator)
+			if err != nil {
+				log.Printf("Failed to resubscribe to creator wallet: %v", err)
+				failed = true
+				return
+			}
+
+			client, sub = resubClient, resub
+
+			continue
+		}
+
+		// same exit conditions as the creator ATA listener, plus the coin no longer being tracked
+		if (coin.exitedBuyCoin && !coin.botPurchased) || (coin.botPurchased && !coin.botHoldsTokens()) || !b.isPendingCoin(coin) {
+			fmt.Println("No buy recorded or bot already sold tokens, stopping creator wallet listener")
+			return
+		}
+
+		lamports := notification.Value.Lamports
+		if reason := b.creatorWalletExitReason(prevLamports, lamports); reason != "" {
+			b.status(fmt.Sprintf("Detected creator wallet activity (%s), Marking to sell %s", reason, coin.mintAddr.String()))
+			b.triggerExit(coin, reason)
+			return
+		}
+
+		prevLamports = lamports
+	}
+}
+
+// creatorWalletExitReason returns the exit reason for a change in the
+// creator wallet's lamports, or "" if the change looks benign
+func (b *Bot) creatorWalletExitReason(prevLamports, lamports uint64) string {
+	inflowLamports := uint64(b.creatorWalletInflowSol * float64(solana.LAMPORTS_PER_SOL))
+	drainedLamports := uint64(b.creatorWalletDrainedSol * float64(solana.LAMPORTS_PER_SOL))
+
+	if lamports > prevLamports && lamports-prevLamports >= inflowLamports {
+		return exitReasonCreatorInflow
+	}
+
+	if prevLamports > drainedLamports && lamports <= drainedLamports {
+		return exitReasonCreatorDrained
+	}
+
+	return ""
+}
+
+func (b *Bot) isPendingCoin(coin *Coin) bool {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	_, ok := b.pendingCoins[coin.mintAddr.String()]
+	return ok
 }
 
 // update that creator has sold (used on actual sell / transfer & err)
 func (b *Bot) setCreatorSold(coin *Coin) {
+	b.setCreatorSoldReason(coin, exitReasonCreatorSold)
+}
+
+// setCreatorSoldReason is setCreatorSold with a more specific exit reason
+func (b *Bot) setCreatorSoldReason(coin *Coin, reason string) {
 	b.pendingCoinsLock.Lock()
 	defer b.pendingCoinsLock.Unlock()
 
 	mintAddr := coin.mintAddr.String()
-	if _, ok := b.pendingCoins[mintAddr]; ok {
-		b.pendingCoins[mintAddr].creatorSold = true
+	if pendingCoin, ok := b.pendingCoins[mintAddr]; ok {
+		firstSell := !pendingCoin.creatorSold
+		if firstSell {
+			go b.recordCreatorSell(pendingCoin, newCreatorSell(pendingCoin))
+		}
+
+		pendingCoin.creatorSold = true
+		pendingCoin.setExitReason(reason)
+
+		if pendingCoin.cancelBuy != nil {
+			pendingCoin.cancelBuy(errCreatorSoldDuringBuy)
+		}
+
+		if firstSell {
+			b.logEventLocked(pendingCoin, eventCreatorSold, reason)
+		}
+	}
+}
+
+// findCreatorATACloseSig fetches the creator ATA's latest transactions, looking for the one which closed it
+func (b *Bot) findCreatorATACloseSig(coin *Coin) (solana.Signature, bool) {
+	instPairs, err := b.fetchCreatorATATrans(coin, nil)
+	if err != nil {
+		return solana.Signature{}, false
+	}
+
+	return findATAClose(instPairs, coin)
+}
+
+// triggerExit marks a pending coin to be sold for `reason`
+func (b *Bot) triggerExit(coin *Coin, reason string) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	mintAddr := coin.mintAddr.String()
+	if pendingCoin, ok := b.pendingCoins[mintAddr]; ok {
+		pendingCoin.setExitReason(reason)
+	}
+}
+
+// setMigrating marks a pending coin whose bonding curve liquidity pump withdrew for migration to Raydium.
+// pump sells can't fill from here on, so rather than burning fees on them we leave the coin for a manual exit
+func (b *Bot) setMigrating(coin *Coin) {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	pendingCoin, ok := b.pendingCoins[coin.mintAddr.String()]
+	if !ok || pendingCoin.migrating {
+		return
+	}
+
+	pendingCoin.migrating = true
+	pendingCoin.setExitReason(exitReasonMigrating)
+
+	if pendingCoin.botHoldsTokens() {
+		b.statusr(fmt.Sprintf("%s is migrating to Raydium while we hold %s tokens, sell it manually", coin.mintAddr.String(), pendingCoin.tokensHeld.String()))
+	}
+}
+
+// setExitReason keeps the first reason we decided to exit a coin for
+func (c *Coin) setExitReason(reason string) {
+	if c.exitReason == "" {
+		c.exitReason = reason
+		c.signalSellCheck()
 	}
 }
 
-// fetchCreatorATATrans pulls latest 3 transactions after we detect change
-// to a creatorATA account. It returns instruction pair containing tx data, along with
-// meta, so we can fetch innerinstructions for the tx
-func (b *Bot) fetchCreatorATATrans(coin *Coin) ([]instPair, error) {
+// creatorATACursor is the newest creator ATA transaction we've fetched
+type creatorATACursor struct {
+	sig  solana.Signature
+	slot uint64
+}
+
+// fetchCreatorATATrans pulls up to `creatorAtaLookbackSigs` transactions of the creatorATA newer than
+// `cursor` (all of the latest if it's nil or empty), advancing it. It returns instruction pairs containing
+// tx data, along with meta, so we can fetch innerinstructions for the tx
+func (b *Bot) fetchCreatorATATrans(coin *Coin, cursor *creatorATACursor) ([]instPair, error) {
 	var instPairs []instPair
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*900)
+	ctx, cancel := context.WithTimeout(context.Background(), b.creatorTxFetchTimeout)
 	defer cancel()
 
-	latestTransResps, err := b.fetchNLastTrans(3, coin.creatorATA.String(), ctx)
+	var until solana.Signature
+	if cursor != nil {
+		until = cursor.sig
+	}
+
+	signatures, latestTransResps, err := b.fetchTransUntil(ctx, b.creatorAtaLookbackSigs, coin.creatorATA.String(), until)
 	if err != nil {
 		return nil, err
 	}
 
+	// signatures come newest first
+	if cursor != nil && len(signatures) > 0 {
+		cursor.sig = signatures[0].Signature
+		cursor.slot = signatures[0].Slot
+	}
+
 	for _, resp := range latestTransResps {
 		var transResult *rpc.GetTransactionResult = &rpc.GetTransactionResult{}
 		if err := resp.GetObject(&transResult); err != nil {
@@ -153,66 +677,183 @@ func (b *Bot) fetchCreatorATATrans(coin *Coin) ([]instPair, error) {
 		}
 
 		meta := transResult.Meta
-		instPairs = append(instPairs, instPair{tx: tx, meta: meta})
+		instPairs = append(instPairs, instPair{tx: tx, meta: meta, insts: decodeInstructions(tx)})
 	}
 
 	return instPairs, nil
 }
 
+// isSellOrTransfer checks the creator ATA's latest transactions for the creator selling or moving tokens.
+// token balance deltas in the tx meta are the source of truth, since they catch sells regardless of
+// instruction shape (aggregators, CPIs). the instruction based detectors corroborate them
 func (b *Bot) isSellOrTransfer(instPairs []instPair, coin *Coin) bool {
-	// immediately check for a sell
+	var balanceDecreased bool
+	for _, instPair := range instPairs {
+		if b.detectBalanceDecrease(instPair, coin) {
+			balanceDecreased = true
+			break
+		}
+	}
+
+	instructionDetected := detectSell(instPairs)
 	for _, instPair := range instPairs {
 		if detectTransfer(instPair, coin) {
+			instructionDetected = true
+		}
+	}
+
+	if balanceDecreased && !instructionDetected {
+		b.status(fmt.Sprintf("Creator balance dropped without a sell / transfer instruction (aggregator or CPI) %s", coin.mintAddr.String()))
+	}
+
+	return balanceDecreased || instructionDetected
+}
+
+// detectBalanceDecrease compares PreTokenBalances and PostTokenBalances in the tx meta for the creator's
+// holdings of the coin (the creator ATA, or any token account owned by the creator), returning true
+// if any of them dropped by at least `creatorMetaSellThreshold`
+func (b *Bot) detectBalanceDecrease(pair instPair, coin *Coin) bool {
+	if pair.meta == nil || pair.tx == nil {
+		return false
+	}
+
+	accountKeys := txAccountKeys(pair.tx, pair.meta)
+	for _, pre := range pair.meta.PreTokenBalances {
+		if !pre.Mint.Equals(coin.mintAddr) {
+			continue
+		}
+
+		isCreatorATA := int(pre.AccountIndex) < len(accountKeys) && accountKeys[pre.AccountIndex].Equals(coin.creatorATA)
+		isCreatorOwned := pre.Owner != nil && pre.Owner.Equals(coin.creator)
+		if !isCreatorATA && !isCreatorOwned {
+			continue
+		}
+
+		preAmount := tokenBalanceAmount(pre)
+		if preAmount == 0 {
+			continue
+		}
+
+		// a closed account has no post balance, so treat it as emptied
+		var postAmount uint64
+		for _, post := range pair.meta.PostTokenBalances {
+			if post.AccountIndex == pre.AccountIndex {
+				postAmount = tokenBalanceAmount(post)
+				break
+			}
+		}
+
+		if postAmount >= preAmount {
+			continue
+		}
+
+		if float64(preAmount-postAmount)/float64(preAmount) >= b.creatorMetaSellThreshold {
 			return true
 		}
 	}
 
-	return detectSell(instPairs)
+	return false
+}
+
+// txAccountKeys returns the keys token balances index into: the static account keys
+// followed by addresses loaded from lookup tables
+func txAccountKeys(tx *solana.Transaction, meta *rpc.TransactionMeta) solana.PublicKeySlice {
+	accountKeys := append(solana.PublicKeySlice{}, tx.Message.AccountKeys...)
+	accountKeys = append(accountKeys, meta.LoadedAddresses.Writable...)
+	return append(accountKeys, meta.LoadedAddresses.ReadOnly...)
+}
+
+func tokenBalanceAmount(balance rpc.TokenBalance) uint64 {
+	if balance.UiTokenAmount == nil {
+		return 0
+	}
+
+	amount, err := strconv.ParseUint(balance.UiTokenAmount.Amount, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return amount
 }
 
 // detectSell uses the instruction pairs from the creator ATA detected tx
 // to see if a sell was detected in those instructions
 func detectSell(instPairs []instPair) bool {
 	for _, instPair := range instPairs {
-		for _, instruction := range instPair.tx.Message.Instructions {
-			// Find the accounts of this instruction:
-			accounts, err := instruction.ResolveInstructionAccounts(&instPair.tx.Message)
-			if err != nil {
-				continue
+		for _, inst := range instPair.insts {
+			if inst.pumpName() == "sell" {
+				fmt.Println("*** Found a sell in the decodedInstructions")
+				return true
 			}
+		}
+	}
 
-			instr, err := pump.DecodeInstruction(accounts, instruction.Data)
-			if err != nil {
-				continue
-			}
+	return false
+}
 
-			data, err := instr.Data()
-			if err != nil || len(data) < 8 {
-				continue
+func detectTransfer(pair instPair, coin *Coin) bool {
+	for _, decodedInstruction := range decodeInnerTokenInstructions(pair) {
+		// TODO: See if this is actually necessary. Would burn appear as transfer?
+		// if _, ok := decodedInstruction.Impl.(*token.Burn); ok {
+		// 	fmt.Println("User burned tokens")
+		// 	return false
+		// }
+
+		// Check for a transfer instruction
+		if transferInst, ok := decodedInstruction.Impl.(*token.Transfer); ok {
+			sender := transferInst.GetSourceAccount().PublicKey.String()
+			if sender == coin.creatorATA.String() {
+				return true
 			}
+		}
+	}
 
-			typeID := data[0:8]
+	return false
+}
+
+// findATAClose looks for a CloseAccount of the creator ATA, either top-level or inner,
+// returning the signature of the tx which closed it
+func findATAClose(instPairs []instPair, coin *Coin) (solana.Signature, bool) {
+	for _, pair := range instPairs {
+		if pair.tx == nil || len(pair.tx.Signatures) == 0 {
+			continue
+		}
+
+		tokenInsts := decodeInnerTokenInstructions(pair)
+		for _, inst := range pair.insts {
+			if inst.token != nil {
+				tokenInsts = append(tokenInsts, inst.token)
+			}
+		}
 
-			for k, v := range pumpIDs {
-				if k.Equal(typeID) {
-					switch v.name {
-					case "sell":
-						fmt.Println("*** Found a sell in the decodedInstructions")
-						return true
-					}
-				}
+		for _, tokenInst := range tokenInsts {
+			if closeInst, ok := tokenInst.Impl.(*token.CloseAccount); ok && closeInst.GetAccount().PublicKey.Equals(coin.creatorATA) {
+				return pair.tx.Signatures[0], true
 			}
 		}
 	}
 
-	return false
+	return solana.Signature{}, false
 }
 
-func detectTransfer(pair instPair, coin *Coin) bool {
-	if pair.meta == nil || len(pair.meta.InnerInstructions) == 0 {
+// creatorATAClosed checks if an account notification is for the creator ATA being closed,
+// which leaves the account with no lamports and handed back to the system program
+func creatorATAClosed(notification *ws.AccountResult) bool {
+	if notification == nil {
 		return false
 	}
 
+	return notification.Value.Lamports == 0 || !notification.Value.Owner.Equals(solana.TokenProgramID)
+}
+
+// decodeInnerTokenInstructions decodes the token program's inner instructions of a tx
+func decodeInnerTokenInstructions(pair instPair) []*token.Instruction {
+	var tokenInsts []*token.Instruction
+
+	if pair.meta == nil || len(pair.meta.InnerInstructions) == 0 {
+		return nil
+	}
+
 	for _, inst := range pair.meta.InnerInstructions {
 		for _, innerInst := range inst.Instructions {
 			progKey, err := pair.tx.ResolveProgramIDIndex(innerInst.ProgramIDIndex)
@@ -234,22 +875,9 @@ func detectTransfer(pair instPair, coin *Coin) bool {
 				continue
 			}
 
-			// TODO: See if this is actually necessary. Would burn appear as transfer?
-			// if _, ok := decodedInstruction.Impl.(*token.Burn); ok {
-			// 	fmt.Println("User burned tokens")
-			// 	return false
-			// }
-
-			// Check for a transfer instruction
-			if transferInst, ok := decodedInstruction.Impl.(*token.Transfer); ok {
-				sender := transferInst.GetSourceAccount().PublicKey.String()
-				if sender == coin.creatorATA.String() {
-					return true
-				}
-			}
-
+			tokenInsts = append(tokenInsts, decodedInstruction)
 		}
 	}
 
-	return false
+	return tokenInsts
 }
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenAccountNotification builds an AccountSubscribe notification for an SPL token account holding `amount`
+func tokenAccountNotification(amount uint64) *ws.AccountResult {
+	data := make([]byte, 165)
+	binary.LittleEndian.PutUint64(data[tokenAccountAmountOffset:], amount)
+
+	notification := &ws.AccountResult{}
+	notification.Value.Data = rpc.DataBytesOrJSONFromBytes(data)
+
+	return notification
+}
+
+func TestCheckCreatorBalanceDrop(t *testing.T) {
+	b := newBaseBot()
+	coin := &Coin{creatorTokenBalance: 1000, creatorBalanceKnown: true}
+
+	// creator bought more, nothing to classify
+	sold, decided := b.checkCreatorBalanceDrop(coin, tokenAccountNotification(1200))
+	require.False(t, sold)
+	require.True(t, decided)
+	require.Equal(t, uint64(1200), coin.creatorTokenBalance)
+
+	// drop under the threshold falls back to fetching transactions
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(1150))
+	require.False(t, sold)
+	require.False(t, decided)
+
+	// large drop is a sell straight from the notification
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(100))
+	require.True(t, sold)
+	require.True(t, decided)
+
+	// undecodable notifications fall back as well
+	sold, decided = b.checkCreatorBalanceDrop(coin, &ws.AccountResult{})
+	require.False(t, sold)
+	require.False(t, decided)
+}
+
+func TestCheckCreatorBalanceDropUnknownBalance(t *testing.T) {
+	b := newBaseBot()
+	coin := &Coin{}
+
+	sold, decided := b.checkCreatorBalanceDrop(coin, tokenAccountNotification(500))
+	require.False(t, sold)
+	require.False(t, decided)
+	require.True(t, coin.creatorBalanceKnown)
+
+	// a small first drop still needs its transactions fetched
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(499))
+	require.False(t, sold)
+	require.False(t, decided)
+
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(200))
+	require.True(t, sold)
+	require.True(t, decided)
+}
+
+func TestCreatorWalletExitReason(t *testing.T) {
+	b := &Bot{creatorWalletInflowSol: 1, creatorWalletDrainedSol: 0.01}
+
+	// fees & small transfers are benign
+	require.Equal(t, "", b.creatorWalletExitReason(2e9, 1.99e9))
+	require.Equal(t, "", b.creatorWalletExitReason(2e9, 2.5e9))
+
+	require.Equal(t, exitReasonCreatorInflow, b.creatorWalletExitReason(2e9, 3.5e9))
+	require.Equal(t, exitReasonCreatorDrained, b.creatorWalletExitReason(2e9, 5e6))
+
+	// already near empty, nothing left to drain
+	require.Equal(t, "", b.creatorWalletExitReason(5e6, 1e6))
+}
+
+func TestAggregatorSellDetectedFromMeta(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, creatorATA: f.creatorATA}
+	b := newBaseBot()
+
+	sell := aggregatorSellPair(t, f, 1_000_000, 0)
+
+	// instruction based detectors miss the aggregator route
+	require.False(t, detectSell([]instPair{sell}))
+	require.False(t, detectTransfer(sell, coin))
+
+	require.True(t, b.detectBalanceDecrease(sell, coin))
+	require.True(t, b.isSellOrTransfer([]instPair{sell}, coin))
+
+	// drops under the threshold aren't a sell
+	require.False(t, b.isSellOrTransfer([]instPair{aggregatorSellPair(t, f, 1_000_000, 950_000)}, coin))
+
+	// closed ATA, no post balance at all
+	closed := aggregatorSellPair(t, f, 1_000_000, 0)
+	closed.meta.PostTokenBalances = nil
+	require.True(t, b.detectBalanceDecrease(closed, coin))
+
+	// balances of other mints are ignored
+	otherMint := newLaunchFixture(t)
+	require.False(t, b.detectBalanceDecrease(sell, &Coin{mintAddr: otherMint.mint, creator: f.creator, creatorATA: f.creatorATA}))
+}
+
+func TestCreatorBuyIsNotMetaSell(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, creatorATA: f.creatorATA}
+	b := newBaseBot()
+
+	buy := aggregatorSellPair(t, f, 1_000_000, 0)
+	buy.meta.PreTokenBalances, buy.meta.PostTokenBalances = buy.meta.PostTokenBalances, buy.meta.PreTokenBalances
+
+	require.False(t, b.detectBalanceDecrease(buy, coin))
+}
+
+func TestFindATAClose(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, creatorATA: f.creatorATA}
+
+	// creator closes their ATA in a standalone tx
+	closeTx := newTestTx(t, f.creator, token.NewCloseAccountInstruction(f.creatorATA, f.creator, f.creator, nil).Build())
+	closeTx.Signatures = []solana.Signature{{1}}
+
+	closeSig, ok := findATAClose([]instPair{{tx: closeTx, insts: decodeInstructions(closeTx)}}, coin)
+	require.True(t, ok)
+	require.Equal(t, closeTx.Signatures[0], closeSig)
+
+	// sell & close in the same aggregator tx, where the close is an inner instruction
+	sell := aggregatorSellPair(t, f, 1_000_000, 0)
+	sell.tx.Signatures = []solana.Signature{{2}}
+	closeInner := compileInner(t, sell.tx, token.NewCloseAccountInstruction(f.creatorATA, f.creator, f.creator, nil).Build())
+	sell.meta.InnerInstructions[0].Instructions = append(sell.meta.InnerInstructions[0].Instructions, closeInner)
+
+	closeSig, ok = findATAClose([]instPair{sell}, coin)
+	require.True(t, ok)
+	require.Equal(t, sell.tx.Signatures[0], closeSig)
+
+	// closing some other token account isn't a signal
+	otherATA := solana.NewWallet().PublicKey()
+	otherTx := newTestTx(t, f.creator, token.NewCloseAccountInstruction(otherATA, f.creator, f.creator, nil).Build())
+	otherTx.Signatures = []solana.Signature{{3}}
+
+	_, ok = findATAClose([]instPair{{tx: otherTx, insts: decodeInstructions(otherTx)}}, coin)
+	require.False(t, ok)
+}
+
+func TestCreatorATAClosed(t *testing.T) {
+	open := tokenAccountNotification(1000)
+	open.Value.Lamports = 2039280
+	open.Value.Owner = solana.TokenProgramID
+	require.False(t, creatorATAClosed(open))
+
+	closed := &ws.AccountResult{}
+	closed.Value.Owner = solana.SystemProgramID
+	require.True(t, creatorATAClosed(closed))
+
+	// lamports drained but not yet reassigned
+	drained := tokenAccountNotification(0)
+	drained.Value.Owner = solana.TokenProgramID
+	require.True(t, creatorATAClosed(drained))
+}
+
+func TestSetCreatorSoldReason(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint}
+	b := &Bot{pendingCoins: map[string]*Coin{f.mint.String(): coin}}
+
+	b.setCreatorSoldReason(coin, exitReasonCreatorClosedATA+" (sig)")
+	require.True(t, coin.creatorSold)
+	require.Equal(t, exitReasonCreatorClosedATA+" (sig)", coin.exitReason)
+}
+
+func TestCheckPipelineDepthWarnsPastThreshold(t *testing.T) {
+	b := &Bot{
+		coinsToBuy:           make(chan *Coin, 4),
+		coinsToSell:          make(chan string, 4),
+		pipelineDepthWarning: 2,
+	}
+
+	saturations := pipelineSaturation.Value()
+
+	b.coinsToBuy <- &Coin{}
+	b.coinsToBuy <- &Coin{}
+	require.False(t, b.checkPipelineDepth())
+	require.Equal(t, int64(2), coinsToBuyDepth.Value())
+
+	// third coin pushes the buy side past the threshold
+	b.coinsToBuy <- &Coin{}
+	require.True(t, b.checkPipelineDepth())
+	require.Equal(t, int64(3), coinsToBuyDepth.Value())
+	require.Equal(t, saturations+1, pipelineSaturation.Value())
+
+	// senders blocked on a full channel count towards the depth too
+	b.coinsToBuy <- &Coin{}
+	go b.signalBuyCoin(&Coin{})
+	require.Eventually(t, func() bool { return b.waitingBuySends.Load() == 1 }, time.Second, time.Millisecond)
+	require.True(t, b.checkPipelineDepth())
+	require.Equal(t, int64(5), coinsToBuyDepth.Value())
+
+	// draining brings it back under
+	for i := 0; i < 4; i++ {
+		<-b.coinsToBuy
+	}
+	require.Eventually(t, func() bool { return b.waitingBuySends.Load() == 0 }, time.Second, time.Millisecond)
+	require.Len(t, b.coinsToBuy, 1)
+	require.False(t, b.checkPipelineDepth())
+}
+
+func TestCreatorDustSellsAccumulate(t *testing.T) {
+	b := &Bot{creatorDustSellShare: 0.05}
+	coin := &Coin{creatorTokenBalance: 1_000_000, creatorPeakBalance: 1_000_000, creatorBalanceKnown: true}
+
+	// 1% test transfer to an exchange is ignored
+	sold, decided := b.checkCreatorBalanceDrop(coin, tokenAccountNotification(990_000))
+	require.False(t, sold)
+	require.True(t, decided)
+
+	// another 2%, still under 5% in total
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(970_000))
+	require.False(t, sold)
+	require.True(t, decided)
+
+	// 3% more crosses the line
+	sold, decided = b.checkCreatorBalanceDrop(coin, tokenAccountNotification(940_000))
+	require.True(t, sold)
+	require.True(t, decided)
+}
+
+func TestCreatorSoldEnough(t *testing.T) {
+	b := &Bot{creatorDustSellShare: 0.05}
+
+	// buying back above the peak raises the bar
+	coin := &Coin{creatorTokenBalance: 960_000, creatorPeakBalance: 1_000_000, creatorBalanceKnown: true}
+	b.checkCreatorBalanceDrop(coin, tokenAccountNotification(2_000_000))
+	require.Equal(t, uint64(2_000_000), coin.creatorPeakBalance)
+	coin.creatorTokenBalance = 1_920_000
+	require.False(t, b.creatorSoldEnough(coin))
+
+	// unknown holdings, can't size the sell
+	require.True(t, b.creatorSoldEnough(&Coin{}))
+	require.True(t, b.creatorSoldEnough(&Coin{creatorBalanceKnown: true}))
+}
+
+func TestDetectSellInRugFixture(t *testing.T) {
+	result, tx := decodeTxFixture(t, "rug-tx.json")
+	pair := instPair{tx: tx, meta: result.Meta, insts: decodeInstructions(tx)}
+
+	require.True(t, detectSell([]instPair{pair}))
+
+	// the meta alone is enough to flag the full exit
+	coin := fixtureCoin(t)
+	b := newBaseBot()
+	require.True(t, b.detectBalanceDecrease(pair, coin))
+
+	_, createTx := decodeTxFixture(t, "create-tx.json")
+	require.False(t, detectSell([]instPair{{tx: createTx, insts: decodeInstructions(createTx)}}))
+}
+
+// newCreatorATAMockRPC serves the creator ATA history `sigs` (newest first, with their slots), each of which
+// is a creator buy. getSignaturesForAddress honours `until`, like a real node
+func newCreatorATAMockRPC(t *testing.T, f *launchFixture, sigs []solana.Signature, slots []uint64) *mockRPC {
+	buyTx := newTestTx(t, f.creator, f.buyInst(1000, 1e9))
+
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		var opts struct {
+			Until string `json:"until"`
+		}
+		require.NoError(t, json.Unmarshal(params[1], &opts))
+
+		var result []map[string]interface{}
+		for i, sig := range sigs {
+			if sig.String() == opts.Until {
+				break
+			}
+			result = append(result, map[string]interface{}{"signature": sig.String(), "slot": slots[i]})
+		}
+
+		return result, nil
+	})
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return txResult(t, buyTx), nil
+	})
+
+	return mock
+}
+
+func untilParam(t *testing.T, call mockRPCRequest) string {
+	var opts struct {
+		Until string `json:"until"`
+	}
+	require.NoError(t, json.Unmarshal(call.Params[1], &opts))
+
+	return opts.Until
+}
+
+func TestCheckCreatorATATransCursor(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, creatorATA: f.creatorATA}
+
+	sigs := []solana.Signature{{3}, {2}, {1}}
+	mock := newCreatorATAMockRPC(t, f, sigs, []uint64{30, 20, 10})
+
+	b := &Bot{
+		rpcClient:              mock.client(),
+		jrpcClient:             mock.jsonrpcClient(),
+		creatorAtaLookbackSigs: 3,
+		creatorTxCheckAttempts: 10,
+		creatorTxFetchTimeout:  time.Second,
+	}
+
+	// the fetched txs already reach the notification's slot, so one fetch is enough
+	cursor := &creatorATACursor{}
+	reason, conclusive := b.checkCreatorATATrans(coin, cursor, 30)
+	require.Empty(t, reason)
+	require.False(t, conclusive)
+	require.Equal(t, creatorATACursor{sig: sigs[0], slot: 30}, *cursor)
+	require.Len(t, mock.callsTo("getSignaturesForAddress"), 1)
+	require.Len(t, mock.callsTo("getTransaction"), 3)
+
+	// a later notification only fetches signatures newer than the cursor, retrying until attempts run out
+	reason, conclusive = b.checkCreatorATATrans(coin, cursor, 40)
+	require.Empty(t, reason)
+	require.False(t, conclusive)
+
+	calls := mock.callsTo("getSignaturesForAddress")
+	require.Len(t, calls, 11)
+	for _, call := range calls[1:] {
+		require.Equal(t, sigs[0].String(), untilParam(t, call))
+	}
+
+	// nothing new to fetch, so no more getTransaction calls
+	require.Len(t, mock.callsTo("getTransaction"), 3)
+}
+
+func TestRemovedCoinStopsListeners(t *testing.T) {
+	f := newLaunchFixture(t)
+
+	// subscriptions which never notify, so only the coin's removal can end the listeners
+	wsMock := newMockWS(t)
+	wsMock.handle("accountSubscribe", func(params []json.RawMessage) []interface{} { return nil })
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} { return nil })
+
+	mock := newMockRPC(t)
+	mock.handle("getBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": 1_000_000_000}, nil
+	})
+
+	b := &Bot{
+		rpcClient:    mock.client(),
+		wsPool:       newWsPoolFromClients(wsMock.client(t)),
+		pendingCoins: make(map[string]*Coin),
+	}
+
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, creatorATA: f.creatorATA}
+	b.addNewPendingCoin(coin)
+
+	baseline := coinGoroutines.Value()
+	b.goCoin(func() { b.listenCreatorSell(coin) })
+	b.goCoin(func() { b.WatchForGraduation(coin.context(), coin) })
+	b.goCoin(func() { b.listenCreatorWallet(coin) })
+
+	require.Equal(t, baseline+3, coinGoroutines.Value())
+	require.Never(t, func() bool { return coinGoroutines.Value() < baseline+3 }, 200*time.Millisecond, 20*time.Millisecond)
+
+	// we never bought, so the coin is deleted on the next pass
+	coin.exitedBuyCoin = true
+	require.Empty(t, checkCoinsToSell(b))
+	require.False(t, b.isPendingCoin(coin))
+
+	require.Eventually(t, func() bool { return coinGoroutines.Value() <= baseline }, time.Second, 10*time.Millisecond)
+	require.True(t, coin.exitedCreatorListener)
+}
+
+func TestFinishCreatorListener(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(coin *Coin)
+		failed bool
+		state  string
+	}{
+		{name: "lost subscription", failed: true, state: listenerExitedError},
+		{name: "held without verdict", state: listenerExitedUndetermined},
+		{name: "verdict reached", setup: func(coin *Coin) { coin.exitReason = exitReasonCreatorSold }, state: listenerExitedClean},
+		{name: "no longer held", setup: func(coin *Coin) { coin.tokensHeld = big.NewInt(0) }, state: listenerExitedClean},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+			if tt.setup != nil {
+				tt.setup(coin)
+			}
+
+			b := &Bot{}
+			b.finishCreatorListener(coin, tt.failed)
+			require.Equal(t, tt.state, b.creatorListenerState(coin))
+		})
+	}
+}
+
+func TestCreatorListenerFailureIsNotARug(t *testing.T) {
+	wsMock := newMockWS(t)
+	client := wsMock.client(t)
+	client.Close()
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), creator: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	b := &Bot{wsPool: newWsPoolFromClients(client), pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	b.listenCreatorSell(coin)
+
+	// losing the subscription isn't recorded as the creator selling, it's left to `deadListenerAction`
+	require.Equal(t, listenerExitedError, b.creatorListenerState(coin))
+	require.False(t, coin.creatorSold)
+	require.Empty(t, coin.exitReason)
+
+	b.deadListenerAction = deadListenerExit
+	require.Equal(t, []*Coin{coin}, checkCoinsToSell(b))
+	require.Equal(t, exitReasonListenerDied, coin.exitReason)
+}
+
+func TestCreatorWalletListenerFailureIsRecorded(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getBalance", func(params []json.RawMessage) (interface{}, error) {
+		return nil, errors.New("rate limited")
+	})
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), creator: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	b := &Bot{rpcClient: mock.client(), pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}, deadListenerAction: deadListenerRestart}
+
+	b.listenCreatorWallet(coin)
+	require.Equal(t, listenerExitedError, b.walletListenerState(coin))
+
+	// restarting only restarts the wallet listener, which fails again
+	require.Empty(t, checkCoinsToSell(b))
+	require.Empty(t, coin.exitReason)
+	require.Empty(t, b.creatorListenerState(coin))
+	require.Eventually(t, func() bool { return len(mock.callsTo("getBalance")) == 2 }, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return b.walletListenerState(coin) == listenerExitedError }, time.Second, 10*time.Millisecond)
+
+	b.deadListenerAction = deadListenerExit
+	require.Equal(t, []*Coin{coin}, checkCoinsToSell(b))
+	require.Equal(t, exitReasonListenerDied, coin.exitReason)
+}
+
+func TestDeadListenerAction(t *testing.T) {
+	f := newLaunchFixture(t)
+
+	wsMock := newMockWS(t)
+	wsMock.handle("accountSubscribe", func(params []json.RawMessage) []interface{} { return nil })
+
+	newDeadCoin := func(b *Bot) *Coin {
+		coin := &Coin{mintAddr: f.mint, creatorATA: f.creatorATA, botPurchased: true, tokensHeld: big.NewInt(1_000_000), exitedCreatorListener: true}
+		b.addNewPendingCoin(coin)
+		b.finishCreatorListener(coin, true)
+		return coin
+	}
+
+	t.Run("exit", func(t *testing.T) {
+		b := &Bot{pendingCoins: make(map[string]*Coin), deadListenerAction: deadListenerExit}
+		coin := newDeadCoin(b)
+
+		require.Equal(t, []*Coin{coin}, checkCoinsToSell(b))
+		require.Equal(t, exitReasonListenerDied, coin.exitReason)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		b := &Bot{pendingCoins: make(map[string]*Coin), deadListenerAction: deadListenerRestart, wsPool: newWsPoolFromClients(wsMock.client(t))}
+		coin := newDeadCoin(b)
+
+		require.Empty(t, checkCoinsToSell(b))
+		require.Empty(t, coin.exitReason)
+		require.Equal(t, listenerActive, b.creatorListenerState(coin))
+
+		// restarted once, the listener is alive again on the next pass
+		require.Empty(t, checkCoinsToSell(b))
+		require.Never(t, func() bool { return b.creatorListenerState(coin) != listenerActive }, 200*time.Millisecond, 20*time.Millisecond)
+
+		// removing the coin stops the new listener cleanly
+		b.pendingCoinsLock.Lock()
+		b.removePendingCoin(f.mint.String(), coin, "test done")
+		b.pendingCoinsLock.Unlock()
+		require.Eventually(t, func() bool { return b.creatorListenerState(coin) == listenerExitedClean }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("unset leaves the coin", func(t *testing.T) {
+		b := &Bot{pendingCoins: make(map[string]*Coin)}
+		coin := newDeadCoin(b)
+
+		require.Empty(t, checkCoinsToSell(b))
+		require.Equal(t, listenerExitedError, b.creatorListenerState(coin))
+	})
+}
+
+func TestCheckCoinToSellVerifiesSold(t *testing.T) {
+	f := newLaunchFixture(t)
+
+	var balance atomic.Value
+	balance.Store("1000000")
+	mock := newMockRPC(t)
+	mock.handle("getTokenAccountBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"amount": balance.Load(), "decimals": 6, "uiAmountString": "1"},
+		}, nil
+	})
+
+	// we believe the coin sold, but the sell never landed
+	coin := &Coin{
+		mintAddr:               f.mint,
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		botPurchased:           true,
+		tokensHeld:             big.NewInt(0),
+		exitReason:             exitReasonCreatorSold,
+		isSellingCoin:          true,
+		exitedSellCoin:         true,
+		exitedCreatorListener:  true,
+	}
+	b := &Bot{rpcClient: mock.client(), pendingCoins: make(map[string]*Coin)}
+	b.addNewPendingCoin(coin)
+
+	// kept while the balance is checked, then sold again
+	require.Empty(t, checkCoinsToSell(b))
+	require.True(t, b.isPendingCoin(coin))
+
+	var toSell []*Coin
+	require.Eventually(t, func() bool {
+		toSell = checkCoinsToSell(b)
+		return len(toSell) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []*Coin{coin}, toSell)
+	require.Equal(t, big.NewInt(1_000_000), coin.tokensHeld)
+	require.True(t, b.isPendingCoin(coin))
+
+	// once the resell empties the account, the coin is deleted
+	balance.Store("0")
+	b.pendingCoinsLock.Lock()
+	coin.tokensHeld = big.NewInt(0)
+	coin.exitedSellCoin = true
+	b.pendingCoinsLock.Unlock()
+
+	require.Eventually(t, func() bool {
+		checkCoinsToSell(b)
+		return !b.isPendingCoin(coin)
+	}, time.Second, 10*time.Millisecond)
+	require.Len(t, mock.callsTo("getTokenAccountBalance"), 2)
+}
+
+func TestSkipStaleCoinFromChannel(t *testing.T) {
+	b := newBaseBot()
+	coin := fixtureCoin(t)
+
+	coin.pickupTime = time.Now().Add(-time.Second)
+	require.False(t, b.skipStaleCoinFromChannel(coin))
+
+	buf := captureLogs(t)
+	coin.pickupTime = time.Now().Add(-4 * time.Second)
+	require.True(t, b.skipStaleCoinFromChannel(coin))
+	require.Contains(t, buf.String(), "Discarding stale queued coin "+coin.mintAddr.String())
+
+	// disabled, or without a pickup time, coins are bought however late
+	b.maxQueueAge = 0
+	require.False(t, b.skipStaleCoinFromChannel(coin))
+
+	b.maxQueueAge = time.Second
+	coin.pickupTime = time.Time{}
+	require.False(t, b.skipStaleCoinFromChannel(coin))
+}
@@ -1,58 +1,238 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math/big"
+	"net/http"
+	"os"
 	"time"
 )
 
-// HandleSellCoins iterates through our list of coins we've purchased,
-// or intend to purchase, checks if they are stale (already sold / buy tx failed),
-// or if they need to be sold, and handles both of those cases
-func (b *Bot) HandleSellCoins() {
+// reasons we exit a position, recorded on the coin when the exit is triggered
+const (
+	exitReasonCreatorSold    = "creator sold"
+	exitReasonCreatorInflow  = "creator wallet inflow"
+	exitReasonCreatorDrained = "creator wallet drained"
+	exitReasonGraduated      = "graduated"
+	exitReasonMigrating      = "migrating"
+	exitReasonMaxHoldValue   = "max hold value"
+	exitReasonNetOutflow     = "net outflow"
+	exitReasonNearCompletion = "curve near completion"
+	exitReasonListenerDied   = "creator listener died"
+	exitReasonBreakevenStop  = "breakeven stop"
+	exitReasonUnsoldBalance  = "tokens left after sell"
+	exitReasonPanic          = "panic sell"
+
+	// followed by the signature of the closing tx, when we find it
+	exitReasonCreatorClosedATA = "creator closed ATA"
+)
+
+// what checkCoinToSell does with a held coin whose creator listener died, see `Bot.deadListenerAction`
+const (
+	deadListenerExit    = "exit"
+	deadListenerRestart = "restart"
+)
+
+// manageSellForCoin runs as goroutine for every coin we go to buy, until the coin is deleted. rather than
+// polling, it checks the coin each time something affecting its exit happens (see signalSellCheck), selling
+// it once it has a reason to exit and deleting it once we're done with it
+func (b *Bot) manageSellForCoin(ctx context.Context, coin *Coin) {
 	for {
-		coinsToSell := b.fetchCoinsToSell()
+		select {
+		case <-ctx.Done():
+			return
+		case <-coin.sellChecks:
+		}
 
-		for _, coin := range coinsToSell {
-			go b.SellCoinFast(coin)
+		b.pendingCoinsLock.Lock()
+		sell, removed := b.checkCoinToSell(coin)
+		b.pendingCoinsLock.Unlock()
+
+		if removed {
+			return
 		}
 
-		// check for coins we should sell each 100 ms
-		time.Sleep(100 * time.Millisecond)
+		if sell {
+			b.SellCoinFast(coin)
+		}
 	}
 }
 
-// fetchCoinsToSell returns coins we should sell,
-// but also deletes coins we no longer need to track
-func (b *Bot) fetchCoinsToSell() []*Coin {
-	var coinsToSell []*Coin
+// checkCoinToSell reports whether we should sell the coin now, deleting it instead (`removed`) if we no
+// longer need to track it. callers hold pendingCoinsLock
+func (b *Bot) checkCoinToSell(coin *Coin) (sell bool, removed bool) {
+	mintAddr := coin.mintAddr.String()
+	if b.pendingCoins[mintAddr] != coin {
+		return false, true
+	}
+
+	// if we exited BuyCoin & do not hold tokens, remove this coin
+	if coin.exitedBuyCoin && !coin.botHoldsTokens() && b.verifiedSold(coin) {
+		b.removePendingCoin(mintAddr, coin, "exited buy but no hold")
+		return false, true
+	}
+
+	// sold coins and stopped listening to creator, delete coin
+	if coin.exitedSellCoin && coin.exitedCreatorListener && b.verifiedSold(coin) {
+		b.removePendingCoin(mintAddr, coin, "exited creator listener and sellCoins routine")
+		return false, true
+	}
+
+	// a held coin whose creator listener died is no longer protected from the creator selling
+	if coin.botHoldsTokens() && coin.exitReason == "" && coin.listenerDead() {
+		b.handleDeadListener(coin)
+	}
+
+	// we hold tokens & have a reason to exit (e.g. creator sold), must exit
+	// make sure we are not already selling this coin, and that a pump sell can still fill
+	if coin.botHoldsTokens() && coin.exitReason != "" && !coin.isSellingCoin && !coin.migrating {
+		b.status(fmt.Sprintf("Selling %s: (decision=%s)", coin.mintAddr.String(), coin.exitReason))
+
+		// claimed under the lock, like panicSell does, so only one sell of the coin runs at once
+		coin.isSellingCoin = true
+		return true, false
+	}
+
+	return false, false
+}
+
+// signalSellCheck wakes the coin's manageSellForCoin to check it again, without blocking. a check
+// already pending covers this one
+func (c *Coin) signalSellCheck() {
+	select {
+	case c.sellChecks <- struct{}{}:
+	default:
+	}
+}
+
+// verifiedSold reports whether a coin we believe is sold can be deleted: we never bought it, or our token
+// account was verified empty on chain. the first call launches the balance check in the background, which
+// signals the coin to be checked again with its result. callers hold pendingCoinsLock
+func (b *Bot) verifiedSold(coin *Coin) bool {
+	if !coin.botPurchased || coin.soldVerified {
+		return true
+	}
+
+	if !coin.verifyingSold {
+		coin.verifyingSold = true
+		b.goCoin(func() { b.verifySold(coin) })
+	}
+
+	return false
+}
+
+// verifySold checks our token account for a coin we believe is sold. an empty (or closed) account lets the
+// coin be deleted, tokens left over are sold again rather than dropped with the coin. a failed check is
+// retried on the coin's next sell check
+func (b *Bot) verifySold(coin *Coin) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	held, err := b.fetchTokenBalance(ctx, coin.associatedTokenAccount)
+	if err != nil && isAccountNotFoundErr(err) {
+		held, err = new(big.Int), nil
+	}
 
 	b.pendingCoinsLock.Lock()
 	defer b.pendingCoinsLock.Unlock()
 
-	for mintAddr, coin := range b.pendingCoins {
-		if coin == nil {
-			continue
+	coin.verifyingSold = false
+	defer coin.signalSellCheck()
+
+	if err != nil {
+		b.statusr(fmt.Sprintf("Failed to verify %s is sold: %s", coin.mintAddr.String(), err))
+		return
+	}
+
+	if held.Sign() == 0 {
+		coin.soldVerified = true
+		return
+	}
+
+	b.statusr(fmt.Sprintf("Still holding %s tokens of %s we believed sold, Marking to sell", held.String(), coin.mintAddr.String()))
+	coin.tokensHeld = held
+	coin.isSellingCoin = false
+	coin.exitedSellCoin = false
+	coin.setExitReason(exitReasonUnsoldBalance)
+}
+
+// handleDeadListener exits a held coin whose creator listener or creator wallet listener died, or restarts
+// the dead ones, per `deadListenerAction`. callers hold pendingCoinsLock
+func (b *Bot) handleDeadListener(coin *Coin) {
+	switch b.deadListenerAction {
+	case deadListenerExit:
+		if isDeadListenerState(coin.listenerState) {
+			b.statusr(fmt.Sprintf("Creator listener of %s is %s, Marking to sell", coin.mintAddr.String(), coin.listenerState))
+		} else {
+			b.statusr(fmt.Sprintf("Creator wallet listener of %s is %s, Marking to sell", coin.mintAddr.String(), coin.walletListenerState))
+		}
+		coin.setExitReason(exitReasonListenerDied)
+	case deadListenerRestart:
+		if isDeadListenerState(coin.listenerState) {
+			b.statusy(fmt.Sprintf("Creator listener of %s is %s, restarting it", coin.mintAddr.String(), coin.listenerState))
+			coin.listenerState = listenerActive
+			coin.exitedCreatorListener = false
+			b.goCoin(func() { b.listenCreatorSell(coin) })
 		}
 
-		// if we exited BuyCoin & do not hold tokens, remove this coin
-		if coin.exitedBuyCoin && !coin.botHoldsTokens() {
-			fmt.Println("Deleting", coin.mintAddr.String(), "because exited buy but no hold")
-			delete(b.pendingCoins, mintAddr)
+		if isDeadListenerState(coin.walletListenerState) {
+			b.statusy(fmt.Sprintf("Creator wallet listener of %s is %s, restarting it", coin.mintAddr.String(), coin.walletListenerState))
+			coin.walletListenerState = listenerActive
+			b.goCoin(func() { b.listenCreatorWallet(coin) })
 		}
+	}
+}
+
+// panicSell halts buying and marks every coin we track to sell, whatever its other exits say. held coins not
+// already being sold are claimed and returned for the caller to sell right away, a buy still in flight is sold
+// by its manageSellForCoin once its tokens land
+func (b *Bot) panicSell() []*Coin {
+	b.tradingHalted.Store(true)
 
-		// sold coins and stopped listening to creator, delete coin
-		if coin.exitedSellCoin && coin.exitedCreatorListener {
-			fmt.Println("Deleting", coin.mintAddr.String(), "because exited creator listener and sellCoins routine")
-			delete(b.pendingCoins, mintAddr)
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	var coinsToSell []*Coin
+	for _, coin := range b.pendingCoins {
+		if coin == nil {
+			continue
 		}
 
-		// we hold tokens & creator sold, must exit
-		// make sure we are not already selling this coin
-		if coin.botHoldsTokens() && coin.creatorSold && !coin.isSellingCoin {
-			b.status(fmt.Sprintf("Selling %s: (decision=creator sold)", coin.mintAddr.String()))
-			coinsToSell = append(coinsToSell, coin)
+		coin.setExitReason(exitReasonPanic)
+		if !coin.botHoldsTokens() || coin.isSellingCoin {
+			continue
 		}
+
+		// claimed under the lock, so manageSellForCoin doesn't start a second sell of it
+		coin.isSellingCoin = true
+		coinsToSell = append(coinsToSell, coin)
 	}
 
 	return coinsToSell
 }
+
+// handlePanic dumps every coin we hold at any price and halts buying, for when the whole market is crashing.
+// buys stay halted until POST /resume, and the bot exits once the sells are done if `panicExit` is set.
+// needs the same authorization as /resume
+func (b *Bot) handlePanic(w http.ResponseWriter, r *http.Request) {
+	if !b.authorizeControl(w, r) {
+		return
+	}
+
+	coins := b.panicSell()
+	msg := fmt.Sprintf("Panic sell: buys halted, dumping %d held coins", len(coins))
+	b.statusr(msg)
+	b.notify(msg)
+
+	b.goCoin(func() {
+		b.sellAllNow(coins)
+		if b.panicExit {
+			b.statusr("Panic sell done, exiting")
+			os.Exit(1)
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "selling %d coins\n", len(coins))
+}
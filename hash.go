@@ -2,11 +2,27 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
+const (
+	// blockhashes expire 150 blocks (~60s) after they were produced. past this age we stop trusting ours,
+	// even if the refresh loop hasn't noticed it's failing
+	blockhashMaxAge = 45 * time.Second
+
+	// refresh before sending once our blockhash was fetched with fewer blocks than this left to live
+	blockhashMinBlocksLeft = 30
+
+	// how long a blockhash / block height fetch may take before the refresh gives up on it
+	blockhashFetchTimeout = 2 * time.Second
+
+	// how often watchBlockhashExpiry checks the blockhash's age
+	blockhashWatchInterval = time.Second
+)
+
 func (b *Bot) fetchBlockhashLoop() {
 	go func() {
 		for {
@@ -19,14 +35,76 @@ func (b *Bot) fetchBlockhashLoop() {
 			time.Sleep(400 * time.Millisecond)
 		}
 	}()
+
+	go b.watchBlockhashExpiry()
 }
 
 func (b *Bot) fetchLatestBlockhash() error {
-	recent, err := b.rpcClient.GetLatestBlockhash(context.TODO(), rpc.CommitmentFinalized)
+	ctx, cancel := context.WithTimeout(context.Background(), blockhashFetchTimeout)
+	defer cancel()
+
+	recent, err := b.rpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
 		return err
 	}
 
-	b.blockhash = &recent.Value.Blockhash
-	return nil
+	b.blockhash.Store(&recent.Value.Blockhash)
+	b.lastValidBlockHeight.Store(recent.Value.LastValidBlockHeight)
+	b.blockhashFetchedAt.Store(time.Now().UnixNano())
+
+	_, err = b.GetCurrentBlockHeight()
+	return err
+}
+
+// GetCurrentBlockHeight fetches the current block height, which `currentBlockHeight` keeps to tell
+// how many blocks our blockhash has left (see blockhashExpiring)
+func (b *Bot) GetCurrentBlockHeight() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), blockhashFetchTimeout)
+	defer cancel()
+
+	height, err := b.rpcClient.GetBlockHeight(ctx, rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, err
+	}
+
+	b.currentBlockHeight.Store(height)
+	return height, nil
+}
+
+// blockhashExpiring reports whether our blockhash is too old to send with, by wall time or, once the
+// block height is known, by how close to its last valid block height it was fetched
+func (b *Bot) blockhashExpiring() bool {
+	fetchedAt := b.blockhashFetchedAt.Load()
+	if fetchedAt == 0 {
+		return false
+	}
+
+	if time.Since(time.Unix(0, fetchedAt)) > blockhashMaxAge {
+		return true
+	}
+
+	height, lastValid := b.currentBlockHeight.Load(), b.lastValidBlockHeight.Load()
+	return height > 0 && height+blockhashMinBlocksLeft > lastValid
+}
+
+// watchBlockhashExpiry runs as goroutine, forcing a refresh whenever the blockhash gets close to expiring,
+// e.g. when the refresh loop is stuck on a hung RPC call
+func (b *Bot) watchBlockhashExpiry() {
+	for range time.Tick(blockhashWatchInterval) {
+		b.refreshExpiringBlockhash()
+	}
+}
+
+// refreshExpiringBlockhash fetches a new blockhash if ours is close to expiring
+func (b *Bot) refreshExpiringBlockhash() {
+	if !b.blockhashExpiring() {
+		return
+	}
+
+	age := time.Since(time.Unix(0, b.blockhashFetchedAt.Load()))
+	b.statusy(fmt.Sprintf("Blockhash is close to expiring (fetched %s ago), refreshing", age.Round(time.Millisecond)))
+
+	if err := b.fetchLatestBlockhash(); err != nil {
+		b.statusr("Failed to refresh expiring blockhash: " + err.Error())
+	}
 }
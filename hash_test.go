@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newBlockhashMockRPC(t *testing.T, hash solana.Hash, lastValid, height uint64) *mockRPC {
+	mock := newMockRPC(t)
+	mock.handle("getLatestBlockhash", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"blockhash": hash.String(), "lastValidBlockHeight": lastValid},
+		}, nil
+	})
+	mock.handle("getBlockHeight", func(params []json.RawMessage) (interface{}, error) {
+		return height, nil
+	})
+
+	return mock
+}
+
+func TestFetchLatestBlockhash(t *testing.T) {
+	hash := solana.Hash{9}
+	mock := newBlockhashMockRPC(t, hash, 1_150, 1_000)
+
+	b := &Bot{rpcClient: mock.client()}
+	require.NoError(t, b.fetchLatestBlockhash())
+	require.Equal(t, hash, *b.blockhash.Load())
+	require.Equal(t, uint64(1_150), b.lastValidBlockHeight.Load())
+	require.Equal(t, uint64(1_000), b.currentBlockHeight.Load())
+	require.False(t, b.blockhashExpiring())
+}
+
+func TestBlockhashExpiring(t *testing.T) {
+	b := &Bot{}
+
+	// never fetched (tests & offline tools set their own)
+	require.False(t, b.blockhashExpiring())
+
+	b.blockhashFetchedAt.Store(time.Now().UnixNano())
+	b.lastValidBlockHeight.Store(1_150)
+	b.currentBlockHeight.Store(1_000)
+	require.False(t, b.blockhashExpiring())
+
+	// too few blocks left
+	b.currentBlockHeight.Store(1_130)
+	require.True(t, b.blockhashExpiring())
+
+	// too old, however many blocks were left
+	b.currentBlockHeight.Store(1_000)
+	b.blockhashFetchedAt.Store(time.Now().Add(-blockhashMaxAge - time.Second).UnixNano())
+	require.True(t, b.blockhashExpiring())
+}
+
+func TestCreateTransactionRefreshesExpiringBlockhash(t *testing.T) {
+	fresh := solana.Hash{9}
+	mock := newBlockhashMockRPC(t, fresh, 1_150, 1_000)
+
+	b := &Bot{rpcClient: mock.client(), privateKey: solana.NewWallet().PrivateKey}
+	b.blockhash.Store(&solana.Hash{1})
+	b.blockhashFetchedAt.Store(time.Now().Add(-time.Minute).UnixNano())
+
+	tx, err := b.createTransaction(solana.NewInstruction(solana.SystemProgramID, nil, nil))
+	require.NoError(t, err)
+	require.Equal(t, fresh, tx.Message.RecentBlockhash)
+
+	// a fresh blockhash is used as is
+	_, err = b.createTransaction(solana.NewInstruction(solana.SystemProgramID, nil, nil))
+	require.NoError(t, err)
+	require.Len(t, mock.callsTo("getLatestBlockhash"), 1)
+}
+
+func TestBlockhashRefreshWhileBuildingTransactions(t *testing.T) {
+	hash := solana.Hash{9}
+	mock := newBlockhashMockRPC(t, hash, 1_150, 1_000)
+
+	b := &Bot{rpcClient: mock.client(), privateKey: solana.NewWallet().PrivateKey}
+	b.blockhash.Store(&solana.Hash{1})
+
+	// the refresh loop swaps the blockhash out while txs are built, which -race must not flag
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			if err := b.fetchLatestBlockhash(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for range 20 {
+		tx, err := b.createTransaction(solana.NewInstruction(solana.SystemProgramID, nil, nil))
+		require.NoError(t, err)
+		require.Contains(t, []solana.Hash{{1}, hash}, tx.Message.RecentBlockhash)
+	}
+
+	<-done
+	require.Equal(t, hash, *b.blockhash.Load())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// sellOnCurveProgress triggers an exit once the coin's curve, as of the latest trade, is `exitCurveProgress`
+// percent of the way to completing. buyers dry up right before migration, so we get out ahead of it
+func (b *Bot) sellOnCurveProgress(coin *Coin) bool {
+	return b.sellOnCurveProgressOf(coin, coin.curve.Load())
+}
+
+// sellOnCurveProgressOf is sellOnCurveProgress against `curve`, nil if unknown
+func (b *Bot) sellOnCurveProgressOf(coin *Coin, curve *BondingCurveData) bool {
+	if b.exitCurveProgress <= 0 || !coin.botPurchased || !coin.botHoldsTokens() {
+		return false
+	}
+
+	if curve == nil || curve.Progress() < b.exitCurveProgress {
+		return false
+	}
+
+	b.status(fmt.Sprintf("Curve of %s is %.1f%% of the way to migration, Marking to sell", coin.mintAddr.String(), curve.Progress()))
+	b.triggerExit(coin, exitReasonNearCompletion)
+	return true
+}
+
+// sellOnMaxHoldValue triggers an exit once selling our tokens would net at least `maxHoldValueSol` over
+// what we paid. `trade` carries the bonding curve's reserves right after it, so we quote the sell off the
+// trade tape without fetching the curve. other exit triggers may fire first, the first reason is kept
+func (b *Bot) sellOnMaxHoldValue(coin *Coin, trade *TradeEvent) bool {
+	if b.maxHoldValueSol <= 0 || !coin.botPurchased || !coin.botHoldsTokens() {
+		return false
+	}
+
+	curve := b.curveAfterTrade(trade)
+	sellQuoteLamports := calculateSellQuote(coin.tokensHeld.Uint64(), curve, b.currentFeeBasisPoints())
+	profitLamports := new(big.Int).Sub(sellQuoteLamports, new(big.Int).SetUint64(coin.buyPrice))
+
+	targetLamports := big.NewInt(int64(b.maxHoldValueSol * float64(solana.LAMPORTS_PER_SOL)))
+	if profitLamports.Cmp(targetLamports) < 0 {
+		return false
+	}
+
+	b.status(fmt.Sprintf("Position in %s is up %s, Marking to sell", coin.mintAddr.String(), formatSol(profitLamports.Int64(), b.solUSD())))
+	b.triggerExit(coin, exitReasonMaxHoldValue)
+	return true
+}
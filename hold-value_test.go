@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateSellQuote(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+
+	// selling what 1 SOL just bought returns the SOL, less the fee & rounding
+	tokens := calculateBuyQuote(solana.LAMPORTS_PER_SOL, curve, 1)
+	afterBuy := &BondingCurveData{
+		VirtualSolReserves:   new(big.Int).Add(curve.VirtualSolReserves, new(big.Int).SetUint64(solana.LAMPORTS_PER_SOL)),
+		VirtualTokenReserves: new(big.Int).Sub(curve.VirtualTokenReserves, tokens),
+	}
+
+	require.InDelta(t, float64(solana.LAMPORTS_PER_SOL), calculateSellQuote(tokens.Uint64(), afterBuy, 0).Uint64(), 2)
+	require.InDelta(t, 0.99*float64(solana.LAMPORTS_PER_SOL), calculateSellQuote(tokens.Uint64(), afterBuy, 100).Uint64(), 2)
+}
+
+func TestSellOnMaxHoldValue(t *testing.T) {
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+	tokens := calculateBuyQuote(solana.LAMPORTS_PER_SOL/10, curve, 1)
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: tokens, buyPrice: solana.LAMPORTS_PER_SOL / 10}
+	b := &Bot{maxHoldValueSol: 0.1, pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	// the curve's reserves after `solIn` more SOL was bought in
+	tradeAfter := func(solIn uint64) *TradeEvent {
+		virtualSol := new(big.Int).Add(curve.VirtualSolReserves, new(big.Int).SetUint64(solIn))
+		invariant := new(big.Int).Mul(curve.VirtualSolReserves, curve.VirtualTokenReserves)
+		return &TradeEvent{
+			Mint:                 coin.mintAddr,
+			VirtualSolReserves:   virtualSol.Uint64(),
+			VirtualTokenReserves: new(big.Int).Div(invariant, virtualSol).Uint64(),
+		}
+	}
+
+	// up, but not 0.1 SOL
+	require.False(t, b.sellOnMaxHoldValue(coin, tradeAfter(2*solana.LAMPORTS_PER_SOL)))
+	require.Empty(t, coin.exitReason)
+
+	require.True(t, b.sellOnMaxHoldValue(coin, tradeAfter(20*solana.LAMPORTS_PER_SOL)))
+	require.Equal(t, exitReasonMaxHoldValue, coin.exitReason)
+
+	// an earlier exit reason wins
+	coin.exitReason = exitReasonCreatorSold
+	b.sellOnMaxHoldValue(coin, tradeAfter(20*solana.LAMPORTS_PER_SOL))
+	require.Equal(t, exitReasonCreatorSold, coin.exitReason)
+
+	// disabled
+	coin.exitReason = ""
+	b.maxHoldValueSol = 0
+	require.False(t, b.sellOnMaxHoldValue(coin, tradeAfter(20*solana.LAMPORTS_PER_SOL)))
+}
+
+func TestSellOnCurveProgress(t *testing.T) {
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	b := &Bot{exitCurveProgress: 90, pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	// no trade seen yet
+	require.False(t, b.sellOnCurveProgress(coin))
+
+	coin.curve.Store(&BondingCurveData{RealSolReserves: new(big.Int).SetUint64(defaultMigrationThreshold / 2)})
+	require.False(t, b.sellOnCurveProgress(coin))
+	require.Empty(t, coin.exitReason)
+
+	coin.curve.Store(&BondingCurveData{RealSolReserves: new(big.Int).SetUint64(defaultMigrationThreshold / 100 * 95)})
+	require.True(t, b.sellOnCurveProgress(coin))
+	require.Equal(t, exitReasonNearCompletion, coin.exitReason)
+
+	// disabled
+	coin.exitReason = ""
+	b.exitCurveProgress = 0
+	require.False(t, b.sellOnCurveProgress(coin))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// loggedInstruction is one line written by InstructionLogger
+type loggedInstruction struct {
+	Time      time.Time          `json:"time"`
+	ProgramID string             `json:"program_id"`
+	Data      []byte             `json:"data"` // base64
+	Accounts  []loggedAccountRef `json:"accounts"`
+	Error     string             `json:"error,omitempty"` // why it failed to decode, empty if it decoded
+}
+
+type loggedAccountRef struct {
+	PublicKey  string `json:"pubkey"`
+	IsSigner   bool   `json:"signer"`
+	IsWritable bool   `json:"writable"`
+}
+
+// InstructionLogger writes the raw launchpad instructions we decode as JSON lines, decoded or not, so the decoder
+// can be fixed from real data once a contract upgrade breaks it. a nil or disabled logger logs nothing
+type InstructionLogger struct {
+	enabled bool
+	outFile *os.File
+
+	lock sync.Mutex
+}
+
+func openInstructionLogger(path string) (*InstructionLogger, error) {
+	outFile, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstructionLogger{enabled: true, outFile: outFile}, nil
+}
+
+// LogInstruction writes one instruction of `programID`, along with `err` if it failed to decode
+func (l *InstructionLogger) LogInstruction(programID solana.PublicKey, data []byte, accounts []*solana.AccountMeta, err error) {
+	if l == nil || !l.enabled {
+		return
+	}
+
+	logged := loggedInstruction{
+		Time:      time.Now().UTC(),
+		ProgramID: programID.String(),
+		Data:      data,
+		Accounts:  make([]loggedAccountRef, 0, len(accounts)),
+	}
+
+	for _, account := range accounts {
+		logged.Accounts = append(logged.Accounts, loggedAccountRef{
+			PublicKey:  account.PublicKey.String(),
+			IsSigner:   account.IsSigner,
+			IsWritable: account.IsWritable,
+		})
+	}
+
+	if err != nil {
+		logged.Error = err.Error()
+	}
+
+	line, err := json.Marshal(logged)
+	if err != nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.outFile.Write(append(line, '\n'))
+}
+
+func (l *InstructionLogger) Close() error {
+	return l.outFile.Close()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstructionLoggerLogsUndecodableInstructions(t *testing.T) {
+	f := newLaunchFixture(t)
+
+	// a contract upgrade changed the create's discriminator, we no longer decode it
+	create := f.createInst()
+	data, err := create.Data()
+	require.NoError(t, err)
+	upgraded := append([]byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0xbe, 0xef}, data[8:]...)
+	upgradedCreate := solana.NewInstruction(pumpProgramID, create.Accounts(), upgraded)
+
+	path := filepath.Join(t.TempDir(), "instructions.jsonl")
+	instrLogger, err := openInstructionLogger(path)
+	require.NoError(t, err)
+
+	b := &Bot{instrLogger: instrLogger}
+	_, err = fetchNewCoin(b.decodeMintInstructions(newTestTx(t, f.creator, upgradedCreate, f.buyInst(1000, 1e9))))
+	require.ErrorIs(t, err, errCreatingNewCoin)
+	require.NoError(t, instrLogger.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var logged []loggedInstruction
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var inst loggedInstruction
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &inst))
+		logged = append(logged, inst)
+	}
+	require.NoError(t, scanner.Err())
+
+	// both get logged, the one we failed to decode with why
+	require.Len(t, logged, 2)
+	require.Equal(t, pumpProgramID.String(), logged[0].ProgramID)
+	require.Equal(t, upgraded, logged[0].Data)
+	require.NotEmpty(t, logged[0].Error)
+	require.Len(t, logged[0].Accounts, len(create.Accounts()))
+	require.Equal(t, f.mint.String(), logged[0].Accounts[0].PublicKey)
+	require.Empty(t, logged[1].Error)
+
+	// nothing is logged without a logger
+	var disabled *InstructionLogger
+	disabled.LogInstruction(pumpProgramID, data, nil, nil)
+}
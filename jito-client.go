@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	jito_go "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go"
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/searcher_client"
+	"github.com/gagliardetto/solana-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// wait after a failed searcher client reconnect, doubling with every failure in a row
+	jitoReconnectMinBackoff = time.Second
+	jitoReconnectMaxBackoff = time.Minute
+)
+
+var errJitoReconnectBackoff = errors.New("Jito Reconnect Backing Off")
+
+// dialSearcherClient connects & authenticates a new searcher client to the block engine. the client's
+// connection lives until the returned cancel is called
+func (j *JitoManager) dialSearcherClient() (*searcher_client.Client, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client, err := searcher_client.New(ctx, jito_go.NewYork.BlockEngineURL, j.rpcClient, j.rpcClient, j.privateKey, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	return client, cancel, nil
+}
+
+// searcherClient is the current searcher client, replaced whenever ensureSearcherClient reconnects
+func (j *JitoManager) searcherClient() *searcher_client.Client {
+	j.clientLock.Lock()
+	defer j.clientLock.Unlock()
+
+	return j.jitoClient
+}
+
+// ensureSearcherClient checks the searcher client's gRPC connection is usable, replacing the client with a
+// freshly authenticated one if it isn't. failed reconnects back off exponentially, returning the last error
+// until the backoff is up so we don't hammer the block engine
+func (j *JitoManager) ensureSearcherClient(ctx context.Context) error {
+	j.clientLock.Lock()
+	defer j.clientLock.Unlock()
+
+	if j.jitoClient != nil && j.jitoClient.GrpcConn != nil {
+		switch j.jitoClient.GrpcConn.GetState() {
+		case connectivity.Ready, connectivity.Idle:
+			return nil
+		}
+	}
+
+	if time.Now().Before(j.nextReconnectAt) {
+		return fmt.Errorf("%w: %w", errJitoReconnectBackoff, j.lastReconnectErr)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	jitoReconnects.Inc()
+	j.statusr("Searcher client disconnected, reconnecting")
+
+	client, cancel, err := j.dial()
+	if err != nil {
+		j.reconnectBackoff = min(max(2*j.reconnectBackoff, jitoReconnectMinBackoff), jitoReconnectMaxBackoff)
+		j.nextReconnectAt = time.Now().Add(j.reconnectBackoff)
+		j.lastReconnectErr = err
+		return fmt.Errorf("failed to reconnect jito searcher client: %w", err)
+	}
+
+	// closes the old client's connection
+	if j.cancelClient != nil {
+		j.cancelClient()
+	}
+
+	j.jitoClient, j.cancelClient = client, cancel
+	j.reconnectBackoff, j.nextReconnectAt, j.lastReconnectErr = 0, time.Time{}, nil
+	j.status("Reconnected searcher client")
+	return nil
+}
+
+// dial is dialSearcherClient, unless swapped out through `dialSearcher`
+func (j *JitoManager) dial() (*searcher_client.Client, context.CancelFunc, error) {
+	if j.dialSearcher != nil {
+		return j.dialSearcher()
+	}
+
+	return j.dialSearcherClient()
+}
+
+// BroadcastBundle sends `transactions` as a bundle through the searcher client, reconnecting it first if needed
+func (j *JitoManager) BroadcastBundle(ctx context.Context, transactions []*solana.Transaction) error {
+	if err := j.ensureSearcherClient(ctx); err != nil {
+		return err
+	}
+
+	_, err := j.searcherClient().BroadcastBundle(transactions)
+	return err
+}
+
+// bundleRejected checks if `err` from BroadcastBundle means the bundle never made it into the block engine: it
+// failed before the send (no client, couldn't assemble it) or the block engine refused it outright. anything else,
+// a timeout or a dropped connection, may come after the block engine took the bundle, so it could still land
+func bundleRejected(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+
+	switch s.Code() {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.ResourceExhausted, codes.PermissionDenied, codes.Unauthenticated, codes.OutOfRange:
+		return true
+	default:
+		return false
+	}
+}
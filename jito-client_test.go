@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/searcher_client"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// idleSearcherClient is a searcher client whose connection hasn't been used yet, so is idle
+func idleSearcherClient(t *testing.T) *searcher_client.Client {
+	conn, err := grpc.NewClient("passthrough:///127.0.0.1:1", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &searcher_client.Client{GrpcConn: conn}
+}
+
+func TestEnsureSearcherClient(t *testing.T) {
+	var dials int
+	dialErr := errors.New("block engine unavailable")
+	next := idleSearcherClient(t)
+
+	j := &JitoManager{jitoClient: idleSearcherClient(t)}
+	j.dialSearcher = func() (*searcher_client.Client, context.CancelFunc, error) {
+		dials++
+		if dialErr != nil {
+			return nil, nil, dialErr
+		}
+		return next, func() {}, nil
+	}
+
+	// an idle connection is fine as is
+	require.NoError(t, j.ensureSearcherClient(context.Background()))
+	require.Zero(t, dials)
+
+	// a closed connection is redialed
+	closedConn := false
+	j.cancelClient = func() { closedConn = true }
+	require.NoError(t, j.jitoClient.GrpcConn.Close())
+
+	reconnects := jitoReconnects.value.Load()
+	require.ErrorIs(t, j.ensureSearcherClient(context.Background()), dialErr)
+	require.Equal(t, 1, dials)
+	require.Equal(t, reconnects+1, jitoReconnects.value.Load())
+	require.Equal(t, jitoReconnectMinBackoff, j.reconnectBackoff)
+
+	// not again until the backoff is up
+	err := j.ensureSearcherClient(context.Background())
+	require.ErrorIs(t, err, errJitoReconnectBackoff)
+	require.ErrorIs(t, err, dialErr)
+	require.Equal(t, 1, dials)
+
+	// failing again doubles the backoff
+	j.nextReconnectAt = time.Now()
+	require.ErrorIs(t, j.ensureSearcherClient(context.Background()), dialErr)
+	require.Equal(t, 2*jitoReconnectMinBackoff, j.reconnectBackoff)
+
+	// a successful reconnect swaps the client in & resets the backoff
+	dialErr = nil
+	j.nextReconnectAt = time.Now()
+	require.NoError(t, j.ensureSearcherClient(context.Background()))
+	require.Equal(t, 3, dials)
+	require.True(t, closedConn)
+	require.Same(t, next, j.searcherClient())
+	require.Zero(t, j.reconnectBackoff)
+	require.NoError(t, j.ensureSearcherClient(context.Background()))
+	require.Equal(t, 3, dials)
+}
+
+func TestBundleRejected(t *testing.T) {
+	// never sent
+	require.True(t, bundleRejected(errors.New("block engine unavailable")))
+	require.True(t, bundleRejected(errJitoReconnectBackoff))
+
+	// refused by the block engine
+	require.True(t, bundleRejected(status.Error(codes.InvalidArgument, "bundle contains an expired blockhash")))
+	require.True(t, bundleRejected(status.Error(codes.ResourceExhausted, "rate limited")))
+
+	// may have been taken before failing
+	require.False(t, bundleRejected(status.Error(codes.DeadlineExceeded, "deadline exceeded")))
+	require.False(t, bundleRejected(status.Error(codes.Unavailable, "connection reset")))
+	require.False(t, bundleRejected(status.Error(codes.Unknown, "stream closed")))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// calls the P95 latency is measured over
+	latencySamples = 100
+
+	// weight of the latest window P95 in the moving average
+	latencyEMAAlpha = 0.1
+
+	// funder lookup latency assumed until we've measured any, giving shouldBuyCoin 1.5s
+	defaultFunderCheckLatency = 750 * time.Millisecond
+)
+
+// latencyWindow tracks the P95 latency of the last `latencySamples` calls, smoothed with an
+// exponential moving average so a single slow call can't swing it. the zero value is ready to use
+type latencyWindow struct {
+	lock    sync.Mutex
+	samples [latencySamples]time.Duration
+	count   int // samples held, up to latencySamples
+	next    int // where the next sample is written, overwriting the oldest once full
+	p95     time.Duration
+}
+
+func (w *latencyWindow) record(latency time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencySamples
+	w.count = min(w.count+1, latencySamples)
+
+	sorted := slices.Clone(w.samples[:w.count])
+	slices.Sort(sorted)
+	windowP95 := sorted[(w.count*95-1)/100]
+
+	if w.count == 1 {
+		w.p95 = windowP95
+		return
+	}
+
+	w.p95 = time.Duration(latencyEMAAlpha*float64(windowP95) + (1-latencyEMAAlpha)*float64(w.p95))
+}
+
+// P95 is the smoothed P95 latency, 0 until a call is recorded
+func (w *latencyWindow) P95() time.Duration {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.p95
+}
+
+// estimateFunderCheckLatency is the P95 latency of our recent funder lookups (fetchNLastTrans),
+// `defaultFunderCheckLatency` until we've made any
+func (b *Bot) estimateFunderCheckLatency() time.Duration {
+	if p95 := b.funderFetchLatency.P95(); p95 > 0 {
+		return p95
+	}
+
+	return defaultFunderCheckLatency
+}
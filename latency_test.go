@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyWindowP95(t *testing.T) {
+	var w latencyWindow
+	require.Zero(t, w.P95())
+
+	w.record(40 * time.Millisecond)
+	require.Equal(t, 40*time.Millisecond, w.P95())
+
+	// a single slow call barely moves the estimate
+	w.record(2 * time.Second)
+	require.Less(t, w.P95(), 300*time.Millisecond)
+
+	// only the last `latencySamples` calls count, old slow calls age out
+	for i := 0; i < 3*latencySamples; i++ {
+		w.record(10 * time.Millisecond)
+	}
+	require.InDelta(t, float64(10*time.Millisecond), float64(w.P95()), float64(time.Millisecond))
+
+	// 5% of calls being slow sits right at the P95
+	for i := 0; i < 3*latencySamples; i++ {
+		latency := 10 * time.Millisecond
+		if i%20 == 0 {
+			latency = time.Second
+		}
+		w.record(latency)
+	}
+	require.InDelta(t, float64(10*time.Millisecond), float64(w.P95()), float64(time.Millisecond))
+}
+
+func TestEstimateFunderCheckLatency(t *testing.T) {
+	b := &Bot{}
+	require.Equal(t, defaultFunderCheckLatency, b.estimateFunderCheckLatency())
+
+	b.funderFetchLatency.record(200 * time.Millisecond)
+	require.Equal(t, 200*time.Millisecond, b.estimateFunderCheckLatency())
+}
+
+func TestFetchNLastTransRecordsTimedOutLatency(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return []interface{}{}, nil
+	})
+
+	b := &Bot{rpcClient: mock.client()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	_, err := b.fetchNLastTrans(10, solana.NewWallet().PublicKey().String(), ctx)
+	require.Error(t, err)
+
+	// the fetch counts for about its deadline, the least it would have taken. the deadline started
+	// ticking before the fetch did, so it can come in a little under
+	require.GreaterOrEqual(t, b.funderFetchLatency.P95(), 20*time.Millisecond)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// localCurve is the coin's bonding curve as kept current from its trades (or the curve poller), if it was
+// updated within `localCurveMaxAge`. nil means the curve has to be fetched
+func (b *Bot) localCurve(coin *Coin) *BondingCurveData {
+	if b.localCurveMaxAge <= 0 {
+		return nil
+	}
+
+	curve := coin.curve.Load()
+	if curve == nil || time.Since(time.Unix(0, coin.curveUpdatedAt.Load())) > b.localCurveMaxAge {
+		return nil
+	}
+
+	return curve
+}
+
+// ReconcileCurves runs as goroutine, checking the local curve of every pending coin against its account
+// each `curveReconcileInterval`, see reconcileCurves
+func (b *Bot) ReconcileCurves(ctx context.Context) {
+	ticker := time.NewTicker(b.curveReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.reconcileCurves(ctx); err != nil {
+			b.statusr("Failed to reconcile bonding curves: " + err.Error())
+		}
+	}
+}
+
+// reconcileCurves fetches the curve of every pending coin we keep a local curve for, logging how far the
+// local one drifted. once it drifted more than `curveDivergenceTolerance`, it's resynced from chain
+func (b *Bot) reconcileCurves(ctx context.Context) error {
+	b.pendingCoinsLock.Lock()
+	var coins []*Coin
+	for _, coin := range b.pendingCoins {
+		if coin.curve.Load() != nil {
+			coins = append(coins, coin)
+		}
+	}
+	b.pendingCoinsLock.Unlock()
+
+	for start := 0; start < len(coins); start += curvePollBatchSize {
+		batch := coins[start:min(start+curvePollBatchSize, len(coins))]
+
+		keys := make([]solana.PublicKey, len(batch))
+		for i, coin := range batch {
+			keys[i] = coin.tokenBondingCurve
+		}
+
+		curves, err := b.fetchBondingCurves(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		for i, chain := range curves {
+			if chain == nil {
+				continue
+			}
+
+			// resyncing to a stale read would drift the curve rather than fix it
+			if _, stale := b.curveStale(chain); !stale {
+				b.reconcileCurve(batch[i], chain)
+			}
+		}
+	}
+
+	return nil
+}
+
+// reconcileCurve compares a coin's local curve against `chain`, just fetched, resyncing it if it drifted too far
+func (b *Bot) reconcileCurve(coin *Coin, chain *BondingCurveData) {
+	local := coin.curve.Load()
+	if local == nil {
+		return
+	}
+
+	divergence := curveDivergence(local, chain)
+	if divergence == 0 {
+		return
+	}
+
+	if divergence <= b.curveDivergenceTolerance {
+		coin.status(fmt.Sprintf("Local curve is %.3f%% off chain", 100*divergence))
+		return
+	}
+
+	curveResyncs.Inc()
+	b.statusy(fmt.Sprintf("Local curve of %s is %.3f%% off chain, resyncing", coin.mintAddr.String(), 100*divergence))
+	b.updateCurve(coin, chain)
+}
+
+// curveDivergence is how far apart (relative to `chain`) the virtual SOL reserves of two curves are, which
+// the price and every quote move with
+func curveDivergence(local, chain *BondingCurveData) float64 {
+	if chain.VirtualSolReserves == nil || chain.VirtualSolReserves.Sign() == 0 {
+		return 0
+	}
+
+	diff := new(big.Int).Sub(local.VirtualSolReserves, chain.VirtualSolReserves)
+	divergence, _ := new(big.Rat).SetFrac(diff.Abs(diff), chain.VirtualSolReserves).Float64()
+	return divergence
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCurve(t *testing.T) {
+	coin := &Coin{}
+	b := &Bot{localCurveMaxAge: time.Second}
+	require.Nil(t, b.localCurve(coin))
+
+	curve := curveAfterCreatorBuy(30_000_000_000000)
+	b.updateCurve(coin, curve)
+	require.Same(t, curve, b.localCurve(coin))
+
+	// too old to trust
+	coin.curveUpdatedAt.Store(time.Now().Add(-2 * time.Second).UnixNano())
+	require.Nil(t, b.localCurve(coin))
+
+	// disabled
+	b.updateCurve(coin, curve)
+	b.localCurveMaxAge = 0
+	require.Nil(t, b.localCurve(coin))
+}
+
+func TestReconcileCurves(t *testing.T) {
+	newCoin := func() *Coin {
+		return &Coin{mintAddr: solana.NewWallet().PublicKey(), tokenBondingCurve: solana.NewWallet().PublicKey()}
+	}
+	near, drifted, untracked := newCoin(), newCoin(), newCoin()
+
+	chain := curveAfterCreatorBuy(100_000_000_000000)
+	accounts := map[solana.PublicKey]interface{}{}
+	for _, coin := range []*Coin{near, drifted, untracked} {
+		accounts[coin.tokenBondingCurve] = bondingCurveAccount(t, chain)["value"]
+	}
+
+	mock := newMockRPC(t)
+	mock.handle("getMultipleAccounts", func(params []json.RawMessage) (interface{}, error) {
+		var keys []solana.PublicKey
+		require.NoError(t, json.Unmarshal(params[0], &keys))
+
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = accounts[key]
+		}
+
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": values}, nil
+	})
+
+	b := &Bot{
+		rpcClient:                mock.client(),
+		curveDivergenceTolerance: 0.01,
+		pendingCoins:             map[string]*Coin{near.mintAddr.String(): near, drifted.mintAddr.String(): drifted, untracked.mintAddr.String(): untracked},
+	}
+
+	// 0.1% off is within tolerance, 10% isn't
+	offBy := func(fraction float64) *BondingCurveData {
+		curve := curveAfterCreatorBuy(100_000_000_000000)
+		drift, _ := new(big.Float).Mul(new(big.Float).SetInt(curve.VirtualSolReserves), big.NewFloat(fraction)).Int(nil)
+		curve.VirtualSolReserves.Add(curve.VirtualSolReserves, drift)
+		return curve
+	}
+	nearCurve := offBy(0.001)
+	b.updateCurve(near, nearCurve)
+	b.updateCurve(drifted, offBy(0.1))
+
+	resyncs := curveResyncs.value.Load()
+	require.NoError(t, b.reconcileCurves(context.Background()))
+
+	// only coins we keep a local curve for are fetched
+	calls := mock.callsTo("getMultipleAccounts")
+	require.Len(t, calls, 1)
+	var keys []solana.PublicKey
+	require.NoError(t, json.Unmarshal(calls[0].Params[0], &keys))
+	require.ElementsMatch(t, []solana.PublicKey{near.tokenBondingCurve, drifted.tokenBondingCurve}, keys)
+
+	require.Same(t, nearCurve, near.curve.Load())
+	require.Equal(t, chain.VirtualSolReserves, drifted.curve.Load().VirtualSolReserves)
+	require.Equal(t, resyncs+1, curveResyncs.value.Load())
+	require.Nil(t, untracked.curve.Load())
+}
+
+func TestCurveDivergence(t *testing.T) {
+	chain := &BondingCurveData{VirtualSolReserves: big.NewInt(40_000_000_000)}
+
+	require.Zero(t, curveDivergence(chain, chain))
+	require.InDelta(t, 0.025, curveDivergence(&BondingCurveData{VirtualSolReserves: big.NewInt(41_000_000_000)}, chain), 1e-9)
+	require.InDelta(t, 0.025, curveDivergence(&BondingCurveData{VirtualSolReserves: big.NewInt(39_000_000_000)}, chain), 1e-9)
+}
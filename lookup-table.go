@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+var (
+	addressLookupTableProgramID = solana.MustPublicKeyFromBase58("AddressLookupTab1e1111111111111111111111111")
+
+	// every pump.fun trade passes the program's event authority PDA
+	pumpEventAuthority, _, _ = solana.FindProgramAddress([][]byte{[]byte("__event_authority")}, pumpProgramID)
+
+	errLookupTableNotReady = errors.New("Lookup Table Not Ready")
+)
+
+const (
+	// where the table's authority starts in its account data, after the option tag
+	lookupTableAuthorityOffset = 22
+
+	// ALT program instruction indexes (bincode u32)
+	lookupTableCreateIndex = 0
+	lookupTableExtendIndex = 2
+
+	// a table (and addresses added to it) can only be looked up from the slot after it was extended
+	lookupTableActivationAttempts = 10
+	lookupTableActivationDelay    = 400 * time.Millisecond
+)
+
+// pumpLookupTableAddresses are the accounts every pump.fun buy & sell passes regardless of the coin.
+// looking these up from a table instead of encoding them inline leaves room for more instructions
+func (b *Bot) pumpLookupTableAddresses() solana.PublicKeySlice {
+	return solana.PublicKeySlice{
+		globalAddr,
+		b.currentFeeRecipient(),
+		solana.SystemProgramID,
+		solana.TokenProgramID,
+		rent,
+		pumpProgramID,
+		pumpEventAuthority,
+	}
+}
+
+// loadPumpLookupTable finds our address lookup table holding the static pump.fun accounts, creating it
+// if we have none, so buy & sell transactions are sent as v0 transactions using it
+func (b *Bot) loadPumpLookupTable() error {
+	wanted := b.pumpLookupTableAddresses()
+
+	table, addresses, err := b.findPumpLookupTable(wanted)
+	if err != nil {
+		return err
+	}
+
+	if table.IsZero() {
+		if table, err = b.createPumpLookupTable(wanted); err != nil {
+			return err
+		}
+		addresses = wanted
+
+		b.statusg("Created pump lookup table " + table.String())
+	} else {
+		b.status("Using pump lookup table " + table.String())
+	}
+
+	b.addressTables = map[solana.PublicKey]solana.PublicKeySlice{table: addresses}
+	return nil
+}
+
+// findPumpLookupTable looks through the active lookup tables our wallet is the authority of for one
+// holding all of `wanted`, returning a zero key if there's none
+func (b *Bot) findPumpLookupTable(wanted solana.PublicKeySlice) (solana.PublicKey, solana.PublicKeySlice, error) {
+	accounts, err := b.rpcClient.GetProgramAccountsWithOpts(context.TODO(), addressLookupTableProgramID, &rpc.GetProgramAccountsOpts{
+		Commitment: rpc.CommitmentConfirmed,
+		Encoding:   solana.EncodingBase64,
+		Filters: []rpc.RPCFilter{{
+			Memcmp: &rpc.RPCFilterMemcmp{Offset: lookupTableAuthorityOffset, Bytes: b.privateKey.PublicKey().Bytes()},
+		}},
+	})
+	if err != nil {
+		return solana.PublicKey{}, nil, err
+	}
+
+	for _, account := range accounts {
+		state, err := addresslookuptable.DecodeAddressLookupTableState(account.Account.Data.GetBinary())
+		if err != nil || !state.IsActive() {
+			continue
+		}
+
+		if state.Addresses.ContainsAll(wanted) {
+			return account.Pubkey, state.Addresses, nil
+		}
+	}
+
+	return solana.PublicKey{}, nil, nil
+}
+
+// createPumpLookupTable creates a lookup table holding `addresses` in a single tx, waiting until it can be used
+func (b *Bot) createPumpLookupTable(addresses solana.PublicKeySlice) (solana.PublicKey, error) {
+	authority := b.privateKey.PublicKey()
+
+	// the table's address derives from a recent slot, which must still be in the slot hashes
+	recentSlot, err := b.rpcClient.GetSlot(context.TODO(), rpc.CommitmentFinalized)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	createInst, table, err := newCreateLookupTableInstruction(authority, recentSlot)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	recent, err := b.rpcClient.GetLatestBlockhash(context.TODO(), rpc.CommitmentFinalized)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	tx, err := solana.NewTransaction(
+		[]solana.Instruction{createInst, newExtendLookupTableInstruction(table, authority, addresses)},
+		recent.Value.Blockhash,
+		solana.TransactionPayer(authority),
+	)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+
+	if _, err := b.signAndSendTx(context.TODO(), tx, false); err != nil {
+		return solana.PublicKey{}, fmt.Errorf("creating lookup table: %w", err)
+	}
+
+	return table, b.waitForLookupTable(table, addresses)
+}
+
+// waitForLookupTable waits until `table` is visible holding `addresses`, and a slot has passed since
+func (b *Bot) waitForLookupTable(table solana.PublicKey, addresses solana.PublicKeySlice) error {
+	for attempt := 0; attempt < lookupTableActivationAttempts; attempt++ {
+		time.Sleep(lookupTableActivationDelay)
+
+		state, err := addresslookuptable.GetAddressLookupTableStateWithOpts(context.TODO(), b.rpcClient, table, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+		if err != nil || !state.Addresses.ContainsAll(addresses) {
+			continue
+		}
+
+		slot, err := b.rpcClient.GetSlot(context.TODO(), rpc.CommitmentConfirmed)
+		if err == nil && slot > state.LastExtendedSlot {
+			return nil
+		}
+	}
+
+	return errLookupTableNotReady
+}
+
+// newCreateLookupTableInstruction builds the ALT program's CreateLookupTable, returning the new table's address
+func newCreateLookupTableInstruction(authority solana.PublicKey, recentSlot uint64) (solana.Instruction, solana.PublicKey, error) {
+	slotBytes := binary.LittleEndian.AppendUint64(nil, recentSlot)
+
+	table, bump, err := solana.FindProgramAddress([][]byte{authority.Bytes(), slotBytes}, addressLookupTableProgramID)
+	if err != nil {
+		return nil, solana.PublicKey{}, err
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, lookupTableCreateIndex)
+	data = append(data, slotBytes...)
+	data = append(data, bump)
+
+	return solana.NewInstruction(addressLookupTableProgramID, solana.AccountMetaSlice{
+		solana.Meta(table).WRITE(),
+		solana.Meta(authority).SIGNER(),
+		solana.Meta(authority).WRITE().SIGNER(),
+		solana.Meta(solana.SystemProgramID),
+	}, data), table, nil
+}
+
+// newExtendLookupTableInstruction builds the ALT program's ExtendLookupTable, appending `addresses` to `table`
+func newExtendLookupTableInstruction(table, authority solana.PublicKey, addresses solana.PublicKeySlice) solana.Instruction {
+	data := binary.LittleEndian.AppendUint32(nil, lookupTableExtendIndex)
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(addresses)))
+	for _, address := range addresses {
+		data = append(data, address.Bytes()...)
+	}
+
+	return solana.NewInstruction(addressLookupTableProgramID, solana.AccountMetaSlice{
+		solana.Meta(table).WRITE(),
+		solana.Meta(authority).SIGNER(),
+		solana.Meta(authority).WRITE().SIGNER(),
+		solana.Meta(solana.SystemProgramID),
+	}, data)
+}
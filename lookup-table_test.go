@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	"github.com/stretchr/testify/require"
+)
+
+func lookupTableAccount(t *testing.T, authority solana.PublicKey, deactivationSlot uint64, addresses solana.PublicKeySlice) string {
+	state := addresslookuptable.AddressLookupTableState{
+		TypeIndex:        1,
+		DeactivationSlot: deactivationSlot,
+		Authority:        &authority,
+		Addresses:        addresses,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, state.MarshalWithEncoder(bin.NewBinEncoder(&buf)))
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestCreateTransactionWithLookupTable(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, tokenBondingCurve: f.bondingCurve, associatedBondingCurve: f.associatedBondingCurve, eventAuthority: f.eventAuthority}
+
+	b := &Bot{privateKey: solana.NewWallet().PrivateKey}
+	b.blockhash.Store(&solana.Hash{})
+	ata, _, err := solana.FindAssociatedTokenAddress(b.privateKey.PublicKey(), f.mint)
+	require.NoError(t, err)
+
+	buy := b.createBuyInstruction(big.NewInt(1000), 1e9, coin, ata).Build()
+
+	legacy, err := b.createTransaction(buy)
+	require.NoError(t, err)
+	require.False(t, legacy.Message.IsVersioned())
+
+	table := solana.NewWallet().PublicKey()
+	b.addressTables = map[solana.PublicKey]solana.PublicKeySlice{table: b.pumpLookupTableAddresses()}
+
+	tx, err := b.createTransaction(buy)
+	require.NoError(t, err)
+	require.True(t, tx.Message.IsVersioned())
+	require.Len(t, tx.Message.AddressTableLookups, 1)
+	require.Equal(t, table, tx.Message.AddressTableLookups[0].AccountKey)
+
+	// the invoked program stays inline, the other static accounts are looked up
+	require.Contains(t, tx.Message.AccountKeys, pumpProgramID)
+	for _, static := range []solana.PublicKey{globalAddr, feeRecipient, rent, pumpEventAuthority, solana.SystemProgramID, solana.TokenProgramID} {
+		require.NotContains(t, tx.Message.AccountKeys, static)
+	}
+	require.Len(t, tx.Message.AccountKeys, len(legacy.Message.AccountKeys)-6)
+
+	// the message survives a round trip
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	decoded, err := solana.TransactionFromBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, tx.Message.AccountKeys, decoded.Message.AccountKeys)
+}
+
+func TestFindPumpLookupTable(t *testing.T) {
+	b := &Bot{privateKey: solana.NewWallet().PrivateKey}
+	authority := b.privateKey.PublicKey()
+	wanted := b.pumpLookupTableAddresses()
+
+	partial, deactivated, ours := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	tables := map[solana.PublicKey]string{
+		partial:     lookupTableAccount(t, authority, math.MaxUint64, wanted[:3]),
+		deactivated: lookupTableAccount(t, authority, 100, wanted),
+		ours:        lookupTableAccount(t, authority, math.MaxUint64, append(solana.PublicKeySlice{solana.NewWallet().PublicKey()}, wanted...)),
+	}
+
+	mock := newMockRPC(t)
+	mock.handle("getProgramAccounts", func(params []json.RawMessage) (interface{}, error) {
+		var opts struct {
+			Filters []struct {
+				Memcmp struct {
+					Offset uint64 `json:"offset"`
+					Bytes  string `json:"bytes"`
+				} `json:"memcmp"`
+			} `json:"filters"`
+		}
+		require.NoError(t, json.Unmarshal(params[1], &opts))
+		require.Len(t, opts.Filters, 1)
+		require.EqualValues(t, lookupTableAuthorityOffset, opts.Filters[0].Memcmp.Offset)
+		require.Equal(t, authority.String(), opts.Filters[0].Memcmp.Bytes)
+
+		var result []interface{}
+		for _, table := range []solana.PublicKey{partial, deactivated, ours} {
+			result = append(result, map[string]interface{}{
+				"pubkey": table.String(),
+				"account": map[string]interface{}{
+					"data":       []string{tables[table], "base64"},
+					"executable": false,
+					"lamports":   1,
+					"owner":      addressLookupTableProgramID.String(),
+					"rentEpoch":  0,
+				},
+			})
+		}
+
+		return result, nil
+	})
+	b.rpcClient = mock.client()
+
+	table, addresses, err := b.findPumpLookupTable(wanted)
+	require.NoError(t, err)
+	require.Equal(t, ours, table)
+	require.True(t, addresses.ContainsAll(wanted))
+
+	// nothing holding every address
+	table, _, err = b.findPumpLookupTable(append(wanted, solana.NewWallet().PublicKey()))
+	require.NoError(t, err)
+	require.True(t, table.IsZero())
+}
+
+func TestLookupTableInstructions(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+
+	create, table, err := newCreateLookupTableInstruction(authority, 123)
+	require.NoError(t, err)
+
+	expected, bump, err := solana.FindProgramAddress([][]byte{authority.Bytes(), {123, 0, 0, 0, 0, 0, 0, 0}}, addressLookupTableProgramID)
+	require.NoError(t, err)
+	require.Equal(t, expected, table)
+
+	data, err := create.Data()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 0, 123, 0, 0, 0, 0, 0, 0, 0, bump}, data)
+
+	extend := newExtendLookupTableInstruction(table, authority, solana.PublicKeySlice{globalAddr, rent})
+	data, err = extend.Data()
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}, data[:12])
+	require.Equal(t, globalAddr.Bytes(), data[12:44])
+	require.Equal(t, rent.Bytes(), data[44:])
+}
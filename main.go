@@ -1,11 +1,19 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/1fge/pump-fun-sniper-bot/replay"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/joho/godotenv"
 )
 
@@ -16,13 +24,296 @@ var (
 	wsURL    = "ws://127.0.0.1:8800"
 	proxyURL = ""
 
+	// headers sent with every request to `rpcURL`, e.g. a provider's API key, from `RPC_HEADERS`
+	// as `Name: value` pairs separated by `;` so secrets stay out of the url
+	rpcHeaders http.Header
+
+	// where we store coins, creator stats & trades, `sqlite://<path>` or `mysql://<dsn>`. overridden by `DATABASE_URL`,
+	// so credentials stay out of the source. empty keeps creator history in memory until restart & only logs trades
+	databaseURL = ""
+
+	// jito geyser gRPC endpoint, only needed for `--mint-detection geyser`
+	geyserURL = ""
+
+	// leave maxSupportedTransactionVersion out of getTransaction, for custom / older RPCs which reject it.
+	// if left on, it's dropped automatically the first time the RPC rejects it
+	omitTxVersion = false
+
+	// resubscribe to mints (and alert) if none arrive over the websocket for this long, 0 disables it
+	mintIdleTimeout = 2 * time.Minute
+
+	// ping every websocket connection this often, redialing it (and resubscribing everything on it) if the
+	// ping isn't answered within `wsPingTimeout`. 0 disables it
+	wsPingInterval = 10 * time.Second
+	wsPingTimeout  = 2 * time.Second
+
+	// launchpad programs to detect mints on, pump and forks sharing its instructions. empty watches pump only.
+	// coins created on forks are recorded (feeding the creator filters) but never bought
+	mintProgramIDs = []solana.PublicKey{
+		// insert fork program IDs here, along with pumpProgramID to keep watching pump
+	}
+
+	// append every mint, decision, buy & sell (with the coin's state) to this file as JSON lines, "" disables it
+	eventLogPath = ""
+
+	// write every create we decode to the coins table, in batches at least this often, so the "creator created coin
+	// before" check knows about launches we saw. 0 disables it, leaving the table to be populated by hand
+	createdCoinFlushInterval = time.Second
+
+	// wallets of other sniper bots. when one buys a coin in the block our buy of it landed in, we may not have been
+	// the second buyer, so every `competedBuysBeforeCut` such buys cut what we spend per coin by `competedBuyCut`
+	knownCompetitorBots = map[string]bool{
+		// insert competitor wallet addresses here
+	}
+	competedBuysBeforeCut = 3
+	competedBuyCut        = 0.1
+
+	// log the positions closed today, their win rate & P&L (from the trade legs we record) this often. 0 disables it
+	tradeSummaryInterval = time.Hour
+
+	// run mint checks (DB & RPC lookups of new coins) on this many workers, queueing up to `mintCheckQueueSize`
+	// more and dropping the oldest queued once full. 0 gives every mint its own goroutine
+	mintCheckWorkers   = 32
+	mintCheckQueueSize = 256
+
+	// discard coins waiting to be bought which were picked up longer ago than this, 0 buys them however late
+	maxQueueAge = 3 * time.Second
+
+	// websocket connections to `wsURL`, one for mint detection & the rest shared by the coins we hold
+	wsConnections = 3
+
 	sendTxRPCs = []string{
 		// insert public RPCs / alernate RPCs here to increase likelihood of tx landing
 	}
 
+	// send to `sendTxRPCs` this long after our dedicated RPC, 0 sends to all of them at once
+	freeRPCSendDelay = time.Duration(0)
+
 	shouldProxy = strings.Contains(os.Getenv("PROXY_URL"), "http")
+
+	// purchase coins with 0.05 solana, priority fee of 200000 microlamp
+	buySol                  = 0.05
+	priorityFeeMicroLamport = uint64(200000)
+
+	// set `buyMode` to `buyModeTokenAmount` to buy a fixed number of tokens (raw units, 6 decimals)
+	// instead of spending `buySol`, skipping coins where that would cost more than `maxBuySol`
+	buyMode        = buyModeSolAmount
+	buyTokenAmount = uint64(0)
+	maxBuySol      = 0.1
+
+	// SOL always left in the wallet for fees & tips, buys which would spend into it are skipped. 0 skips the balance check
+	reserveSol = 0.0
+
+	// refetch our SOL balance the reserve is checked against this often, buys sent since are held against the last one
+	walletBalanceRefreshInterval = 2 * time.Second
+
+	// create our ATA in its own confirmed tx before buying, for strategies that aren't time critical. the buy
+	// waits `ataConfirmDelay` after the ATA tx confirms, then checks the ATA exists before buying into it
+	separateATATx   = false
+	ataConfirmDelay = 500 * time.Millisecond
+
+	// build buys for real but only log what they'd pay (tokens, slippage, tip & fees) instead of sending them
+	shadowBuy = false
+
+	// abort a buy when jito's mempool shows someone else buying the coin before ours is sent
+	monitorMempool = false
+
+	// send buys & sells as v0 transactions looking the static pump accounts up from our own
+	// address lookup table, created on startup (paying its rent) if we don't have one yet
+	useLookupTable = false
+
+	// commitment a buy must reach before the position counts as open for accounting, e.g. `rpc.CommitmentFinalized`.
+	// sells are armed once the buy confirms either way
+	buyAccountingCommitment = rpc.CommitmentConfirmed
+
+	// sell once a position is up this much SOL (needs the trade tape of the coin), 0 disables it
+	maxHoldValueSol = 0.0
+
+	// sell once others sold more SOL than they bought over this window (needs the trade tape of the coin), 0 disables it
+	netOutflowExitWindow = time.Duration(0)
+
+	// skip coins whose curve is already this far (percent) toward migration when we buy, and sell held
+	// coins once their curve gets this close to completing (checked on every trade of the coin). 0 disables either
+	maxBuyCurveProgress = 0.0
+	exitCurveProgress   = 0.0
+
+	// skip coins whose curve is already this far (percent) toward migration when we first check them, e.g. 20.
+	// catches coins we detected late. 0 disables it
+	maxEvalCurveFill = 0.0
+
+	// wait until this many slots passed since a coin's create before buying it, e.g. 2. 0 disables it
+	minSlotsBeforeBuy = uint64(0)
+
+	// fetch the curves of all our coins this often in a single getMultipleAccounts call, feeding the curve exits
+	// between trades (or for coins without a trade tape). 0 disables it
+	curvePollInterval = time.Duration(0)
+
+	// quote buys off a coin's local curve (kept current from its trades) if it was updated this recently, rather
+	// than fetching it. 0 always fetches. local curves are checked against chain every `curveReconcileInterval`
+	// (0 disables it), resyncing any more than `curveDivergenceTolerance` (a fraction) off
+	localCurveMaxAge         = time.Duration(0)
+	curveReconcileInterval   = 30 * time.Second
+	curveDivergenceTolerance = 0.01
+
+	// treat bonding curves an RPC node served over this many slots behind the current slot as stale, refetching
+	// them before a buy and skipping them when polling. 0 disables the check
+	maxCurveSlotLag = uint64(10)
+
+	// also ask this RPC for the bonding curve of a new coin while our own doesn't see it yet, "" only asks ours
+	bondingCurveFallbackRPC = ""
+
+	// refetch pump's Global params (fee recipient, fees...) this often, in case we missed the SetParams changing them
+	globalParamsRefreshInterval = 30 * time.Minute
+
+	// annotate SOL amounts (P&L, buys, loss limit) with their USD value, from a price API answering like CoinGecko's
+	// simple price (e.g. `coinGeckoSolPriceURL`) and cached for `solPriceTTL`. "" reports in SOL only
+	solPriceURL = ""
+	solPriceTTL = time.Minute
+
+	// skip coins others already bought more than this much SOL of after the creator
+	maxExternalSolBeforeEntry = 0.1
+
+	// exit strategy held coins follow on their trade tape, e.g. `strategyHalfAt2xBreakeven` sells half once the
+	// price doubles and the rest if it falls back to our entry. `strategyNone` leaves exits to the triggers above
+	strategyPreset = strategyNone
+
+	// how many trades of each held coin's trade tape its price history keeps, 0 keeps none
+	priceHistoryLength = 256
+
+	// endpoint listing jito-enabled validators, can be swapped for a proxy
+	jitoValidatorsURL = "https://kobe.mainnet.jito.network/api/v1/validators"
+
+	// floor for jito tips (in lamports), protects against near zero tip percentiles
+	minTipLamports uint64 = 100000
+
+	// which sides of a trade are allowed to go through jito with a tip
+	tipOnBuy  = true
+	tipOnSell = true
+
+	// compute unit limits of vanilla / jito sell txs, sells run heavier than buys when the chain is busy
+	sellComputeUnitLimits     uint32 = 100000
+	jitoSellComputeUnitLimits uint32 = 80000
+
+	// optional backup mint detection through PumpPortal webhooks
+	// set `pumpPortalWebhookURL` to the public URL of this machine's webhook server. the server listens on
+	// `webhookServerHost`, local only by default, so expose it through a proxy adding `Authorization: Bearer <WEBHOOK_TOKEN>`
+	pumpPortalWebhookURL = ""
+	webhookServerHost    = "127.0.0.1"
+	webhookServerPort    = 8090
+
+	// serve metrics (e.g. dropped ws messages) on this port, 0 disables. also serves `/resume` & `/panic`, authorized by `CONTROL_TOKEN`
+	metricsServerPort = 0
+
+	// exit once the sells started by `/panic` are done, rather than staying up with buys halted
+	panicExit = false
+
+	// halt new buys once the day's (UTC) closed positions lost more than this much SOL, until `/resume`. 0 disables it
+	maxDailyLossSol = 0.0
+
+	// buffer size of the coinsToBuy / coinsToSell channels, 0 keeps them unbuffered
+	pipelineBufferSize = 0
+
+	// most funder safety checks running at once across all mints, 0 leaves them unbounded
+	maxFunderChecks = 16
+
+	// mints we never trade (known scams, coins we're avoiding), plus any listed one per line in `mintDenylistFile`
+	mintDenylist     = []string{}
+	mintDenylistFile = ""
+
+	// skip coins bought in the create's block by wallets sharing a funder with the creator. costs up to
+	// `maxCoordinatedBuyersChecked` extra funder lookups per launch, sharing the `maxFunderChecks` limit
+	detectCoordinatedBuys = false
+
+	// skip coins whose creator launched another coin this recently, however they look otherwise. 0 disables it
+	creatorCooldown = time.Duration(0)
+
+	// how far (0-1) the creator's token balance must drop in one account notification to count as a sell
+	// without fetching the creator's transactions, smaller drops are classified from their transactions
+	creatorSellDropThreshold = 0.5
+
+	// how far (0-1) the creator's token balance must drop between a fetched tx's pre & post balances
+	// for the tx to count as a sell / transfer, catching sells routed through aggregators
+	creatorMetaSellThreshold = 0.1
+
+	// also watch each coin's creator wallet, exiting on a SOL inflow of at least `creatorWalletInflowSol`
+	// (sell proceeds routed back from another wallet) or once the wallet is drained to `creatorWalletDrainedSol`
+	watchCreatorWallet      = false
+	creatorWalletInflowSol  = 1.0
+	creatorWalletDrainedSol = 0.01
+
+	// what to do with a held coin whose creator listener died: sell it (`deadListenerExit`) or listen again (`deadListenerRestart`)
+	deadListenerAction = deadListenerExit
+
+	// how many of the latest txs of the creator we search for funders, and of the creator ATA we check for a
+	// sell / transfer. more lookback finds more at the cost of latency
+	funderLookbackSigs     = 30
+	creatorAtaLookbackSigs = 3
+
+	// skip coins whose creator did not buy in the launch tx
+	requireCreatorBuy = true
+
+	// skip coins whose creator was funded inside the launch tx itself
+	requireOlderFunder = true
+
+	// share (0-1) of their peak holdings the creator must have sold / moved in total before we exit,
+	// smaller sells (e.g. test transfers to an exchange) are logged and ignored
+	creatorDustSellShare = 0.05
+
+	// times fetchBondingCurve retries while a new bonding curve account isn't visible yet, `bondingCurveRetryDelay` apart
+	bondingCurveRetries    = 3
+	bondingCurveRetryDelay = 100 * time.Millisecond
+
+	// persist the launches, sells & graduations of creators, skipping creators who sold out of at least
+	// `creatorMaxRugRate` (0-1) of their launches, or whose median sell came within `creatorMinMedianSellTime` of launch
+	recordCreatorStats       = true
+	creatorMaxRugRate        = 0.5
+	creatorMinMedianSellTime = time.Minute
+
+	// when a creator ATA notification can't be classified on its own, fetch the ATA's new txs up to `creatorTxCheckAttempts`
+	// times, `creatorTxCheckInterval` apart, each fetch timing out after `creatorTxFetchTimeout`
+	creatorTxCheckAttempts = 10
+	creatorTxCheckInterval = 200 * time.Millisecond
+	creatorTxFetchTimeout  = 900 * time.Millisecond
+
+	// most held coins we stream the full trade tape of at once (flow exits, curve updates), 0 disables it
+	maxTradeTapes = 20
+
+	// fetch each coin's mint account, skipping coins whose mint or freeze authority is still set,
+	// or whose decimals / supply aren't pump's
+	checkMintTokenomics = true
+
+	// times SellCoinFast sells again while our token balance shows tokens left after a sell confirmed
+	sellRounds = 3
+
+	// `logFormatJSON` prints status lines as single-line JSON (level, component, mint, msg, ts) for log aggregators
+	logFormat = logFormatText
+)
+
+var (
+	bigtableReplay   = flag.Bool("bigtable-replay", false, "replay historical pump.fun creates from the Solana Bigtable ledger in dry-run mode, then exit")
+	replayFrom       = flag.String("replay-from", "", "start date of the replay (YYYY-MM-DD, UTC)")
+	replayTo         = flag.String("replay-to", "", "end date of the replay, exclusive (YYYY-MM-DD, UTC)")
+	replayOut        = flag.String("replay-out", "replay.csv", "CSV file the replay decisions are written to")
+	bigtableEndpoint = flag.String("bigtable-endpoint", replay.DefaultBigtableEndpoint, "Solana ledger Bigtable endpoint")
+)
+
+var mintDetection = flag.String("mint-detection", mintDetectionLogs, "how new mints are detected: logs, block (full blocks, needs block subscriptions enabled on the RPC), events (pump's create events, skips fetching the mint tx) or geyser (needs geyserURL)")
+
+var logInstructions = flag.String("log-instructions", "", "append the raw pump.fun instructions of every mint tx (decoded or not) to this file as JSON lines, to fix the decoder after contract upgrades")
+
+var (
+	recordBuyFills = flag.String("record-buy-fills", "", "record the pump.fun buys & sells in the txs listed (one signature per line) in this file for the quote tests, then exit")
+	buyFillsOut    = flag.String("buy-fills-out", "testdata/buy-fills.json", "JSON file the recorded buys are written to")
+	sellFillsOut   = flag.String("sell-fills-out", "testdata/sell-fills.json", "JSON file the recorded sells are written to")
+)
+
+var (
+	recordTx    = flag.String("record-tx", "", "record the tx with this signature as a test fixture, then exit")
+	recordTxOut = flag.String("record-tx-out", "testdata/tx.json", "JSON file the recorded tx is written to")
 )
 
+var backfillCreatorStats = flag.Bool("backfill-creator-stats", false, "seed the creator_stats launches of the coins we traded, then exit")
+
 func loadPrivateKey() (string, error) {
 	if err := godotenv.Load(); err != nil {
 		return "", err
@@ -32,11 +323,62 @@ func loadPrivateKey() (string, error) {
 }
 
 func main() {
-	db, err := sql.Open("mysql", "root:XXXXXX!@/CoinTrades")
-	if err != nil {
-		log.Fatal(err)
+	flag.Parse()
+	setLogFormat(logFormat)
+
+	// `go run . selftest` checks our pump instructions offline, then exits
+	if flag.Arg(0) == "selftest" {
+		if err := runSelfTest(); err != nil {
+			log.Fatal("Self Test Failed ", err)
+		}
+		log.Println("Self test passed")
+		return
+	}
+
+	if *recordTx != "" {
+		if err := startTxFixtureRecording(rpcURL, *recordTx, *recordTxOut); err != nil {
+			log.Fatal("Error Recording Tx ", err)
+		}
+		return
+	}
+
+	if *recordBuyFills != "" {
+		if err := startBuyFillRecording(rpcURL, *recordBuyFills, *buyFillsOut, *sellFillsOut); err != nil {
+			log.Fatal("Error Recording Buy Fills ", err)
+		}
+		return
+	}
+
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		databaseURL = url
+	}
+
+	var store Store = newMemoryStore()
+	if databaseURL == "" {
+		log.Println("WARNING: no DATABASE_URL set, storing in memory. creator history filtering resets on restart, trades are only logged")
+	} else {
+		db, err := openStore(databaseURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.db.Close()
+
+		store = db
+	}
+
+	if *backfillCreatorStats {
+		if err := startCreatorStatsBackfill(store); err != nil {
+			log.Fatal("Error Backfilling Creator Stats ", err)
+		}
+		return
+	}
+
+	if *bigtableReplay {
+		if err := startBigtableReplay(store); err != nil {
+			log.Fatal("Error Replaying From Bigtable ", err)
+		}
+		return
 	}
-	defer db.Close()
 
 	privateKey, err := loadPrivateKey()
 	if err != nil {
@@ -44,18 +386,204 @@ func main() {
 	}
 
 	proxyURL = os.Getenv("PROXY_URL")
+	rpcHeaders, err = parseRPCHeaders(os.Getenv("RPC_HEADERS"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// purchase coins with 0.05 solana, priority fee of 200000 microlamp
-	bot, err := NewBot(rpcURL, wsURL, privateKey, db, 0.05, 200000)
+	bot, err := NewBot(rpcURL, wsURL, privateKey, store, buySol, priorityFeeMicroLamport)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	bot.skipATALookup = true
+	bot.separateATATx = separateATATx
+	bot.ataConfirmDelay = ataConfirmDelay
+	bot.shadowBuy = shadowBuy
+	bot.omitTxVersion = omitTxVersion
+	bot.freeRPCSendDelay = freeRPCSendDelay
+	bot.monitorMempool = monitorMempool
+	bot.buyAccountingCommitment = buyAccountingCommitment
+	bot.deadListenerAction = deadListenerAction
+	bot.mintIdleTimeout = mintIdleTimeout
+	bot.maxQueueAge = maxQueueAge
+	bot.mintProgramIDs = mintProgramIDs
+	if mintCheckWorkers > 0 {
+		bot.mintChecks = newMintCheckPool(mintCheckWorkers, mintCheckQueueSize)
+	}
+
+	bot.creatorCooldown = creatorCooldown
+	bot.detectCoordinatedBuys = detectCoordinatedBuys
+	if pipelineBufferSize > 0 {
+		bot.coinsToBuy = make(chan *Coin, pipelineBufferSize)
+		bot.coinsToSell = make(chan string, pipelineBufferSize)
+	}
+	if maxFunderChecks > 0 {
+		bot.funderCheckSlots = make(chan struct{}, maxFunderChecks)
+	}
+	bot.creatorSellDropThreshold = creatorSellDropThreshold
+	bot.creatorMetaSellThreshold = creatorMetaSellThreshold
+	bot.watchCreatorWallet = watchCreatorWallet
+	bot.creatorWalletInflowSol = creatorWalletInflowSol
+	bot.creatorWalletDrainedSol = creatorWalletDrainedSol
+	bot.funderLookbackSigs = funderLookbackSigs
+	bot.creatorAtaLookbackSigs = creatorAtaLookbackSigs
+	bot.requireCreatorBuy = requireCreatorBuy
+	bot.requireOlderFunder = requireOlderFunder
+	bot.creatorDustSellShare = creatorDustSellShare
+	bot.bondingCurveRetries = bondingCurveRetries
+	bot.bondingCurveRetryDelay = bondingCurveRetryDelay
+	bot.recordCreatorStats = recordCreatorStats
+	bot.creatorMaxRugRate = creatorMaxRugRate
+	bot.creatorMinMedianSellTime = creatorMinMedianSellTime
+	bot.creatorTxCheckAttempts = creatorTxCheckAttempts
+	bot.creatorTxCheckInterval = creatorTxCheckInterval
+	bot.creatorTxFetchTimeout = creatorTxFetchTimeout
+	bot.maxTradeTapes = maxTradeTapes
+	bot.checkMintTokenomics = checkMintTokenomics
+	bot.sellRounds = sellRounds
+	bot.mintDenylist, err = loadMintDenylist(mintDenylist, mintDenylistFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if useLookupTable {
+		if err := bot.loadPumpLookupTable(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	bot.tipOnBuy = tipOnBuy
+	bot.tipOnSell = tipOnSell
+	bot.sellComputeUnitLimits = sellComputeUnitLimits
+	bot.jitoSellComputeUnitLimits = jitoSellComputeUnitLimits
+	bot.buyMode = buyMode
+	bot.buyTokenAmount = buyTokenAmount
+	bot.maxBuyLamport = uint64(maxBuySol * float64(solana.LAMPORTS_PER_SOL))
+	bot.reserveLamports = uint64(reserveSol * float64(solana.LAMPORTS_PER_SOL))
+	bot.walletBalanceRefreshInterval = walletBalanceRefreshInterval
+	bot.maxHoldValueSol = maxHoldValueSol
+	bot.netOutflowExitWindow = netOutflowExitWindow
+	bot.maxBuyCurveProgress = maxBuyCurveProgress
+	bot.exitCurveProgress = exitCurveProgress
+	bot.maxEvalCurveFill = maxEvalCurveFill
+	bot.minSlotsBeforeBuy = minSlotsBeforeBuy
+	bot.knownCompetitorBots = knownCompetitorBots
+	bot.competedBuysBeforeCut = competedBuysBeforeCut
+	bot.competedBuyCut = competedBuyCut
+	bot.curvePollInterval = curvePollInterval
+	bot.localCurveMaxAge = localCurveMaxAge
+	bot.curveReconcileInterval = curveReconcileInterval
+	bot.curveDivergenceTolerance = curveDivergenceTolerance
+	bot.maxCurveSlotLag = maxCurveSlotLag
+	bot.globalParamsRefreshInterval = globalParamsRefreshInterval
+	if bondingCurveFallbackRPC != "" {
+		bot.bondingCurveFallbackClient = rpc.New(bondingCurveFallbackRPC)
+	}
+	bot.maxExternalSolBeforeEntry = maxExternalSolBeforeEntry
+	bot.strategyPreset = strategyPreset
+	bot.priceHistoryLength = priceHistoryLength
+	bot.maxDailyLossSol = maxDailyLossSol
+	bot.controlToken = os.Getenv("CONTROL_TOKEN")
+	bot.webhookToken = os.Getenv("WEBHOOK_TOKEN")
+	bot.panicExit = panicExit
+
+	if token, chatID := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_ID"); token != "" && chatID != "" {
+		bot.notifier = newTelegramNotifier(token, chatID)
+	}
+
+	if eventLogPath != "" {
+		eventLog, err := openFileEventLog(eventLogPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer eventLog.Close()
 
-	go bot.HandleNewMints()
+		bot.eventLog = eventLog
+	}
+
+	if createdCoinFlushInterval > 0 {
+		bot.createdCoins = newCreatedCoinRecorder(bot.store, createdCoinFlushInterval)
+		go bot.createdCoins.run(context.Background())
+	}
+
+	if solPriceURL != "" {
+		bot.solPrice = newSolPriceFeed(newHTTPSolPriceSource(solPriceURL), solPriceTTL)
+		go bot.solPrice.refresh()
+	}
+
+	if *logInstructions != "" {
+		instrLogger, err := openInstructionLogger(*logInstructions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer instrLogger.Close()
+
+		bot.instrLogger = instrLogger
+	}
+
+	// buys are checked against the cached balance, so it's fetched before the first one
+	if bot.reserveLamports > 0 {
+		if err := bot.refreshWalletBalance(); err != nil {
+			log.Fatal("Error Fetching Wallet Balance ", err)
+		}
+
+		if walletBalanceRefreshInterval > 0 {
+			go bot.RefreshWalletBalance(context.Background())
+		}
+	}
+
+	if err := bot.startMintDetection(context.Background(), *mintDetection, geyserURL); err != nil {
+		log.Fatal("Error Starting Mint Detection ", err)
+	}
 	go bot.HandleBuyCoins()
-	go bot.HandleSellCoins()
+
+	if curvePollInterval > 0 {
+		go bot.PollCurves(context.Background())
+	}
+
+	if curveReconcileInterval > 0 {
+		go bot.ReconcileCurves(context.Background())
+	}
+
+	if globalParamsRefreshInterval > 0 {
+		go bot.RefreshGlobalParams(context.Background())
+	}
+
+	if wsPingInterval > 0 {
+		bot.wsPingInterval = wsPingInterval
+		bot.wsPingTimeout = wsPingTimeout
+		go bot.wsHealthMonitor(context.Background())
+	}
+
+	// trades kept in memory are only logged, there's nothing to summarize
+	if _, inMemory := store.(*memoryStore); tradeSummaryInterval > 0 && !inMemory {
+		bot.tradeSummaryInterval = tradeSummaryInterval
+		go bot.LogTradeSummary(context.Background())
+	}
+
+	if metricsServerPort != 0 {
+		go func() {
+			log.Fatal(bot.StartMetricsServer(metricsServerPort))
+		}()
+	}
+
+	if pumpPortalWebhookURL != "" {
+		if bot.webhookToken == "" {
+			log.Fatal("WEBHOOK_TOKEN must be set to receive PumpPortal webhooks")
+		}
+
+		go func() {
+			// a backup detection path, losing it leaves the bot running on log detection
+			addr := net.JoinHostPort(webhookServerHost, strconv.Itoa(webhookServerPort))
+			if err := bot.StartWebhookServer(addr); err != nil {
+				bot.statusr("PumpPortal webhook server stopped: " + err.Error())
+			}
+		}()
+
+		if err := bot.RegisterPumpPortalWebhook(pumpPortalWebhookURL, []string{"newToken"}); err != nil {
+			log.Fatal("Error Registering PumpPortal Webhook", err)
+		}
+	}
 
 	if err := bot.beginJito(); err != nil {
 		log.Fatal("Error Starting Jito", err)
@@ -63,3 +591,33 @@ func main() {
 
 	select {}
 }
+
+func startBigtableReplay(store Store) error {
+	from, err := time.Parse(time.DateOnly, *replayFrom)
+	if err != nil {
+		return err
+	}
+
+	to, err := time.Parse(time.DateOnly, *replayTo)
+	if err != nil {
+		return err
+	}
+
+	cfg := replay.BigtableConfig{Endpoint: *bigtableEndpoint}
+	return runBigtableReplay(store, cfg, buySol, from, to, *replayOut)
+}
+
+func startCreatorStatsBackfill(store Store) error {
+	db, ok := store.(*sqlStore)
+	if !ok {
+		return errNoDatabase
+	}
+
+	backfilled, err := db.backfillCreatorStats()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Backfilled creator stats (%d rows affected)\n", backfilled)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	jito_go "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go"
+	util "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/pkg"
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/proto"
+	"github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	errCompetingBuy = errors.New("Competing buy pending in mempool")
+	errNoJitoClient = errors.New("No Jito Client")
+)
+
+// mempoolStream is the part of the jito mempool subscription we read, faked in tests
+type mempoolStream interface {
+	Recv() (*proto.PendingTxNotification, error)
+}
+
+// MonitorMempool streams pending pump.fun txs from jito's mempool, signaling (once) as soon as a wallet
+// other than ours sends a buy of `mintAddr`. runs until ctx is done or the stream fails
+func (b *Bot) MonitorMempool(ctx context.Context, mintAddr solana.PublicKey, signal chan bool) error {
+	if b.jitoManager == nil || b.jitoManager.searcherClient() == nil {
+		return errNoJitoClient
+	}
+
+	jitoClient := b.jitoManager.searcherClient()
+
+	// the client's own subscription helpers are bound to its auth context, never ours, so we
+	// carry its auth metadata over to a stream which is torn down with ctx
+	md, _ := metadata.FromOutgoingContext(jitoClient.Auth.GrpcCtx)
+	stream, err := jitoClient.SearcherService.SubscribeMempool(metadata.NewOutgoingContext(ctx, md), &proto.MempoolSubscription{
+		Msg: &proto.MempoolSubscription_ProgramV0Sub{
+			ProgramV0Sub: &proto.ProgramSubscriptionV0{Programs: []string{pumpProgramID.String()}},
+		},
+		Regions: []string{jito_go.NewYork.Region},
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.watchPendingBuys(ctx, stream, mintAddr, signal)
+}
+
+// watchPendingBuys reads pending txs off `stream` until a competing buy of `mintAddr` shows up
+func (b *Bot) watchPendingBuys(ctx context.Context, stream mempoolStream, mintAddr solana.PublicKey, signal chan bool) error {
+	ourWallet := b.privateKey.PublicKey()
+
+	for {
+		notification, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for _, packet := range notification.Transactions {
+			tx, err := util.ConvertProtobufPacketToTransaction(packet)
+			if err != nil {
+				continue
+			}
+
+			buyer, ok := pendingBuyer(tx, mintAddr)
+			if !ok || buyer.Equals(ourWallet) {
+				continue
+			}
+
+			select {
+			case signal <- true:
+			default:
+			}
+			return nil
+		}
+	}
+}
+
+// pendingBuyer returns the wallet buying `mint` in a pending tx, if it buys it at all
+func pendingBuyer(tx *solana.Transaction, mint solana.PublicKey) (solana.PublicKey, bool) {
+	for _, inst := range decodeInstructions(tx) {
+		if inst.pumpName() != "buy" {
+			continue
+		}
+
+		buy, ok := inst.pump.Impl.(*pump.Buy)
+		if !ok {
+			continue
+		}
+
+		buyMint, user := buy.GetMintAccount(), buy.GetUserAccount()
+		if buyMint != nil && user != nil && buyMint.PublicKey.Equals(mint) {
+			return user.PublicKey, true
+		}
+	}
+
+	return solana.PublicKey{}, false
+}
+
+// startMempoolMonitor watches the mempool for competing buys of the coin while we build our buy,
+// returning the channel signaled if one shows up. nil when mempool monitoring is off
+func (b *Bot) startMempoolMonitor(ctx context.Context, coin *Coin) chan bool {
+	if !b.monitorMempool {
+		return nil
+	}
+
+	signal := make(chan bool, 1)
+	go func() {
+		if err := b.MonitorMempool(ctx, coin.mintAddr, signal); err != nil {
+			coin.status(fmt.Sprintf("Mempool monitor stopped: %s", err))
+		}
+	}()
+
+	return signal
+}
+
+// competingBuyPending reports whether the mempool monitor saw a competing buy yet
+func competingBuyPending(signal chan bool) bool {
+	select {
+	case <-signal:
+		return true
+	default:
+		return false
+	}
+}
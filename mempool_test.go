@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/proto"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMempoolStream hands out its notifications in order, then fails with `err`
+type fakeMempoolStream struct {
+	notifications []*proto.PendingTxNotification
+	err           error
+}
+
+func (s *fakeMempoolStream) Recv() (*proto.PendingTxNotification, error) {
+	if len(s.notifications) == 0 {
+		return nil, s.err
+	}
+
+	notification := s.notifications[0]
+	s.notifications = s.notifications[1:]
+	return notification, nil
+}
+
+func pendingPacket(t *testing.T, tx *solana.Transaction) *proto.Packet {
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	return &proto.Packet{Data: data, Meta: &proto.Meta{Size: uint64(len(data))}}
+}
+
+func TestWatchPendingBuys(t *testing.T) {
+	f := newLaunchFixture(t)
+	other := newLaunchFixture(t)
+	wallet := solana.NewWallet().PrivateKey
+	competitor := solana.NewWallet().PublicKey()
+
+	b := &Bot{privateKey: wallet}
+
+	t.Run("competing buy", func(t *testing.T) {
+		stream := &fakeMempoolStream{err: io.EOF, notifications: []*proto.PendingTxNotification{
+			// our own buy & a buy of another coin don't count
+			{Transactions: []*proto.Packet{
+				pendingPacket(t, newTestTx(t, wallet.PublicKey(), buyerInst(f, wallet.PublicKey()))),
+				pendingPacket(t, newTestTx(t, competitor, buyerInst(other, competitor))),
+			}},
+			{Transactions: []*proto.Packet{pendingPacket(t, newTestTx(t, competitor, buyerInst(f, competitor)))}},
+		}}
+
+		signal := make(chan bool, 1)
+		require.NoError(t, b.watchPendingBuys(context.Background(), stream, f.mint, signal))
+		require.True(t, competingBuyPending(signal))
+	})
+
+	t.Run("no competing buy", func(t *testing.T) {
+		stream := &fakeMempoolStream{err: io.EOF, notifications: []*proto.PendingTxNotification{
+			{Transactions: []*proto.Packet{pendingPacket(t, newTestTx(t, wallet.PublicKey(), buyerInst(f, wallet.PublicKey())))}},
+		}}
+
+		signal := make(chan bool, 1)
+		require.ErrorIs(t, b.watchPendingBuys(context.Background(), stream, f.mint, signal), io.EOF)
+		require.False(t, competingBuyPending(signal))
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		stream := &fakeMempoolStream{err: errors.New("stream cancelled")}
+		require.NoError(t, b.watchPendingBuys(ctx, stream, f.mint, make(chan bool, 1)))
+	})
+}
+
+func TestStartMempoolMonitorDisabled(t *testing.T) {
+	b := &Bot{}
+
+	// a nil channel never signals, so buys go ahead as before
+	signal := b.startMempoolMonitor(context.Background(), &Coin{})
+	require.Nil(t, signal)
+	require.False(t, competingBuyPending(signal))
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	metricsLock sync.Mutex
+	allCounters []*counter
+	allGauges   []*gauge
+	allHistVecs []*histogramVec
+
+	wsMessagesDropped = newCounter("ws_message_dropped_total", "Mint log messages dropped because the processing queue was full")
+	mintChecksDropped = newCounter("mint_checks_dropped_total", "Queued mint checks dropped for newer mints because every mint check worker was busy")
+
+	coinsToBuyDepth    = newGauge("coins_to_buy_depth", "Coins waiting to be picked up by HandleBuyCoins")
+	coinsToSellDepth   = newGauge("coins_to_sell_depth", "Coins waiting in the coinsToSell channel")
+	pipelineSaturation = newCounter("pipeline_saturation_total", "Times the buy / sell pipeline depth exceeded the warning threshold")
+
+	staleQueuedCoins = newCounter("stale_queued_coins_total", "Coins discarded from coinsToBuy for being picked up more than maxQueueAge ago")
+
+	tradeEventsDropped = newCounter("trade_events_dropped_total", "Trade events dropped because a coin's sell strategies weren't keeping up")
+
+	coinGoroutines    = newGauge("coin_goroutines", "Per-coin goroutines running (listeners, trade tapes, sells)")
+	mintChecksRunning = newGauge("mint_checks_running", "Checks of detected mints running, on the mint check pool or their own goroutines")
+
+	positionsOpened = newCounter("positions_opened_total", "Buys which reached the accounting commitment, opening a position")
+
+	mintWatchdogResubscribes = newCounter("mint_watchdog_resubscribes_total", "Times the mint subscription was restarted after going quiet for mintIdleTimeout")
+
+	wsHealthReconnects = newCounter("ws_health_reconnects_total", "WebSocket connections redialed after failing their ping")
+
+	shouldBuyTimeouts = newCounter("should_buy_timeout_total", "Coins passed on because shouldBuyCoin ran past its deadline")
+
+	staleCurveReads = newCounter("stale_curve_reads_total", "Bonding curve reads served more than maxCurveSlotLag slots behind the current slot")
+
+	curveResyncs = newCounter("curve_resync_total", "Local bonding curves resynced from chain after drifting past curveDivergenceTolerance")
+
+	jitoReconnects = newCounter("jito_reconnect_total", "Times the jito searcher client was redialed after its gRPC connection dropped")
+
+	rpcFirstSeenSlot = newHistogramVec("rpc_first_seen_slot", "Slot a send RPC returned our landed tx at, relative to the slot it landed in", "endpoint", []float64{-8, -4, -2, -1, 0, 1, 2, 4, 8})
+
+	createdCoinsDropped = newCounter("created_coins_dropped_total", "Decoded creates dropped because the coins table writer was behind")
+
+	competedBotBuys = newCounter("competed_bot_buys_total", "Buys of ours landing in the same block as a known competitor bot's buy of the coin")
+
+	creatorTxCheckMisses = newCounter("creator_tx_check_misses_total", "Creator ATA notifications whose fetched transactions showed no sell / transfer")
+)
+
+// counter is a monotonically increasing metric, exposed in the prometheus text format
+type counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+func newCounter(name, help string) *counter {
+	c := &counter{name: name, help: help}
+
+	metricsLock.Lock()
+	allCounters = append(allCounters, c)
+	metricsLock.Unlock()
+
+	return c
+}
+
+func (c *counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// gauge is a metric which can go up and down, exposed in the prometheus text format
+type gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func newGauge(name, help string) *gauge {
+	g := &gauge{name: name, help: help}
+
+	metricsLock.Lock()
+	allGauges = append(allGauges, g)
+	metricsLock.Unlock()
+
+	return g
+}
+
+func (g *gauge) Set(value int64) {
+	g.value.Store(value)
+}
+
+func (g *gauge) Add(delta int64) {
+	g.value.Add(delta)
+}
+
+func (g *gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// histogramVec is a histogram per value of its label, exposed in the prometheus text format
+type histogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64 // upper bounds, ascending. +Inf is implied
+
+	lock   sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // observations per bucket, not cumulative. the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help, label string, buckets []float64) *histogramVec {
+	h := &histogramVec{name: name, help: help, label: label, buckets: buckets, series: make(map[string]*histogram)}
+
+	metricsLock.Lock()
+	allHistVecs = append(allHistVecs, h)
+	metricsLock.Unlock()
+
+	return h
+}
+
+// Observe records `value` in the histogram of `labelValue`
+func (h *histogramVec) Observe(labelValue string, value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	series, ok := h.series[labelValue]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[labelValue] = series
+	}
+
+	bucket, _ := slices.BinarySearch(h.buckets, value)
+	series.counts[bucket]++
+	series.sum += value
+	series.count++
+}
+
+// Count is how many values were observed for `labelValue`
+func (h *histogramVec) Count(labelValue string) uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if series, ok := h.series[labelValue]; ok {
+		return series.count
+	}
+
+	return 0
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	labelValues := make([]string, 0, len(h.series))
+	for labelValue := range h.series {
+		labelValues = append(labelValues, labelValue)
+	}
+	slices.Sort(labelValues)
+
+	for _, labelValue := range labelValues {
+		series := h.series[labelValue]
+		labels := fmt.Sprintf("%s=%q", h.label, labelValue)
+
+		var cumulative uint64
+		for i, count := range series.counts {
+			cumulative += count
+
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", h.name, labels, le, cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_sum{%s} %g\n%s_count{%s} %d\n", h.name, labels, series.sum, h.name, labels, series.count)
+	}
+}
+
+// writeMetrics writes every registered metric in the prometheus text format
+func writeMetrics(w io.Writer) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	for _, c := range allCounters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value())
+	}
+
+	for _, g := range allGauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.Value())
+	}
+
+	for _, h := range allHistVecs {
+		h.write(w)
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
+
+// StartMetricsServer serves our metrics on `/metrics`, along with the `/resume` & `/panic` control endpoints.
+// It blocks until the server exits
+func (b *Bot) StartMetricsServer(port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/resume", b.handleResume)
+	mux.HandleFunc("/panic", b.handlePanic)
+
+	b.status(fmt.Sprintf("Serving metrics on :%d/metrics", port))
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/geyser_client"
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/proto"
+	"github.com/1fge/pump-fun-sniper-bot/replay"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// how new mints are detected, see `--mint-detection`
+const (
+	mintDetectionLogs   = "logs"   // pump program log subscription, a notification per tx
+	mintDetectionBlock  = "block"  // full blocks mentioning the pump program, every tx in order
+	mintDetectionGeyser = "geyser" // jito geyser transaction stream
+	mintDetectionEvents = "events" // pump's create & trade events, coins are built without fetching their tx
+)
+
+var (
+	errUnknownMintDetection = errors.New("Unknown Mint Detection Mode")
+	errNoGeyserURL          = errors.New("Geyser Mint Detection Needs A Geyser URL")
+)
+
+// startMintDetection starts detecting new mints with `mode`, one of the `mintDetection` modes
+func (b *Bot) startMintDetection(ctx context.Context, mode, geyserURL string) error {
+	switch mode {
+	case mintDetectionLogs:
+		go b.HandleNewMints()
+	case mintDetectionBlock:
+		go b.HandleNewMintsFromBlocks(ctx)
+	case mintDetectionEvents:
+		go b.EventStreamListener(ctx)
+	case mintDetectionGeyser:
+		if geyserURL == "" {
+			return errNoGeyserURL
+		}
+
+		client, err := geyser_client.New(ctx, geyserURL, nil)
+		if err != nil {
+			return err
+		}
+
+		go b.HandleNewMintsFromGeyser(ctx, client)
+	default:
+		return fmt.Errorf("%w: %q", errUnknownMintDetection, mode)
+	}
+
+	// geyser streams don't go through our websocket connections
+	if mode != mintDetectionGeyser && b.mintIdleTimeout > 0 {
+		go b.watchMintSubscription(ctx)
+	}
+
+	return nil
+}
+
+// HandleNewMintsFromBlocks runs as goroutine, subscribing to every block with a tx mentioning the pump
+// program. more bandwidth than the log subscription, but each block carries all of its txs in order, so
+// a mint can't be lost to a single dropped notification. the RPC needs `--rpc-pubsub-enable-block-subscription`
+func (b *Bot) HandleNewMintsFromBlocks(ctx context.Context) {
+	fmt.Println("Listening for new mints (blocks)...")
+
+	client := b.wsPool.client(mintConn)
+	sub, err := subscribePumpBlocks(client)
+	if err != nil {
+		log.Fatalf("Failed to subscribe to pump program blocks: %v", err)
+	}
+	defer func() { sub.Unsubscribe() }()
+
+	for ctx.Err() == nil {
+		msg, err := sub.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Error receiving block, resubscribing: %v\n", err)
+			client, sub = b.resubscribeMintBlocks(client)
+			continue
+		}
+
+		if msg.Value.Block == nil {
+			continue
+		}
+
+		b.processMintBlock(msg.Value.Slot, msg.Value.Block)
+	}
+}
+
+func subscribePumpBlocks(client *ws.Client) (*ws.BlockSubscription, error) {
+	version := uint64(0)
+	rewards := false
+
+	return client.BlockSubscribe(
+		ws.NewBlockSubscribeFilterMentionsAccountOrProgram(pumpProgramID),
+		&ws.BlockSubscribeOpts{
+			Commitment:                     rpc.CommitmentConfirmed,
+			Encoding:                       solana.EncodingBase64,
+			TransactionDetails:             rpc.TransactionDetailsFull,
+			Rewards:                        &rewards,
+			MaxSupportedTransactionVersion: &version,
+		},
+	)
+}
+
+// resubscribeMintBlocks redials the mint connection after `failed` dropped and subscribes to the pump
+// program blocks again, retrying until it works since we can't detect mints without it
+func (b *Bot) resubscribeMintBlocks(failed *ws.Client) (*ws.Client, *ws.BlockSubscription) {
+	for {
+		client, err := b.wsPool.reconnect(mintConn, failed)
+		if err == nil {
+			sub, err := subscribePumpBlocks(client)
+			if err == nil {
+				return client, sub
+			}
+
+			log.Printf("Failed to resubscribe to pump program blocks: %v\n", err)
+		} else {
+			log.Printf("Failed to redial mint connection: %v\n", err)
+		}
+
+		// if the redialed connection is the one failing, redial it again next time
+		failed = b.wsPool.client(mintConn)
+		time.Sleep(time.Second)
+	}
+}
+
+// processMintBlock launches the buy checks for every successful mint tx of a block
+func (b *Bot) processMintBlock(slot uint64, block *rpc.GetBlockResult) {
+	for _, blockTx := range block.Transactions {
+		if blockTx.Meta == nil || blockTx.Meta.Err != nil {
+			continue
+		}
+
+		// a fee change would fail every trade built with the old params
+		if containsSetParamsLog(blockTx.Meta.LogMessages) {
+			go b.refreshGlobalParamsAfterSetParams()
+		}
+
+		if !containsMintLog(blockTx.Meta.LogMessages) {
+			continue
+		}
+
+		b.lastMintSeen.Store(time.Now().UnixNano())
+
+		tx, err := blockTx.GetTransaction()
+		if err != nil || len(tx.Signatures) == 0 {
+			continue
+		}
+
+		b.dispatchMintTx(tx, blockTx.Meta, slot)
+	}
+}
+
+// HandleNewMintsFromGeyser runs as goroutine, streaming every tx jito's geyser sees and checking the
+// successful pump mints among them. the stream is resubscribed if it fails
+func (b *Bot) HandleNewMintsFromGeyser(ctx context.Context, client *geyser_client.Client) {
+	fmt.Println("Listening for new mints (geyser)...")
+
+	for ctx.Err() == nil {
+		stream, err := client.SubscribeTransactionUpdates()
+		if err != nil {
+			log.Printf("Failed to subscribe to geyser transactions: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for {
+			update, err := stream.Recv()
+			if err != nil {
+				log.Printf("Error receiving geyser transaction, resubscribing: %v\n", err)
+				break
+			}
+
+			b.processGeyserTransaction(update.GetTransaction())
+		}
+	}
+}
+
+// processGeyserTransaction launches the buy checks for a geyser streamed tx if it's a successful mint
+func (b *Bot) processGeyserTransaction(update *proto.TransactionUpdate) {
+	if update == nil || update.GetIsVote() {
+		return
+	}
+
+	meta := update.GetTx().GetMeta()
+	if meta == nil || meta.GetErr() != nil {
+		return
+	}
+
+	setParams, mint := containsSetParamsLog(meta.GetLogMessages()), containsMintLog(meta.GetLogMessages())
+	if !setParams && !mint {
+		return
+	}
+
+	// the stream carries every tx, mints of other token launchers included
+	tx, err := replay.TransactionFromProto(update.GetTx())
+	if err != nil || len(tx.Signatures) == 0 || !mentionsPumpProgram(tx) {
+		return
+	}
+
+	if setParams {
+		go b.refreshGlobalParamsAfterSetParams()
+	}
+
+	if !mint {
+		return
+	}
+
+	// geyser's meta isn't in RPC form, the creator's account is resolved without it
+	b.dispatchMintTx(tx, nil, update.GetSlot())
+}
+
+func mentionsPumpProgram(tx *solana.Transaction) bool {
+	for _, key := range tx.Message.AccountKeys {
+		if key.Equals(pumpProgramID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dispatchMintTx checks a mint tx received in full, unless another detection path already did
+func (b *Bot) dispatchMintTx(tx *solana.Transaction, meta *rpc.TransactionMeta, slot uint64) {
+	sig := tx.Signatures[0]
+	if !b.markMintDetected(sig) {
+		return
+	}
+
+	b.status(fmt.Sprintf("Detected Mint (%s) in slot %d", sig.String(), slot))
+	b.goMintCheck(func(detectedAt time.Time) { b.checkAndSignalBuyCoinFromTx(tx, meta, slot, detectedAt) })
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNewMintsFromBlocks(t *testing.T) {
+	create, createTx := decodeTxFixture(t, "create-tx.json")
+	_, rugTx := decodeTxFixture(t, "rug-tx.json")
+
+	// a create which failed on chain is never checked
+	failedTx := *createTx
+	failedTx.Signatures = []solana.Signature{{1}}
+	failed := txResult(t, &failedTx)
+	failed["meta"] = map[string]interface{}{"err": map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}, "logMessages": create.Meta.LogMessages}
+
+	subscribed := make(chan []json.RawMessage, 1)
+	wsMock := newMockWS(t)
+	wsMock.handle("blockSubscribe", func(params []json.RawMessage) []interface{} {
+		subscribed <- params
+		return []interface{}{map[string]interface{}{
+			"context": map[string]interface{}{"slot": create.Slot},
+			"value": map[string]interface{}{
+				"slot": create.Slot,
+				"block": map[string]interface{}{
+					"transactions": []interface{}{failed, loadTxFixture(t, "rug-tx.json"), loadTxFixture(t, "create-tx.json")},
+				},
+			},
+		}}
+	})
+
+	coin, err := fetchNewCoin(decodeInstructions(createTx))
+	require.NoError(t, err)
+
+	b := &Bot{
+		wsPool: newWsPoolFromClients(wsMock.client(t)),
+		// rejected first thing, so nothing past detection needs mocking
+		mintDenylist: map[string]bool{coin.mintAddr.String(): true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.HandleNewMintsFromBlocks(ctx)
+
+	params := <-subscribed
+	require.Len(t, params, 2)
+	require.JSONEq(t, `{"mentionsAccountOrProgram": "`+pumpProgramID.String()+`"}`, string(params[0]))
+	require.Contains(t, string(params[1]), `"transactionDetails":"full"`)
+
+	require.Eventually(t, func() bool {
+		_, detected := b.detectedMints.Load(createTx.Signatures[0])
+		return detected
+	}, time.Second, 10*time.Millisecond)
+
+	_, detected := b.detectedMints.Load(failedTx.Signatures[0])
+	require.False(t, detected)
+
+	_, detected = b.detectedMints.Load(rugTx.Signatures[0])
+	require.False(t, detected)
+}
+
+func TestStartMintDetectionRejectsUnknownMode(t *testing.T) {
+	b := &Bot{}
+
+	require.ErrorIs(t, b.startMintDetection(context.Background(), "carrier-pigeon", ""), errUnknownMintDetection)
+	require.ErrorIs(t, b.startMintDetection(context.Background(), mintDetectionGeyser, ""), errNoGeyserURL)
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,8 +15,10 @@ import (
 	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
 )
 
 type pumpInstr struct {
@@ -24,11 +28,18 @@ type pumpInstr struct {
 	isPump      bool
 }
 
+// mintLogQueueSize bounds how many mint logs can wait between the
+// websocket receive loop and the goroutine launching buy checks
+const mintLogQueueSize = 256
+
 var (
 	errBadCreateInstruction = errors.New("Bad `Create` Instruction")
 	errNoCreatorATA         = errors.New("No Creator ATA")
 	errCreatingNewCoin      = errors.New("Unknown Error Creating New Coin")
 	errNoCreatorBuy         = errors.New("No Creator Buy Found")
+
+	errBondingCurveNotPDA           = errors.New("Bonding Curve Isn't The Mint's PDA")
+	errAssociatedBondingCurveNotATA = errors.New("Associated Bonding Curve Isn't The Bonding Curve's ATA")
 )
 
 var pumpIDs = map[bin.TypeID]*pumpInstr{
@@ -44,72 +55,390 @@ var pumpIDs = map[bin.TypeID]*pumpInstr{
 	bin.TypeID([8]byte{2, 160, 134, 1, 0, 7, 2, 0}): &pumpInstr{programName: "Compute Budget", name: "SetComputeUnitLimit", impl: nil, isPump: false},
 }
 
-// HandleNewMints runs as goroutine, subscribing to logs for pump program
+// decodedInst is a top-level instruction of a transaction, decoded once with the
+// decoder matching its program so callers don't each re-decode the same tx
+type decodedInst struct {
+	programID solana.PublicKey
+	accounts  []*solana.AccountMeta
+	data      []byte // raw, for fields our decoders don't know about
+
+	// at most one of these is set, depending on programID
+	pump   *pump.Instruction
+	system *system.Instruction
+	token  *token.Instruction
+}
+
+// pumpName returns the pumpIDs name of a pump instruction (create, buy, sell...)
+func (d *decodedInst) pumpName() string {
+	if d.pump == nil {
+		return ""
+	}
+
+	if v, ok := pumpIDs[d.pump.TypeID]; ok {
+		return v.name
+	}
+
+	return ""
+}
+
+// decodeInstructions decodes all pump, system & token instructions of a transaction.
+// instructions of other programs (or that fail to decode) are skipped
+func decodeInstructions(tx *solana.Transaction) []*decodedInst {
+	return decodeProgramInstructions(tx, []solana.PublicKey{pump.ProgramID}, nil)
+}
+
+// decodeMintInstructions is decodeInstructions, decoding the instructions of every program in `mintProgramIDs` as pump's.
+// those go to `instrLogger` too, whether they decode or not
+func (b *Bot) decodeMintInstructions(tx *solana.Transaction) []*decodedInst {
+	return decodeProgramInstructions(tx, b.mintPrograms(), b.instrLogger)
+}
+
+// mintPrograms are the launchpad programs we detect mints on, pump unless `mintProgramIDs` is set
+func (b *Bot) mintPrograms() []solana.PublicKey {
+	if len(b.mintProgramIDs) == 0 {
+		return []solana.PublicKey{pumpProgramID}
+	}
+
+	return b.mintProgramIDs
+}
+
+// decodeProgramInstructions decodes the system & token instructions of a transaction, and those of
+// `pumpPrograms` as pump instructions, logging the latter to `instrLogger` (may be nil)
+func decodeProgramInstructions(tx *solana.Transaction, pumpPrograms []solana.PublicKey, instrLogger *InstructionLogger) []*decodedInst {
+	var decoded []*decodedInst
+
+	for _, instruction := range tx.Message.Instructions {
+		programID, err := tx.ResolveProgramIDIndex(instruction.ProgramIDIndex)
+		if err != nil {
+			continue
+		}
+
+		// Find the accounts of this instruction:
+		accounts, err := instruction.ResolveInstructionAccounts(&tx.Message)
+		if err != nil {
+			continue
+		}
+
+		inst := &decodedInst{programID: programID, accounts: accounts, data: instruction.Data}
+
+		switch {
+		case slices.ContainsFunc(pumpPrograms, programID.Equals):
+			inst.pump, err = pump.DecodeInstruction(accounts, instruction.Data)
+			instrLogger.LogInstruction(programID, instruction.Data, accounts, err)
+		case programID.Equals(solana.SystemProgramID):
+			inst.system, err = system.DecodeInstruction(accounts, instruction.Data)
+		case programID.Equals(solana.TokenProgramID):
+			inst.token, err = token.DecodeInstruction(accounts, instruction.Data)
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		decoded = append(decoded, inst)
+	}
+
+	return decoded
+}
+
+// HandleNewMints runs as goroutine, subscribing to logs for pump program (and every other program in `mintProgramIDs`)
 // if we detect a coin we should buy, it's passed off to buy / sell handler
 func (b *Bot) HandleNewMints() {
 	fmt.Println("Listening for new mints...")
 
-	sub, err := b.wsClient.LogsSubscribeMentions(pumpProgramID, rpc.CommitmentConfirmed)
+	msgQueue := make(chan *ws.LogResult, mintLogQueueSize)
+	go b.processMintLogs(msgQueue)
+
+	// a logs subscription only takes one address, every program gets its own on the mint connection
+	programs := b.mintPrograms()
+	for _, program := range programs[1:] {
+		go b.monitorMintLogs(program, msgQueue)
+	}
+
+	b.monitorMintLogs(programs[0], msgQueue)
+}
+
+// monitorMintLogs subscribes to the logs of launchpad `program`, queueing its mints on `msgQueue`
+func (b *Bot) monitorMintLogs(program solana.PublicKey, msgQueue chan *ws.LogResult) {
+	client := b.wsPool.client(mintConn)
+	sub, err := client.LogsSubscribeMentions(program, rpc.CommitmentConfirmed)
 	if err != nil {
-		log.Fatalf("Failed to subscribe to pump program logs: %v", err)
+		log.Fatalf("Failed to subscribe to %s program logs: %v", program, err)
 	}
-	defer sub.Unsubscribe()
+	defer func() { sub.Unsubscribe() }()
 
 	for {
 		msg, err := sub.Recv()
 		if err != nil {
-			log.Printf("Error receiving log: %v\n", err)
+			log.Printf("Error receiving log, resubscribing: %v\n", err)
+			client, sub = b.resubscribeMints(client, program)
 			continue
 		}
 
-		// Analyze the logs to detect mint operations
-		for _, logEntry := range msg.Value.Logs {
-			if !isMintLog(logEntry) {
-				continue
-			}
+		// a fee change would fail every trade built with the old params
+		if hasSetParamsLog(msg) {
+			go b.refreshGlobalParamsAfterSetParams()
+		}
+
+		// only mint messages are queued, so the flood of pump trade logs
+		// can never crowd new mints out of the queue
+		if !hasMintLog(msg) {
+			continue
+		}
+
+		b.lastMintSeen.Store(time.Now().UnixNano())
+		b.enqueueMintLog(msgQueue, msg)
+	}
+}
+
+// resubscribeMints redials the mint connection after `failed` dropped and subscribes to the logs of
+// `program` again, retrying until it works since we can't detect mints without it
+func (b *Bot) resubscribeMints(failed *ws.Client, program solana.PublicKey) (*ws.Client, *ws.LogSubscription) {
+	for {
+		client, sub, err := b.wsPool.resubscribeLogs(mintConn, failed, program)
+		if err == nil {
+			return client, sub
+		}
+
+		// if the redialed connection is the one failing, redial it again next time
+		failed = b.wsPool.client(mintConn)
+
+		log.Printf("Failed to resubscribe to %s program logs: %v\n", program, err)
+		time.Sleep(time.Second)
+	}
+}
 
-			b.status("Detected Mint (" + msg.Value.Signature.String() + ")")
-			go b.checkAndSignalBuyCoin(msg.Value.Signature)
+// watchMintSubscription runs as goroutine, alerting and forcing the mint connection to resubscribe whenever
+// no mint has arrived over it for `mintIdleTimeout`. mints arrive constantly, so a long silence usually means
+// the subscription died without its connection erroring
+func (b *Bot) watchMintSubscription(ctx context.Context) {
+	b.lastMintSeen.Store(time.Now().UnixNano())
+
+	ticker := time.NewTicker(b.mintIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idle := time.Since(time.Unix(0, b.lastMintSeen.Load()))
+		if idle < b.mintIdleTimeout {
+			continue
 		}
+
+		mintWatchdogResubscribes.Inc()
+		msg := fmt.Sprintf("No mints seen in %s, resubscribing", idle.Round(time.Second))
+		b.statusr(msg)
+		b.notify(msg)
+
+		// give the new subscription a full timeout before checking on it again
+		b.lastMintSeen.Store(time.Now().UnixNano())
+
+		// the receive loop sees its subscription fail, then redials & resubscribes
+		b.wsPool.client(mintConn).Close()
+	}
+}
+
+// enqueueMintLog passes a mint log to the processing goroutine without ever blocking the
+// receive loop. if the queue is full the message is dropped (and counted) instead
+func (b *Bot) enqueueMintLog(msgQueue chan<- *ws.LogResult, msg *ws.LogResult) bool {
+	select {
+	case msgQueue <- msg:
+		return true
+	default:
+		wsMessagesDropped.Inc()
+		b.statusr("Mint log queue full, dropping " + msg.Value.Signature.String())
+		return false
+	}
+}
+
+// mintCheckPool runs mint checks (checkAndSignalBuyCoin & co) on a fixed number of workers, so slow DB / RPC
+// calls can't pile goroutines up behind the mints. once every worker is busy and the queue is full, the oldest
+// queued check is dropped for the newest: a mint that waited that long is too stale to snipe anyway
+type mintCheckPool struct {
+	queue chan func()
+}
+
+// newMintCheckPool starts `workers` workers taking checks off a queue of `queueSize` (at least 1)
+func newMintCheckPool(workers, queueSize int) *mintCheckPool {
+	p := &mintCheckPool{queue: make(chan func(), max(queueSize, 1))}
+
+	for range workers {
+		go p.work()
 	}
+
+	return p
 }
 
-// check if new coin should be bought & handle async
-func (b *Bot) checkAndSignalBuyCoin(mintSig solana.Signature) {
-	start := time.Now()
+func (p *mintCheckPool) work() {
+	for check := range p.queue {
+		mintChecksRunning.Add(1)
+		check()
+		mintChecksRunning.Add(-1)
+	}
+}
+
+// submit queues `check` without ever blocking, dropping the oldest queued check while the queue is full.
+// returns how many checks were dropped for it
+func (p *mintCheckPool) submit(check func()) (dropped int) {
+	for {
+		select {
+		case p.queue <- check:
+			return dropped
+		default:
+		}
+
+		select {
+		case <-p.queue:
+			dropped++
+			mintChecksDropped.Inc()
+		default:
+		}
+	}
+}
+
+// goMintCheck runs a mint check on the mint check pool, or its own goroutine without one. the check is passed
+// when its mint was detected, so time spent queued counts against the staleness limit of signalIfShouldBuy
+func (b *Bot) goMintCheck(check func(detectedAt time.Time)) {
+	detectedAt := time.Now()
+	run := func() { check(detectedAt) }
+
+	if b.mintChecks == nil {
+		mintChecksRunning.Add(1)
+		go func() {
+			defer mintChecksRunning.Add(-1)
+			run()
+		}()
+		return
+	}
+
+	if dropped := b.mintChecks.submit(run); dropped > 0 {
+		b.statusr(fmt.Sprintf("Mint check pool saturated, dropped the %d oldest queued mints", dropped))
+	}
+}
+
+// processMintLogs launches the buy checks for every queued mint log
+func (b *Bot) processMintLogs(msgQueue <-chan *ws.LogResult) {
+	for msg := range msgQueue {
+		if !b.markMintDetected(msg.Value.Signature) {
+			continue
+		}
+
+		b.status("Detected Mint (" + msg.Value.Signature.String() + ")")
+		sig := msg.Value.Signature
+		b.goMintCheck(func(detectedAt time.Time) { b.checkAndSignalBuyCoin(sig, detectedAt) })
+	}
+}
+
+func hasMintLog(msg *ws.LogResult) bool {
+	return containsMintLog(msg.Value.Logs)
+}
+
+func containsMintLog(logs []string) bool {
+	for _, logEntry := range logs {
+		if isMintLog(logEntry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markMintDetected returns true the first time we see a mint signature, so coins
+// reported by more than one detection path are only checked (and bought) once
+func (b *Bot) markMintDetected(mintSig solana.Signature) bool {
+	if _, seen := b.detectedMints.LoadOrStore(mintSig, struct{}{}); seen {
+		return false
+	}
+
+	// mints are only worth buying for a couple seconds, no need to remember them for long
+	time.AfterFunc(time.Minute, func() {
+		b.detectedMints.Delete(mintSig)
+	})
+
+	return true
+}
+
+// creatorOnCooldown records a launch by `creator`, reporting whether they already launched within `creatorCooldown`.
+// the cooldown runs from their latest launch, so a wallet spamming launches stays on it
+func (b *Bot) creatorOnCooldown(creator string) bool {
+	if b.creatorCooldown <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	last, launched := b.creatorLaunches.Swap(creator, now)
+
+	// forget the creator once the cooldown is over, unless they launched again since
+	time.AfterFunc(b.creatorCooldown, func() {
+		b.creatorLaunches.CompareAndDelete(creator, now)
+	})
+
+	return launched && now.Sub(last.(time.Time)) < b.creatorCooldown
+}
+
+// check if new coin (detected at `detectedAt`) should be bought & handle async
+func (b *Bot) checkAndSignalBuyCoin(mintSig solana.Signature, detectedAt time.Time) {
+	if b.tradingHalted.Load() {
+		return
+	}
+
 	newCoin, err := b.fetchMintDetails(mintSig)
 	if err != nil {
 		log.Print(err)
 		return
 	}
 
+	b.signalIfShouldBuy(newCoin, detectedAt)
+}
+
+// checkAndSignalBuyCoinFromTx is checkAndSignalBuyCoin for a create tx we already received in full
+// (block / geyser mint detection), skipping the refetch. meta may be nil
+func (b *Bot) checkAndSignalBuyCoinFromTx(tx *solana.Transaction, meta *rpc.TransactionMeta, slot uint64, detectedAt time.Time) {
+	if b.tradingHalted.Load() {
+		return
+	}
+
+	newCoin, err := b.mintDetailsFromTx(tx, meta, slot)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	b.signalIfShouldBuy(newCoin, detectedAt)
+}
+
+// signalIfShouldBuy passes the coin to the buy handler if it passes our checks, and queueing for a mint check
+// worker & the details fetched since detection at `start` didn't take too long
+func (b *Bot) signalIfShouldBuy(newCoin *Coin, start time.Time) {
+	b.logEvent(newCoin, eventMintDetected, "")
+	b.recordCreatedCoin(newCoin)
+
 	if !b.shouldBuyCoin(newCoin) {
+		b.logEvent(newCoin, eventDecision, "skip: "+newCoin.rejectReason)
 		return
 	}
 
 	if time.Since(start) > 2*time.Second {
 		b.status(fmt.Sprintf("Skipping %s (detail fetch took too long)", newCoin.mintAddr.String()))
+		b.logEvent(newCoin, eventDecision, "skip: detail fetch took too long")
 		return
 	}
 
+	b.logEvent(newCoin, eventDecision, "buy")
 	newCoin.pickupTime = start
-	b.coinsToBuy <- newCoin
+	b.signalBuyCoin(newCoin)
 }
 
 // fetchMintDetails returns data on the coin like addresses associated with BC,
 // associated bonding curve, and creator information like how many coins they purchased
 func (b *Bot) fetchMintDetails(sig solana.Signature) (*Coin, error) {
-	version := uint64(0)
-	tx, err := b.rpcClient.GetTransaction(
-		context.Background(),
-		sig,
-		&rpc.GetTransactionOpts{
-			MaxSupportedTransactionVersion: &version,
-			Encoding:                       solana.EncodingBase64,
-			Commitment:                     rpc.CommitmentConfirmed,
-		},
-	)
-
+	tx, err := b.getTransaction(context.Background(), sig, rpc.CommitmentConfirmed)
 	if err != nil {
 		return nil, errors.New("Failed to fetch mint transaction: " + err.Error())
 	}
@@ -119,57 +448,89 @@ func (b *Bot) fetchMintDetails(sig solana.Signature) (*Coin, error) {
 		return nil, err
 	}
 
-	newCoin, err := fetchNewCoin(decodedTx)
+	return b.mintDetailsFromTx(decodedTx, tx.Meta, tx.Slot)
+}
+
+// mintDetailsFromTx builds the coin created by a mint tx landed in `slot`. without meta (nil),
+// the account the creator bought into is watched as is rather than resolved from the tx's balances
+func (b *Bot) mintDetailsFromTx(decodedTx *solana.Transaction, meta *rpc.TransactionMeta, slot uint64) (*Coin, error) {
+	decodedInsts := b.decodeMintInstructions(decodedTx)
+
+	newCoin, err := fetchNewCoin(decodedInsts)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := newCoin.fetchCreatorBuy(decodedTx); err != nil {
+	if _, err := newCoin.fetchCreatorBuy(decodedInsts); err != nil {
 		return nil, err
 	}
 
+	if len(decodedTx.Signatures) > 0 {
+		newCoin.createSignature = decodedTx.Signatures[0]
+	}
+	newCoin.createSlot = slot
+
+	if meta != nil {
+		newCoin.resolveCreatorTokenAccount(decodedTx, meta)
+	}
+
+	if b.detectCoordinatedBuys && len(decodedTx.Signatures) > 0 {
+		if err := b.detectMultiWalletCoordinatedBuy(newCoin, slot, decodedTx.Signatures[0]); err != nil {
+			newCoin.status("Failed to check same-block buyers: " + err.Error())
+		}
+	}
+
 	return newCoin, nil
 }
 
-func fetchNewCoin(decodedTx *solana.Transaction) (*Coin, error) {
-	for _, instruction := range decodedTx.Message.Instructions {
-		// Find the accounts of this instruction:
-		accounts, err := instruction.ResolveInstructionAccounts(&decodedTx.Message)
-		if err != nil {
+func fetchNewCoin(decodedInsts []*decodedInst) (*Coin, error) {
+	for _, inst := range decodedInsts {
+		if inst.pumpName() != "create" {
 			continue
 		}
 
-		instr, err := pump.DecodeInstruction(accounts, instruction.Data)
-		if err != nil {
-			continue
-		}
+		if create, ok := inst.pump.Impl.(*pump.Create); ok {
+			coin, err := newCoinFromCreateInst(create)
+			if err != nil {
+				return nil, err
+			}
 
-		data, err := instr.Data()
-		if err != nil || len(data) < 8 {
-			continue
+			coin.programID = inst.programID
+			coin.createArgCreator = decodeCreateCreatorArg(inst.data)
+			if err := coin.validateCurveAccounts(); err != nil {
+				logStatus(levelError, "coin", coin.mintAddr.String(), coin.mintAddr.String()+" (R)", "Rejecting create with tampered curve accounts: "+err.Error())
+				return nil, err
+			}
+
+			return coin, nil
 		}
+	}
 
-		typeID := data[0:8]
+	return nil, errCreatingNewCoin
+}
 
-		for k, v := range pumpIDs {
-			if k.Equal(typeID) {
-				x := reflect.New(v.impl).Interface()
-				switch v.name {
-				case "create":
-					p := x.(*pump.Create)
-					p.AccountMetaSlice = accounts
+// validateCurveAccounts checks the bonding curve accounts the create listed are the ones the program derives
+// from the mint, so a malformed or malicious create can't have us quote & buy against some other account
+func (c *Coin) validateCurveAccounts() error {
+	bondingCurve, _, err := solana.FindProgramAddress([][]byte{[]byte("bonding-curve"), c.mintAddr.Bytes()}, c.programID)
+	if err != nil {
+		return err
+	}
 
-					if err := p.UnmarshalWithDecoder(bin.NewBorshDecoder(data[8:])); err != nil {
-						return nil, fmt.Errorf("error Decoding `Create`:%v", err)
-					}
+	if !bondingCurve.Equals(c.tokenBondingCurve) {
+		return fmt.Errorf("%w: listed %s, expected %s", errBondingCurveNotPDA, c.tokenBondingCurve, bondingCurve)
+	}
 
-					return newCoinFromCreateInst(p)
-				}
-			}
-		}
+	associatedBondingCurve, _, err := solana.FindAssociatedTokenAddress(bondingCurve, c.mintAddr)
+	if err != nil {
+		return err
 	}
 
-	return nil, errCreatingNewCoin
+	if !associatedBondingCurve.Equals(c.associatedBondingCurve) {
+		return fmt.Errorf("%w: listed %s, expected %s", errAssociatedBondingCurveNotATA, c.associatedBondingCurve, associatedBondingCurve)
+	}
+
+	return nil
 }
 
 func newCoinFromCreateInst(inst *pump.Create) (*Coin, error) {
@@ -183,97 +544,314 @@ func newCoinFromCreateInst(inst *pump.Create) (*Coin, error) {
 		return nil, errBadCreateInstruction
 	}
 
-	return &Coin{
+	coin := &Coin{
 		mintAddr:               mintAddr.PublicKey,
 		tokenBondingCurve:      bondingCurve.PublicKey,
 		associatedBondingCurve: associatedBondingCurve.PublicKey,
 		eventAuthority:         eventAuthority.PublicKey,
 		creator:                creatorAddr.PublicKey,
-	}, nil
+	}
+
+	if inst.Name != nil {
+		coin.name = *inst.Name
+	}
+
+	if inst.Symbol != nil {
+		coin.symbol = *inst.Symbol
+	}
+
+	if inst.Uri != nil {
+		coin.uri = *inst.Uri
+	}
+
+	return coin, nil
+}
+
+// decodeCreateCreatorArg decodes the creator newer pump creates append to their data after the uri,
+// which our generated `pump.Create` predates. zero if `data` (the raw create, discriminator included) has none
+func decodeCreateCreatorArg(data []byte) solana.PublicKey {
+	decoder := bin.NewBorshDecoder(data)
+	if err := decoder.SkipBytes(8); err != nil {
+		return solana.PublicKey{}
+	}
+
+	// name, symbol & uri
+	var field string
+	for range 3 {
+		if err := decoder.Decode(&field); err != nil {
+			return solana.PublicKey{}
+		}
+	}
+
+	var creator solana.PublicKey
+	if decoder.Remaining() < solana.PublicKeyLength || decoder.Decode(&creator) != nil {
+		return solana.PublicKey{}
+	}
+
+	return creator
 }
 
 // fetchCreatorBuy detects creator buy from mint inst and:
 // fetches buy amount (if any)
 // sets creator ATA address
+// the returned bool reports whether the creator bought in the launch tx
+func (c *Coin) fetchCreatorBuy(decodedInsts []*decodedInst) (bool, error) {
+	c.detectJustInTimeFunding(decodedInsts)
 
-func (c *Coin) fetchCreatorBuy(decodedTx *solana.Transaction) error {
-	for _, instruction := range decodedTx.Message.Instructions {
-		// Find the accounts of this instruction:
-		accounts, err := instruction.ResolveInstructionAccounts(&decodedTx.Message)
-		if err != nil {
+	for _, inst := range decodedInsts {
+		if inst.pumpName() != "buy" {
 			continue
 		}
 
-		instr, err := pump.DecodeInstruction(accounts, instruction.Data)
-		if err != nil {
+		p, ok := inst.pump.Impl.(*pump.Buy)
+		if !ok {
 			continue
 		}
 
-		data, err := instr.Data()
-		if err != nil || len(data) < 8 {
+		if p.MaxSolCost == nil {
+			return false, errNoCreatorBuy
+		}
+
+		associatedUser := p.GetAssociatedUserAccount()
+		if associatedUser == nil {
+			return false, errNoCreatorATA
+		}
+
+		c.creatorPurchased = true
+		c.creatorPurchaseSol = 0.99 * float64(*p.MaxSolCost) / float64(solana.LAMPORTS_PER_SOL)
+		c.creatorATA = associatedUser.PublicKey
+		c.creatorATASource = creatorATASourceBuy
+
+		if p.Amount != nil {
+			c.creatorTokenBalance = *p.Amount
+			c.creatorPeakBalance = *p.Amount
+			c.creatorBalanceKnown = true
+		}
+
+		return true, nil
+	}
+
+	// no buy in launch tx, still watch the creator's ATA in case they buy later
+	creatorATA, _, err := solana.FindAssociatedTokenAddress(c.creator, c.mintAddr)
+	if err != nil {
+		return false, err
+	}
+
+	c.creatorPurchased = false
+	c.creatorPurchaseSol = 0
+	c.creatorATA = creatorATA
+	c.creatorATASource = creatorATASourceCanonical
+	c.creatorTokenBalance = 0
+	c.creatorBalanceKnown = true
+	return false, nil
+}
+
+// where the token account we watch for creator sells (coin.creatorATA) came from
+const (
+	creatorATASourceBuy       = "creator buy account"
+	creatorATASourceCanonical = "creator's canonical ATA"
+	creatorATASourceForwarded = "creator-owned account the bought tokens were forwarded to"
+	creatorATASourceForeign   = "bought into account owned by "
+)
+
+// resolveCreatorTokenAccount checks the launch tx's token balances for who owns the account the creator
+// bought into, since some launch tooling buys into a program-owned or otherwise non-associated account.
+// we watch, in order: the buy account if the creator owns it, a creator-owned account the tokens were
+// forwarded to, the buy account if it still holds the tokens (a rug has to move them out of it), and
+// finally the creator's canonical ATA
+func (c *Coin) resolveCreatorTokenAccount(tx *solana.Transaction, meta *rpc.TransactionMeta) {
+	if !c.creatorPurchased {
+		return
+	}
+
+	accountKeys := txAccountKeys(tx, meta)
+	buyAccount := c.creatorATA
+
+	var buyAccountOwner *solana.PublicKey
+	var buyAccountAmount uint64
+	var forwarded *solana.PublicKey
+	var forwardedAmount uint64
+
+	for _, post := range meta.PostTokenBalances {
+		if !post.Mint.Equals(c.mintAddr) || post.Owner == nil || int(post.AccountIndex) >= len(accountKeys) {
 			continue
 		}
 
-		typeID := data[0:8]
-
-		for k, v := range pumpIDs {
-			if k.Equal(typeID) {
-				x := reflect.New(v.impl).Interface()
-				switch v.name {
-				case "buy":
-					p := x.(*pump.Buy)
-					p.AccountMetaSlice = accounts
-					if err := p.UnmarshalWithDecoder(bin.NewBorshDecoder(data[8:])); err != nil {
-						return fmt.Errorf("err unmarshalling buy data: %s", err.Error())
-					}
-
-					if p.MaxSolCost == nil {
-						return errNoCreatorBuy
-					}
-
-					associatedUser := p.GetAssociatedUserAccount()
-					if associatedUser == nil {
-						return errNoCreatorATA
-					}
-
-					c.creatorPurchased = true
-					c.creatorPurchaseSol = 0.99 * float64(*p.MaxSolCost) / float64(solana.LAMPORTS_PER_SOL)
-					c.creatorATA = associatedUser.PublicKey
-					return nil
-				}
-			}
+		account := accountKeys[post.AccountIndex]
+		amount := tokenBalanceAmount(post)
+
+		if account.Equals(buyAccount) {
+			buyAccountOwner = post.Owner
+			buyAccountAmount = amount
+			continue
+		}
+
+		if post.Owner.Equals(c.creator) && amount > forwardedAmount {
+			forwarded = &account
+			forwardedAmount = amount
 		}
 	}
 
-	return errNoCreatorBuy
+	// nothing tells us the buy account is wrong
+	if buyAccountOwner == nil && forwarded == nil || buyAccountOwner != nil && buyAccountOwner.Equals(c.creator) {
+		return
+	}
+
+	switch {
+	case forwarded != nil:
+		c.setCreatorTokenAccount(*forwarded, creatorATASourceForwarded, forwardedAmount)
+	case buyAccountAmount > 0:
+		c.creatorATASource = creatorATASourceForeign + buyAccountOwner.String()
+		c.creatorTokenBalance = buyAccountAmount
+		c.creatorPeakBalance = buyAccountAmount
+	default:
+		canonicalATA, _, err := solana.FindAssociatedTokenAddress(c.creator, c.mintAddr)
+		if err != nil {
+			return
+		}
+
+		c.setCreatorTokenAccount(canonicalATA, creatorATASourceCanonical, 0)
+	}
+}
+
+// setCreatorTokenAccount switches the account we watch for creator sells, holding `balance`
+func (c *Coin) setCreatorTokenAccount(account solana.PublicKey, source string, balance uint64) {
+	c.creatorATA = account
+	c.creatorATASource = source
+	c.creatorTokenBalance = balance
+	c.creatorPeakBalance = balance
+	c.creatorBalanceKnown = true
+}
+
+// detectJustInTimeFunding flags creators who receive SOL in the launch tx itself,
+// before the `Create` instruction, a pattern used by bot operators to fund throwaway wallets
+func (c *Coin) detectJustInTimeFunding(decodedInsts []*decodedInst) {
+	for _, inst := range decodedInsts {
+		if inst.pumpName() == "create" {
+			return
+		}
+
+		if inst.system == nil {
+			continue
+		}
+
+		transfer, ok := inst.system.Impl.(*system.Transfer)
+		if !ok {
+			continue
+		}
+
+		recipient := transfer.GetRecipientAccount()
+		funder := transfer.GetFundingAccount()
+		if recipient == nil || funder == nil {
+			continue
+		}
+
+		if recipient.PublicKey.Equals(c.creator) && !funder.PublicKey.Equals(c.creator) {
+			c.justInTimeFunded = true
+			c.status("creator appears JIT-funded in launch tx")
+			return
+		}
+	}
 }
 
 func (b *Bot) shouldBuyCoin(coin *Coin) bool {
-	// check price constraints
+	// mints we never trade, whatever else the coin looks like
+	if b.mintDenylist[coin.mintAddr.String()] {
+		return coin.reject("mint denylisted")
+	}
+
+	// buys & sells are built against pump's global account & fee recipient, which a fork's curve doesn't take,
+	// so coins detected on other `mintProgramIDs` are only watched & recorded, never bought
+	if !coin.programID.Equals(pumpProgramID) {
+		return coin.reject("not a pump coin")
+	}
+
+	// every launch counts toward the cooldown, so it's checked before anything else can reject the coin
 	var creatorPubKey = coin.creator.String()
-	if coin.creatorPurchaseSol < 0.5 || coin.creatorPurchaseSol > 2.5 {
-		return false
+	if b.creatorOnCooldown(creatorPubKey) {
+		return coin.reject("creator on cooldown")
+	}
+
+	// check price constraints
+	if !coin.creatorPurchased && b.requireCreatorBuy {
+		return coin.reject("no creator buy")
+	}
+
+	if coin.creatorPurchased && (coin.creatorPurchaseSol < 0.5 || coin.creatorPurchaseSol > 2.5) {
+		return coin.reject("creator buy out of range")
+	}
+
+	if coin.justInTimeFunded && b.requireOlderFunder {
+		return coin.reject("creator JIT-funded")
+	}
+
+	if coin.coordinatedLaunch {
+		return coin.reject("coordinated launch")
 	}
 
 	// make sure creator's first coin
-	if b.addressCreatedCoin(creatorPubKey) {
-		return false
+	if b.addressCreatedCoin(creatorPubKey, coin.mintAddr.String()) {
+		return coin.reject("creator created coin before")
+	}
+
+	// also catch creators we've seen rug, which the coins table may not know about
+	if reason := b.creatorStatsRejectReason(creatorPubKey); reason != "" {
+		return coin.reject(reason)
+	}
+
+	// coins we detect late may already be well up the curve, long before BuyCoin checks maxBuyCurveProgress
+	if b.maxEvalCurveFill > 0 {
+		curve := b.localCurve(coin)
+		if curve == nil {
+			var err error
+			if curve, err = b.fetchFreshBondingCurve(coin.tokenBondingCurve); err != nil {
+				b.statusr("Error fetching bonding curve: " + err.Error())
+				return coin.reject("error fetching bonding curve")
+			}
+		}
+
+		coin.evalCurveFill = curve.Progress()
+		if coin.evalCurveFill > b.maxEvalCurveFill {
+			return coin.reject(fmt.Sprintf("curve %.1f%% filled", coin.evalCurveFill))
+		}
+	}
+
+	// a hung RPC call must not hold up the buy pipeline, so the mint & funder checks get twice the funder lookup's usual P95
+	ctx, cancel := context.WithTimeout(context.Background(), 2*b.estimateFunderCheckLatency())
+	defer cancel()
+
+	if b.checkMintTokenomics {
+		tokenomics, err := b.validateTokenomics(ctx, coin.mintAddr)
+		if ctx.Err() != nil {
+			return b.rejectShouldBuyTimeout(coin)
+		}
+
+		if err != nil {
+			b.statusr("Error checking tokenomics: " + err.Error())
+			return coin.reject("error fetching mint")
+		}
+
+		if reason := tokenomics.rejectReason(); reason != "" {
+			return coin.reject(reason)
+		}
+	}
+
+	creatorFunders, err := b.fetchCreatorFunders(creatorPubKey, ctx)
+	if ctx.Err() != nil {
+		return b.rejectShouldBuyTimeout(coin)
 	}
 
-	// check 30 past tx for all funders, not just first
-	funderTrans, err := b.fetchNLastTrans(30, creatorPubKey)
 	if err != nil {
 		b.statusr("Error checking buy coin: " + err.Error())
-		return false
+		return coin.reject("error fetching funders")
 	}
 
-	// fetch up to 3 funders
-	creatorFunders := findFundersFromResps(funderTrans, creatorPubKey, 3)
 	if len(creatorFunders) == 0 {
-		return false
+		return coin.reject("no funders found")
 	}
 
-	var funderStatusChan = make(chan bool)
+	// buffered so checks finishing after a timeout don't block
+	var funderStatusChan = make(chan bool, len(creatorFunders))
 	var safeFundersCount int
 
 	for _, funder := range creatorFunders {
@@ -281,27 +859,61 @@ func (b *Bot) shouldBuyCoin(coin *Coin) bool {
 	}
 
 	for i := 0; i < len(creatorFunders); i++ {
-		safe := <-funderStatusChan
-		if safe {
-			safeFundersCount++
+		select {
+		case safe := <-funderStatusChan:
+			if safe {
+				safeFundersCount++
+			}
+		case <-ctx.Done():
+			return b.rejectShouldBuyTimeout(coin)
 		}
 	}
 
-	return safeFundersCount == len(creatorFunders)
+	if safeFundersCount != len(creatorFunders) {
+		return coin.reject("unsafe funder")
+	}
+
+	return true
+}
+
+// rejectShouldBuyTimeout passes on a coin whose checks ran past shouldBuyCoin's deadline
+func (b *Bot) rejectShouldBuyTimeout(coin *Coin) bool {
+	shouldBuyTimeouts.Inc()
+	coin.status("shouldBuyCoin timed out")
+	return coin.reject("shouldBuyCoin timed out")
+}
+
+// fetchCreatorFunders checks the creator's last `funderLookbackSigs` tx for all funders, not just first
+func (b *Bot) fetchCreatorFunders(creatorPubKey string, optCtx ...context.Context) ([]string, error) {
+	funderTrans, err := b.fetchNLastTrans(b.funderLookbackSigs, creatorPubKey, optCtx...)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch up to 3 funders
+	return findFundersFromResps(funderTrans, creatorPubKey, 3), nil
 }
 
 func (b *Bot) isSafeFunder(funder string, funderStatusChan chan bool) {
+	release := b.acquireFunderCheck()
+	defer release()
+
 	if isExchangeAddress(funder) {
 		funderStatusChan <- true
 		return
 	}
 
-	if b.addressCreatedCoin(funder) {
+	if b.addressCreatedCoin(funder, "") {
 		funderStatusChan <- false
 		return
 	}
 
-	// TODO: add back if we want to sacrifice speed (or can afford to)
+	// funder hasn't created coins before, so it's safe. without this send a clean funder never
+	// reported back, and shouldBuyCoin was left waiting on it
+	funderStatusChan <- true
+
+	// TODO: add back if we want to sacrifice speed (or can afford to), in place of the send above
+	// as it sends its own result
 
 	// // do second check against the funding wallets
 	// // but only for the first funder found, as this covers most
@@ -328,21 +940,28 @@ func (b *Bot) isSafeFunder(funder string, funderStatusChan chan bool) {
 	// 	return
 	// }
 
-	// if b.addressCreatedCoin(secondOrderFunder) {
+	// if b.addressCreatedCoin(secondOrderFunder, "") {
 	// 	funderStatusChan <- false
 	// }
 }
 
-func (b *Bot) addressCreatedCoin(creatorAddress string) bool {
-	query := "SELECT COUNT(*) FROM coins WHERE creator_address = ?"
+// acquireFunderCheck blocks until a funder check slot is free, returning the func releasing it
+func (b *Bot) acquireFunderCheck() (release func()) {
+	if b.funderCheckSlots == nil {
+		return func() {}
+	}
 
-	var count int
-	err := b.dbConnection.QueryRow(query, creatorAddress).Scan(&count)
+	b.funderCheckSlots <- struct{}{}
+	return func() { <-b.funderCheckSlots }
+}
+
+func (b *Bot) addressCreatedCoin(creatorAddress, exceptMint string) bool {
+	createdCoin, err := b.store.CreatorHasCoin(creatorAddress, exceptMint)
 	if err != nil {
 		log.Fatalf("Failed to execute query: %v", err)
 	}
 
-	return count > 0
+	return createdCoin
 }
 
 func findFundersFromResps(responses jsonrpc.RPCResponses, creatorAddress string, fundersLimit int) []string {
@@ -420,3 +1039,45 @@ func checkHasFunder(tx *solana.Transaction, creatorAddr string) string {
 func isMintLog(logEntry string) bool {
 	return strings.Contains(logEntry, "InitializeMint2")
 }
+
+// hasPumpWithdrawLog checks if pump's Withdraw instruction ran in a tx, which moves a completed
+// bonding curve's liquidity out for migration to Raydium. only pump's own logs count, see pumpOwnLogs
+func hasPumpWithdrawLog(logs []string) bool {
+	for _, logEntry := range pumpOwnLogs(logs) {
+		if logEntry == "Program log: Instruction: Withdraw" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadMintDenylist builds the set of mints we never trade from `mints` and, if `path` is set, a file
+// listing one mint per line (blank lines & lines starting with `#` are skipped)
+func loadMintDenylist(mints []string, path string) (map[string]bool, error) {
+	denylist := make(map[string]bool)
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				mints = append(mints, line)
+			}
+		}
+	}
+
+	for _, mint := range mints {
+		mintAddr, err := solana.PublicKeyFromBase58(mint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denylisted mint %q: %w", mint, err)
+		}
+
+		denylist[mintAddr.String()] = true
+	}
+
+	return denylist, nil
+}
@@ -0,0 +1,929 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	cb "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/require"
+)
+
+// sigsLimitParam returns the `limit` passed in a getSignaturesForAddress call
+func sigsLimitParam(t *testing.T, call mockRPCRequest) int {
+	var opts struct {
+		Limit int `json:"limit"`
+	}
+	require.Len(t, call.Params, 2)
+	require.NoError(t, json.Unmarshal(call.Params[1], &opts))
+
+	return opts.Limit
+}
+
+func newLookbackMockRPC(t *testing.T) *mockRPC {
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		return []map[string]interface{}{{"signature": solana.Signature{1}.String(), "slot": 1}}, nil
+	})
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return nil, nil
+	})
+
+	return mock
+}
+
+func TestFunderLookbackSigsConfigured(t *testing.T) {
+	mock := newLookbackMockRPC(t)
+	b := &Bot{
+		rpcClient:          mock.client(),
+		jrpcClient:         mock.jsonrpcClient(),
+		funderLookbackSigs: 12,
+	}
+
+	_, err := b.fetchCreatorFunders(solana.NewWallet().PublicKey().String())
+	require.NoError(t, err)
+
+	calls := mock.callsTo("getSignaturesForAddress")
+	require.Len(t, calls, 1)
+	require.Equal(t, 12, sigsLimitParam(t, calls[0]))
+}
+
+func TestCreatorAtaLookbackSigsConfigured(t *testing.T) {
+	mock := newLookbackMockRPC(t)
+	b := &Bot{
+		rpcClient:              mock.client(),
+		jrpcClient:             mock.jsonrpcClient(),
+		creatorAtaLookbackSigs: 5,
+		creatorTxFetchTimeout:  time.Second,
+	}
+
+	_, err := b.fetchCreatorATATrans(&Coin{creatorATA: solana.NewWallet().PublicKey()}, nil)
+	require.NoError(t, err)
+
+	calls := mock.callsTo("getSignaturesForAddress")
+	require.Len(t, calls, 1)
+	require.Equal(t, 5, sigsLimitParam(t, calls[0]))
+}
+
+func TestDecodeInstructions(t *testing.T) {
+	f := newLaunchFixture(t)
+	funder := solana.NewWallet().PublicKey()
+
+	tx := newTestTx(t, f.creator,
+		cb.NewSetComputeUnitPriceInstruction(1000).Build(),
+		system.NewTransferInstruction(1e9, funder, f.creator).Build(),
+		f.createInst(),
+		f.buyInst(1000, 1e9),
+		token.NewTransferInstruction(10, f.creatorATA, solana.NewWallet().PublicKey(), f.creator, nil).Build(),
+	)
+
+	insts := decodeInstructions(tx)
+
+	// compute budget instructions are skipped
+	require.Len(t, insts, 4)
+
+	transfer, ok := insts[0].system.Impl.(*system.Transfer)
+	require.True(t, ok)
+	require.Equal(t, uint64(1e9), *transfer.Lamports)
+	require.Equal(t, funder, transfer.GetFundingAccount().PublicKey)
+
+	require.Equal(t, "create", insts[1].pumpName())
+	create, ok := insts[1].pump.Impl.(*pump.Create)
+	require.True(t, ok)
+	require.Equal(t, f.mint, create.GetMintAccount().PublicKey)
+
+	require.Equal(t, "buy", insts[2].pumpName())
+	buy, ok := insts[2].pump.Impl.(*pump.Buy)
+	require.True(t, ok)
+	require.Equal(t, uint64(1e9), *buy.MaxSolCost)
+
+	require.Equal(t, token.ProgramID, insts[3].programID)
+	_, ok = insts[3].token.Impl.(*token.Transfer)
+	require.True(t, ok)
+
+	coin, err := fetchNewCoin(insts)
+	require.NoError(t, err)
+	require.Equal(t, f.bondingCurve, coin.tokenBondingCurve)
+	require.Equal(t, f.creator, coin.creator)
+
+	found, err := coin.fetchCreatorBuy(insts)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, f.creatorATA, coin.creatorATA)
+}
+
+func TestFetchNewCoinDecodesCreateFields(t *testing.T) {
+	f := newLaunchFixture(t)
+	create := f.createInst()
+	data, err := create.Data()
+	require.NoError(t, err)
+
+	coin, err := fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, create)))
+	require.NoError(t, err)
+	require.Equal(t, "Test Coin", coin.name)
+	require.Equal(t, "TEST", coin.symbol)
+	require.Equal(t, "https://example.com/test.json", coin.uri)
+	require.True(t, coin.createArgCreator.IsZero())
+
+	// newer creates name the creator after the uri
+	argCreator := solana.NewWallet().PublicKey()
+	extended := solana.NewInstruction(pumpProgramID, create.Accounts(), append(slices.Clone(data), argCreator.Bytes()...))
+
+	coin, err = fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, extended)))
+	require.NoError(t, err)
+	require.Equal(t, "Test Coin", coin.name)
+	require.Equal(t, "TEST", coin.symbol)
+	require.Equal(t, "https://example.com/test.json", coin.uri)
+	require.Equal(t, argCreator, coin.createArgCreator)
+	require.Equal(t, f.creator, coin.creator)
+
+	// a truncated trailing field isn't mistaken for a creator
+	require.True(t, decodeCreateCreatorArg(append(slices.Clone(data), 1, 2, 3)).IsZero())
+}
+
+func TestFetchNewCoinRejectsTamperedCurveAccounts(t *testing.T) {
+	f := newLaunchFixture(t)
+	create := f.createInst()
+	data, err := create.Data()
+	require.NoError(t, err)
+
+	tampered := func(index int) solana.Instruction {
+		accounts := slices.Clone(create.Accounts())
+		accounts[index] = solana.Meta(solana.NewWallet().PublicKey()).WRITE()
+		return solana.NewInstruction(pumpProgramID, accounts, data)
+	}
+
+	// the create lists some other account as the mint's bonding curve
+	_, err = fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, tampered(2))))
+	require.ErrorIs(t, err, errBondingCurveNotPDA)
+
+	// or as the bonding curve's token account
+	_, err = fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, tampered(3))))
+	require.ErrorIs(t, err, errAssociatedBondingCurveNotATA)
+
+	_, err = fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, create)))
+	require.NoError(t, err)
+}
+
+func TestFetchCreatorBuyWithoutBuy(t *testing.T) {
+	f := newLaunchFixture(t)
+	insts := decodeInstructions(newTestTx(t, f.creator, f.createInst()))
+
+	coin, err := fetchNewCoin(insts)
+	require.NoError(t, err)
+
+	found, err := coin.fetchCreatorBuy(insts)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.False(t, coin.creatorPurchased)
+	require.Zero(t, coin.creatorPurchaseSol)
+
+	// we still know where the creator's tokens would land
+	require.Equal(t, f.creatorATA, coin.creatorATA)
+
+	b := &Bot{requireCreatorBuy: true}
+	require.False(t, b.shouldBuyCoin(coin))
+}
+
+func TestDetectJustInTimeFunding(t *testing.T) {
+	f := newLaunchFixture(t)
+	funder := solana.NewWallet().PublicKey()
+	fundCreator := system.NewTransferInstruction(2e9, funder, f.creator).Build()
+
+	// funded before `Create`
+	insts := decodeInstructions(newTestTx(t, funder, fundCreator, f.createInst(), f.buyInst(1000, 1e9)))
+	coin, err := fetchNewCoin(insts)
+	require.NoError(t, err)
+
+	_, err = coin.fetchCreatorBuy(insts)
+	require.NoError(t, err)
+	require.True(t, coin.justInTimeFunded)
+
+	b := &Bot{requireOlderFunder: true}
+	require.False(t, b.shouldBuyCoin(coin))
+
+	// transfers after `Create` aren't funding the launch
+	insts = decodeInstructions(newTestTx(t, funder, f.createInst(), fundCreator, f.buyInst(1000, 1e9)))
+	coin, err = fetchNewCoin(insts)
+	require.NoError(t, err)
+
+	_, err = coin.fetchCreatorBuy(insts)
+	require.NoError(t, err)
+	require.False(t, coin.justInTimeFunded)
+}
+
+func TestEnqueueMintLogDropsWhenFull(t *testing.T) {
+	b := &Bot{}
+	msgQueue := make(chan *ws.LogResult, 1)
+
+	first, second := &ws.LogResult{}, &ws.LogResult{}
+	dropped := wsMessagesDropped.Value()
+
+	require.True(t, b.enqueueMintLog(msgQueue, first))
+	require.False(t, b.enqueueMintLog(msgQueue, second))
+	require.Equal(t, dropped+1, wsMessagesDropped.Value())
+
+	require.Same(t, first, <-msgQueue)
+}
+
+// fixtureCoin returns the coin parsed out of the create tx fixture
+func fixtureCoin(t *testing.T) *Coin {
+	_, tx := decodeTxFixture(t, "create-tx.json")
+	insts := decodeInstructions(tx)
+
+	coin, err := fetchNewCoin(insts)
+	require.NoError(t, err)
+
+	_, err = coin.fetchCreatorBuy(insts)
+	require.NoError(t, err)
+
+	return coin
+}
+
+func TestFetchMintDetailsFromFixture(t *testing.T) {
+	_, tx := decodeTxFixture(t, "create-tx.json")
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return loadTxFixture(t, "create-tx.json"), nil
+	})
+
+	b := &Bot{rpcClient: mock.client()}
+	coin, err := b.fetchMintDetails(tx.Signatures[0])
+	require.NoError(t, err)
+
+	// the fee payer creates the coin
+	require.Equal(t, tx.Message.AccountKeys[0], coin.creator)
+
+	bondingCurve, _, err := solana.FindProgramAddress([][]byte{[]byte("bonding-curve"), coin.mintAddr.Bytes()}, pumpProgramID)
+	require.NoError(t, err)
+	require.Equal(t, bondingCurve, coin.tokenBondingCurve)
+
+	creatorATA, _, err := solana.FindAssociatedTokenAddress(coin.creator, coin.mintAddr)
+	require.NoError(t, err)
+	require.Equal(t, creatorATA, coin.creatorATA)
+
+	require.True(t, coin.creatorPurchased)
+	require.InDelta(t, 0.99*1.01, coin.creatorPurchaseSol, 1e-9)
+	require.Equal(t, uint64(34_612_903_225806), coin.creatorTokenBalance)
+	require.False(t, coin.justInTimeFunded)
+}
+
+// rejectTxVersionHandler serves the create fixture like an RPC which doesn't know maxSupportedTransactionVersion
+func rejectTxVersionHandler(t *testing.T) mockRPCHandler {
+	return func(params []json.RawMessage) (interface{}, error) {
+		if len(params) > 1 && strings.Contains(string(params[1]), "maxSupportedTransactionVersion") {
+			return nil, errors.New("Invalid params: unknown field `maxSupportedTransactionVersion`")
+		}
+		return loadTxFixture(t, "create-tx.json"), nil
+	}
+}
+
+func TestFetchMintDetailsRetriesWithoutTxVersion(t *testing.T) {
+	_, tx := decodeTxFixture(t, "create-tx.json")
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", rejectTxVersionHandler(t))
+
+	b := &Bot{rpcClient: mock.client()}
+	coin, err := b.fetchMintDetails(tx.Signatures[0])
+	require.NoError(t, err)
+	require.Equal(t, tx.Message.AccountKeys[0], coin.creator)
+
+	calls := mock.callsTo("getTransaction")
+	require.Len(t, calls, 2)
+	require.Contains(t, string(calls[0].Params[1]), "maxSupportedTransactionVersion")
+	require.NotContains(t, string(calls[1].Params[1]), "maxSupportedTransactionVersion")
+
+	// remembered, later fetches go without it straight away
+	_, err = b.fetchMintDetails(tx.Signatures[0])
+	require.NoError(t, err)
+	require.Len(t, mock.callsTo("getTransaction"), 3)
+
+	// configured to omit it, it's never sent
+	mock = newMockRPC(t)
+	mock.handle("getTransaction", rejectTxVersionHandler(t))
+
+	b = &Bot{rpcClient: mock.client(), omitTxVersion: true}
+	_, err = b.fetchMintDetails(tx.Signatures[0])
+	require.NoError(t, err)
+	require.Len(t, mock.callsTo("getTransaction"), 1)
+}
+
+func TestFetchMintDetailsErrors(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return loadTxFixture(t, "rug-tx.json"), nil
+	})
+
+	b := &Bot{rpcClient: mock.client()}
+
+	// a sell isn't a create
+	_, err := b.fetchMintDetails(solana.Signature{1})
+	require.ErrorIs(t, err, errCreatingNewCoin)
+
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return nil, errors.New("node is behind")
+	})
+
+	_, err = b.fetchMintDetails(solana.Signature{1})
+	require.ErrorContains(t, err, "Failed to fetch mint transaction")
+}
+
+// newFunderMockRPC serves a creator history holding a single tx, in which `funder` sends the creator 1 SOL
+func newFunderMockRPC(t *testing.T, creator, funder solana.PublicKey) *mockRPC {
+	fundTx := newTestTx(t, funder, system.NewTransferInstruction(1e9, funder, creator).Build())
+
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		return []map[string]interface{}{{"signature": solana.Signature{2}.String(), "slot": 1}}, nil
+	})
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return txResult(t, fundTx), nil
+	})
+
+	return mock
+}
+
+func TestShouldBuyCoin(t *testing.T) {
+	funder := solana.NewWallet().PublicKey()
+
+	tests := []struct {
+		name         string
+		setup        func(coin *Coin, mock *mockRPC) Store
+		shouldBuy    bool
+		rejectReason string
+	}{
+		{
+			name:      "first coin with fresh funder",
+			setup:     func(coin *Coin, mock *mockRPC) Store { return newMemoryStore() },
+			shouldBuy: true,
+		},
+		{
+			name: "exchange funder",
+			setup: func(coin *Coin, mock *mockRPC) Store {
+				exchange := solana.MustPublicKeyFromBase58("5tzFkiKscXHK5ZXCGbXZxdw7gTjjD1mBwuoFbhUvuAi9")
+				fundTx := newTestTx(t, exchange, system.NewTransferInstruction(1e9, exchange, coin.creator).Build())
+				mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+					return txResult(t, fundTx), nil
+				})
+
+				// even if the exchange wallet shows up in the DB
+				return memoryStoreWithCreators(exchange.String())
+			},
+			shouldBuy: true,
+		},
+		{
+			name: "creator buy out of range",
+			setup: func(coin *Coin, mock *mockRPC) Store {
+				coin.creatorPurchaseSol = 3
+				return newMemoryStore()
+			},
+			rejectReason: "creator buy out of range",
+		},
+		{
+			name:         "creator created coin before",
+			setup:        func(coin *Coin, mock *mockRPC) Store { return memoryStoreWithCreators(coin.creator.String()) },
+			rejectReason: "creator created coin before",
+		},
+		{
+			name: "creator rugged a tracked launch",
+			setup: func(coin *Coin, mock *mockRPC) Store {
+				store := newMemoryStore()
+				store.RecordCreatorLaunch(coin.creator.String())
+				store.RecordCreatorSell(&CreatorSell{Creator: coin.creator.String(), TimeToSell: 10 * time.Second, DumpShare: 1})
+				return store
+			},
+			rejectReason: "creator rugged 1 of 1 launches",
+		},
+		{
+			name:         "funder created coin before",
+			setup:        func(coin *Coin, mock *mockRPC) Store { return memoryStoreWithCreators(funder.String()) },
+			rejectReason: "unsafe funder",
+		},
+		{
+			name: "no funders",
+			setup: func(coin *Coin, mock *mockRPC) Store {
+				mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+					return nil, nil
+				})
+				return newMemoryStore()
+			},
+			rejectReason: "no funders found",
+		},
+		{
+			name: "funder lookup fails",
+			setup: func(coin *Coin, mock *mockRPC) Store {
+				mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+					return nil, errors.New("rate limited")
+				})
+				return newMemoryStore()
+			},
+			rejectReason: "error fetching funders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coin := fixtureCoin(t)
+			mock := newFunderMockRPC(t, coin.creator, funder)
+
+			b := &Bot{
+				rpcClient:          mock.client(),
+				jrpcClient:         mock.jsonrpcClient(),
+				funderLookbackSigs: 30,
+
+				creatorMaxRugRate:        0.5,
+				creatorMinMedianSellTime: time.Minute,
+			}
+			b.store = tt.setup(coin, mock)
+
+			require.Equal(t, tt.shouldBuy, b.shouldBuyCoin(coin))
+			require.Equal(t, tt.rejectReason, coin.rejectReason)
+		})
+	}
+}
+
+func TestShouldBuyCoinDenylistedMint(t *testing.T) {
+	coin := fixtureCoin(t)
+	mock := newFunderMockRPC(t, coin.creator, solana.NewWallet().PublicKey())
+
+	b := &Bot{
+		rpcClient:          mock.client(),
+		jrpcClient:         mock.jsonrpcClient(),
+		funderLookbackSigs: 30,
+		store:              newMemoryStore(),
+	}
+
+	// a coin we would otherwise buy
+	require.True(t, b.shouldBuyCoin(coin))
+
+	b.mintDenylist = map[string]bool{coin.mintAddr.String(): true}
+	coin.rejectReason = ""
+	calls := len(mock.callsTo("getSignaturesForAddress"))
+
+	require.False(t, b.shouldBuyCoin(coin))
+	require.Equal(t, "mint denylisted", coin.rejectReason)
+
+	// rejected before any other check runs
+	require.Len(t, mock.callsTo("getSignaturesForAddress"), calls)
+}
+
+func TestLoadMintDenylist(t *testing.T) {
+	fromConfig, fromFile := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# known scams\n\n  "+fromFile.String()+"  \n"), 0o644))
+
+	denylist, err := loadMintDenylist([]string{fromConfig.String()}, path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{fromConfig.String(): true, fromFile.String(): true}, denylist)
+
+	_, err = loadMintDenylist([]string{"not a mint"}, "")
+	require.Error(t, err)
+
+	_, err = loadMintDenylist(nil, filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
+
+// slowStore holds every CreatorHasCoin lookup for a moment, tracking the most running at once
+type slowStore struct {
+	*memoryStore
+
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (s *slowStore) CreatorHasCoin(address, exceptMint string) (bool, error) {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+
+	for {
+		maxRunning := s.maxRunning.Load()
+		if running <= maxRunning || s.maxRunning.CompareAndSwap(maxRunning, running) {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	return s.memoryStore.CreatorHasCoin(address, exceptMint)
+}
+
+func TestFunderChecksBounded(t *testing.T) {
+	store := &slowStore{memoryStore: newMemoryStore()}
+	b := &Bot{store: store, funderCheckSlots: make(chan struct{}, 4)}
+
+	// a burst of mints checking 3 funders each
+	var wg sync.WaitGroup
+	for mint := 0; mint < 10; mint++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			funderStatusChan := make(chan bool)
+			for funder := 0; funder < 3; funder++ {
+				go b.isSafeFunder(solana.NewWallet().PublicKey().String(), funderStatusChan)
+			}
+
+			for funder := 0; funder < 3; funder++ {
+				require.True(t, <-funderStatusChan)
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(t, int32(4), store.maxRunning.Load())
+
+	// every slot is released once the checks return
+	require.Eventually(t, func() bool { return len(b.funderCheckSlots) == 0 }, time.Second, time.Millisecond)
+}
+
+func TestResolveCreatorTokenAccount(t *testing.T) {
+	result, tx := decodeTxFixture(t, "create-tx.json")
+	buyAccount := fixtureCoin(t).creatorATA
+	buyBalance := result.Meta.PostTokenBalances[0]
+
+	// tx with the creator's bought tokens ending up in `balances`
+	resolve := func(balances ...rpc.TokenBalance) *Coin {
+		coin := fixtureCoin(t)
+		meta := *result.Meta
+		meta.PostTokenBalances = balances
+
+		coin.resolveCreatorTokenAccount(tx, &meta)
+		return coin
+	}
+
+	// the fixture buys into the creator's own ATA
+	coin := resolve(buyBalance)
+	require.Equal(t, buyAccount, coin.creatorATA)
+	require.Equal(t, creatorATASourceBuy, coin.creatorATASource)
+
+	// bought into a program's account, which still holds the tokens
+	program := solana.NewWallet().PublicKey()
+	foreign := buyBalance
+	foreign.Owner = &program
+
+	coin = resolve(foreign)
+	require.Equal(t, buyAccount, coin.creatorATA)
+	require.Equal(t, creatorATASourceForeign+program.String(), coin.creatorATASource)
+
+	// the program forwarded the tokens to another account of the creator's
+	forwardedAccount := solana.NewWallet().PublicKey()
+	tx.Message.AccountKeys = append(tx.Message.AccountKeys, forwardedAccount)
+
+	emptied := foreign
+	emptied.UiTokenAmount = &rpc.UiTokenAmount{Amount: "0", Decimals: 6}
+	forwarded := buyBalance
+	forwarded.AccountIndex = uint16(len(tx.Message.AccountKeys) - 1)
+
+	coin = resolve(emptied, forwarded)
+	require.Equal(t, forwardedAccount, coin.creatorATA)
+	require.Equal(t, creatorATASourceForwarded, coin.creatorATASource)
+	require.Equal(t, uint64(34_612_903_225806), coin.creatorTokenBalance)
+
+	// tokens went somewhere we can't see, fall back to the canonical ATA
+	canonicalATA, _, err := solana.FindAssociatedTokenAddress(coin.creator, coin.mintAddr)
+	require.NoError(t, err)
+
+	coin = resolve(emptied)
+	require.Equal(t, canonicalATA, coin.creatorATA)
+	require.Equal(t, creatorATASourceCanonical, coin.creatorATASource)
+}
+
+func TestShouldBuyCoinCreatorCooldown(t *testing.T) {
+	coin := fixtureCoin(t)
+	mock := newFunderMockRPC(t, coin.creator, solana.NewWallet().PublicKey())
+
+	b := &Bot{
+		rpcClient:          mock.client(),
+		jrpcClient:         mock.jsonrpcClient(),
+		funderLookbackSigs: 30,
+		store:              newMemoryStore(),
+		creatorCooldown:    time.Minute,
+	}
+
+	require.True(t, b.shouldBuyCoin(coin))
+
+	// the creator's next launch within the cooldown is rejected, however good it looks
+	next := fixtureCoin(t)
+	next.creator = coin.creator
+	require.False(t, b.shouldBuyCoin(next))
+	require.Equal(t, "creator on cooldown", next.rejectReason)
+
+	// other creators aren't held back
+	require.True(t, b.creatorOnCooldown(coin.creator.String()))
+	require.False(t, b.creatorOnCooldown(solana.NewWallet().PublicKey().String()))
+
+	// once the cooldown is over, the creator may launch again
+	b.creatorLaunches.Store(coin.creator.String(), time.Now().Add(-2*time.Minute))
+	require.False(t, b.creatorOnCooldown(coin.creator.String()))
+}
+
+func TestShouldBuyCoinTimesOut(t *testing.T) {
+	funder := solana.NewWallet().PublicKey()
+
+	tests := []struct {
+		name  string
+		setup func(b *Bot, mock *mockRPC)
+	}{
+		{
+			name: "funder lookup hangs",
+			setup: func(b *Bot, mock *mockRPC) {
+				mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+					time.Sleep(300 * time.Millisecond)
+					return []map[string]interface{}{}, nil
+				})
+			},
+		},
+		{
+			name: "funder check hangs",
+			setup: func(b *Bot, mock *mockRPC) {
+				// every funder check slot is taken
+				b.funderCheckSlots = make(chan struct{}, 1)
+				b.funderCheckSlots <- struct{}{}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coin := fixtureCoin(t)
+			mock := newFunderMockRPC(t, coin.creator, funder)
+
+			b := &Bot{
+				rpcClient:          mock.client(),
+				jrpcClient:         mock.jsonrpcClient(),
+				store:              newMemoryStore(),
+				funderLookbackSigs: 30,
+			}
+			tt.setup(b, mock)
+
+			// funder lookups usually take 20ms, allowing shouldBuyCoin 40ms
+			b.funderFetchLatency.record(20 * time.Millisecond)
+
+			timeouts := shouldBuyTimeouts.Value()
+			start := time.Now()
+
+			require.False(t, b.shouldBuyCoin(coin))
+			require.Equal(t, "shouldBuyCoin timed out", coin.rejectReason)
+			require.Less(t, time.Since(start), 250*time.Millisecond)
+			require.Equal(t, timeouts+1, shouldBuyTimeouts.Value())
+		})
+	}
+}
+
+func TestWatchMintSubscriptionResubscribesWhenIdle(t *testing.T) {
+	subscribes := make(chan struct{}, 4)
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		subscribes <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, err := newWsPool(ctx, wsMock.url(), 1)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	notifier := &recordingNotifier{}
+	b := &Bot{wsPool: pool, mintIdleTimeout: 100 * time.Millisecond, notifier: notifier}
+
+	go b.HandleNewMints()
+	<-subscribes
+
+	resubscribesBefore := mintWatchdogResubscribes.Value()
+	go b.watchMintSubscription(ctx)
+
+	select {
+	case <-subscribes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("mint subscription wasn't restarted")
+	}
+
+	require.Greater(t, mintWatchdogResubscribes.Value(), resubscribesBefore)
+	require.NotEmpty(t, notifier.sent())
+}
+
+func TestHandleNewMintsSubscribesEveryMintProgram(t *testing.T) {
+	fork := solana.NewWallet().PublicKey()
+
+	mentions := make(chan string, 4)
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		var filter struct {
+			Mentions []string `json:"mentions"`
+		}
+		if json.Unmarshal(params[0], &filter) == nil && len(filter.Mentions) == 1 {
+			mentions <- filter.Mentions[0]
+		}
+		return nil
+	})
+
+	b := &Bot{
+		wsPool:         newWsPoolFromClients(wsMock.client(t)),
+		mintProgramIDs: []solana.PublicKey{pumpProgramID, fork},
+	}
+	go b.HandleNewMints()
+
+	var subscribed []string
+	for len(subscribed) < 2 {
+		select {
+		case mention := <-mentions:
+			subscribed = append(subscribed, mention)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only subscribed to %v", subscribed)
+		}
+	}
+
+	require.ElementsMatch(t, []string{pumpProgramID.String(), fork.String()}, subscribed)
+}
+
+func TestDecodeMintInstructionsOfForks(t *testing.T) {
+	fork := solana.NewWallet().PublicKey()
+	f := newLaunchFixture(t)
+
+	// the fork's create is pump's, invoked on another program which derives its own curve accounts
+	create := f.createInst()
+	data, err := create.Data()
+	require.NoError(t, err)
+
+	forkBondingCurve, _, err := solana.FindProgramAddress([][]byte{[]byte("bonding-curve"), f.mint.Bytes()}, fork)
+	require.NoError(t, err)
+	forkAssociatedBondingCurve, _, err := solana.FindAssociatedTokenAddress(forkBondingCurve, f.mint)
+	require.NoError(t, err)
+
+	forkAccounts := slices.Clone(create.Accounts())
+	forkAccounts[2] = solana.Meta(forkBondingCurve).WRITE()
+	forkAccounts[3] = solana.Meta(forkAssociatedBondingCurve).WRITE()
+	forkCreate := solana.NewInstruction(fork, forkAccounts, data)
+
+	b := &Bot{mintProgramIDs: []solana.PublicKey{pumpProgramID, fork}}
+
+	for _, tt := range []struct {
+		name    string
+		inst    solana.Instruction
+		program solana.PublicKey
+	}{
+		{name: "pump", inst: create, program: pumpProgramID},
+		{name: "fork", inst: forkCreate, program: fork},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTestTx(t, f.creator, tt.inst)
+
+			coin, err := fetchNewCoin(b.decodeMintInstructions(tx))
+			require.NoError(t, err)
+			require.Equal(t, f.mint, coin.mintAddr)
+			require.Equal(t, tt.program, coin.programID)
+		})
+	}
+
+	// programs we weren't configured with aren't decoded
+	_, err = fetchNewCoin(decodeInstructions(newTestTx(t, f.creator, forkCreate)))
+	require.ErrorIs(t, err, errCreatingNewCoin)
+}
+
+func TestMintCheckPoolDropsOldestWhenSaturated(t *testing.T) {
+	// the only worker is stuck on a slow check
+	release := make(chan struct{})
+	started := make(chan struct{})
+	pool := newMintCheckPool(1, 2)
+	b := &Bot{mintChecks: pool}
+	b.goMintCheck(func(time.Time) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var lock sync.Mutex
+	var ran []int
+	check := func(i int) func(time.Time) {
+		return func(time.Time) {
+			lock.Lock()
+			ran = append(ran, i)
+			lock.Unlock()
+		}
+	}
+
+	// the subscriber keeps handing off mints without waiting on the worker
+	droppedBefore := mintChecksDropped.Value()
+	start := time.Now()
+	for i := range 5 {
+		b.goMintCheck(check(i))
+	}
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.Equal(t, droppedBefore+3, mintChecksDropped.Value())
+
+	// only the newest mints are still checked
+	close(release)
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(ran) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	require.Equal(t, []int{3, 4}, ran)
+	lock.Unlock()
+}
+
+func TestShouldBuyCoinChecksCurveFill(t *testing.T) {
+	coin := fixtureCoin(t)
+	mock := newFunderMockRPC(t, coin.creator, solana.NewWallet().PublicKey())
+
+	// others bought the coin a third of the way up the curve before we saw it
+	lateCurve := curveAfterCreatorBuy(coin.creatorTokenBalance)
+	lateCurve.RealSolReserves = new(big.Int).SetUint64(defaultMigrationThreshold / 3)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, lateCurve), nil
+	})
+
+	b := &Bot{
+		rpcClient:          mock.client(),
+		jrpcClient:         mock.jsonrpcClient(),
+		funderLookbackSigs: 30,
+		store:              newMemoryStore(),
+		maxEvalCurveFill:   20,
+		localCurveMaxAge:   time.Second,
+	}
+
+	require.False(t, b.shouldBuyCoin(coin))
+	require.Equal(t, "curve 33.3% filled", coin.rejectReason)
+	require.InDelta(t, 33.3, coin.evalCurveFill, 0.1)
+	require.InDelta(t, 33.3, coin.state().EvalCurveFill, 0.1)
+
+	// a curve kept current from the coin's trades isn't fetched again
+	fresh := fixtureCoin(t)
+	fresh.creator = solana.NewWallet().PublicKey()
+	b.updateCurve(fresh, curveAfterCreatorBuy(fresh.creatorTokenBalance))
+	mock = newFunderMockRPC(t, fresh.creator, solana.NewWallet().PublicKey())
+	b.rpcClient, b.jrpcClient = mock.client(), mock.jsonrpcClient()
+
+	require.True(t, b.shouldBuyCoin(fresh), fresh.rejectReason)
+	require.Less(t, fresh.evalCurveFill, 20.0)
+	require.Empty(t, mock.callsTo("getAccountInfo"))
+}
+
+func TestShouldBuyCoinSkipsForkCoins(t *testing.T) {
+	coin := fixtureCoin(t)
+	coin.programID = solana.NewWallet().PublicKey()
+
+	b := &Bot{}
+	require.False(t, b.shouldBuyCoin(coin))
+	require.Equal(t, "not a pump coin", coin.rejectReason)
+}
+
+func TestMintCheckGetsDetectionTime(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	b := &Bot{mintChecks: newMintCheckPool(1, 1)}
+	b.goMintCheck(func(time.Time) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	// the check is handed when its mint was detected, not when a worker got to it
+	detected := make(chan time.Time, 1)
+	submittedAt := time.Now()
+	b.goMintCheck(func(detectedAt time.Time) { detected <- detectedAt })
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	require.WithinDuration(t, submittedAt, <-detected, 10*time.Millisecond)
+}
+
+func TestMintChecksRunningGauge(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	running := mintChecksRunning.Value()
+
+	b := &Bot{}
+	b.goMintCheck(func(time.Time) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	require.Equal(t, running+1, mintChecksRunning.Value())
+
+	close(release)
+	require.Eventually(t, func() bool { return mintChecksRunning.Value() == running }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// Notifier pushes alerts which need an operator's attention, e.g. trading being halted
+type Notifier interface {
+	Send(msg string) error
+}
+
+// telegramNotifier sends alerts as Telegram messages from a bot to a chat
+type telegramNotifier struct {
+	apiURL   string
+	botToken string
+	chatID   string
+	client   *http.Client
+}
+
+func newTelegramNotifier(botToken, chatID string) *telegramNotifier {
+	return &telegramNotifier{
+		apiURL:   telegramAPIURL,
+		botToken: botToken,
+		chatID:   chatID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *telegramNotifier) Send(msg string) error {
+	body, err := json.Marshal(map[string]string{"chat_id": n.chatID, "text": msg})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(fmt.Sprintf("%s/bot%s/sendMessage", n.apiURL, n.botToken), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to send telegram message: %s %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// notify sends `msg` through our notifier, if one is configured
+func (b *Bot) notify(msg string) {
+	if b.notifier == nil {
+		return
+	}
+
+	if err := b.notifier.Send(msg); err != nil {
+		b.statusr("Failed to send notification: " + err.Error())
+	}
+}
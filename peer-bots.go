@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// checkPeerBots fetches the block our buy of the coin landed in, looking for buys of the same mint by
+// `knownCompetitorBots`. racing one of them for the coin means we may not have been the second buyer, so
+// every `competedBuysBeforeCut` competed buys cut our buy amount by `competedBuyCut`. runs off the hot path
+func (b *Bot) checkPeerBots(coin *Coin, buySig solana.Signature) {
+	if len(b.knownCompetitorBots) == 0 {
+		return
+	}
+
+	competitors, err := b.findCompetingBots(coin, buySig)
+	if err != nil {
+		b.statusr(fmt.Sprintf("Failed to check %s for competing bots: %s", coin.mintAddr.String(), err))
+		return
+	}
+
+	if len(competitors) == 0 {
+		return
+	}
+
+	coin.status("Competed with known bot " + strings.Join(competitors, ", "))
+	b.logEvent(coin, eventCompetedWithBot, strings.Join(competitors, ","))
+
+	competedBotBuys.Inc()
+	competed := b.competedBuys.Add(1)
+	if b.competedBuysBeforeCut <= 0 || competed%int64(b.competedBuysBeforeCut) != 0 {
+		return
+	}
+
+	b.buyAmountCuts.Add(1)
+	b.statusy(fmt.Sprintf("%d buys competed with known bots, buying %s per coin from now on", competed, formatSol(int64(b.buyLamports()), b.solUSD())))
+}
+
+// findCompetingBots returns the known competitor bots buying the coin in the block `buySig` landed in
+func (b *Bot) findCompetingBots(coin *Coin, buySig solana.Signature) ([]string, error) {
+	buy, err := b.fetchConfirmedTxResult(buySig)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rewards := false
+	version := uint64(0)
+	block, err := b.rpcClient.GetBlockWithOpts(ctx, buy.Slot, &rpc.GetBlockOpts{
+		Encoding:                       solana.EncodingBase64,
+		TransactionDetails:             rpc.TransactionDetailsFull,
+		Rewards:                        &rewards,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*solana.Transaction
+	for _, blockTx := range block.Transactions {
+		if blockTx.Meta == nil || blockTx.Meta.Err != nil {
+			continue
+		}
+
+		if tx, err := blockTx.GetTransaction(); err == nil {
+			txs = append(txs, tx)
+		}
+	}
+
+	var competitors []string
+	for _, buyer := range findBuyers(txs, coin) {
+		if b.knownCompetitorBots[buyer] {
+			competitors = append(competitors, buyer)
+		}
+	}
+
+	return competitors, nil
+}
+
+// buyLamports is how much we spend on each coin in `buyModeSolAmount`, `buyAmountLamport` less
+// `competedBuyCut` for each cut made by checkPeerBots
+func (b *Bot) buyLamports() uint64 {
+	cuts := b.buyAmountCuts.Load()
+	if cuts == 0 {
+		return b.buyAmountLamport
+	}
+
+	return uint64(float64(b.buyAmountLamport) * math.Pow(1-b.competedBuyCut, float64(cuts)))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPeerBots(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, creator: f.creator, tokenBondingCurve: f.bondingCurve}
+	wallet := solana.NewWallet().PrivateKey
+	competitor, stranger := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	// our buys landed in slot 100, next to the competitor's, and in slot 200, next to a stranger's
+	blocks := map[uint64][]*solana.Transaction{
+		100: {newTestTx(t, competitor, buyerInst(f, competitor))},
+		200: {newTestTx(t, stranger, buyerInst(f, stranger))},
+	}
+	buySlots := map[string]uint64{solana.Signature{1}.String(): 100, solana.Signature{2}.String(): 200}
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var sig string
+		require.NoError(t, json.Unmarshal(params[0], &sig))
+
+		result := txResult(t, newTestTx(t, wallet.PublicKey(), buyerInst(f, wallet.PublicKey())))
+		result["slot"] = buySlots[sig]
+		return result, nil
+	})
+	mock.handle("getBlock", func(params []json.RawMessage) (interface{}, error) {
+		var slot uint64
+		require.NoError(t, json.Unmarshal(params[0], &slot))
+
+		var txs []interface{}
+		for _, tx := range blocks[slot] {
+			data, err := tx.MarshalBinary()
+			require.NoError(t, err)
+
+			txs = append(txs, map[string]interface{}{
+				"transaction": []string{base64.StdEncoding.EncodeToString(data), "base64"},
+				"meta":        map[string]interface{}{"err": nil, "fee": 5000, "preBalances": []uint64{}, "postBalances": []uint64{}},
+			})
+		}
+
+		return map[string]interface{}{"blockhash": solana.Hash{}.String(), "parentSlot": slot - 1, "transactions": txs}, nil
+	})
+
+	b := &Bot{
+		rpcClient:             mock.client(),
+		privateKey:            wallet,
+		buyAmountLamport:      1_000_000_000,
+		knownCompetitorBots:   map[string]bool{competitor.String(): true},
+		competedBuysBeforeCut: 2,
+		competedBuyCut:        0.1,
+	}
+
+	// only buys next to a known bot count toward a cut
+	b.checkPeerBots(coin, solana.Signature{2})
+	require.Zero(t, b.competedBuys.Load())
+
+	b.checkPeerBots(coin, solana.Signature{1})
+	require.EqualValues(t, 1, b.competedBuys.Load())
+	require.Equal(t, uint64(1_000_000_000), b.buyLamports())
+
+	b.checkPeerBots(coin, solana.Signature{1})
+	require.EqualValues(t, 2, b.competedBuys.Load())
+	require.Equal(t, uint64(900_000_000), b.buyLamports())
+
+	// cuts compound
+	b.buyAmountCuts.Add(1)
+	require.Equal(t, uint64(810_000_000), b.buyLamports())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// a just confirmed tx can take a moment to be served by getTransaction
+	tradeTxFetchAttempts = 5
+	tradeTxFetchDelay    = 500 * time.Millisecond
+)
+
+var errWalletNotInTx = errors.New("Wallet Not In Transaction")
+
+// AtomicBuySell is a single round trip: the buy tx of a position and the sell tx which closed it,
+// with the P&L attributed to that pair of transactions
+type AtomicBuySell struct {
+	Mint          string
+	BuySignature  string // empty if the buy signature is unknown
+	SellSignature string
+
+	BuyLamports  uint64 // the max SOL cost the buy was sent with
+	SolReceived  uint64 // lamports the sell paid our wallet, before the sell's tx fee & tip
+	TokensSold   uint64
+	FeesLamports uint64 // tx fees (base & priority) of the buy & sell
+	TipsLamports uint64 // jito tips of the buy & sell
+
+	GrossPnLLamports    int64 // SolReceived less BuyLamports
+	RealizedPnLLamports int64 // net of fees & tips, see netPnL
+
+	// SOL/USD prices when the buy & sell went through, 0 if unknown. RealizedPnLUSD is 0 unless both are known
+	BuySolUSD      float64
+	SellSolUSD     float64
+	RealizedPnLUSD float64
+
+	ListenerState string // of the coin's creator listener when the round trip was recorded
+}
+
+// recordRoundTrip fetches the confirmed sell (and buy) of a coin, attributing the SOL the sell
+// paid us to the buy, then stores the round trip, logs the P&L & counts it toward the daily loss limit.
+// runs off the hot path
+func (b *Bot) recordRoundTrip(coin *Coin, sellSig solana.Signature) {
+	if !b.recordTrades && b.maxDailyLossSol <= 0 {
+		return
+	}
+
+	if !b.positionCounts(coin) {
+		b.statusy(fmt.Sprintf("Not accounting sell %s of %s, our buy never reached %s", sellSig, coin.mintAddr.String(), b.buyAccountingCommitment))
+		return
+	}
+
+	trade, err := b.fetchRoundTrip(coin, sellSig)
+	if err != nil {
+		b.statusr(fmt.Sprintf("Failed to fetch round trip of %s: %s", coin.mintAddr.String(), err))
+		return
+	}
+
+	pnl := fmt.Sprintf("P&L %s: %+.5f SOL (gross %+.5f, paid %.5f, received %.5f, fees %.5f, tips %.5f, sell %s)",
+		trade.Mint,
+		float64(trade.RealizedPnLLamports)/float64(solana.LAMPORTS_PER_SOL),
+		float64(trade.GrossPnLLamports)/float64(solana.LAMPORTS_PER_SOL),
+		float64(trade.BuyLamports)/float64(solana.LAMPORTS_PER_SOL),
+		float64(trade.SolReceived)/float64(solana.LAMPORTS_PER_SOL),
+		float64(trade.FeesLamports)/float64(solana.LAMPORTS_PER_SOL),
+		float64(trade.TipsLamports)/float64(solana.LAMPORTS_PER_SOL),
+		trade.SellSignature,
+	)
+	if trade.BuySolUSD > 0 && trade.SellSolUSD > 0 {
+		pnl += fmt.Sprintf(", %+.2f USD (SOL at $%.2f buying, $%.2f selling)", trade.RealizedPnLUSD, trade.BuySolUSD, trade.SellSolUSD)
+	}
+
+	if trade.RealizedPnLLamports >= 0 {
+		b.statusg(pnl)
+	} else {
+		b.statusr(pnl)
+	}
+
+	b.recordDailyPnL(trade.RealizedPnLLamports)
+
+	if !b.recordTrades {
+		return
+	}
+
+	if err := b.store.RecordTrade(trade); err != nil {
+		b.statusr("Failed to record trade: " + err.Error())
+	}
+}
+
+// fetchRoundTrip builds the round trip of the coin's buy & `sellSig` from their tx metas.
+// SolReceived comes from our wallet's lamport change in the sell, TokensSold from our token balances.
+// fees are the metas' `fee`, tips the transfers to jito's tip accounts in the txs themselves
+func (b *Bot) fetchRoundTrip(coin *Coin, sellSig solana.Signature) (*AtomicBuySell, error) {
+	wallet := b.privateKey.PublicKey()
+
+	trade := &AtomicBuySell{
+		Mint:          coin.mintAddr.String(),
+		SellSignature: sellSig.String(),
+		BuyLamports:   coin.buyPrice,
+		BuySolUSD:     coin.buySolUSD,
+		SellSolUSD:    b.solUSD(),
+
+		ListenerState: b.creatorListenerState(coin),
+	}
+
+	if err := b.addSell(trade, coin, sellSig); err != nil {
+		return nil, err
+	}
+
+	// the position's partial sells (see sellPartial) were paid for by the same buy
+	b.pendingCoinsLock.Lock()
+	partialSells := slices.Clone(coin.partialSellSignatures)
+	b.pendingCoinsLock.Unlock()
+
+	for _, sig := range partialSells {
+		if err := b.addSell(trade, coin, sig); err != nil {
+			b.statusr(fmt.Sprintf("Failed to fetch partial sell %s of %s, leaving it out of the P&L: %s", sig, coin.mintAddr.String(), err))
+		}
+	}
+
+	if coin.buyTransactionSignature != nil {
+		trade.BuySignature = coin.buyTransactionSignature.String()
+
+		// without the buy's fee & tip the P&L is a little optimistic, but still worth recording
+		if buyTx, buyMeta, err := b.fetchConfirmedTx(*coin.buyTransactionSignature); err == nil {
+			trade.FeesLamports += buyMeta.Fee
+			trade.TipsLamports += jitoTipLamports(buyTx, wallet)
+		}
+	}
+
+	trade.GrossPnLLamports = int64(trade.SolReceived) - int64(trade.BuyLamports)
+	trade.RealizedPnLLamports = netPnL(trade.GrossPnLLamports, trade.FeesLamports, trade.TipsLamports)
+	trade.RealizedPnLUSD = netPnLUSD(trade)
+	return trade, nil
+}
+
+// addSell adds what a confirmed sell of the coin paid us, and cost us, to the round trip
+func (b *Bot) addSell(trade *AtomicBuySell, coin *Coin, sellSig solana.Signature) error {
+	wallet := b.privateKey.PublicKey()
+
+	sellTx, sellMeta, err := b.fetchConfirmedTx(sellSig)
+	if err != nil {
+		return err
+	}
+
+	lamportsChange, err := walletLamportsChange(sellTx, sellMeta, wallet)
+	if err != nil {
+		return err
+	}
+
+	sellTip := jitoTipLamports(sellTx, wallet)
+
+	trade.SolReceived += uint64(max(lamportsChange+int64(sellMeta.Fee)+int64(sellTip), 0))
+	trade.TokensSold += tokensSold(sellMeta, coin.mintAddr, wallet)
+	trade.FeesLamports += sellMeta.Fee
+	trade.TipsLamports += sellTip
+	return nil
+}
+
+// netPnLUSD is a round trip's realized P&L in USD, the buy valued at the SOL price it went through at and the
+// sell (with the fees & tips, mostly paid selling) at the sell's. 0 unless both prices are known
+func netPnLUSD(trade *AtomicBuySell) float64 {
+	paid, buyKnown := usdValue(int64(trade.BuyLamports), trade.BuySolUSD)
+	received, sellKnown := usdValue(int64(trade.SolReceived)-int64(trade.FeesLamports)-int64(trade.TipsLamports), trade.SellSolUSD)
+	if !buyKnown || !sellKnown {
+		return 0
+	}
+
+	return received - paid
+}
+
+// netPnL is a round trip's P&L once the tx fees & jito tips paid to get it are taken out
+func netPnL(grossLamports int64, feesLamports, tipsLamports uint64) int64 {
+	return grossLamports - int64(feesLamports) - int64(tipsLamports)
+}
+
+// fetchConfirmedTx fetches a tx & its meta at confirmed commitment, retrying while it isn't served yet
+func (b *Bot) fetchConfirmedTx(sig solana.Signature) (*solana.Transaction, *rpc.TransactionMeta, error) {
+	result, err := b.fetchConfirmedTxResult(sig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := result.Transaction.GetTransaction()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, result.Meta, nil
+}
+
+// walletLamportsChange is how many lamports `wallet` gained (or lost) in a tx, fees included
+func walletLamportsChange(tx *solana.Transaction, meta *rpc.TransactionMeta, wallet solana.PublicKey) (int64, error) {
+	for i, key := range txAccountKeys(tx, meta) {
+		if !key.Equals(wallet) {
+			continue
+		}
+
+		if i >= len(meta.PreBalances) || i >= len(meta.PostBalances) {
+			break
+		}
+
+		return int64(meta.PostBalances[i]) - int64(meta.PreBalances[i]), nil
+	}
+
+	return 0, errWalletNotInTx
+}
+
+// tokensSold is how many tokens of `mint` the token accounts owned by `wallet` lost in a tx
+func tokensSold(meta *rpc.TransactionMeta, mint, wallet solana.PublicKey) uint64 {
+	var sold uint64
+
+	for _, pre := range meta.PreTokenBalances {
+		if !pre.Mint.Equals(mint) || pre.Owner == nil || !pre.Owner.Equals(wallet) {
+			continue
+		}
+
+		// a closed account has no post balance
+		var postAmount uint64
+		for _, post := range meta.PostTokenBalances {
+			if post.AccountIndex == pre.AccountIndex {
+				postAmount = tokenBalanceAmount(post)
+				break
+			}
+		}
+
+		if preAmount := tokenBalanceAmount(pre); preAmount > postAmount {
+			sold += preAmount - postAmount
+		}
+	}
+
+	return sold
+}
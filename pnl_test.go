@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	jito_go "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	wallet := solana.NewWallet().PrivateKey
+	mint := solana.NewWallet().PublicKey()
+	buySig, sellSig := solana.Signature{1}, solana.Signature{2}
+
+	// any tx paid for by our wallet will do, only the meta is looked at
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		system.NewTransferInstruction(1, wallet.PublicKey(), solana.NewWallet().PublicKey()).Build(),
+	}, solana.Hash{}, solana.TransactionPayer(wallet.PublicKey()))
+	require.NoError(t, err)
+
+	tokenBalance := func(amount string) map[string]interface{} {
+		return map[string]interface{}{
+			"accountIndex":  1,
+			"mint":          mint.String(),
+			"owner":         wallet.PublicKey().String(),
+			"uiTokenAmount": map[string]interface{}{"amount": amount, "decimals": 6},
+		}
+	}
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		result := txResult(t, tx)
+
+		var sig string
+		require.NoError(t, json.Unmarshal(params[0], &sig))
+		if sig == sellSig.String() {
+			// the sell paid us 0.15 SOL, less its 5000 lamport fee
+			result["meta"] = map[string]interface{}{
+				"err":               nil,
+				"fee":               5000,
+				"preBalances":       []uint64{1_000_000_000, 2_039_280, 1},
+				"postBalances":      []uint64{1_149_995_000, 2_039_280, 1},
+				"preTokenBalances":  []interface{}{tokenBalance("3000000000")},
+				"postTokenBalances": []interface{}{tokenBalance("0")},
+			}
+		}
+
+		return result, nil
+	})
+
+	store := newRecordingStore()
+	b := &Bot{rpcClient: mock.client(), privateKey: wallet, store: store, recordTrades: true}
+	coin := &Coin{mintAddr: mint, buyPrice: solana.LAMPORTS_PER_SOL / 10, buyTransactionSignature: &buySig}
+
+	// a buy which never reached the accounting commitment isn't a position
+	coin.positionSettled = make(chan struct{})
+	close(coin.positionSettled)
+	b.recordRoundTrip(coin, sellSig)
+	require.Empty(t, store.trades)
+
+	coin.positionOpen = true
+	b.recordRoundTrip(coin, sellSig)
+
+	require.Len(t, store.trades, 1)
+	require.Equal(t, &AtomicBuySell{
+		Mint:                mint.String(),
+		BuySignature:        buySig.String(),
+		SellSignature:       sellSig.String(),
+		BuyLamports:         100_000_000,
+		SolReceived:         150_000_000,
+		TokensSold:          3_000_000_000,
+		FeesLamports:        10_000,
+		GrossPnLLamports:    50_000_000,
+		RealizedPnLLamports: 49_990_000,
+	}, store.trades[0])
+}
+
+func TestNetPnL(t *testing.T) {
+	tests := []struct {
+		name  string
+		gross int64
+		fees  uint64
+		tips  uint64
+		net   int64
+	}{
+		{name: "vanilla round trip", gross: 50_000_000, fees: 10_000, net: 49_990_000},
+		{name: "tipped round trip", gross: 50_000_000, fees: 10_000, tips: 2_000_000, net: 47_990_000},
+		{name: "tips turn a small win into a loss", gross: 1_000_000, fees: 10_000, tips: 2_000_000, net: -1_010_000},
+		{name: "losing round trip", gross: -20_000_000, fees: 10_000, tips: 100_000, net: -20_110_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.net, netPnL(tt.gross, tt.fees, tt.tips))
+		})
+	}
+}
+
+func TestJitoTipLamports(t *testing.T) {
+	wallet, other := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	tipAccount := jito_go.MainnetTipAccounts[3]
+
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		system.NewTransferInstruction(1_000_000, wallet, tipAccount).Build(),
+		system.NewTransferInstruction(5_000, wallet, other).Build(),     // not a tip
+		system.NewTransferInstruction(7_000, other, tipAccount).Build(), // someone else's tip
+		system.NewTransferInstruction(250_000, wallet, jito_go.MainnetTipAccounts[0]).Build(),
+	}, solana.Hash{}, solana.TransactionPayer(wallet))
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(1_250_000), jitoTipLamports(tx, wallet))
+	require.Equal(t, uint64(7_000), jitoTipLamports(tx, other))
+}
+
+func TestWalletLamportsChangeMissingWallet(t *testing.T) {
+	result, tx := decodeTxFixture(t, "create-tx.json")
+
+	_, err := walletLamportsChange(tx, result.Meta, solana.NewWallet().PublicKey())
+	require.ErrorIs(t, err, errWalletNotInTx)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// PricePoint is a coin's bonding curve right after a trade
+type PricePoint struct {
+	At    time.Time
+	Curve *BondingCurveData
+	Price float64 // lamports per whole token, see SpotPrice
+}
+
+// PriceHistory holds the latest curve states of a held coin, fed by its trade tape, for exit strategies which
+// need more than the latest snapshot (trailing stops, momentum). a ring buffer, so memory per coin is bounded
+// by its capacity. the zero value is empty, safe for concurrent use
+type PriceHistory struct {
+	lock sync.Mutex
+
+	points []PricePoint // ring buffer, allocated on the first record
+	count  int          // points held, up to len(points)
+	next   int          // where the next point is written, overwriting the oldest once full
+
+	entry, high PricePoint // first point & highest priced point recorded, kept once overwritten
+}
+
+// record adds the curve after a trade seen at `at`, keeping the last `capacity` points
+func (h *PriceHistory) record(curve *BondingCurveData, at time.Time, capacity int) {
+	if capacity <= 0 {
+		return
+	}
+
+	price, _ := curve.SpotPrice().Float64()
+	point := PricePoint{At: at, Curve: curve, Price: price}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.points == nil {
+		h.points = make([]PricePoint, capacity)
+		h.entry, h.high = point, point
+	}
+
+	h.points[h.next] = point
+	h.next = (h.next + 1) % len(h.points)
+	h.count = min(h.count+1, len(h.points))
+
+	if point.Price > h.high.Price {
+		h.high = point
+	}
+}
+
+// at is the i-th oldest point held. callers hold the lock
+func (h *PriceHistory) at(i int) PricePoint {
+	return h.points[(h.next-h.count+i+len(h.points))%len(h.points)]
+}
+
+// Latest is the most recent point, false if nothing was recorded
+func (h *PriceHistory) Latest() (PricePoint, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 {
+		return PricePoint{}, false
+	}
+
+	return h.at(h.count - 1), true
+}
+
+// Entry is the first point recorded after our buy, false if nothing was recorded
+func (h *PriceHistory) Entry() (PricePoint, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.entry, h.count > 0
+}
+
+// HighWaterMark is the highest priced point since our entry, false if nothing was recorded
+func (h *PriceHistory) HighWaterMark() (PricePoint, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.high, h.count > 0
+}
+
+// Change is the percent price change from `lookback` before `now` to the latest point, measured from the
+// newest point at least that old, or the oldest point held if the history doesn't reach back that far.
+// false until two points were recorded
+func (h *PriceHistory) Change(lookback time.Duration, now time.Time) (float64, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count < 2 {
+		return 0, false
+	}
+
+	from := h.at(0)
+	for i := h.count - 1; i >= 0; i-- {
+		if point := h.at(i); now.Sub(point.At) >= lookback {
+			from = point
+			break
+		}
+	}
+
+	if from.Price == 0 {
+		return 0, false
+	}
+
+	latest := h.at(h.count - 1)
+	return 100 * (latest.Price - from.Price) / from.Price, true
+}
+
+// reset drops every point, freeing the buffer
+func (h *PriceHistory) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.points, h.count, h.next = nil, 0, 0
+	h.entry, h.high = PricePoint{}, PricePoint{}
+}
+
+// recordPrice adds the curve after a trade to the coin's price history, from our entry on
+func (b *Bot) recordPrice(coin *Coin, curve *BondingCurveData) {
+	if !coin.botPurchased {
+		return
+	}
+
+	coin.prices.record(curve, time.Now(), b.priceHistoryLength)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// curveAtPrice is a curve whose spot price is `price` lamports per token
+func curveAtPrice(price int64) *BondingCurveData {
+	return &BondingCurveData{VirtualSolReserves: big.NewInt(price), VirtualTokenReserves: big.NewInt(tokenUnit)}
+}
+
+func TestPriceHistory(t *testing.T) {
+	var h PriceHistory
+	start := time.Now()
+
+	_, ok := h.Latest()
+	require.False(t, ok)
+	_, ok = h.Change(time.Second, start)
+	require.False(t, ok)
+
+	// a pump & dump, one trade a second, overflowing the 4 points kept
+	for i, price := range []int64{30, 60, 45, 40, 36, 33} {
+		h.record(curveAtPrice(price), start.Add(time.Duration(i)*time.Second), 4)
+	}
+
+	require.Len(t, h.points, 4)
+
+	latest, ok := h.Latest()
+	require.True(t, ok)
+	require.Equal(t, 33.0, latest.Price)
+
+	// entry & high survive being overwritten
+	entry, _ := h.Entry()
+	require.Equal(t, 30.0, entry.Price)
+	require.Equal(t, start, entry.At)
+
+	high, _ := h.HighWaterMark()
+	require.Equal(t, 60.0, high.Price)
+
+	now := start.Add(5 * time.Second)
+	change, ok := h.Change(3*time.Second, now)
+	require.True(t, ok)
+	require.InDelta(t, -26.67, change, 0.01) // from 45 at 2s
+
+	// beyond the history held, the oldest point is used
+	change, _ = h.Change(time.Minute, now)
+	require.InDelta(t, -26.67, change, 0.01)
+
+	change, _ = h.Change(time.Second, now)
+	require.InDelta(t, -8.33, change, 0.01) // from 36 at 4s
+
+	h.reset()
+	require.Nil(t, h.points)
+	_, ok = h.HighWaterMark()
+	require.False(t, ok)
+}
+
+func TestRecordPrice(t *testing.T) {
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey()}
+	b := &Bot{priceHistoryLength: 8, pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	// trades before our buy aren't our entry
+	b.recordPrice(coin, curveAtPrice(30))
+	_, ok := coin.prices.Latest()
+	require.False(t, ok)
+
+	coin.botPurchased = true
+	b.recordPrice(coin, curveAtPrice(40))
+	entry, ok := coin.prices.Entry()
+	require.True(t, ok)
+	require.Equal(t, 40.0, entry.Price)
+
+	// the history goes with the coin
+	b.pendingCoinsLock.Lock()
+	b.removePendingCoin(coin.mintAddr.String(), coin, "test")
+	b.pendingCoinsLock.Unlock()
+
+	_, ok = coin.prices.Latest()
+	require.False(t, ok)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const pumpPortalWebhooksURL = "https://pumpportal.fun/api/webhooks"
+
+type pumpPortalWebhookRegistration struct {
+	PublicKey  string   `json:"publicKey"`
+	WebhookURL string   `json:"webhookUrl"`
+	Events     []string `json:"events"`
+}
+
+// pumpPortalEvent is the subset of the PumpPortal event payload we care about.
+// `newToken` events arrive with txType=create, `tokenTrade` with buy / sell
+type pumpPortalEvent struct {
+	Signature       string `json:"signature"`
+	Mint            string `json:"mint"`
+	TraderPublicKey string `json:"traderPublicKey"`
+	TxType          string `json:"txType"`
+}
+
+// RegisterPumpPortalWebhook asks PumpPortal to POST the given events (e.g. `newToken`, `tokenTrade`)
+// to `webhookURL`, giving us a backup mint detection path if our log subscription gets ratelimited
+func (b *Bot) RegisterPumpPortalWebhook(webhookURL string, events []string) error {
+	body, err := json.Marshal(pumpPortalWebhookRegistration{
+		PublicKey:  b.privateKey.PublicKey().String(),
+		WebhookURL: webhookURL,
+		Events:     events,
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(pumpPortalWebhooksURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to register pumpportal webhook: %s %s", resp.Status, string(respBody))
+	}
+
+	b.status("Registered PumpPortal webhook " + webhookURL)
+	return nil
+}
+
+// StartWebhookServer listens on `addr` for PumpPortal webhook POSTs and passes any
+// new mints through the same checks as mints detected via logs. It blocks
+// until the server exits
+func (b *Bot) StartWebhookServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", b.handlePumpPortalWebhook)
+
+	b.status("Listening for PumpPortal webhooks on " + addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handlePumpPortalWebhook takes webhook POSTs carrying `Authorization: Bearer <webhookToken>`, since every
+// create it's sent costs us a tx fetch & a mint check
+func (b *Bot) handlePumpPortalWebhook(w http.ResponseWriter, r *http.Request) {
+	if !authorizeBearer(w, r, b.webhookToken) {
+		return
+	}
+
+	var event pumpPortalEvent
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&event); err != nil {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if event.TxType != "create" {
+		return
+	}
+
+	mintSig, err := solana.SignatureFromBase58(event.Signature)
+	if err != nil {
+		b.statusr("Bad signature in PumpPortal webhook: " + event.Signature)
+		return
+	}
+
+	if !b.markMintDetected(mintSig) {
+		return
+	}
+
+	b.status("Detected Mint via PumpPortal (" + mintSig.String() + ")")
+	b.goMintCheck(func(detectedAt time.Time) { b.checkAndSignalBuyCoin(mintSig, detectedAt) })
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePumpPortalWebhook(t *testing.T) {
+	// no workers, so checks stay queued where the test can count them
+	b := &Bot{webhookToken: "secret", mintChecks: newMintCheckPool(0, 4)}
+
+	post := func(method, auth string, event *pumpPortalEvent) int {
+		body, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(method, "/", strings.NewReader(string(body)))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		rec := httptest.NewRecorder()
+		b.handlePumpPortalWebhook(rec, req)
+		return rec.Code
+	}
+
+	create := &pumpPortalEvent{Signature: solana.Signature{1}.String(), TxType: "create"}
+
+	require.Equal(t, http.StatusMethodNotAllowed, post(http.MethodGet, "Bearer secret", create))
+	require.Equal(t, http.StatusUnauthorized, post(http.MethodPost, "", create))
+	require.Equal(t, http.StatusUnauthorized, post(http.MethodPost, "Bearer wrong", create))
+	require.Empty(t, b.mintChecks.queue)
+
+	// trades aren't mints
+	require.Equal(t, http.StatusOK, post(http.MethodPost, "Bearer secret", &pumpPortalEvent{Signature: solana.Signature{2}.String(), TxType: "buy"}))
+	require.Empty(t, b.mintChecks.queue)
+
+	// a create is checked once, however often it's posted
+	require.Equal(t, http.StatusOK, post(http.MethodPost, "Bearer secret", create))
+	require.Equal(t, http.StatusOK, post(http.MethodPost, "Bearer secret", create))
+	require.Len(t, b.mintChecks.queue, 1)
+
+	// without a webhook token nothing is taken
+	b.webhookToken = ""
+	require.Equal(t, http.StatusUnauthorized, post(http.MethodPost, "Bearer ", &pumpPortalEvent{Signature: solana.Signature{3}.String(), TxType: "create"}))
+	require.Len(t, b.mintChecks.queue, 1)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/1fge/pump-fun-sniper-bot/replay"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+var replayCSVHeader = []string{"slot", "block_time", "signature", "mint", "creator", "creator_buy_sol", "decision", "reason", "tokens_quote"}
+
+// runBigtableReplay feeds every pump.fun create between `from` and `to` through our
+// coin checks in dry-run mode (nothing is sent), writing each mint and the decision to a CSV.
+// NOTE: creator / funder checks run against the current RPC & DB state, not the state at the time
+func runBigtableReplay(store Store, cfg replay.BigtableConfig, buySol float64, from, to time.Time, outPath string) error {
+	ctx := context.Background()
+
+	b := newBaseBot()
+	b.rpcClient, b.jrpcClient = newRPCClients(rpcURL)
+	// replays only read creator stats, never write them
+	b.store = store
+	b.recordCreatorStats = false
+	b.buyAmountLamport = uint64(buySol * float64(solana.LAMPORTS_PER_SOL))
+
+	reader, err := replay.NewBigtableReader(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	latestSlot, err := b.rpcClient.GetSlot(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return err
+	}
+
+	startSlot, err := reader.SlotAtTime(ctx, from, 0, latestSlot)
+	if err != nil {
+		return err
+	}
+
+	endSlot, err := reader.SlotAtTime(ctx, to, startSlot, latestSlot)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	w := csv.NewWriter(outFile)
+	defer w.Flush()
+
+	if err := w.Write(replayCSVHeader); err != nil {
+		return err
+	}
+
+	b.status(fmt.Sprintf("Replaying slots %d to %d into %s", startSlot, endSlot, outPath))
+
+	var replayed int
+	err = reader.StreamTransactions(ctx, startSlot, endSlot, pumpProgramID, func(tx *replay.Transaction) error {
+		if tx.Failed || len(tx.Tx.Signatures) == 0 {
+			return nil
+		}
+
+		record, ok := b.replayTransaction(tx)
+		if !ok {
+			return nil
+		}
+
+		replayed++
+		if replayed%100 == 0 {
+			b.status(fmt.Sprintf("Replayed %d mints (slot %d)", replayed, tx.Slot))
+		}
+
+		return w.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.status(fmt.Sprintf("Replay complete, %d mints written to %s", replayed, outPath))
+	return nil
+}
+
+// replayTransaction runs a historical tx through fetchNewCoin -> shouldBuyCoin -> calculateBuyQuote,
+// returning the CSV record for it. ok is false if the tx isn't a create
+func (b *Bot) replayTransaction(tx *replay.Transaction) (record []string, ok bool) {
+	decodedInsts := decodeInstructions(tx.Tx)
+
+	coin, err := fetchNewCoin(decodedInsts)
+	if err != nil {
+		return nil, false
+	}
+
+	record = []string{
+		strconv.FormatUint(tx.Slot, 10),
+		tx.BlockTime.UTC().Format(time.RFC3339),
+		tx.Tx.Signatures[0].String(),
+		coin.mintAddr.String(),
+		coin.creator.String(),
+	}
+
+	if _, err := coin.fetchCreatorBuy(decodedInsts); err != nil {
+		return append(record, "0", "skip", err.Error(), ""), true
+	}
+
+	record = append(record, strconv.FormatFloat(coin.creatorPurchaseSol, 'f', 4, 64))
+
+	if !b.shouldBuyCoin(coin) {
+		return append(record, "skip", coin.rejectReason, ""), true
+	}
+
+	tokensToBuy, _, err := b.buyQuote(curveAfterCreatorBuy(coin.creatorTokenBalance))
+	if err != nil {
+		return append(record, "skip", err.Error(), ""), true
+	}
+
+	return append(record, "buy", "", tokensToBuy.String()), true
+}
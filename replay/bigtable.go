@@ -0,0 +1,322 @@
+package replay
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/proto"
+	"github.com/gagliardetto/solana-go"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/api/option"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultBigtableEndpoint = "bigtable.mainnet-beta.solana.com:443"
+	DefaultBigtableProject  = "mainnet-beta"
+	DefaultBigtableInstance = "solana-ledger"
+
+	// solana's ledger stores one row per slot in the `blocks` table, holding a compressed
+	// protobuf `ConfirmedBlock` in the `x:proto` cell (older rows may only have bincode `x:bin`)
+	blocksTable = "blocks"
+	protoColumn = "x:proto"
+)
+
+var (
+	errNoBlock               = errors.New("No Block Found")
+	errUnknownCompression    = errors.New("Unknown Bigtable Compression Method")
+	errMalformedTransaction  = errors.New("Malformed Bigtable Transaction")
+	errBlockMissingBlockTime = errors.New("Block Missing Block Time")
+)
+
+// BigtableConfig configures the connection to a Solana ledger Bigtable instance.
+// Credentials are picked up from GOOGLE_APPLICATION_CREDENTIALS unless CredentialsFile is set
+type BigtableConfig struct {
+	Endpoint        string
+	Project         string
+	Instance        string
+	CredentialsFile string
+}
+
+// Transaction is a single historical transaction read from Bigtable
+type Transaction struct {
+	Slot      uint64
+	BlockTime time.Time
+	Failed    bool
+	Tx        *solana.Transaction
+}
+
+// BigtableReader streams historical transactions out of the Solana ledger stored in Bigtable
+type BigtableReader struct {
+	client *bigtable.Client
+	blocks *bigtable.Table
+}
+
+func NewBigtableReader(ctx context.Context, cfg BigtableConfig) (*BigtableReader, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultBigtableEndpoint
+	}
+
+	if cfg.Project == "" {
+		cfg.Project = DefaultBigtableProject
+	}
+
+	if cfg.Instance == "" {
+		cfg.Instance = DefaultBigtableInstance
+	}
+
+	opts := []option.ClientOption{option.WithEndpoint(cfg.Endpoint)}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	client, err := bigtable.NewClient(ctx, cfg.Project, cfg.Instance, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BigtableReader{
+		client: client,
+		blocks: client.Open(blocksTable),
+	}, nil
+}
+
+func (r *BigtableReader) Close() error {
+	return r.client.Close()
+}
+
+// SlotAtTime binary searches [lowSlot, highSlot] for the first slot whose block time is at or after `t`
+func (r *BigtableReader) SlotAtTime(ctx context.Context, t time.Time, lowSlot, highSlot uint64) (uint64, error) {
+	for lowSlot < highSlot {
+		mid := lowSlot + (highSlot-lowSlot)/2
+
+		slot, blockTime, err := r.firstBlockTimeFrom(ctx, mid)
+		if err != nil && err != errNoBlock {
+			return 0, err
+		}
+
+		if err == errNoBlock || !blockTime.Before(t) {
+			highSlot = mid
+		} else {
+			lowSlot = slot + 1
+		}
+	}
+
+	return lowSlot, nil
+}
+
+// firstBlockTimeFrom returns the slot & block time of the first stored block at or after `slot`
+func (r *BigtableReader) firstBlockTimeFrom(ctx context.Context, slot uint64) (uint64, time.Time, error) {
+	var (
+		foundSlot uint64
+		block     *proto.ConfirmedBlock
+		readErr   error
+	)
+
+	err := r.blocks.ReadRows(ctx, bigtable.InfiniteRange(slotKey(slot)), func(row bigtable.Row) bool {
+		foundSlot, block, readErr = decodeBlockRow(row)
+		return false
+	}, bigtable.LimitRows(1), bigtable.RowFilter(bigtable.ColumnFilter("proto")))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if readErr != nil {
+		return 0, time.Time{}, readErr
+	}
+
+	if block == nil {
+		return 0, time.Time{}, errNoBlock
+	}
+
+	if block.GetBlockTime() == nil {
+		return 0, time.Time{}, errBlockMissingBlockTime
+	}
+
+	return foundSlot, time.Unix(block.GetBlockTime().GetTimestamp(), 0), nil
+}
+
+// StreamTransactions calls fn, in slot order, for every transaction in [startSlot, endSlot)
+// which references `programID`. Returning an error from fn stops the stream
+func (r *BigtableReader) StreamTransactions(ctx context.Context, startSlot, endSlot uint64, programID solana.PublicKey, fn func(*Transaction) error) error {
+	var fnErr error
+
+	err := r.blocks.ReadRows(ctx, bigtable.NewRange(slotKey(startSlot), slotKey(endSlot)), func(row bigtable.Row) bool {
+		slot, block, err := decodeBlockRow(row)
+		if err != nil {
+			// skip blocks we can't decode (e.g. legacy bincode rows) rather than aborting the replay
+			return true
+		}
+
+		var blockTime time.Time
+		if block.GetBlockTime() != nil {
+			blockTime = time.Unix(block.GetBlockTime().GetTimestamp(), 0)
+		}
+
+		for _, confirmedTx := range block.GetTransactions() {
+			tx, err := TransactionFromProto(confirmedTx)
+			if err != nil || !mentionsProgram(tx, programID) {
+				continue
+			}
+
+			if fnErr = fn(&Transaction{
+				Slot:      slot,
+				BlockTime: blockTime,
+				Failed:    confirmedTx.GetMeta().GetErr() != nil,
+				Tx:        tx,
+			}); fnErr != nil {
+				return false
+			}
+		}
+
+		return true
+	}, bigtable.RowFilter(bigtable.ColumnFilter("proto")))
+	if err != nil {
+		return err
+	}
+
+	return fnErr
+}
+
+func slotKey(slot uint64) string {
+	return fmt.Sprintf("%016x", slot)
+}
+
+func decodeBlockRow(row bigtable.Row) (uint64, *proto.ConfirmedBlock, error) {
+	var slot uint64
+	if _, err := fmt.Sscanf(row.Key(), "%016x", &slot); err != nil {
+		return 0, nil, err
+	}
+
+	for _, item := range row["x"] {
+		if item.Column != protoColumn {
+			continue
+		}
+
+		data, err := decompress(item.Value)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		block := &proto.ConfirmedBlock{}
+		if err := protobuf.Unmarshal(data, block); err != nil {
+			return 0, nil, err
+		}
+
+		return slot, block, nil
+	}
+
+	return 0, nil, errNoBlock
+}
+
+// decompress strips the bincode encoded compression method (u32 little endian)
+// prefixed to every cell and decompresses the remaining data
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errUnknownCompression
+	}
+
+	method := binary.LittleEndian.Uint32(data[0:4])
+	payload := bytes.NewReader(data[4:])
+
+	switch method {
+	case 0:
+		return data[4:], nil
+	case 1:
+		return io.ReadAll(bzip2.NewReader(payload))
+	case 2:
+		reader, err := gzip.NewReader(payload)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	case 3:
+		reader, err := zstd.NewReader(payload)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return io.ReadAll(reader)
+	default:
+		return nil, errUnknownCompression
+	}
+}
+
+// TransactionFromProto converts a ledger (or geyser streamed) transaction into a solana-go transaction.
+// For v0 transactions, addresses loaded from lookup tables are appended to the account keys
+// (writable then readonly), which matches how instruction account indexes address them
+func TransactionFromProto(confirmedTx *proto.ConfirmedTransaction) (*solana.Transaction, error) {
+	protoTx := confirmedTx.GetTransaction()
+	message := protoTx.GetMessage()
+	if protoTx == nil || message == nil || message.GetHeader() == nil {
+		return nil, errMalformedTransaction
+	}
+
+	tx := &solana.Transaction{}
+	for _, sig := range protoTx.GetSignatures() {
+		if len(sig) != solana.SignatureLength {
+			return nil, errMalformedTransaction
+		}
+		tx.Signatures = append(tx.Signatures, solana.SignatureFromBytes(sig))
+	}
+
+	header := message.GetHeader()
+	tx.Message.Header = solana.MessageHeader{
+		NumRequiredSignatures:       uint8(header.GetNumRequiredSignatures()),
+		NumReadonlySignedAccounts:   uint8(header.GetNumReadonlySignedAccounts()),
+		NumReadonlyUnsignedAccounts: uint8(header.GetNumReadonlyUnsignedAccounts()),
+	}
+
+	keys := message.GetAccountKeys()
+	if meta := confirmedTx.GetMeta(); meta != nil {
+		keys = append(keys, meta.GetLoadedWritableAddresses()...)
+		keys = append(keys, meta.GetLoadedReadonlyAddresses()...)
+	}
+
+	for _, key := range keys {
+		if len(key) != solana.PublicKeyLength {
+			return nil, errMalformedTransaction
+		}
+		tx.Message.AccountKeys = append(tx.Message.AccountKeys, solana.PublicKeyFromBytes(key))
+	}
+
+	if len(message.GetRecentBlockhash()) == 32 {
+		tx.Message.RecentBlockhash = solana.HashFromBytes(message.GetRecentBlockhash())
+	}
+
+	for _, inst := range message.GetInstructions() {
+		accounts := make([]uint16, len(inst.GetAccounts()))
+		for i, accountIndex := range inst.GetAccounts() {
+			accounts[i] = uint16(accountIndex)
+		}
+
+		tx.Message.Instructions = append(tx.Message.Instructions, solana.CompiledInstruction{
+			ProgramIDIndex: uint16(inst.GetProgramIdIndex()),
+			Accounts:       accounts,
+			Data:           inst.GetData(),
+		})
+	}
+
+	return tx, nil
+}
+
+func mentionsProgram(tx *solana.Transaction, programID solana.PublicKey) bool {
+	for _, key := range tx.Message.AccountKeys {
+		if key.Equals(programID) {
+			return true
+		}
+	}
+
+	return false
+}
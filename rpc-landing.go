@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// landed txs tracked before RPCs which were never first to return get deprioritized
+const rpcLandingMinTxs = 50
+
+// deprioritized RPCs are sent to this much (about a slot) after the rest, skipping them if the tx lands first
+const deprioritizedRPCSendDelay = 400 * time.Millisecond
+
+// the dedicated RPC's endpoint label, it's never deprioritized
+const dedicatedRPCEndpoint = "dedicated"
+
+// rpcEndpointLabel names send RPC `i` (of `sendTxRPCs`) by its index & domain. RPC urls usually carry an API key
+// in their path, query or subdomain, so the url itself never goes into logs or metric labels
+func rpcEndpointLabel(i int, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Sprintf("rpc%d", i)
+	}
+
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+
+	return fmt.Sprintf("rpc%d-%s", i, strings.Join(labels, "."))
+}
+
+// rpcSend is one RPC's send of a tx returning, at `slot` (our current slot when it returned, 0 if unknown)
+type rpcSend struct {
+	endpoint string
+	slot     uint64
+	at       time.Time
+}
+
+// rpcSends collects the sends of one tx as they return
+type rpcSends struct {
+	lock  sync.Mutex
+	sends []rpcSend
+}
+
+func (s *rpcSends) add(send rpcSend) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sends = append(s.sends, send)
+}
+
+// first is the send which returned at the lowest slot (earliest among sends of the same slot),
+// likely the one which got the tx to the leader
+func (s *rpcSends) first() (rpcSend, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.sends) == 0 {
+		return rpcSend{}, false
+	}
+
+	first := s.sends[0]
+	for _, send := range s.sends[1:] {
+		if send.slot < first.slot || (send.slot == first.slot && send.at.Before(first.at)) {
+			first = send
+		}
+	}
+
+	return first, true
+}
+
+// TxLandingRateByRPC tracks which of the RPCs we send vanilla txs through returned first for the txs
+// which landed. once `rpcLandingMinTxs` landed, RPCs which were never first are deprioritized
+type TxLandingRateByRPC struct {
+	lock   sync.Mutex
+	landed int
+	firsts map[string]int // endpoint -> landed txs it returned first for
+}
+
+// record credits the RPC which returned first for a tx which landed in `landedSlot`, observing how far
+// from the landing slot every RPC returned. returns the endpoint credited, "" without any sends
+func (r *TxLandingRateByRPC) record(sends *rpcSends, landedSlot uint64) string {
+	first, ok := sends.first()
+	if !ok {
+		return ""
+	}
+
+	// without slots to compare, only the order the sends returned in is known
+	if landedSlot > 0 {
+		sends.lock.Lock()
+		for _, send := range sends.sends {
+			if send.slot > 0 {
+				rpcFirstSeenSlot.Observe(send.endpoint, float64(int64(send.slot)-int64(landedSlot)))
+			}
+		}
+		sends.lock.Unlock()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.firsts == nil {
+		r.firsts = make(map[string]int)
+	}
+
+	r.landed++
+	r.firsts[first.endpoint]++
+	return first.endpoint
+}
+
+// deprioritized checks if `endpoint` was never first for the `rpcLandingMinTxs` or more landed txs we tracked
+func (r *TxLandingRateByRPC) deprioritized(endpoint string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return endpoint != dedicatedRPCEndpoint && r.landed >= rpcLandingMinTxs && r.firsts[endpoint] == 0
+}
+
+// firstRate is the share (0-1) of landed txs `endpoint` returned first for
+func (r *TxLandingRateByRPC) firstRate(endpoint string) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.landed == 0 {
+		return 0
+	}
+
+	return float64(r.firsts[endpoint]) / float64(r.landed)
+}
+
+// recordLanding credits the first RPC to return for a vanilla tx which landed in `landedSlot`
+func (b *Bot) recordLanding(sends *rpcSends, landedSlot uint64) {
+	if endpoint := b.txLanding.record(sends, landedSlot); endpoint != "" {
+		b.status(fmt.Sprintf("Tx landed in slot %d, %s returned first (first for %.1f%% of landed txs)", landedSlot, endpoint, 100*b.txLanding.firstRate(endpoint)))
+	}
+}
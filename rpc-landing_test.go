@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxLandingRateByRPC(t *testing.T) {
+	now := time.Now()
+	landing := &TxLandingRateByRPC{}
+
+	// the lowest slot wins, the earliest return breaks ties
+	sends := &rpcSends{}
+	sends.add(rpcSend{endpoint: dedicatedRPCEndpoint, slot: 101, at: now})
+	sends.add(rpcSend{endpoint: "rpc0-fast.rpc", slot: 100, at: now.Add(20 * time.Millisecond)})
+	sends.add(rpcSend{endpoint: "rpc1-slow.rpc", slot: 100, at: now.Add(30 * time.Millisecond)})
+
+	observed := rpcFirstSeenSlot.Count("rpc0-fast.rpc")
+	require.Equal(t, "rpc0-fast.rpc", landing.record(sends, 102))
+	require.Equal(t, observed+1, rpcFirstSeenSlot.Count("rpc0-fast.rpc"))
+	require.Equal(t, 1.0, landing.firstRate("rpc0-fast.rpc"))
+
+	var metrics bytes.Buffer
+	writeMetrics(&metrics)
+	require.Contains(t, metrics.String(), `rpc_first_seen_slot_bucket{endpoint="rpc0-fast.rpc",le="-2"}`)
+
+	// nothing returned, nothing to credit
+	require.Empty(t, landing.record(&rpcSends{}, 102))
+
+	// too few landings to judge anyone yet
+	require.False(t, landing.deprioritized("rpc1-slow.rpc"))
+
+	for landing.landed < rpcLandingMinTxs {
+		sends := &rpcSends{}
+		sends.add(rpcSend{endpoint: dedicatedRPCEndpoint, slot: 100, at: now})
+		sends.add(rpcSend{endpoint: "rpc1-slow.rpc", slot: 101, at: now})
+		landing.record(sends, 0)
+	}
+
+	require.True(t, landing.deprioritized("rpc1-slow.rpc"))
+	require.False(t, landing.deprioritized("rpc0-fast.rpc"))
+
+	// our own RPC is always sent to right away
+	landing.firsts[dedicatedRPCEndpoint] = 0
+	require.False(t, landing.deprioritized(dedicatedRPCEndpoint))
+}
+
+func TestRPCEndpointLabelDropsSecrets(t *testing.T) {
+	require.Equal(t, "rpc0-helius-rpc.com", rpcEndpointLabel(0, "https://mainnet.helius-rpc.com/?api-key=secret"))
+	require.Equal(t, "rpc1-quiknode.pro", rpcEndpointLabel(1, "https://secret-name.solana-mainnet.quiknode.pro/secret-token/"))
+	require.Equal(t, "rpc2", rpcEndpointLabel(2, "not a url"))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// amount(8) + maxSolCost / minSolOutput(8)
+const pumpTradeArgsSize = 16
+
+var errInstructionLayout = errors.New("Instruction Doesn't Match Pump Layout")
+
+// runSelfTest builds a buy and a sell for dummy accounts and checks them against pump's layout,
+// so a program change breaking our instructions is caught before trading. makes no network calls
+func runSelfTest() error {
+	b := newBaseBot()
+	b.privateKey = solana.NewWallet().PrivateKey
+
+	coin := &Coin{
+		mintAddr:               solana.NewWallet().PublicKey(),
+		tokenBondingCurve:      solana.NewWallet().PublicKey(),
+		associatedBondingCurve: solana.NewWallet().PublicKey(),
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		eventAuthority:         pumpEventAuthority,
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+
+	user, feeRecipient := b.privateKey.PublicKey(), b.currentFeeRecipient()
+
+	buy := b.createBuyInstruction(big.NewInt(1_000_000), 1, coin, coin.associatedTokenAccount).Build()
+	if err := validatePumpInstruction(buy, "buy", pumpBuyLayout(coin, coin.associatedTokenAccount, user, feeRecipient)); err != nil {
+		return fmt.Errorf("buy: %w", err)
+	}
+
+	sell := b.createSellInstruction(coin).Build()
+	if err := validatePumpInstruction(sell, "sell", pumpSellLayout(coin, user, feeRecipient)); err != nil {
+		return fmt.Errorf("sell: %w", err)
+	}
+
+	return nil
+}
+
+// validatePumpInstruction checks an instruction calls pump's `name` instruction with exactly `layout`'s accounts
+func validatePumpInstruction(inst solana.Instruction, name string, layout []pumpAccount) error {
+	if !inst.ProgramID().Equals(pumpProgramID) {
+		return fmt.Errorf("%w: program is %s", errInstructionLayout, inst.ProgramID())
+	}
+
+	data, err := inst.Data()
+	if err != nil {
+		return err
+	}
+
+	discriminator := sha256.Sum256([]byte("global:" + name))
+	if len(data) != 8+pumpTradeArgsSize || !bytes.Equal(data[:8], discriminator[:8]) {
+		return fmt.Errorf("%w: data isn't a %s (%d bytes)", errInstructionLayout, name, len(data))
+	}
+
+	accounts := inst.Accounts()
+	if len(accounts) != len(layout) {
+		return fmt.Errorf("%w: %d accounts, expected %d", errInstructionLayout, len(accounts), len(layout))
+	}
+
+	for i, expected := range layout {
+		account := accounts[i]
+		if account == nil || !account.PublicKey.Equals(expected.key) {
+			return fmt.Errorf("%w: account %d isn't %s", errInstructionLayout, i, expected.name)
+		}
+
+		if account.IsWritable != expected.writable || account.IsSigner != expected.signer {
+			return fmt.Errorf("%w: %s has writable=%t signer=%t, expected writable=%t signer=%t", errInstructionLayout,
+				expected.name, account.IsWritable, account.IsSigner, expected.writable, expected.signer)
+		}
+	}
+
+	return nil
+}
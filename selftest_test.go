@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	require.NoError(t, runSelfTest())
+}
+
+func TestValidatePumpInstruction(t *testing.T) {
+	b := &Bot{privateKey: solana.NewWallet().PrivateKey}
+	coin := &Coin{
+		mintAddr:               solana.NewWallet().PublicKey(),
+		tokenBondingCurve:      solana.NewWallet().PublicKey(),
+		associatedBondingCurve: solana.NewWallet().PublicKey(),
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		eventAuthority:         pumpEventAuthority,
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+	user := b.privateKey.PublicKey()
+
+	t.Run("missing account", func(t *testing.T) {
+		buy := b.createBuyInstruction(big.NewInt(1_000_000), 1, coin, coin.associatedTokenAccount)
+		buy.AccountMetaSlice = append(buy.AccountMetaSlice[:9:9], buy.AccountMetaSlice[10:]...) // drop rent
+
+		err := validatePumpInstruction(buy.Build(), "buy", pumpBuyLayout(coin, coin.associatedTokenAccount, user, feeRecipient))
+		require.ErrorIs(t, err, errInstructionLayout)
+	})
+
+	t.Run("accounts out of order", func(t *testing.T) {
+		sell := b.createSellInstruction(coin)
+		sell.AccountMetaSlice[8], sell.AccountMetaSlice[9] = sell.AccountMetaSlice[9], sell.AccountMetaSlice[8]
+
+		err := validatePumpInstruction(sell.Build(), "sell", pumpSellLayout(coin, user, feeRecipient))
+		require.ErrorIs(t, err, errInstructionLayout)
+	})
+
+	t.Run("wrong instruction", func(t *testing.T) {
+		sell := b.createSellInstruction(coin).Build()
+
+		err := validatePumpInstruction(sell, "buy", pumpSellLayout(coin, user, feeRecipient))
+		require.ErrorIs(t, err, errInstructionLayout)
+	})
+}
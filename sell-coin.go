@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"sync"
 	"time"
 
 	"github.com/1fge/pump-fun-sniper-bot/pump"
@@ -15,44 +15,123 @@ import (
 
 // SellCoinFast utilizes the fact that, unlike buying, we do not care if duplicate tx hit the chain
 // if they do, we lose the priority fee, but ensure we are out of the position quickly. For this reason,
-// we spam sell transactions every 400ms for a duration of 6 seconds, resulting in 15 sell tx
+// we spam sell transactions every 400ms for a duration of 6 seconds, resulting in 15 sell tx.
+// once a sell confirms we check our token balance, selling whatever is left for up to `sellRounds` rounds
 func (b *Bot) SellCoinFast(coin *Coin) {
 	fmt.Println("Preparing to sell coin", coin.mintAddr.String())
-	// send off sell requests separated by 400ms, wait for one to return
-	// valid transaction, otherwise repeat (for 45 seconds at most)
 	coin.isSellingCoin = true
 	defer coin.setExitedSellCoinTrue()
 
+	for round := 1; ; round++ {
+		b.sellRound(coin)
+
+		sold, err := b.confirmSold(coin)
+		if err != nil {
+			// can't tell either way, trust the sell like we used to
+			b.statusr(fmt.Sprintf("Failed to confirm sell of %s via balance: %s", coin.mintAddr.String(), err))
+			return
+		}
+
+		if sold {
+			return
+		}
+
+		if round >= b.sellRounds {
+			b.statusr(fmt.Sprintf("Still holding %s tokens of %s after %d sell rounds, giving up", coin.tokensHeld.String(), coin.mintAddr.String(), round))
+			return
+		}
+
+		b.statusr(fmt.Sprintf("Still holding %s tokens of %s after sell, selling again", coin.tokensHeld.String(), coin.mintAddr.String()))
+	}
+}
+
+// sellAllNow sells every coin of `coins` at once, returning once each SellCoinFast is done
+func (b *Bot) sellAllNow(coins []*Coin) {
+	var wg sync.WaitGroup
+	for _, coin := range coins {
+		wg.Add(1)
+		b.goCoin(func() {
+			defer wg.Done()
+			b.SellCoinFast(coin)
+		})
+	}
+
+	wg.Wait()
+}
+
+// sellRound sends sell tx every 400ms until one confirms, or the 6 second window closes. it returns once
+// every sell it sent is done, so none of them sees the coin change under it in the next round
+func (b *Bot) sellRound(coin *Coin) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*6)
 	defer cancel()
 
 	ticker := time.NewTicker(400 * time.Millisecond)
 	defer ticker.Stop()
 
+	// the sell session is cancelled as soon as any sell tx confirms, so the
+	// other attempts stop sending & drop their signature subscriptions
+	sessionCtx, cancelSession := context.WithCancel(context.Background())
+	defer cancelSession()
+
 	result := make(chan int, 1) // Buffered to ensure non-blocking send
 	var sendVanilla = true
 
+	var sells sync.WaitGroup
+	sending := make(chan struct{})
+
 	// goroutine to send off sell tx every 400 until confirmed
 	go func() {
+		defer close(sending)
+
 		for {
 			select {
 			case <-ticker.C:
 				// alternate between jito and vanilla each iteration, in case of no jito leader
 				sendVanilla = !sendVanilla
-				go b.sellCoinWrapper(coin, result, sendVanilla)
+
+				sells.Add(1)
+				go func(sendVanilla bool) {
+					defer sells.Done()
+					b.sellCoinWrapper(sessionCtx, cancelSession, coin, result, sendVanilla)
+				}(sendVanilla)
 			case <-ctx.Done():
 				return // Stop the ticker loop when context is cancelled
+			case <-sessionCtx.Done():
+				return // a sell already confirmed
 			}
 		}
 	}()
 
-	// wait for first result to come back
-	<-result
-	time.Sleep(1 * time.Second)
+	// wait for first result to come back, or for the window to close without one
+	select {
+	case <-result:
+	case <-ctx.Done():
+	}
+
+	// stop the sells still out, then wait for them to return
+	cancelSession()
+	<-sending
+	sells.Wait()
+}
+
+// confirmSold checks our token account actually emptied, rather than trusting the sell signature.
+// tokensHeld is updated to the balance left, so another round sells exactly what remains
+func (b *Bot) confirmSold(coin *Coin) (bool, error) {
+	held, err := b.fetchTokenBalance(context.TODO(), coin.associatedTokenAccount)
+	if err != nil {
+		return false, err
+	}
+
+	b.pendingCoinsLock.Lock()
+	coin.tokensHeld = held
+	b.pendingCoinsLock.Unlock()
+
+	return !coin.botHoldsTokens(), nil
 }
 
-func (b *Bot) sellCoinWrapper(coin *Coin, result chan int, sendVanilla bool) {
-	sellSignature, err := b.sellCoin(coin, sendVanilla)
+func (b *Bot) sellCoinWrapper(ctx context.Context, cancelSession context.CancelFunc, coin *Coin, result chan int, sendVanilla bool) {
+	sentAt := time.Now()
+	sellSignature, err := b.sellCoin(ctx, coin, sendVanilla)
 	if err != nil {
 		if err != context.Canceled {
 			if sellSignature != nil {
@@ -70,52 +149,134 @@ func (b *Bot) sellCoinWrapper(coin *Coin, result chan int, sendVanilla bool) {
 		return
 	}
 
-	result <- 1
+	cancelSession()
+
+	// every sell which landed is a leg, even one racing the sell reported below
+	go b.recordTradeLeg(coin, tradeSideSell, *sellSignature, 0, time.Since(sentAt))
+
+	select {
+	case result <- 1:
+		// only the sell closing the position is attributed to the buy
+		b.pendingCoinsLock.Lock()
+		first := coin.sellTransactionSignature == nil
+		if first {
+			coin.sellTransactionSignature = sellSignature
+		}
+		b.pendingCoinsLock.Unlock()
+
+		if first {
+			b.logEvent(coin, eventSellConfirmed, sellSignature.String())
+			go b.recordRoundTrip(coin, *sellSignature)
+		}
+	default:
+		// another attempt already reported the sell
+	}
 }
 
-func (b *Bot) sellCoin(coin *Coin, sendVanilla bool) (*solana.Signature, error) {
+func (b *Bot) sellCoin(ctx context.Context, coin *Coin, sendVanilla bool) (*solana.Signature, error) {
 	if coin == nil {
 		return nil, errNilCoin
 	}
 
-	sellInstruction := b.createSellInstruction(coin)
-	culInst := cb.NewSetComputeUnitLimitInstruction(uint32(computeUnitLimits))
+	// enable jito if it's jito leader and we do not force vanilla tx
+	vanillaInstructions := b.sellInstructions(coin, false)
+	instructions, enableJito := b.addJitoTip(coin, b.sellInstructions(coin, true), b.tipOnSell && !sendVanilla)
+	if !enableJito {
+		instructions = vanillaInstructions
+	}
+
+	tx, err := b.createTransaction(instructions...)
+	if err != nil {
+		return nil, err
+	}
+
+	// keeps the priority fee the jito tx dropped for its tip
+	fallbackTx, err := b.createJitoFallbackTx(enableJito, vanillaInstructions)
+	if err != nil {
+		return nil, err
+	}
+
+	b.logEvent(coin, eventSellSent, sendRoute(enableJito))
+	return b.signAndSendTxWithFallback(ctx, tx, enableJito, fallbackTx)
+}
+
+// sellInstructions are the priority fee, compute unit limit & full sell instructions of a sell tx,
+// with the CU limit of a jito or vanilla sell per `isJito`
+func (b *Bot) sellInstructions(coin *Coin, isJito bool) []solana.Instruction {
+	culInst := cb.NewSetComputeUnitLimitInstruction(b.sellComputeUnitLimit(isJito))
 	cupInst := cb.NewSetComputeUnitPriceInstruction(b.feeMicroLamport)
-	instructions := []solana.Instruction{cupInst.Build(), culInst.Build(), sellInstruction.Build()}
 
-	// enable jito if it's jito leader and we do not force vanilla tx
-	enableJito := b.jitoManager.isJitoLeader() && !sendVanilla
-	if enableJito {
-		coin.status("Jito leader, setting tip & removing priority fee inst")
-		tipInst, err := b.jitoManager.generateTipInstruction()
-		if err != nil {
-			log.Fatal(err)
-		}
+	return []solana.Instruction{cupInst.Build(), culInst.Build(), b.createSellInstruction(coin).Build()}
+}
 
-		instructions = append(instructions, tipInst)
+// sellComputeUnitLimit is the CU limit of a sell tx. jito bundles don't compete for block space like vanilla
+// txs do, so they get by with a lower limit. falls back to the buy limit when unset
+func (b *Bot) sellComputeUnitLimit(isJito bool) uint32 {
+	limit := b.sellComputeUnitLimits
+	if isJito {
+		limit = b.jitoSellComputeUnitLimits
+	}
 
-		// IMPORTANT: remove priority fee when we jito tip
-		instructions = instructions[1:]
+	if limit == 0 {
+		return computeUnitLimits
 	}
 
-	tx, err := b.createTransaction(instructions...)
+	return limit
+}
+
+// sellPartial sells `amount` of our tokens in a single tx, unlike SellCoinFast's spam of full sells, since every
+// duplicate which landed would sell another `amount`. tokensHeld is refreshed from our balance afterwards
+func (b *Bot) sellPartial(coin *Coin, amount uint64) (*solana.Signature, error) {
+	ctx, cancel := context.WithTimeout(coin.context(), 6*time.Second)
+	defer cancel()
+
+	culInst := cb.NewSetComputeUnitLimitInstruction(b.sellComputeUnitLimit(false))
+	cupInst := cb.NewSetComputeUnitPriceInstruction(b.feeMicroLamport)
+	sellInstruction := b.createSellAmountInstruction(coin, amount)
+
+	tx, err := b.createTransaction(cupInst.Build(), culInst.Build(), sellInstruction.Build())
 	if err != nil {
 		return nil, err
 	}
 
-	return b.signAndSendTx(tx, enableJito)
+	b.logEvent(coin, eventSellSent, fmt.Sprintf("partial %d", amount))
+	sentAt := time.Now()
+	sig, sendErr := b.signAndSendTx(ctx, tx, false)
+
+	// even an unconfirmed sell may have landed, only our balance tells
+	if _, err := b.confirmSold(coin); err != nil {
+		b.statusr(fmt.Sprintf("Failed to refresh balance of %s after partial sell: %s", coin.mintAddr.String(), err))
+	}
+
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	b.pendingCoinsLock.Lock()
+	coin.partialSellSignatures = append(coin.partialSellSignatures, *sig)
+	b.pendingCoinsLock.Unlock()
+
+	b.logEvent(coin, eventSellConfirmed, sig.String())
+	go b.recordTradeLeg(coin, tradeSideSell, *sig, 0, time.Since(sentAt))
+
+	return sig, nil
 }
 
 func (b *Bot) createSellInstruction(coin *Coin) *pump.Sell {
+	return b.createSellAmountInstruction(coin, coin.tokensHeld.Uint64())
+}
+
+// createSellAmountInstruction sells `amount` of our tokens of the coin
+func (b *Bot) createSellAmountInstruction(coin *Coin, amount uint64) *pump.Sell {
 	// we want a minimum of 1 lamport, which ensures we should get filled at any price
 	// as long as any of the 15 tx land
 	minimumLamports := uint64(1)
 
 	return pump.NewSellInstruction(
-		coin.tokensHeld.Uint64(),
+		amount,
 		minimumLamports,
 		globalAddr,
-		feeRecipient,
+		b.currentFeeRecipient(),
 		coin.mintAddr,
 		coin.tokenBondingCurve,
 		coin.associatedBondingCurve,
@@ -129,6 +290,25 @@ func (b *Bot) createSellInstruction(coin *Coin) *pump.Sell {
 	)
 }
 
+// pumpSellLayout is the account list of pump's sell instruction, in order
+func pumpSellLayout(coin *Coin, user, feeRecipient solana.PublicKey) []pumpAccount {
+	return []pumpAccount{
+		{name: "global", key: globalAddr},
+		{name: "feeRecipient", key: feeRecipient, writable: true},
+		{name: "mint", key: coin.mintAddr},
+		{name: "bondingCurve", key: coin.tokenBondingCurve, writable: true},
+		{name: "associatedBondingCurve", key: coin.associatedBondingCurve, writable: true},
+		{name: "associatedUser", key: coin.associatedTokenAccount, writable: true},
+		{name: "user", key: user, writable: true, signer: true},
+		{name: "systemProgram", key: solana.SystemProgramID},
+		{name: "associatedTokenProgram", key: associatedtokenaccount.ProgramID},
+		{name: "tokenProgram", key: token.ProgramID},
+		{name: "eventAuthority", key: coin.eventAuthority},
+		{name: "program", key: pumpProgramID},
+	}
+}
+
 func (c *Coin) setExitedSellCoinTrue() {
 	c.exitedSellCoin = true
+	c.signalSellCheck()
 }
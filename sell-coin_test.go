@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/searcher_client"
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	cb "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSellCoinFastResellsRemainingBalance(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:               f.mint,
+		tokenBondingCurve:      f.bondingCurve,
+		associatedBondingCurve: f.associatedBondingCurve,
+		eventAuthority:         f.eventAuthority,
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+
+	var lock sync.Mutex
+	var soldAmounts []uint64
+
+	mock := newMockRPC(t)
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var encoded string
+		require.NoError(t, json.Unmarshal(params[0], &encoded))
+
+		tx, err := solana.TransactionFromBase64(encoded)
+		require.NoError(t, err)
+
+		for _, inst := range decodeInstructions(tx) {
+			if sell, ok := inst.pump.Impl.(*pump.Sell); ok && inst.pumpName() == "sell" {
+				lock.Lock()
+				soldAmounts = append(soldAmounts, *sell.Amount)
+				lock.Unlock()
+			}
+		}
+
+		return tx.Signatures[0].String(), nil
+	})
+
+	// the first sell leaves some tokens behind, the second empties the account
+	balances := []string{"5000", "0"}
+	mock.handle("getTokenAccountBalance", func(params []json.RawMessage) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		amount := balances[0]
+		if len(balances) > 1 {
+			balances = balances[1:]
+		}
+
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"amount": amount, "decimals": 6, "uiAmountString": "0"},
+		}, nil
+	})
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	b := &Bot{
+		rpcClient:  mock.client(),
+		wsPool:     newWsPoolFromClients(wsMock.client(t)),
+		privateKey: solana.NewWallet().PrivateKey,
+		sellRounds: 3,
+	}
+	b.blockhash.Store(&solana.Hash{})
+
+	b.SellCoinFast(coin)
+
+	require.True(t, coin.exitedSellCoin)
+	require.False(t, coin.botHoldsTokens())
+	require.Len(t, mock.callsTo("getTokenAccountBalance"), 2)
+
+	// the follow up round only sells what was left
+	lock.Lock()
+	defer lock.Unlock()
+	require.Contains(t, soldAmounts, uint64(1_000_000))
+	require.Equal(t, uint64(5000), soldAmounts[len(soldAmounts)-1])
+}
+
+func TestRejectedJitoSellFallsBackWithPriorityFee(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:               f.mint,
+		tokenBondingCurve:      f.bondingCurve,
+		associatedBondingCurve: f.associatedBondingCurve,
+		eventAuthority:         f.eventAuthority,
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+
+	sent := make(chan *solana.Transaction, 1)
+	mock := newMockRPC(t)
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var encoded string
+		if err := json.Unmarshal(params[0], &encoded); err != nil {
+			return nil, err
+		}
+
+		tx, err := solana.TransactionFromBase64(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		sent <- tx
+		return tx.Signatures[0].String(), nil
+	})
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	// the leader runs jito, but the block engine is unreachable
+	tipAccount := solana.NewWallet().PublicKey()
+	jitoManager := newTestJitoManager(t, true, tipAccount)
+	jitoManager.dialSearcher = func() (*searcher_client.Client, context.CancelFunc, error) {
+		return nil, nil, errors.New("block engine unavailable")
+	}
+
+	wallet := solana.NewWallet().PrivateKey
+	jitoManager.privateKey = wallet
+
+	b := &Bot{
+		rpcClient:       mock.client(),
+		wsPool:          newWsPoolFromClients(wsMock.client(t)),
+		privateKey:      wallet,
+		jitoManager:     jitoManager,
+		feeMicroLamport: 200000,
+		tipOnSell:       true,
+
+		sellComputeUnitLimits:     100000,
+		jitoSellComputeUnitLimits: 60000,
+	}
+	b.blockhash.Store(&solana.Hash{})
+
+	sig, err := b.sellCoin(context.Background(), coin, false)
+	require.NoError(t, err)
+
+	// the vanilla tx sent instead pays the priority fee, not the tip
+	tx := <-sent
+	require.Equal(t, tx.Signatures[0], *sig)
+
+	var feeSet, limitSet bool
+	for _, inst := range tx.Message.Instructions {
+		programID, err := tx.ResolveProgramIDIndex(inst.ProgramIDIndex)
+		require.NoError(t, err)
+
+		if programID.Equals(solana.ComputeBudget) {
+			decoded, err := cb.DecodeInstruction(nil, inst.Data)
+			require.NoError(t, err)
+
+			if price, ok := decoded.Impl.(*cb.SetComputeUnitPrice); ok {
+				require.Equal(t, uint64(200000), price.MicroLamports)
+				feeSet = true
+			}
+
+			// and the vanilla CU limit, not the jito one
+			if limit, ok := decoded.Impl.(*cb.SetComputeUnitLimit); ok {
+				require.Equal(t, uint32(100000), limit.Units)
+				limitSet = true
+			}
+		}
+	}
+	require.True(t, feeSet)
+	require.True(t, limitSet)
+	require.Zero(t, jitoTipLamports(tx, b.privateKey.PublicKey()))
+}
+
+func TestSellComputeUnitLimit(t *testing.T) {
+	b := newBaseBot()
+	require.Equal(t, uint32(100000), b.sellComputeUnitLimit(false))
+	require.Equal(t, uint32(80000), b.sellComputeUnitLimit(true))
+
+	// unset limits fall back to the buy's
+	b = &Bot{}
+	require.Equal(t, computeUnitLimits, b.sellComputeUnitLimit(false))
+	require.Equal(t, computeUnitLimits, b.sellComputeUnitLimit(true))
+}
+
+// sellingBot is a bot whose sells all confirm and empty our token account, counting the sells sent per mint
+type sellingBot struct {
+	*Bot
+
+	lock      sync.Mutex
+	soldMints map[solana.PublicKey]int
+}
+
+func newSellingBot(t *testing.T) *sellingBot {
+	b := &sellingBot{Bot: newBaseBot(), soldMints: map[solana.PublicKey]int{}}
+
+	mock := newMockRPC(t)
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var encoded string
+		if err := json.Unmarshal(params[0], &encoded); err != nil {
+			return nil, err
+		}
+
+		tx, err := solana.TransactionFromBase64(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, inst := range decodeInstructions(tx) {
+			if sell, ok := inst.pump.Impl.(*pump.Sell); ok && inst.pumpName() == "sell" {
+				b.lock.Lock()
+				b.soldMints[sell.GetMintAccount().PublicKey]++
+				b.lock.Unlock()
+			}
+		}
+
+		return tx.Signatures[0].String(), nil
+	})
+	mock.handle("getTokenAccountBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"amount": "0", "decimals": 6, "uiAmountString": "0"},
+		}, nil
+	})
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	b.rpcClient = mock.client()
+	b.wsPool = newWsPoolFromClients(wsMock.client(t))
+	b.privateKey = solana.NewWallet().PrivateKey
+	b.blockhash.Store(&solana.Hash{})
+	b.tipOnBuy, b.tipOnSell = false, false
+	return b
+}
+
+func (b *sellingBot) sells(mint solana.PublicKey) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.soldMints[mint]
+}
+
+// heldCoin is a coin of its own launch we bought
+func heldCoin(t *testing.T) *Coin {
+	f := newLaunchFixture(t)
+	return &Coin{
+		mintAddr:               f.mint,
+		tokenBondingCurve:      f.bondingCurve,
+		associatedBondingCurve: f.associatedBondingCurve,
+		eventAuthority:         f.eventAuthority,
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		botPurchased:           true,
+		tokensHeld:             big.NewInt(1_000_000),
+	}
+}
+
+func TestHandlePanicSellsHeldCoins(t *testing.T) {
+	b := newSellingBot(t)
+	b.controlToken = "secret"
+
+	held, heldWithExit, selling := heldCoin(t), heldCoin(t), heldCoin(t)
+	heldWithExit.exitReason = exitReasonMaxHoldValue
+	selling.isSellingCoin = true
+	buying := &Coin{mintAddr: solana.NewWallet().PublicKey()}
+	for _, coin := range []*Coin{held, heldWithExit, selling, buying} {
+		b.pendingCoins[coin.mintAddr.String()] = coin
+	}
+
+	baseline := coinGoroutines.Value()
+	req := httptest.NewRequest(http.MethodPost, "/panic", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	b.handlePanic(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, "selling 2 coins\n", rec.Body.String())
+	require.True(t, b.tradingHalted.Load())
+
+	// a coin still being bought is sold once its tokens land, the one already selling is left alone
+	require.Equal(t, exitReasonPanic, held.exitReason)
+	require.Equal(t, exitReasonMaxHoldValue, heldWithExit.exitReason)
+	require.Equal(t, exitReasonPanic, buying.exitReason)
+
+	require.Eventually(t, func() bool { return coinGoroutines.Value() <= baseline }, 10*time.Second, 10*time.Millisecond)
+
+	require.Positive(t, b.sells(held.mintAddr))
+	require.Positive(t, b.sells(heldWithExit.mintAddr))
+	require.Zero(t, b.sells(selling.mintAddr))
+	require.NotNil(t, held.sellTransactionSignature)
+}
+
+func TestManageSellForCoinSellsOnExit(t *testing.T) {
+	b := newSellingBot(t)
+
+	coin := heldCoin(t)
+	coin.exitedCreatorListener = true
+	b.addNewPendingCoin(coin)
+
+	baseline := coinGoroutines.Value()
+	b.goCoin(func() { b.manageSellForCoin(coin.context(), coin) })
+
+	// nothing is sold until an exit triggers
+	require.Never(t, func() bool { return b.sells(coin.mintAddr) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	b.triggerExit(coin, exitReasonCreatorSold)
+
+	// sold, verified empty, then deleted along with the goroutine
+	require.Eventually(t, func() bool { return !b.isPendingCoin(coin) }, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return coinGoroutines.Value() <= baseline }, time.Second, 10*time.Millisecond)
+	require.Positive(t, b.sells(coin.mintAddr))
+	require.NotNil(t, coin.sellTransactionSignature)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// coinGeckoSolPriceURL serves `{"solana":{"usd":<price>}}`, the response httpSolPriceSource expects
+const coinGeckoSolPriceURL = "https://api.coingecko.com/api/v3/simple/price?ids=solana&vs_currencies=usd"
+
+var errNoSolPrice = errors.New("No SOL/USD Price In Response")
+
+// SolPriceSource fetches the current SOL/USD price
+type SolPriceSource interface {
+	FetchSolPrice(ctx context.Context) (float64, error)
+}
+
+// httpSolPriceSource fetches the SOL/USD price from a public price API answering like CoinGecko's simple price
+type httpSolPriceSource struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSolPriceSource(url string) *httpSolPriceSource {
+	return &httpSolPriceSource{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *httpSolPriceSource) FetchSolPrice(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("failed to fetch SOL price: %s %s", resp.Status, string(respBody))
+	}
+
+	var prices map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, err
+	}
+
+	price := prices["solana"]["usd"]
+	if price <= 0 {
+		return 0, errNoSolPrice
+	}
+
+	return price, nil
+}
+
+// SolPriceFeed caches the SOL/USD price from `source` for `ttl`. reads never wait on the source: a stale price
+// is refreshed in the background, and served until it's `ttl` past due. without one, we report in SOL only
+type SolPriceFeed struct {
+	source SolPriceSource
+	ttl    time.Duration
+
+	lock      sync.Mutex
+	price     float64
+	fetchedAt time.Time
+
+	refreshing atomic.Bool
+}
+
+func newSolPriceFeed(source SolPriceSource, ttl time.Duration) *SolPriceFeed {
+	return &SolPriceFeed{source: source, ttl: ttl}
+}
+
+// usdPrice is the cached SOL/USD price, false if there's none recent enough to report
+func (f *SolPriceFeed) usdPrice() (float64, bool) {
+	if f == nil {
+		return 0, false
+	}
+
+	f.lock.Lock()
+	price, age := f.price, time.Since(f.fetchedAt)
+	f.lock.Unlock()
+
+	if age > f.ttl {
+		go f.refresh()
+	}
+
+	if price == 0 || age > 2*f.ttl {
+		return 0, false
+	}
+
+	return price, true
+}
+
+// refresh fetches the price from the source, unless another refresh is already running
+func (f *SolPriceFeed) refresh() {
+	if !f.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	defer f.refreshing.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	price, err := f.source.FetchSolPrice(ctx)
+	if err != nil {
+		logStatus(levelWarn, "sol-price", "", "SOL Price (R)", "Failed to fetch SOL/USD price, reporting in SOL only: "+err.Error())
+		return
+	}
+
+	f.lock.Lock()
+	f.price, f.fetchedAt = price, time.Now()
+	f.lock.Unlock()
+}
+
+// usdValue converts `lamports` to USD at `solUSD`, false if the price is unknown (0)
+func usdValue(lamports int64, solUSD float64) (float64, bool) {
+	if solUSD <= 0 {
+		return 0, false
+	}
+
+	return float64(lamports) / float64(solana.LAMPORTS_PER_SOL) * solUSD, true
+}
+
+// formatSol formats `lamports` as SOL, with their USD value at `solUSD` unless it's unknown (0)
+func formatSol(lamports int64, solUSD float64) string {
+	sol := fmt.Sprintf("%.5f SOL", float64(lamports)/float64(solana.LAMPORTS_PER_SOL))
+	if usd, ok := usdValue(lamports, solUSD); ok {
+		return fmt.Sprintf("%s ($%.2f)", sol, usd)
+	}
+
+	return sol
+}
+
+// solUSD is the current SOL/USD price from our feed, 0 if we have none
+func (b *Bot) solUSD() float64 {
+	price, _ := b.solPrice.usdPrice()
+	return price
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSolPriceSource serves `price`, or `err` if it's set
+type fakeSolPriceSource struct {
+	price atomic.Value // float64
+	err   atomic.Value // error
+	calls atomic.Int32
+}
+
+func (s *fakeSolPriceSource) FetchSolPrice(ctx context.Context) (float64, error) {
+	s.calls.Add(1)
+	if err, ok := s.err.Load().(error); ok && err != nil {
+		return 0, err
+	}
+
+	return s.price.Load().(float64), nil
+}
+
+func TestHTTPSolPriceSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"solana":{"usd":151.25}}`)
+	}))
+	defer server.Close()
+
+	price, err := newHTTPSolPriceSource(server.URL).FetchSolPrice(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 151.25, price)
+
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer empty.Close()
+
+	_, err = newHTTPSolPriceSource(empty.URL).FetchSolPrice(context.Background())
+	require.ErrorIs(t, err, errNoSolPrice)
+}
+
+func TestSolPriceFeedFallsBackToSol(t *testing.T) {
+	source := &fakeSolPriceSource{}
+	source.price.Store(150.0)
+	feed := newSolPriceFeed(source, time.Minute)
+
+	// nothing cached yet, the first read only kicks off a fetch
+	_, ok := feed.usdPrice()
+	require.False(t, ok)
+	require.Eventually(t, func() bool {
+		price, ok := feed.usdPrice()
+		return ok && price == 150
+	}, time.Second, 10*time.Millisecond)
+
+	// fresh prices are served from cache
+	calls := source.calls.Load()
+	feed.usdPrice()
+	require.Equal(t, calls, source.calls.Load())
+
+	// a source going down keeps serving the last price for a while, then none
+	source.err.Store(errors.New("rate limited"))
+	feed.lock.Lock()
+	feed.fetchedAt = time.Now().Add(-90 * time.Second)
+	feed.lock.Unlock()
+
+	price, ok := feed.usdPrice()
+	require.True(t, ok)
+	require.Equal(t, 150.0, price)
+
+	feed.lock.Lock()
+	feed.fetchedAt = time.Now().Add(-3 * time.Minute)
+	feed.lock.Unlock()
+	_, ok = feed.usdPrice()
+	require.False(t, ok)
+
+	// without a feed we report in SOL only
+	b := &Bot{}
+	require.Zero(t, b.solUSD())
+	require.Equal(t, "0.05000 SOL", formatSol(50_000_000, b.solUSD()))
+	require.Equal(t, "0.05000 SOL ($7.50)", formatSol(50_000_000, 150))
+}
+
+func TestNetPnLUSD(t *testing.T) {
+	trade := &AtomicBuySell{
+		BuyLamports:  1_000_000_000,
+		SolReceived:  1_200_000_000,
+		FeesLamports: 100_000_000,
+		BuySolUSD:    100,
+		SellSolUSD:   110,
+	}
+
+	// bought 1 SOL at $100, netted 1.1 SOL at $110
+	require.InDelta(t, 21.0, netPnLUSD(trade), 1e-9)
+
+	trade.BuySolUSD = 0
+	require.Zero(t, netPnLUSD(trade))
+}
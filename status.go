@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// logFormatText prints status lines for humans, e.g. `Bot (R) Failed to fetch creator balance`
+	logFormatText = "text"
+	// logFormatJSON prints each status line as a single JSON object, for log aggregators
+	logFormatJSON = "json"
+)
+
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// statusLine is a status line in `logFormatJSON`
+type statusLine struct {
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Mint      string `json:"mint,omitempty"`
+	Msg       string `json:"msg"`
+	TS        string `json:"ts"`
+}
+
+// statusFormat is the `logFormat` status lines are printed in, text until setLogFormat
+var statusFormat atomic.Value
+
+// setLogFormat prints status lines in `format` from now on
+func setLogFormat(format string) {
+	statusFormat.Store(format)
+}
+
+// logStatus prints a status line of `component` in the format set by setLogFormat. `prefix` leads the human readable line
+func logStatus(level, component, mint, prefix string, msg interface{}) {
+	format, _ := statusFormat.Load().(string)
+	writeStatus(log.Default(), format, level, component, mint, prefix, msg)
+}
+
+// writeStatus prints a status line to `logger` in `format`
+func writeStatus(logger *log.Logger, format, level, component, mint, prefix string, msg interface{}) {
+	text := fmt.Sprintf("%v", msg)
+	if format != logFormatJSON {
+		logger.Println(prefix, text)
+		return
+	}
+
+	line, err := json.Marshal(&statusLine{
+		Level:     level,
+		Component: component,
+		Mint:      mint,
+		Msg:       text,
+		TS:        time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		logger.Println(prefix, text)
+		return
+	}
+
+	// skip the logger's own date prefix, so each line is valid JSON
+	logger.Writer().Write(append(line, '\n'))
+}
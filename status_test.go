@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the standard logger's output to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+
+	output := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	return &buf
+}
+
+func TestStatusJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", log.LstdFlags)
+	mint := solana.NewWallet().PublicKey().String()
+
+	writeStatus(logger, logFormatJSON, levelError, "bot", "", "Bot (R)", "failed \"quoting\"\nacross lines")
+	writeStatus(logger, logFormatJSON, levelInfo, "coin", mint, mint, "Detected creator sell")
+	writeStatus(logger, logFormatJSON, levelInfo, "jito", "", "Jito Manager", "Fetching jito-enabled validators")
+
+	var lines []statusLine
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line statusLine
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+
+		_, err := time.Parse(time.RFC3339Nano, line.TS)
+		require.NoError(t, err)
+
+		line.TS = ""
+		lines = append(lines, line)
+	}
+
+	require.Equal(t, []statusLine{
+		{Level: levelError, Component: "bot", Msg: "failed \"quoting\"\nacross lines"},
+		{Level: levelInfo, Component: "coin", Mint: mint, Msg: "Detected creator sell"},
+		{Level: levelInfo, Component: "jito", Msg: "Fetching jito-enabled validators"},
+	}, lines)
+}
+
+func TestStatusText(t *testing.T) {
+	buf := captureLogs(t)
+
+	(&Bot{}).statusy("Waiting for transaction")
+	require.Contains(t, buf.String(), "Bot (Y) Waiting for transaction\n")
+}
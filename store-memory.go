@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errNoDatabase      = errors.New("No Database Configured")
+	errTradesNotStored = errors.New("Trades Not Stored Without A Database")
+)
+
+// coins the memoryStore remembers creators by, about a week of pump launches. past it the oldest are forgotten
+const memoryStoreMaxCoins = 200_000
+
+// memoryStore is the Store used when no database is configured. creator history (coins created, launches,
+// sells & graduations) lives in maps for as long as the bot runs, so the creator filters start over on
+// every restart. trades & legs aren't kept at all, only logged
+type memoryStore struct {
+	lock      sync.Mutex
+	coins     map[string]map[string]*CreatedCoin // by creator, then mint
+	coinOrder []*CreatedCoin                     // oldest first, forgotten past maxCoins
+	maxCoins  int
+	stats     map[string]*CreatorStats
+	sells     map[string][]*CreatorSell // by creator, deduped by mint
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		coins:    make(map[string]map[string]*CreatedCoin),
+		maxCoins: memoryStoreMaxCoins,
+		stats:    make(map[string]*CreatorStats),
+		sells:    make(map[string][]*CreatorSell),
+	}
+}
+
+func (s *memoryStore) CreatorHasCoin(address, exceptMint string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for mint := range s.coins[address] {
+		if mint != exceptMint {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *memoryStore) RecordCoins(coins []*CreatedCoin) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, coin := range coins {
+		created, ok := s.coins[coin.Creator]
+		if !ok {
+			created = make(map[string]*CreatedCoin)
+			s.coins[coin.Creator] = created
+		}
+
+		if _, ok := created[coin.Mint]; ok {
+			continue
+		}
+
+		created[coin.Mint] = coin
+		s.coinOrder = append(s.coinOrder, coin)
+	}
+
+	for len(s.coinOrder) > s.maxCoins {
+		s.forgetOldestCoin()
+	}
+
+	return nil
+}
+
+// forgetOldestCoin drops the coin recorded first. callers hold lock
+func (s *memoryStore) forgetOldestCoin() {
+	oldest := s.coinOrder[0]
+	s.coinOrder[0] = nil
+	s.coinOrder = s.coinOrder[1:]
+
+	delete(s.coins[oldest.Creator], oldest.Mint)
+	if len(s.coins[oldest.Creator]) == 0 {
+		delete(s.coins, oldest.Creator)
+	}
+}
+
+// creatorStats returns the stats of `creator` to update, adding them if needed. callers hold lock
+func (s *memoryStore) creatorStats(creator string) *CreatorStats {
+	if _, ok := s.stats[creator]; !ok {
+		s.stats[creator] = &CreatorStats{}
+	}
+
+	return s.stats[creator]
+}
+
+func (s *memoryStore) RecordCreatorLaunch(creator string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.creatorStats(creator).Launches++
+	return nil
+}
+
+func (s *memoryStore) RecordCreatorSell(sell *CreatorSell) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, recorded := range s.sells[sell.Creator] {
+		if recorded.Mint == sell.Mint {
+			return nil
+		}
+	}
+
+	s.sells[sell.Creator] = append(s.sells[sell.Creator], sell)
+
+	summary := summarizeCreatorSells(s.sells[sell.Creator])
+	stats := s.creatorStats(sell.Creator)
+	stats.Rugs = summary.Rugs
+	stats.MedianTimeToSell = summary.MedianTimeToSell
+	stats.MedianDumpShare = summary.MedianDumpShare
+	return nil
+}
+
+func (s *memoryStore) RecordCreatorGraduation(creator string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.creatorStats(creator).Graduations++
+	return nil
+}
+
+func (s *memoryStore) CreatorStats(creator string) (*CreatorStats, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats, ok := s.stats[creator]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *stats
+	return &copied, nil
+}
+
+func (s *memoryStore) RecordTrade(trade *AtomicBuySell) error {
+	logStatus(levelInfo, "store", trade.Mint, "Trade", fmt.Sprintf("%s closed (buy %s, sell %s): spent %d, received %d, fees %d, tips %d, realized P&L %d lamports",
+		trade.Mint, trade.BuySignature, trade.SellSignature, trade.BuyLamports, trade.SolReceived, trade.FeesLamports, trade.TipsLamports, trade.RealizedPnLLamports))
+	return nil
+}
+
+func (s *memoryStore) RecordTradeLeg(leg *TradeLeg) error {
+	logStatus(levelInfo, "store", leg.Mint, "Trade Leg", fmt.Sprintf("%s %s (%s, slot %d): %d tokens, spent %d, received %d, fee %d, tip %d lamports via %s",
+		leg.Side, leg.Mint, leg.Signature, leg.Slot, leg.TokenAmount, leg.LamportsSpent, leg.LamportsReceived, leg.FeeLamports, leg.TipLamports, leg.SendPath))
+	return nil
+}
+
+// TradeSummary can't sum up trades which were only logged
+func (s *memoryStore) TradeSummary(wallet string, since time.Time) (*TradeSummary, error) {
+	return nil, errTradesNotStored
+}
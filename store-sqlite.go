@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeLayout is how SQLite's CURRENT_TIMESTAMP writes times (UTC), binding times in it keeps them comparable
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// sqliteSchema creates the same tables as the MySQL schema. SQLite takes no inline indexes nor ON UPDATE,
+// so indexes are created on their own and creator_stats.updated_at only holds when the row was inserted
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS creator_sells (
+		mint_address VARCHAR(44) NOT NULL PRIMARY KEY,
+		creator_address VARCHAR(44) NOT NULL,
+		seconds_to_sell DOUBLE NOT NULL,
+		dump_share DOUBLE NOT NULL,
+		pumped BOOLEAN NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS creator_sells_creator_address ON creator_sells (creator_address)`,
+	`CREATE TABLE IF NOT EXISTS creator_stats (
+		creator_address VARCHAR(44) NOT NULL PRIMARY KEY,
+		launches INT NOT NULL DEFAULT 0,
+		rugs INT NOT NULL DEFAULT 0,
+		graduations INT NOT NULL DEFAULT 0,
+		median_seconds_to_sell DOUBLE NOT NULL DEFAULT 0,
+		median_dump_share DOUBLE NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS coins (
+		mint_address VARCHAR(44) NOT NULL PRIMARY KEY,
+		creator_address VARCHAR(44) NOT NULL,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		symbol VARCHAR(255) NOT NULL DEFAULT '',
+		signature VARCHAR(88) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS coins_creator_address ON coins (creator_address)`,
+	`CREATE TABLE IF NOT EXISTS trades (
+		sell_signature VARCHAR(88) NOT NULL PRIMARY KEY,
+		buy_signature VARCHAR(88) NOT NULL,
+		mint_address VARCHAR(44) NOT NULL,
+		buy_lamports BIGINT NOT NULL,
+		sol_received_lamports BIGINT NOT NULL,
+		tokens_sold BIGINT NOT NULL,
+		fees_lamports BIGINT NOT NULL,
+		tips_lamports BIGINT NOT NULL DEFAULT 0,
+		gross_pnl_lamports BIGINT NOT NULL DEFAULT 0,
+		realized_pnl_lamports BIGINT NOT NULL,
+		listener_state VARCHAR(32) NOT NULL DEFAULT '',
+		buy_sol_usd DOUBLE NOT NULL DEFAULT 0,
+		sell_sol_usd DOUBLE NOT NULL DEFAULT 0,
+		realized_pnl_usd DOUBLE NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS trades_mint_address ON trades (mint_address)`,
+	`CREATE TABLE IF NOT EXISTS trade_legs (
+		signature VARCHAR(88) NOT NULL PRIMARY KEY,
+		mint_address VARCHAR(44) NOT NULL,
+		wallet_address VARCHAR(44) NOT NULL,
+		side VARCHAR(4) NOT NULL,
+		slot BIGINT NOT NULL DEFAULT 0,
+		token_amount BIGINT NOT NULL,
+		lamports_spent BIGINT NOT NULL DEFAULT 0,
+		lamports_received BIGINT NOT NULL DEFAULT 0,
+		fee_lamports BIGINT NOT NULL DEFAULT 0,
+		priority_fee_lamports BIGINT NOT NULL DEFAULT 0,
+		tip_lamports BIGINT NOT NULL DEFAULT 0,
+		send_path VARCHAR(16) NOT NULL DEFAULT '',
+		exit_reason VARCHAR(64) NOT NULL DEFAULT '',
+		detect_to_send_ms BIGINT NOT NULL DEFAULT 0,
+		send_to_confirm_ms BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS trade_legs_mint_address ON trade_legs (mint_address)`,
+	`CREATE INDEX IF NOT EXISTS trade_legs_wallet_address_created_at ON trade_legs (wallet_address, created_at)`,
+}
+
+var sqliteDialect = &sqlDialect{
+	schema: sqliteSchema,
+
+	insertIgnore: "INSERT OR IGNORE",
+	upsert:       func(key string) string { return "ON CONFLICT(" + key + ") DO UPDATE SET" },
+	inserted:     func(column string) string { return "excluded." + column },
+	greatest:     "MAX",
+	signedInt:    "INTEGER",
+	timeArg:      func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeLayout) },
+}
+
+func newSQLiteStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, dialect: sqliteDialect}
+}
+
+// openSQLite opens (or creates) the SQLite database at `path`. SQLite takes one writer at a time, so the pool
+// is a single connection, and a lock held by another process is waited out rather than failing the write
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
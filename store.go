@@ -0,0 +1,382 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Store is the persistence the bot relies on for filtering coins. Backed by SQLite or MySQL
+// in prod (see openStore), and swappable for an in-memory implementation in tests
+type Store interface {
+	// CreatorHasCoin reports whether `address` has created a pump.fun coin other than `exceptMint` (the coin
+	// being checked, which may already be recorded)
+	CreatorHasCoin(address, exceptMint string) (bool, error)
+	// RecordCoins stores creates we decoded in the coins table CreatorHasCoin queries, once per mint
+	RecordCoins(coins []*CreatedCoin) error
+
+	// RecordCreatorLaunch counts a coin launched by `creator` which we tracked
+	RecordCreatorLaunch(creator string) error
+	// RecordCreatorSell stores a creator sell we detected and refreshes the creator's stats
+	RecordCreatorSell(sell *CreatorSell) error
+	// RecordCreatorGraduation counts a coin launched by `creator` which graduated to Raydium
+	RecordCreatorGraduation(creator string) error
+	// CreatorStats returns the historical stats of `creator`, nil if we have none
+	CreatorStats(creator string) (*CreatorStats, error)
+
+	// RecordTrade stores a closed position with its realized P&L
+	RecordTrade(trade *AtomicBuySell) error
+	// RecordTradeLeg stores one of our buys or sells which landed
+	RecordTradeLeg(leg *TradeLeg) error
+	// TradeSummary sums up the positions of `wallet` with a sell leg recorded since `since`
+	TradeSummary(wallet string, since time.Time) (*TradeSummary, error)
+}
+
+// creatorStatsSchema creates the tables backing creator stats. `creator_sells` holds every
+// sell we detected, `creator_stats` the per creator aggregates recomputed from it
+var creatorStatsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS creator_sells (
+		mint_address VARCHAR(44) NOT NULL PRIMARY KEY,
+		creator_address VARCHAR(44) NOT NULL,
+		seconds_to_sell DOUBLE NOT NULL,
+		dump_share DOUBLE NOT NULL,
+		pumped BOOLEAN NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX (creator_address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS creator_stats (
+		creator_address VARCHAR(44) NOT NULL PRIMARY KEY,
+		launches INT NOT NULL DEFAULT 0,
+		rugs INT NOT NULL DEFAULT 0,
+		graduations INT NOT NULL DEFAULT 0,
+		median_seconds_to_sell DOUBLE NOT NULL DEFAULT 0,
+		median_dump_share DOUBLE NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`,
+}
+
+// coinsSchema creates the table of every create we decoded, one row per mint since notifications
+// can be redelivered
+var coinsSchema = `CREATE TABLE IF NOT EXISTS coins (
+	mint_address VARCHAR(44) NOT NULL PRIMARY KEY,
+	creator_address VARCHAR(44) NOT NULL,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	symbol VARCHAR(255) NOT NULL DEFAULT '',
+	signature VARCHAR(88) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX (creator_address)
+)`
+
+// tradesSchema creates the table of round trips, one row per closed position
+var tradesSchema = `CREATE TABLE IF NOT EXISTS trades (
+	sell_signature VARCHAR(88) NOT NULL PRIMARY KEY,
+	buy_signature VARCHAR(88) NOT NULL,
+	mint_address VARCHAR(44) NOT NULL,
+	buy_lamports BIGINT UNSIGNED NOT NULL,
+	sol_received_lamports BIGINT UNSIGNED NOT NULL,
+	tokens_sold BIGINT UNSIGNED NOT NULL,
+	fees_lamports BIGINT UNSIGNED NOT NULL,
+	tips_lamports BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	gross_pnl_lamports BIGINT NOT NULL DEFAULT 0,
+	realized_pnl_lamports BIGINT NOT NULL,
+	listener_state VARCHAR(32) NOT NULL DEFAULT '',
+	buy_sol_usd DOUBLE NOT NULL DEFAULT 0,
+	sell_sol_usd DOUBLE NOT NULL DEFAULT 0,
+	realized_pnl_usd DOUBLE NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX (mint_address)
+)`
+
+// tradesMigrations add the columns of trades tables created before them
+var tradesMigrations = []string{
+	"ALTER TABLE trades ADD COLUMN tips_lamports BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER fees_lamports",
+	"ALTER TABLE trades ADD COLUMN gross_pnl_lamports BIGINT NOT NULL DEFAULT 0 AFTER tips_lamports",
+	"ALTER TABLE trades ADD COLUMN buy_sol_usd DOUBLE NOT NULL DEFAULT 0 AFTER listener_state",
+	"ALTER TABLE trades ADD COLUMN sell_sol_usd DOUBLE NOT NULL DEFAULT 0 AFTER buy_sol_usd",
+	"ALTER TABLE trades ADD COLUMN realized_pnl_usd DOUBLE NOT NULL DEFAULT 0 AFTER sell_sol_usd",
+}
+
+// tradeLegsSchema creates the table of our buys & sells, one row per tx which landed
+var tradeLegsSchema = `CREATE TABLE IF NOT EXISTS trade_legs (
+	signature VARCHAR(88) NOT NULL PRIMARY KEY,
+	mint_address VARCHAR(44) NOT NULL,
+	wallet_address VARCHAR(44) NOT NULL,
+	side VARCHAR(4) NOT NULL,
+	slot BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	token_amount BIGINT UNSIGNED NOT NULL,
+	lamports_spent BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	lamports_received BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	fee_lamports BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	priority_fee_lamports BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	tip_lamports BIGINT UNSIGNED NOT NULL DEFAULT 0,
+	send_path VARCHAR(16) NOT NULL DEFAULT '',
+	exit_reason VARCHAR(64) NOT NULL DEFAULT '',
+	detect_to_send_ms BIGINT NOT NULL DEFAULT 0,
+	send_to_confirm_ms BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX (mint_address),
+	INDEX (wallet_address, created_at)
+)`
+
+// mysqlErrDupFieldName is returned adding a column which already exists
+const mysqlErrDupFieldName = 1060
+
+var errUnknownDatabaseScheme = errors.New("Unknown Database URL Scheme")
+
+// sqlDialect is what sets the SQL of one database we store in apart from the others
+type sqlDialect struct {
+	schema     []string // creates any of our tables which don't exist yet
+	migrations []string // add the columns of tables created before them, run after `schema`
+
+	insertIgnore string                        // starts an insert skipping rows whose key already exists
+	upsert       func(key string) string       // starts the update of an insert's row whose `key` already exists
+	inserted     func(column string) string    // the value an upserted row was inserted with for `column`
+	greatest     string                        // scalar function picking the largest of its arguments
+	signedInt    string                        // signed integer type to CAST to
+	timeArg      func(t time.Time) interface{} // binds `t` the way CURRENT_TIMESTAMP is stored
+}
+
+var mysqlDialect = &sqlDialect{
+	schema:     append(append([]string{}, creatorStatsSchema...), coinsSchema, tradesSchema, tradeLegsSchema),
+	migrations: tradesMigrations,
+
+	insertIgnore: "INSERT IGNORE",
+	upsert:       func(key string) string { return "ON DUPLICATE KEY UPDATE" },
+	inserted:     func(column string) string { return "VALUES(" + column + ")" },
+	greatest:     "GREATEST",
+	signedInt:    "SIGNED",
+	timeArg:      func(t time.Time) interface{} { return t },
+}
+
+// sqlStore is a Store over a SQL database, MySQL or SQLite as per its dialect
+type sqlStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+func newMySQLStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, dialect: mysqlDialect}
+}
+
+// openStore connects to the database at `databaseURL`, creating our tables if needed. `sqlite://<path>` opens
+// (or creates) a SQLite file, `mysql://<dsn>` a MySQL database through a go-sql-driver DSN, as does a bare DSN
+func openStore(databaseURL string) (*sqlStore, error) {
+	var store *sqlStore
+
+	scheme, dsn, ok := strings.Cut(databaseURL, "://")
+	if !ok {
+		scheme, dsn = "mysql", databaseURL
+	}
+
+	switch scheme {
+	case "sqlite":
+		db, err := openSQLite(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		store = newSQLiteStore(db)
+	case "mysql":
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		store = newMySQLStore(db)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownDatabaseScheme, scheme)
+	}
+
+	if err := store.createTables(); err != nil {
+		store.db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// createTables creates any of our tables which don't exist yet
+func (s *sqlStore) createTables() error {
+	for _, statement := range s.dialect.schema {
+		if _, err := s.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range s.dialect.migrations {
+		var mysqlErr *mysql.MySQLError
+		if _, err := s.db.Exec(statement); err != nil && !(errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupFieldName) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) CreatorHasCoin(address, exceptMint string) (bool, error) {
+	query := "SELECT COUNT(*) FROM coins WHERE creator_address = ? AND mint_address != ?"
+
+	var count int
+	if err := s.db.QueryRow(query, address, exceptMint).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *sqlStore) RecordCoins(coins []*CreatedCoin) error {
+	if len(coins) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(coins))
+	args := make([]interface{}, 0, 6*len(coins))
+	for i, coin := range coins {
+		placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+		args = append(args, coin.Mint, coin.Creator, coin.Name, coin.Symbol, coin.Signature, s.dialect.timeArg(coin.CreatedAt))
+	}
+
+	query := s.dialect.insertIgnore + " INTO coins (mint_address, creator_address, name, symbol, signature, created_at) VALUES " + strings.Join(placeholders, ", ")
+	_, err := s.db.Exec(query, args...)
+	return err
+}
+
+func (s *sqlStore) RecordCreatorLaunch(creator string) error {
+	query := "INSERT INTO creator_stats (creator_address, launches) VALUES (?, 1) " + s.dialect.upsert("creator_address") + " launches = launches + 1"
+
+	_, err := s.db.Exec(query, creator)
+	return err
+}
+
+func (s *sqlStore) RecordCreatorGraduation(creator string) error {
+	query := "INSERT INTO creator_stats (creator_address, graduations) VALUES (?, 1) " + s.dialect.upsert("creator_address") + " graduations = graduations + 1"
+
+	_, err := s.db.Exec(query, creator)
+	return err
+}
+
+func (s *sqlStore) RecordCreatorSell(sell *CreatorSell) error {
+	insert := s.dialect.insertIgnore + " INTO creator_sells (mint_address, creator_address, seconds_to_sell, dump_share, pumped) VALUES (?, ?, ?, ?, ?)"
+	if _, err := s.db.Exec(insert, sell.Mint, sell.Creator, sell.TimeToSell.Seconds(), sell.DumpShare, sell.Pumped); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query("SELECT seconds_to_sell, dump_share, pumped FROM creator_sells WHERE creator_address = ?", sell.Creator)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var sells []*CreatorSell
+	for rows.Next() {
+		var seconds float64
+		recorded := &CreatorSell{Creator: sell.Creator}
+		if err := rows.Scan(&seconds, &recorded.DumpShare, &recorded.Pumped); err != nil {
+			return err
+		}
+
+		recorded.TimeToSell = time.Duration(seconds * float64(time.Second))
+		sells = append(sells, recorded)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stats := summarizeCreatorSells(sells)
+	update := fmt.Sprintf(`INSERT INTO creator_stats (creator_address, rugs, median_seconds_to_sell, median_dump_share) VALUES (?, ?, ?, ?)
+		%s rugs = %s, median_seconds_to_sell = %s, median_dump_share = %s`,
+		s.dialect.upsert("creator_address"), s.dialect.inserted("rugs"), s.dialect.inserted("median_seconds_to_sell"), s.dialect.inserted("median_dump_share"))
+
+	_, err = s.db.Exec(update, sell.Creator, stats.Rugs, stats.MedianTimeToSell.Seconds(), stats.MedianDumpShare)
+	return err
+}
+
+func (s *sqlStore) CreatorStats(creator string) (*CreatorStats, error) {
+	query := "SELECT launches, rugs, graduations, median_seconds_to_sell, median_dump_share FROM creator_stats WHERE creator_address = ?"
+
+	var seconds float64
+	stats := &CreatorStats{}
+	err := s.db.QueryRow(query, creator).Scan(&stats.Launches, &stats.Rugs, &stats.Graduations, &seconds, &stats.MedianDumpShare)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats.MedianTimeToSell = time.Duration(seconds * float64(time.Second))
+	return stats, nil
+}
+
+func (s *sqlStore) RecordTrade(trade *AtomicBuySell) error {
+	query := s.dialect.insertIgnore + ` INTO trades (sell_signature, buy_signature, mint_address, buy_lamports, sol_received_lamports, tokens_sold, fees_lamports, tips_lamports, gross_pnl_lamports, realized_pnl_lamports, listener_state, buy_sol_usd, sell_sol_usd, realized_pnl_usd)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := s.db.Exec(query, trade.SellSignature, trade.BuySignature, trade.Mint, trade.BuyLamports, trade.SolReceived, trade.TokensSold, trade.FeesLamports, trade.TipsLamports, trade.GrossPnLLamports, trade.RealizedPnLLamports, trade.ListenerState, trade.BuySolUSD, trade.SellSolUSD, trade.RealizedPnLUSD)
+	return err
+}
+
+func (s *sqlStore) RecordTradeLeg(leg *TradeLeg) error {
+	query := s.dialect.insertIgnore + ` INTO trade_legs (signature, mint_address, wallet_address, side, slot, token_amount, lamports_spent, lamports_received, fee_lamports, priority_fee_lamports, tip_lamports, send_path, exit_reason, detect_to_send_ms, send_to_confirm_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := s.db.Exec(query, leg.Signature, leg.Mint, leg.Wallet, leg.Side, leg.Slot, leg.TokenAmount, leg.LamportsSpent, leg.LamportsReceived, leg.FeeLamports, leg.PriorityFeeLamports, leg.TipLamports, leg.SendPath, leg.ExitReason, leg.DetectToSend.Milliseconds(), leg.SendToConfirm.Milliseconds())
+	return err
+}
+
+// TradeSummary nets out every leg of the positions sold since `since`, buys recorded before it included
+func (s *sqlStore) TradeSummary(wallet string, since time.Time) (*TradeSummary, error) {
+	query := fmt.Sprintf(`SELECT CAST(SUM(lamports_received) AS %[1]s) - CAST(SUM(lamports_spent + fee_lamports + tip_lamports) AS %[1]s)
+		FROM trade_legs
+		WHERE wallet_address = ? AND mint_address IN (
+			SELECT mint_address FROM trade_legs WHERE wallet_address = ? AND side = 'sell' AND created_at >= ?
+		)
+		GROUP BY mint_address`, s.dialect.signedInt)
+
+	rows, err := s.db.Query(query, wallet, wallet, s.dialect.timeArg(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pnls []int64
+	for rows.Next() {
+		var pnl int64
+		if err := rows.Scan(&pnl); err != nil {
+			return nil, err
+		}
+
+		pnls = append(pnls, pnl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summarizePositions(pnls), nil
+}
+
+// backfillCreatorStats seeds launch counts from the coins we traded, their creators from the coins table. live
+// launches only count coins we tracked, the only ones we detect rugs on, so counting every create in coins would
+// deflate rug rates. sells were never stored before creator_sells existed, so rugs & medians only fill in as
+// new sells are detected
+func (s *sqlStore) backfillCreatorStats() (int64, error) {
+	query := fmt.Sprintf(`INSERT INTO creator_stats (creator_address, launches)
+		SELECT coins.creator_address, COUNT(DISTINCT coins.mint_address) FROM coins
+		JOIN trades ON trades.mint_address = coins.mint_address
+		WHERE 1 = 1 GROUP BY coins.creator_address
+		%s launches = %s(launches, %s)`, s.dialect.upsert("creator_address"), s.dialect.greatest, s.dialect.inserted("launches"))
+
+	result, err := s.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
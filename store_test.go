@@ -0,0 +1,171 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteStore(t *testing.T) *sqlStore {
+	store, err := openStore("sqlite://" + filepath.Join(t.TempDir(), "pump.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.db.Close() })
+
+	return store
+}
+
+func TestOpenStoreRejectsUnknownScheme(t *testing.T) {
+	_, err := openStore("postgres://localhost/coins")
+	require.ErrorIs(t, err, errUnknownDatabaseScheme)
+}
+
+func TestSQLiteStoreCoinsAndCreatorStats(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	// tables already existing is fine
+	require.NoError(t, store.createTables())
+
+	coins := []*CreatedCoin{
+		{Mint: "mint-1", Creator: "creator", CreatedAt: time.Now()},
+		{Mint: "mint-2", Creator: "creator", CreatedAt: time.Now()},
+	}
+	require.NoError(t, store.RecordCoins(coins))
+	require.NoError(t, store.RecordCoins(coins[:1]))
+
+	has, err := store.CreatorHasCoin("creator", "mint-1")
+	require.NoError(t, err)
+	require.True(t, has)
+
+	has, err = store.CreatorHasCoin("other", "")
+	require.NoError(t, err)
+	require.False(t, has)
+
+	stats, err := store.CreatorStats("creator")
+	require.NoError(t, err)
+	require.Nil(t, stats)
+
+	// only coins we traded count as launches, however many the creator made
+	require.NoError(t, store.RecordTrade(&AtomicBuySell{Mint: "mint-1", SellSignature: "sell-1"}))
+	require.NoError(t, store.RecordTrade(&AtomicBuySell{Mint: "mint-1", SellSignature: "sell-2"}))
+
+	backfilled, err := store.backfillCreatorStats()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, backfilled)
+
+	stats, err = store.CreatorStats("creator")
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Launches)
+
+	require.NoError(t, store.RecordCreatorLaunch("creator"))
+	require.NoError(t, store.RecordCreatorGraduation("creator"))
+
+	sells := []*CreatorSell{
+		{Creator: "creator", Mint: "mint-1", TimeToSell: 10 * time.Second, DumpShare: 0.9},
+		{Creator: "creator", Mint: "mint-2", TimeToSell: 30 * time.Second, DumpShare: 0.5, Pumped: true},
+	}
+	for _, sell := range sells {
+		require.NoError(t, store.RecordCreatorSell(sell))
+	}
+
+	// a redelivered sell isn't counted twice
+	require.NoError(t, store.RecordCreatorSell(sells[0]))
+
+	stats, err = store.CreatorStats("creator")
+	require.NoError(t, err)
+
+	want := summarizeCreatorSells(sells)
+	require.Equal(t, 2, stats.Launches)
+	require.Equal(t, 1, stats.Graduations)
+	require.Equal(t, want.Rugs, stats.Rugs)
+	require.Equal(t, want.MedianTimeToSell, stats.MedianTimeToSell)
+	require.Equal(t, want.MedianDumpShare, stats.MedianDumpShare)
+
+	// the backfill never lowers launches counted since
+	_, err = store.backfillCreatorStats()
+	require.NoError(t, err)
+
+	stats, err = store.CreatorStats("creator")
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Launches)
+}
+
+func TestSQLiteStoreTradeSummary(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	require.NoError(t, store.RecordTrade(&AtomicBuySell{Mint: "mint-1", SellSignature: "sell-1", RealizedPnLLamports: 100}))
+
+	legs := []*TradeLeg{
+		{Mint: "mint-1", Wallet: "wallet", Side: tradeSideBuy, Signature: "buy-1", LamportsSpent: 1000, FeeLamports: 10},
+		{Mint: "mint-1", Wallet: "wallet", Side: tradeSideSell, Signature: "sell-1", LamportsReceived: 1500, FeeLamports: 10, TipLamports: 5},
+		{Mint: "mint-2", Wallet: "wallet", Side: tradeSideBuy, Signature: "buy-2", LamportsSpent: 1000},
+		{Mint: "mint-2", Wallet: "wallet", Side: tradeSideSell, Signature: "sell-2", LamportsReceived: 400},
+		{Mint: "mint-3", Wallet: "wallet", Side: tradeSideBuy, Signature: "buy-3", LamportsSpent: 1000},
+		{Mint: "mint-1", Wallet: "other", Side: tradeSideSell, Signature: "sell-4", LamportsReceived: 1000},
+	}
+	for _, leg := range legs {
+		require.NoError(t, store.RecordTradeLeg(leg))
+	}
+
+	summary, err := store.TradeSummary("wallet", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Positions)
+	require.Equal(t, 1, summary.Wins)
+	require.EqualValues(t, 475-600, summary.PnLLamports)
+
+	summary, err = store.TradeSummary("wallet", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, summary.Positions)
+}
+
+func TestMemoryStoreKeepsCreatorHistoryAndLogsTrades(t *testing.T) {
+	store := newMemoryStore()
+
+	require.NoError(t, store.RecordCoins([]*CreatedCoin{{Mint: "mint-1", Creator: "creator"}}))
+
+	has, err := store.CreatorHasCoin("creator", "mint-1")
+	require.NoError(t, err)
+	require.False(t, has)
+
+	has, err = store.CreatorHasCoin("creator", "mint-2")
+	require.NoError(t, err)
+	require.True(t, has)
+
+	sell := &CreatorSell{Creator: "creator", Mint: "mint-1", TimeToSell: 10 * time.Second, DumpShare: 0.9}
+	require.NoError(t, store.RecordCreatorLaunch("creator"))
+	require.NoError(t, store.RecordCreatorSell(sell))
+	require.NoError(t, store.RecordCreatorSell(sell))
+
+	stats, err := store.CreatorStats("creator")
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Launches)
+	require.Equal(t, summarizeCreatorSells([]*CreatorSell{sell}).Rugs, stats.Rugs)
+
+	buf := captureLogs(t)
+	require.NoError(t, store.RecordTrade(&AtomicBuySell{Mint: "mint-1", SellSignature: "sell-1", RealizedPnLLamports: -100}))
+	require.Contains(t, buf.String(), "realized P&L -100 lamports")
+
+	_, err = store.TradeSummary("wallet", time.Time{})
+	require.ErrorIs(t, err, errTradesNotStored)
+}
+
+func TestMemoryStoreForgetsOldestCoins(t *testing.T) {
+	store := newMemoryStore()
+	store.maxCoins = 2
+
+	require.NoError(t, store.RecordCoins([]*CreatedCoin{{Mint: "mint-1", Creator: "first"}, {Mint: "mint-2", Creator: "second"}}))
+	require.NoError(t, store.RecordCoins([]*CreatedCoin{{Mint: "mint-3", Creator: "third"}}))
+
+	has, err := store.CreatorHasCoin("first", "")
+	require.NoError(t, err)
+	require.False(t, has)
+
+	for _, creator := range []string{"second", "third"} {
+		has, err = store.CreatorHasCoin(creator, "")
+		require.NoError(t, err)
+		require.True(t, has)
+	}
+
+	require.Len(t, store.coins, 2)
+}
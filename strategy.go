@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// exit strategy presets, see `Bot.strategyPreset`. they run on the trade tape of held coins
+const (
+	strategyNone = ""
+
+	// sell half the position once the price doubles from our entry, then exit the rest if it falls back to our entry
+	strategyHalfAt2xBreakeven = "half-at-2x-breakeven"
+)
+
+// how far a coin is through its strategy preset
+const (
+	strategyStageWaiting    int32 = iota // waiting for the take profit
+	strategyStageTakeProfit              // partial sell in flight
+	strategyStageStopArmed               // took profit, the rest exits at our entry
+)
+
+// runStrategyPreset advances the coin through `strategyPreset` on the latest curve of its trade tape.
+// the partial sell runs in its own goroutine, the stop exits through manageSellForCoin like every other exit
+func (b *Bot) runStrategyPreset(coin *Coin) {
+	if b.strategyPreset != strategyHalfAt2xBreakeven || !coin.botPurchased || !coin.botHoldsTokens() {
+		return
+	}
+
+	curve := coin.curve.Load()
+	if curve == nil {
+		return
+	}
+
+	entry := coin.strategyEntryPrice()
+	if entry == nil {
+		return
+	}
+
+	price := curve.SpotPrice()
+
+	switch coin.strategyStage.Load() {
+	case strategyStageWaiting:
+		if price.Cmp(new(big.Rat).Mul(entry, big.NewRat(2, 1))) < 0 || !coin.strategyStage.CompareAndSwap(strategyStageWaiting, strategyStageTakeProfit) {
+			return
+		}
+
+		half := new(big.Int).Div(coin.tokensHeld, big.NewInt(2)).Uint64()
+		b.status(fmt.Sprintf("%s doubled from our entry, selling half (%d tokens)", coin.mintAddr.String(), half))
+
+		b.goCoin(func() {
+			if _, err := b.sellPartial(coin, half); err != nil {
+				b.statusr(fmt.Sprintf("Partial sell of %s failed: %s", coin.mintAddr.String(), err))
+			}
+
+			// whether or not the sell went through, we never ride a double back below our entry
+			coin.strategyStage.Store(strategyStageStopArmed)
+		})
+	case strategyStageStopArmed:
+		if price.Cmp(entry) > 0 {
+			return
+		}
+
+		b.status(fmt.Sprintf("%s fell back to our entry, Marking to sell", coin.mintAddr.String()))
+		b.triggerExit(coin, exitReasonBreakevenStop)
+	}
+}
+
+// strategyEntryPrice is what we paid per whole token (lamports, like SpotPrice), set from our position
+// the first time it's asked for, so later partial sells don't move it. nil before we hold tokens
+func (c *Coin) strategyEntryPrice() *big.Rat {
+	if entry := c.entryPrice.Load(); entry != nil {
+		return entry
+	}
+
+	if c.tokensHeld == nil || c.tokensHeld.Sign() <= 0 || c.buyPrice == 0 {
+		return nil
+	}
+
+	lamports := new(big.Int).Mul(new(big.Int).SetUint64(c.buyPrice), big.NewInt(tokenUnit))
+	c.entryPrice.CompareAndSwap(nil, new(big.Rat).SetFrac(lamports, c.tokensHeld))
+	return c.entryPrice.Load()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrategyHalfAt2xBreakeven(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{
+		mintAddr:               f.mint,
+		tokenBondingCurve:      f.bondingCurve,
+		associatedBondingCurve: f.associatedBondingCurve,
+		eventAuthority:         f.eventAuthority,
+		associatedTokenAccount: solana.NewWallet().PublicKey(),
+		botPurchased:           true,
+		tokensHeld:             big.NewInt(1_000_000_000), // 1000 tokens
+		buyPrice:               30_000,                    // 30 lamports per token
+	}
+
+	var lock sync.Mutex
+	var soldAmounts []uint64
+
+	mock := newMockRPC(t)
+	mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var encoded string
+		require.NoError(t, json.Unmarshal(params[0], &encoded))
+
+		tx, err := solana.TransactionFromBase64(encoded)
+		require.NoError(t, err)
+
+		for _, inst := range decodeInstructions(tx) {
+			if sell, ok := inst.pump.Impl.(*pump.Sell); ok {
+				lock.Lock()
+				soldAmounts = append(soldAmounts, *sell.Amount)
+				lock.Unlock()
+			}
+		}
+
+		return tx.Signatures[0].String(), nil
+	})
+	mock.handle("getTokenAccountBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"amount": "500000000", "decimals": 6, "uiAmountString": "500"},
+		}, nil
+	})
+
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": map[string]interface{}{"err": nil}}}
+	})
+
+	b := &Bot{
+		rpcClient:      mock.client(),
+		wsPool:         newWsPoolFromClients(wsMock.client(t)),
+		privateKey:     solana.NewWallet().PrivateKey,
+		strategyPreset: strategyHalfAt2xBreakeven,
+		pendingCoins:   map[string]*Coin{f.mint.String(): coin},
+	}
+	b.blockhash.Store(&solana.Hash{})
+
+	trade := func(price int64) {
+		coin.curve.Store(curveAtPrice(price))
+		b.runStrategyPreset(coin)
+	}
+
+	// up, but not 2x yet
+	trade(45)
+	trade(59)
+	require.Empty(t, mock.callsTo("sendTransaction"))
+
+	// 2x sells half, once
+	trade(60)
+	trade(62)
+	require.Eventually(t, func() bool { return coin.strategyStage.Load() == strategyStageStopArmed }, 5*time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	require.Equal(t, []uint64{500_000_000}, soldAmounts)
+	lock.Unlock()
+	require.Equal(t, big.NewInt(500_000_000), coin.tokensHeld)
+	require.Len(t, coin.partialSellSignatures, 1)
+
+	// the rest rides until the price is back at our entry
+	trade(40)
+	require.Empty(t, coin.exitReason)
+
+	trade(30)
+	b.pendingCoinsLock.Lock()
+	require.Equal(t, exitReasonBreakevenStop, coin.exitReason)
+	b.pendingCoinsLock.Unlock()
+}
+
+func TestStrategyEntryPrice(t *testing.T) {
+	coin := &Coin{}
+	require.Nil(t, coin.strategyEntryPrice())
+
+	coin.tokensHeld, coin.buyPrice = big.NewInt(2_000_000), 50
+	require.Equal(t, big.NewRat(25, 1), coin.strategyEntryPrice())
+
+	// selling part of the position doesn't move it
+	coin.tokensHeld = big.NewInt(1_000_000)
+	require.Equal(t, big.NewRat(25, 1), coin.strategyEntryPrice())
+}
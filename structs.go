@@ -2,26 +2,27 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
-	"github.com/gagliardetto/solana-go/rpc/ws"
-	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/ratelimit"
 )
 
 var (
-	errDBConnectionNil = errors.New("MySQL DB Connection Nil")
+	errStoreNil           = errors.New("Store Nil")
+	errMalformedRPCHeader = errors.New("Malformed RPC Header")
 
 	pumpProgramID solana.PublicKey = solana.MustPublicKeyFromBase58("6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P")
 	globalAddr    solana.PublicKey = solana.MustPublicKeyFromBase58("4wTV1YmiEkRvAtNtsSGPtUrqRYQMe5SKy2uB4Jjaxnjf")
@@ -29,45 +30,342 @@ var (
 	rent          solana.PublicKey = solana.MustPublicKeyFromBase58("SysvarRent111111111111111111111111111111111")
 )
 
+// sendTxClient is a free / alternate RPC vanilla txs are also sent through
+type sendTxClient struct {
+	*rpc.Client
+	endpoint string // rpcEndpointLabel of its url, what we log & label metrics with
+}
+
 type Bot struct {
 	rpcClient     *rpc.Client
 	jrpcClient    rpc.JSONRPCClient
-	sendTxClients []*rpc.Client
+	sendTxClients []sendTxClient
+
+	// txLanding tracks which send RPC returns first for the vanilla txs which land
+	txLanding TxLandingRateByRPC
 
-	wsClient     *ws.Client
-	privateKey   solana.PrivateKey
-	dbConnection *sql.DB
+	// freeRPCSendDelay holds vanilla sends through `sendTxClients` back this long after the dedicated
+	// send, so the dedicated RPC gets the tx first and free RPCs ratelimit us less. 0 sends all at once
+	freeRPCSendDelay time.Duration
+
+	// wsPool spreads our websocket subscriptions over `wsConnections` connections
+	wsPool     *WsPool
+	privateKey solana.PrivateKey
+	store      Store
 
 	feeMicroLamport  uint64
-	buyAmountLamport uint64 // amount of coins we buy for each coin (in lamports)
+	buyAmountLamport uint64 // amount of coins we buy for each coin (in lamports), see buyLamports
+
+	// buyMode is either `buyModeSolAmount`, spending `buyAmountLamport` on each coin, or `buyModeTokenAmount`,
+	// buying `buyTokenAmount` tokens (raw units, 6 decimals) and skipping the coin if that costs over `maxBuyLamport`
+	buyMode        string
+	buyTokenAmount uint64
+	maxBuyLamport  uint64
+
+	// reserveLamports is left in the wallet for fees & tips: before sending, a buy must cost at most our
+	// cached balance less it & what pending buys may spend. 0 sends without checking the balance
+	reserveLamports uint64
+
+	// walletBalance is our SOL balance the reserve is checked against, refetched every `walletBalanceRefreshInterval`
+	walletBalance                walletBalance
+	walletBalanceRefreshInterval time.Duration
 
 	pendingCoins     map[string]*Coin // coins which we will attempt to buy, but have yet to be purchased
 	pendingCoinsLock sync.Mutex
 	coinsToBuy       chan *Coin
 	coinsToSell      chan string
 
+	// waitingBuySends counts goroutines blocked handing a coin to `coinsToBuy`
+	waitingBuySends atomic.Int64
+	// pipelineDepthWarning is how many coins can wait in coinsToBuy / coinsToSell before we warn
+	pipelineDepthWarning int
+
+	// maxQueueAge is how long since its detection a coin may have been picked up when HandleBuyCoins
+	// dequeues it, older ones are discarded rather than bought late. 0 disables it
+	maxQueueAge time.Duration
+
+	// detectedMints holds mint signatures we have recently started checking,
+	// used to dedupe mints seen by multiple detection paths (logs, webhooks)
+	detectedMints sync.Map
+
+	// lastMintSeen is when (unix nanos) our websocket mint detection last received a mint. once it's been
+	// `mintIdleTimeout` ago, watchMintSubscription resubscribes. 0 disables the watchdog
+	lastMintSeen    atomic.Int64
+	mintIdleTimeout time.Duration
+
+	// wsHealthMonitor pings every websocket connection each `wsPingInterval`, redialing the ones
+	// not answering within `wsPingTimeout`
+	wsPingInterval time.Duration
+	wsPingTimeout  time.Duration
+
+	// mintChecks runs the checks of detected mints on a bounded pool, see mintCheckPool. nil gives every check its own goroutine
+	mintChecks *mintCheckPool
+
+	// mintProgramIDs are the launchpads (pump and forks sharing its instructions) whose logs are watched for
+	// mints and whose instructions are decoded as pump's, a log subscription each. empty watches pump only
+	mintProgramIDs []solana.PublicKey
+
+	// confirmedSigs caches signatures we've seen confirm, so we never subscribe to them again
+	confirmedSigs sync.Map
+
+	// omitTxVersion leaves maxSupportedTransactionVersion out of getTransaction, for RPCs which reject it.
+	// txVersionRejected omits it the same way once the RPC has rejected it
+	omitTxVersion     bool
+	txVersionRejected atomic.Bool
+
+	// batchCurveFetchRejected fetches polled bonding curves one by one once the RPC has rejected getMultipleAccounts
+	batchCurveFetchRejected atomic.Bool
+
+	// globalParams caches pump's Global account (fee recipient & fee), refreshed whenever
+	// we see a SetParams in the pump logs. nil until first fetched
+	globalParams atomic.Pointer[pump.Global]
+
 	// skipATALookup skips looking up if the ATA exists. Useful for debugging & attempting to purchase coins we already have owned.
 	// in prod, should always be set to `true` since we should never have ATA for new coins.
 	skipATALookup bool
 
-	blockhash   *solana.Hash
+	// separateATATx creates our ATA in its own confirmed transaction before the buy, instead of
+	// bundling it with the buy. waits `ataConfirmDelay` after confirmation then verifies the ATA exists.
+	// adds latency, so only for strategies which aren't racing to be the first buyer
+	separateATATx   bool
+	ataConfirmDelay time.Duration
+
+	// shadowBuy builds every buy as usual, curve, jito leader & tip included, but logs it (see logShadowBuy)
+	// instead of sending it. for checking a new RPC / jito setup before going live
+	shadowBuy bool
+
+	// buyAccountingCommitment is the commitment our buy must reach before the position counts as open
+	// for accounting (see openPosition). sells are armed at confirmed regardless
+	buyAccountingCommitment rpc.CommitmentType
+
+	// addressTables holds our pump lookup table (see loadPumpLookupTable) once loaded, making buys &
+	// sells v0 transactions which look the static pump accounts up. nil sends legacy transactions
+	addressTables map[solana.PublicKey]solana.PublicKeySlice
+
+	// deadListenerAction is what we do with a held coin once its creator listener stops without a
+	// verdict: `deadListenerExit` sells it, `deadListenerRestart` listens again, empty leaves it unprotected
+	deadListenerAction string
+
+	// monitorMempool streams jito's mempool while we build a buy (see MonitorMempool), aborting
+	// the buy if another wallet's buy of the coin is pending before ours is sent
+	monitorMempool bool
+
+	// bondingCurveRetries is how many times fetchBondingCurve retries when the bonding curve account
+	// isn't visible yet (right after creation at processed commitment), waiting `bondingCurveRetryDelay` between tries
+	bondingCurveRetries    int
+	bondingCurveRetryDelay time.Duration
+
+	// bondingCurveFallbackClient is asked for the bonding curve whenever `rpcClient` doesn't see it yet. nil only asks `rpcClient`
+	bondingCurveFallbackClient *rpc.Client
+
+	// maxCurveSlotLag is how many slots behind the current slot (tracked by the jito manager) a curve read
+	// may be before it's stale, served by a lagging RPC node. stale reads are refetched before buying and
+	// skipped when polling. 0 disables the check
+	maxCurveSlotLag uint64
+
+	// mintDenylist holds mints we never buy, see loadMintDenylist
+	mintDenylist map[string]bool
+
+	// creatorCooldown skips coins whose creator launched another coin this recently, tracked in `creatorLaunches`
+	// (creator -> time of their latest launch). 0 disables it
+	creatorCooldown time.Duration
+	creatorLaunches sync.Map
+
+	// requireCreatorBuy skips coins where the creator did not buy in the launch tx
+	requireCreatorBuy bool
+
+	// checkMintTokenomics fetches each coin's mint account, skipping coins whose mint or freeze authority
+	// is still set, or whose decimals / supply aren't pump's, see validateTokenomics
+	checkMintTokenomics bool
+
+	// requireOlderFunder skips coins whose creator was funded inside the launch tx itself
+	requireOlderFunder bool
+
+	// detectCoordinatedBuys checks the bonding curve's latest `coordinatedBuyLookbackSigs` tx for wallets
+	// buying in the same block as the create which share a funder with the creator, skipping those coins.
+	// off by default, it costs a funder lookup per same-block buyer on top of the creator's
+	detectCoordinatedBuys      bool
+	coordinatedBuyLookbackSigs int
+
+	// funderLookbackSigs is how many of the creator's latest tx we search for funders.
+	// more lookback improves funder detection at the cost of latency
+	funderLookbackSigs int
+	// funderCheckSlots bounds how many isSafeFunder checks run at once across all mints, to protect
+	// the RPC & DB when many mints land together. its capacity is the limit, nil leaves checks unbounded
+	funderCheckSlots chan struct{}
+	// funderFetchLatency tracks fetchNLastTrans, shouldBuyCoin gives up after twice its P95
+	funderFetchLatency latencyWindow
+	// creatorAtaLookbackSigs is how many of the creator ATA's latest tx we check for a sell / transfer
+	creatorAtaLookbackSigs int
+	// when a creator ATA notification can't be classified on its own, we fetch the ATA's new txs up to
+	// `creatorTxCheckAttempts` times, `creatorTxCheckInterval` apart, each fetch timing out after
+	// `creatorTxFetchTimeout`. we stop early once the fetched txs reach the notification's slot
+	creatorTxCheckAttempts int
+	creatorTxCheckInterval time.Duration
+	creatorTxFetchTimeout  time.Duration
+	// creatorSellDropThreshold is the fraction (0-1) the creator's token balance must drop by
+	// in a single account notification to be treated as a sell without fetching transactions.
+	// smaller drops are classified by fetching the creator ATA's transactions
+	creatorSellDropThreshold float64
+	// creatorMetaSellThreshold is the fraction (0-1) the creator's token balance must drop by, going
+	// from PreTokenBalances to PostTokenBalances of a fetched tx, for the tx to count as a sell / transfer
+	creatorMetaSellThreshold float64
+	// creatorDustSellShare is the fraction (0-1) of their peak holdings the creator must have sold / moved
+	// in total before we exit. smaller sells (e.g. test transfers to an exchange) are logged and ignored
+	creatorDustSellShare float64
+
+	// recordCreatorStats persists launches, sells & graduations of the creators we track, which
+	// shouldBuyCoin checks against: creators who sold out of at least `creatorMaxRugRate` (0-1) of their
+	// launches, or whose median sell came less than `creatorMinMedianSellTime` after launch, are skipped
+	recordCreatorStats       bool
+	creatorMaxRugRate        float64
+	creatorMinMedianSellTime time.Duration
+
+	// createdCoins writes every create we decode to the coins table, which addressCreatedCoin checks
+	// creators against. nil records nothing
+	createdCoins *createdCoinRecorder
+
+	// knownCompetitorBots are wallets of other sniper bots. every `competedBuysBeforeCut` of our buys which land in
+	// the same block as one of theirs buying the coin (counted in competedBuys) cut what we spend per coin by
+	// `competedBuyCut` (0-1), once more in buyAmountCuts. 0 never cuts. see checkPeerBots
+	knownCompetitorBots   map[string]bool
+	competedBuysBeforeCut int
+	competedBuyCut        float64
+	competedBuys          atomic.Int64
+	buyAmountCuts         atomic.Int32
+
+	// recordTrades stores the buy & sell of every position we close with its realized P&L, see recordRoundTrip,
+	// and every buy & sell tx which landed as a trade leg, see recordTradeLeg
+	recordTrades bool
+	// tradeSummaryInterval is how often LogTradeSummary logs the day's closed positions from the trade legs
+	tradeSummaryInterval time.Duration
+
+	// maxDailyLossSol halts new buys once the realized loss of the day's closed positions (UTC) exceeds it,
+	// notifying the operator, until trading is resumed through `/resume`. 0 disables it
+	maxDailyLossSol float64
+	dailyLoss       dailyLoss
+	tradingHalted   atomic.Bool
+
+	// notifier alerts the operator, e.g. when trading halts. nil only logs
+	notifier Notifier
+
+	// solPrice annotates what we report in SOL with its USD value. nil reports in SOL only
+	solPrice *SolPriceFeed
+
+	// eventLog records every mint, decision, buy & sell for debugging and auditing. nil records nothing
+	eventLog EventLog
+
+	// instrLogger records the raw launchpad instructions of every mint tx we decode. nil records nothing
+	instrLogger *InstructionLogger
+
+	// controlToken authorizes control endpoints like `/resume` (as a bearer token), empty disables them
+	controlToken string
+
+	// webhookToken authorizes PumpPortal webhook POSTs (as a bearer token), empty rejects them all
+	webhookToken string
+
+	// panicExit exits the bot once the sells started by POST /panic are done
+	panicExit bool
+
+	// watchCreatorWallet also subscribes to the creator's wallet for each coin, exiting on
+	// SOL inflows of at least `creatorWalletInflowSol` (sell proceeds from another wallet)
+	// or when the wallet is drained to `creatorWalletDrainedSol` or less
+	watchCreatorWallet      bool
+	creatorWalletInflowSol  float64
+	creatorWalletDrainedSol float64
+
+	// maxTradeTapes caps how many held coins we stream the full trade tape of (see WatchTrades), 0 disables it
+	maxTradeTapes    int
+	activeTradeTapes atomic.Int64
+
+	// priceHistoryLength is how many trades of each held coin's trade tape its price history keeps, 0 keeps none
+	priceHistoryLength int
+
+	// maxHoldValueSol exits a coin once selling it would net at least this much SOL over what we paid,
+	// checked on every trade of the coin's trade tape. 0 disables it
+	maxHoldValueSol float64
+
+	// netOutflowExitWindow exits a coin once more SOL was sold out than bought in over this window
+	// (needs the trade tape of the coin), 0 disables it
+	netOutflowExitWindow time.Duration
+
+	// maxBuyCurveProgress skips coins whose curve is already this far (percent, 0-100) toward migration
+	// when we go to buy. exitCurveProgress exits a held coin once its curve gets this close to completing,
+	// checked on every trade of the coin. 0 disables either
+	maxBuyCurveProgress float64
+	exitCurveProgress   float64
+
+	// maxEvalCurveFill skips coins whose curve is already this far (percent, 0-100) toward migration when
+	// shouldBuyCoin evaluates them, i.e. we detected them late. 0 disables it
+	maxEvalCurveFill float64
+
+	// minSlotsBeforeBuy holds buys until this many slots passed since the coin's create (the slot of its mint
+	// tx, against the current slot tracked by the jito manager). coins whose create slot we don't know aren't
+	// held. 0 disables it
+	minSlotsBeforeBuy uint64
+
+	// maxExternalSolBeforeEntry skips coins others already bought more than this much SOL of after the
+	// creator, since we'd no longer be the second buyer
+	maxExternalSolBeforeEntry float64
+
+	// curvePollInterval fetches the bonding curves of every pending coin this often, in one getMultipleAccounts
+	// call, feeding the same curve exits as the trade tape. 0 disables it
+	curvePollInterval time.Duration
+
+	// localCurveMaxAge lets BuyCoin quote off the coin's local curve (kept current from its trades) instead of
+	// fetching it, if it was updated this recently. 0 always fetches. curveReconcileInterval checks local curves
+	// against chain this often, resyncing any off by more than curveDivergenceTolerance (a fraction). 0 disables it
+	localCurveMaxAge         time.Duration
+	curveReconcileInterval   time.Duration
+	curveDivergenceTolerance float64
+
+	// globalParamsRefreshInterval refetches pump's Global params (fee recipient, fees...) this often, on top of
+	// refetching them whenever we see a SetParams tx. 0 only refetches on SetParams
+	globalParamsRefreshInterval time.Duration
+
+	// strategyPreset is the exit strategy preset held coins follow on their trade tape, e.g.
+	// `strategyHalfAt2xBreakeven`. `strategyNone` leaves exits to the other triggers
+	strategyPreset string
+
+	// sellRounds is how many times SellCoinFast re-enters the sell loop while our token balance
+	// shows we still hold tokens after a sell confirmed
+	sellRounds int
+
+	// tipOnBuy / tipOnSell send buys / sells through jito with a tip when the leader runs jito.
+	// disabling a side always sends it as a vanilla tx with a priority fee
+	tipOnBuy  bool
+	tipOnSell bool
+
+	// sellComputeUnitLimits / jitoSellComputeUnitLimits are the CU limits of vanilla / jito sell txs,
+	// above the buy's since sells occasionally exceed it when the chain is busy
+	sellComputeUnitLimits     uint32
+	jitoSellComputeUnitLimits uint32
+
+	// blockhash is the latest blockhash txs are built on, swapped out by the refresh loop while txs are built
+	blockhash atomic.Pointer[solana.Hash]
+	// blockhashFetchedAt is when (unix nanos) `blockhash` was fetched, 0 until the refresh loop runs.
+	// lastValidBlockHeight is the block height it expires after, currentBlockHeight the latest we fetched
+	blockhashFetchedAt   atomic.Int64
+	lastValidBlockHeight atomic.Uint64
+	currentBlockHeight   atomic.Uint64
+
 	jitoManager *JitoManager
 }
 
 func (b *Bot) status(msg interface{}) {
-	log.Println("Bot", fmt.Sprintf("%v", msg))
+	logStatus(levelInfo, "bot", "", "Bot", msg)
 }
 
 func (b *Bot) statusy(msg interface{}) {
-	log.Println("Bot (Y)", fmt.Sprintf("%v", msg))
+	logStatus(levelWarn, "bot", "", "Bot (Y)", msg)
 }
 
 func (b *Bot) statusg(msg interface{}) {
-	log.Println("Bot (G)", fmt.Sprintf("%v", msg))
+	logStatus(levelInfo, "bot", "", "Bot (G)", msg)
 }
 
 func (b *Bot) statusr(msg interface{}) {
-	log.Println("Bot (R)", fmt.Sprintf("%v", msg))
+	logStatus(levelError, "bot", "", "Bot (R)", msg)
 }
 
 type Coin struct {
@@ -77,67 +375,286 @@ type Coin struct {
 	tokenBondingCurve      solana.PublicKey
 	associatedBondingCurve solana.PublicKey
 	eventAuthority         solana.PublicKey
+	programID              solana.PublicKey // launchpad program the coin was created on, see `mintProgramIDs`
+
+	// metadata the coin was created with. createArgCreator is the creator the create's data names, which
+	// newer creates append after the uri (zero for creates without it), see decodeCreateCreatorArg
+	name             string
+	symbol           string
+	uri              string
+	createArgCreator solana.PublicKey
+	createSignature  solana.Signature // of the launch tx
+	createSlot       uint64           // slot the launch tx landed in, 0 if unknown
 
 	creator            solana.PublicKey
 	creatorATA         solana.PublicKey
+	creatorATASource   string // why creatorATA is the account we watch, see resolveCreatorTokenAccount
 	creatorPurchased   bool
 	creatorPurchaseSol float64 // actual solana amount of buy, not lamports
 
+	justInTimeFunded  bool // creator received SOL in the launch tx, before `Create`
+	coordinatedLaunch bool // wallets sharing a funder with the creator bought in the create's block
+
+	creatorTokenBalance uint64 // last known token balance of creatorATA
+	creatorPeakBalance  uint64 // most tokens we've seen creatorATA hold, used to size creator sells
+	creatorBalanceKnown bool   // whether creatorTokenBalance has been set yet. all three under pendingCoinsLock once pending
+
 	// our values related to the coin once we buy / decide to buy, and afterwards
-	creatorSold  bool // has creator sold?
-	botPurchased bool // separate bool.
+	creatorSold  bool   // has creator sold?
+	graduated    bool   // has a Raydium pool been created for the coin?
+	migrating    bool   // has pump withdrawn the curve's liquidity for migration? pump sells can't fill after
+	exitReason   string // why we decided to sell, empty until an exit is triggered
+	botPurchased bool   // separate bool.
+
+	exitedBuyCoin         bool   // trigger to notify that we have finished all buy ops
+	exitedSellCoin        bool   // trigger to notify that we have exited sell code routine
+	exitedCreatorListener bool   // trigger to notify that we stopped listening to creator sell
+	listenerState         string // how the creator listener is doing, see listenerActive & co. under pendingCoinsLock
+	walletListenerState   string // same for the creator wallet listener, empty unless `watchCreatorWallet`
 
-	exitedBuyCoin         bool // trigger to notify that we have finished all buy ops
-	exitedSellCoin        bool // trigger to notify that we have exited sell code routine
-	exitedCreatorListener bool // trigger to notify that we stopped listening to creator sell
+	// cancelBuy aborts BuyCoin before it sends once the creator sells, nil outside it. under pendingCoinsLock
+	cancelBuy context.CancelCauseFunc
 
 	isSellingCoin bool // lets program know that we are already in the process of selling coin to avoid dup sell
 
+	// verifyingSold is set while verifySold checks our token account is empty, soldVerified once it was.
+	// a coin we bought is only deleted once verified, under pendingCoinsLock
+	verifyingSold bool
+	soldVerified  bool
+
 	associatedTokenAccount solana.PublicKey // our wallet's ata for this coin
 	tokensHeld             *big.Int
 
-	buyPrice                uint64
-	buyTransactionSignature *solana.Signature
+	positionOpen             bool          // our buy reached `buyAccountingCommitment`, see openPosition
+	positionSettled          chan struct{} // closed once openPosition decided positionOpen
+	buyPrice                 uint64
+	buySolUSD                float64 // SOL/USD price when the buy went through, 0 if unknown
+	buyTransactionSignature  *solana.Signature
+	sellTransactionSignature *solana.Signature  // first sell which confirmed, see recordRoundTrip
+	partialSellSignatures    []solana.Signature // sells of part of the position before it closed, under pendingCoinsLock
+
+	// trades receives every trade on the coin's bonding curve while WatchTrades runs, closed once it stops
+	trades     chan *TradeEvent
+	stopTrades context.CancelFunc
+
+	// cancelled once the coin is removed from pendingCoins, every per-coin goroutine exits on it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sellChecks wakes the coin's manageSellForCoin whenever one of its exits may have changed, see signalSellCheck
+	sellChecks chan struct{}
+
+	// flow is the buy / sell flow of others on the curve since our entry, recorded off the trade tape
+	flow TradeFlow
+	// curve is the bonding curve after the latest trade on the trade tape, nil until one arrives.
+	// curveUpdatedAt is when (unix nanos) it was last stored, see updateCurve
+	curve          atomic.Pointer[BondingCurveData]
+	curveUpdatedAt atomic.Int64
+	// prices is the curve after each of the latest trades since our entry, see priceHistoryLength
+	prices PriceHistory
+
+	// where the coin is in `strategyPreset`, and the entry price (lamports per token) it's measured from
+	strategyStage atomic.Int32
+	entryPrice    atomic.Pointer[big.Rat]
+
+	rejectReason  string  // why shouldBuyCoin passed on this coin
+	evalCurveFill float64 // how far (percent) the curve was toward migration when shouldBuyCoin checked it
+}
+
+// reject records why we passed on a coin, always returning false
+// so checks can `return coin.reject(...)`
+func (c *Coin) reject(reason string) bool {
+	c.rejectReason = reason
+	return false
 }
 
 func (c *Coin) status(msg interface{}) {
-	log.Println(c.mintAddr.String(), fmt.Sprintf("%v", msg))
+	mint := c.mintAddr.String()
+	logStatus(levelInfo, "coin", mint, mint, msg)
 }
 
 func proxiedClient(endpoint string) jsonrpc.RPCClient {
 	u, _ := url.Parse(proxyURL)
 	opts := &jsonrpc.RPCClientOpts{
 		HTTPClient: &http.Client{
-			Transport: &http.Transport{
+			Transport: withHeaders(&http.Transport{
 				Proxy: http.ProxyURL(u),
-			},
+			}, rpcHeaders),
 		},
 	}
 
 	return jsonrpc.NewClientWithOpts(endpoint, opts)
 }
 
-// NewBot creates a new bot struct that we use to buy & sell coins
-func NewBot(rpcURL, wsURL, privateKey string, dbConnection *sql.DB, buySol float64, feeMicroLamport uint64) (*Bot, error) {
-	var rpcClient *rpc.Client
-	var jrpcClient rpc.JSONRPCClient
+// headerClient is a client of `endpoint` sending `headers` with every request
+func headerClient(endpoint string, headers http.Header) jsonrpc.RPCClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	opts := &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{Transport: withHeaders(transport, headers)},
+	}
 
+	return jsonrpc.NewClientWithOpts(endpoint, opts)
+}
+
+// newRPCClients creates the clients we use to query our main RPC, proxied if configured
+// and sending `rpcHeaders` (e.g. an API key) if any are set
+func newRPCClients(rpcURL string) (*rpc.Client, rpc.JSONRPCClient) {
 	if shouldProxy {
-		rpcClient = rpc.NewWithCustomRPCClient(proxiedClient(rpcURL))
-		jrpcClient = proxiedClient(rpcURL)
-	} else {
-		rpcClient = rpc.New(rpcURL)
-		jrpcClient = rpc.NewWithRateLimit(rpcURL, 500)
+		return rpc.NewWithCustomRPCClient(proxiedClient(rpcURL)), proxiedClient(rpcURL)
 	}
 
-	wsClient, err := ws.Connect(context.Background(), wsURL)
+	if len(rpcHeaders) > 0 {
+		return rpc.NewWithCustomRPCClient(headerClient(rpcURL, rpcHeaders)), newRateLimitedClient(headerClient(rpcURL, rpcHeaders), 500)
+	}
+
+	return rpc.New(rpcURL), rpc.NewWithRateLimit(rpcURL, 500)
+}
+
+// headerTransport adds `headers` to every request sent through `base`, so secrets like API keys
+// don't have to be embedded in the RPC url
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// withHeaders wraps `base` to send `headers`, or returns it as is without any
+func withHeaders(base http.RoundTripper, headers http.Header) http.RoundTripper {
+	if len(headers) == 0 {
+		return base
+	}
+
+	return &headerTransport{base: base, headers: headers}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// parseRPCHeaders parses headers given as `Name: value` pairs separated by `;`,
+// e.g. `x-api-key: abc; Authorization: Bearer xyz`
+func parseRPCHeaders(s string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(pair, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !found || name == "" {
+			return nil, fmt.Errorf("%w: %q", errMalformedRPCHeader, strings.TrimSpace(pair))
+		}
+
+		headers.Add(name, value)
+	}
+
+	return headers, nil
+}
+
+// rateLimitedClient is what rpc.NewWithRateLimit builds, around a client of our own
+type rateLimitedClient struct {
+	rpc.JSONRPCClient
+	limiter ratelimit.Limiter
+}
+
+func newRateLimitedClient(client rpc.JSONRPCClient, rps int) *rateLimitedClient {
+	return &rateLimitedClient{JSONRPCClient: client, limiter: ratelimit.New(rps)}
+}
+
+func (c *rateLimitedClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	c.limiter.Take()
+	return c.JSONRPCClient.CallForInto(ctx, out, method, params)
+}
+
+func (c *rateLimitedClient) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	c.limiter.Take()
+	return c.JSONRPCClient.CallWithCallback(ctx, method, params, callback)
+}
+
+func (c *rateLimitedClient) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	c.limiter.Take()
+	return c.JSONRPCClient.CallBatch(ctx, requests)
+}
+
+// newBaseBot creates a bot with our default settings, but without any clients
+// or wallet attached. NewBot (and offline tools like replay) fill in the rest
+func newBaseBot() *Bot {
+	return &Bot{
+		pendingCoins:     make(map[string]*Coin),
+		pendingCoinsLock: sync.Mutex{},
+		coinsToBuy:       make(chan *Coin),
+		coinsToSell:      make(chan string),
+
+		pipelineDepthWarning: 5,
+		maxQueueAge:          3 * time.Second,
+
+		buyMode: buyModeSolAmount,
+
+		ataConfirmDelay: 500 * time.Millisecond,
+
+		bondingCurveRetries:    3,
+		bondingCurveRetryDelay: 100 * time.Millisecond,
+
+		tipOnBuy:  true,
+		tipOnSell: true,
+
+		sellComputeUnitLimits:     100000,
+		jitoSellComputeUnitLimits: 80000,
+
+		sellRounds: 3,
+
+		maxTradeTapes:      20,
+		priceHistoryLength: 256,
+
+		checkMintTokenomics: true,
+
+		maxExternalSolBeforeEntry: 0.1,
+
+		requireCreatorBuy:  true,
+		requireOlderFunder: true,
+		funderLookbackSigs: 30,
+
+		coordinatedBuyLookbackSigs: 20,
+
+		creatorAtaLookbackSigs: 3,
+		creatorTxCheckAttempts: 10,
+		creatorTxCheckInterval: 200 * time.Millisecond,
+		creatorTxFetchTimeout:  900 * time.Millisecond,
+		creatorDustSellShare:   0.05,
+
+		creatorSellDropThreshold: 0.5,
+		creatorMetaSellThreshold: 0.1,
+
+		recordCreatorStats:       true,
+		recordTrades:             true,
+		buyAccountingCommitment:  rpc.CommitmentConfirmed,
+		deadListenerAction:       deadListenerExit,
+		creatorMaxRugRate:        0.5,
+		creatorMinMedianSellTime: time.Minute,
+
+		creatorWalletInflowSol:  1,
+		creatorWalletDrainedSol: 0.01,
+	}
+}
+
+// NewBot creates a new bot struct that we use to buy & sell coins
+func NewBot(rpcURL, wsURL, privateKey string, store Store, buySol float64, feeMicroLamport uint64) (*Bot, error) {
+	rpcClient, jrpcClient := newRPCClients(rpcURL)
+
+	wsPool, err := newWsPool(context.Background(), wsURL, wsConnections)
 	if err != nil {
 		fmt.Println("ws connection err", err)
 		return nil, err
 	}
 
-	if dbConnection == nil {
-		return nil, errDBConnectionNil
+	if store == nil {
+		return nil, errStoreNil
 	}
 
 	botPrivKey, err := solana.PrivateKeyFromBase58(privateKey)
@@ -147,34 +664,32 @@ func NewBot(rpcURL, wsURL, privateKey string, dbConnection *sql.DB, buySol float
 
 	buySolToLamport := buySol * float64(solana.LAMPORTS_PER_SOL)
 
-	jitoManager, err := newJitoManager(rpcClient, botPrivKey)
+	jitoManager, err := newJitoManager(rpcClient, wsPool, botPrivKey)
 	if err != nil {
 		return nil, err
 	}
 
-	var sendTxClients []*rpc.Client
-	for _, txRPC := range sendTxRPCs {
-		sendTxClients = append(sendTxClients, rpc.New(txRPC))
+	var sendTxClients []sendTxClient
+	for i, txRPC := range sendTxRPCs {
+		sendTxClients = append(sendTxClients, sendTxClient{Client: rpc.New(txRPC), endpoint: rpcEndpointLabel(i, txRPC)})
 	}
 
-	b := &Bot{
-		rpcClient:     rpcClient,
-		jrpcClient:    jrpcClient,
-		wsClient:      wsClient,
-		sendTxClients: sendTxClients,
+	b := newBaseBot()
+	b.rpcClient = rpcClient
+	b.jrpcClient = jrpcClient
+	b.wsPool = wsPool
+	b.sendTxClients = sendTxClients
 
-		privateKey:       botPrivKey,
-		dbConnection:     dbConnection,
-		buyAmountLamport: uint64(buySolToLamport),
-		feeMicroLamport:  feeMicroLamport,
+	b.privateKey = botPrivKey
+	b.store = store
+	if err := b.refreshGlobalParams(); err != nil {
+		b.statusr("Failed to fetch pump params, using the default fee recipient: " + err.Error())
+	}
 
-		jitoManager: jitoManager,
+	b.buyAmountLamport = uint64(buySolToLamport)
+	b.feeMicroLamport = feeMicroLamport
 
-		pendingCoins:     make(map[string]*Coin),
-		pendingCoinsLock: sync.Mutex{},
-		coinsToBuy:       make(chan *Coin),
-		coinsToSell:      make(chan string),
-	}
+	b.jitoManager = jitoManager
 
 	b.fetchBlockhashLoop()
 	return b, nil
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCClientsSendHeaders(t *testing.T) {
+	var lock sync.Mutex
+	var received []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		received = append(received, r.Header.Clone())
+		lock.Unlock()
+
+		var req struct {
+			ID interface{} `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": 42})
+	}))
+	defer server.Close()
+
+	headers, err := parseRPCHeaders("x-api-key: secret; Authorization: Bearer token:with:colons")
+	require.NoError(t, err)
+
+	previous := rpcHeaders
+	rpcHeaders = headers
+	t.Cleanup(func() { rpcHeaders = previous })
+
+	rpcClient, jrpcClient := newRPCClients(server.URL)
+
+	slot, err := rpcClient.GetSlot(context.Background(), rpc.CommitmentConfirmed)
+	require.NoError(t, err)
+	require.EqualValues(t, 42, slot)
+
+	var out uint64
+	require.NoError(t, jrpcClient.CallForInto(context.Background(), &out, "getSlot", nil))
+	require.EqualValues(t, 42, out)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, received, 2)
+	for _, header := range received {
+		require.Equal(t, "secret", header.Get("X-Api-Key"))
+		require.Equal(t, "Bearer token:with:colons", header.Get("Authorization"))
+	}
+}
+
+func TestParseRPCHeaders(t *testing.T) {
+	headers, err := parseRPCHeaders("")
+	require.NoError(t, err)
+	require.Empty(t, headers)
+
+	headers, err = parseRPCHeaders(" x-api-key : abc ;")
+	require.NoError(t, err)
+	require.Equal(t, http.Header{"X-Api-Key": {"abc"}}, headers)
+
+	_, err = parseRPCHeaders("x-api-key abc")
+	require.ErrorIs(t, err, errMalformedRPCHeader)
+}
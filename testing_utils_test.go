@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/searcher_client"
+	jitoutil "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/pkg"
+	jitoproto "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/proto"
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// mockRPCHandler returns the `result` for a single JSON-RPC call
+type mockRPCHandler func(params []json.RawMessage) (interface{}, error)
+
+type mockRPCRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      interface{}       `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type mockRPCResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      interface{}   `json:"id"`
+	Result  interface{}   `json:"result"`
+	Error   *mockRPCError `json:"error,omitempty"`
+}
+
+type mockRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mockRPC is a tiny JSON-RPC server used to stand in for a solana RPC node.
+// handlers are keyed by method name, and every call is recorded so tests
+// can assert on what the bot sent
+type mockRPC struct {
+	server *httptest.Server
+
+	lock     sync.Mutex
+	handlers map[string]mockRPCHandler
+	calls    []mockRPCRequest
+}
+
+func newMockRPC(t *testing.T) *mockRPC {
+	m := &mockRPC{handlers: make(map[string]mockRPCHandler)}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockRPC) handle(method string, handler mockRPCHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.handlers[method] = handler
+}
+
+func (m *mockRPC) client() *rpc.Client {
+	return rpc.New(m.server.URL)
+}
+
+func (m *mockRPC) jsonrpcClient() rpc.JSONRPCClient {
+	return jsonrpc.NewClient(m.server.URL)
+}
+
+// callsTo returns all recorded calls to `method`
+func (m *mockRPC) callsTo(method string) []mockRPCRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var calls []mockRPCRequest
+	for _, call := range m.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+func (m *mockRPC) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// batch requests arrive as a JSON array
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []mockRPCRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resps := make([]mockRPCResponse, len(reqs))
+		for i, req := range reqs {
+			resps[i] = m.call(req)
+		}
+
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+
+	var req mockRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(m.call(req))
+}
+
+func (m *mockRPC) call(req mockRPCRequest) mockRPCResponse {
+	m.lock.Lock()
+	m.calls = append(m.calls, req)
+	handler, ok := m.handlers[req.Method]
+	m.lock.Unlock()
+
+	resp := mockRPCResponse{JSONRPC: "2.0", ID: req.ID}
+	if !ok {
+		resp.Error = &mockRPCError{Code: -32601, Message: "method not found: " + req.Method}
+		return resp
+	}
+
+	result, err := handler(req.Params)
+	if err != nil {
+		resp.Error = &mockRPCError{Code: -32000, Message: err.Error()}
+		return resp
+	}
+
+	resp.Result = result
+	return resp
+}
+
+// launchFixture holds the accounts of a fake pump.fun launch, derived the
+// same way the pump program derives them
+type launchFixture struct {
+	creator                solana.PublicKey
+	mint                   solana.PublicKey
+	bondingCurve           solana.PublicKey
+	associatedBondingCurve solana.PublicKey
+	creatorATA             solana.PublicKey
+	eventAuthority         solana.PublicKey
+}
+
+func newLaunchFixture(t *testing.T) *launchFixture {
+	f := &launchFixture{
+		creator: solana.NewWallet().PublicKey(),
+		mint:    solana.NewWallet().PublicKey(),
+	}
+
+	var err error
+	f.bondingCurve, _, err = solana.FindProgramAddress([][]byte{[]byte("bonding-curve"), f.mint.Bytes()}, pumpProgramID)
+	require.NoError(t, err)
+
+	f.associatedBondingCurve, _, err = solana.FindAssociatedTokenAddress(f.bondingCurve, f.mint)
+	require.NoError(t, err)
+
+	f.creatorATA, _, err = solana.FindAssociatedTokenAddress(f.creator, f.mint)
+	require.NoError(t, err)
+
+	f.eventAuthority, _, err = solana.FindProgramAddress([][]byte{[]byte("__event_authority")}, pumpProgramID)
+	require.NoError(t, err)
+
+	return f
+}
+
+func (f *launchFixture) createInst() solana.Instruction {
+	return pump.NewCreateInstruction(
+		"Test Coin",
+		"TEST",
+		"https://example.com/test.json",
+		f.mint,
+		solana.NewWallet().PublicKey(),
+		f.bondingCurve,
+		f.associatedBondingCurve,
+		globalAddr,
+		solana.TokenMetadataProgramID,
+		solana.NewWallet().PublicKey(),
+		f.creator,
+		solana.SystemProgramID,
+		solana.TokenProgramID,
+		solana.SPLAssociatedTokenAccountProgramID,
+		rent,
+		f.eventAuthority,
+		pumpProgramID,
+	).Build()
+}
+
+func (f *launchFixture) buyInst(tokens, maxSolCost uint64) solana.Instruction {
+	return pump.NewBuyInstruction(
+		tokens,
+		maxSolCost,
+		globalAddr,
+		feeRecipient,
+		f.mint,
+		f.bondingCurve,
+		f.associatedBondingCurve,
+		f.creatorATA,
+		f.creator,
+		solana.SystemProgramID,
+		solana.TokenProgramID,
+		rent,
+		f.eventAuthority,
+		pumpProgramID,
+	).Build()
+}
+
+// newTestTx builds an unsigned transaction paid by `payer`
+func newTestTx(t *testing.T, payer solana.PublicKey, instructions ...solana.Instruction) *solana.Transaction {
+	tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(payer))
+	require.NoError(t, err)
+
+	return tx
+}
+
+// jupiterProgramID is used to route fixture sells through an aggregator
+var jupiterProgramID = solana.MustPublicKeyFromBase58("JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4")
+
+// compileInner compiles `inst` against the account keys of `tx`, as it would appear in the
+// meta's inner instructions. all accounts of `inst` must already be in the tx
+func compileInner(t *testing.T, tx *solana.Transaction, inst solana.Instruction) solana.CompiledInstruction {
+	indexOf := func(key solana.PublicKey) uint16 {
+		for i, accountKey := range tx.Message.AccountKeys {
+			if accountKey.Equals(key) {
+				return uint16(i)
+			}
+		}
+
+		t.Fatalf("account %s not in tx", key)
+		return 0
+	}
+
+	data, err := inst.Data()
+	require.NoError(t, err)
+
+	compiled := solana.CompiledInstruction{ProgramIDIndex: indexOf(inst.ProgramID()), Data: data}
+	for _, account := range inst.Accounts() {
+		compiled.Accounts = append(compiled.Accounts, indexOf(account.PublicKey))
+	}
+
+	return compiled
+}
+
+// tokenBalance builds a meta token balance for the account at `index` of a tx
+func tokenBalance(index uint16, mint, owner solana.PublicKey, amount uint64) rpc.TokenBalance {
+	return rpc.TokenBalance{
+		AccountIndex:  index,
+		Owner:         &owner,
+		Mint:          mint,
+		UiTokenAmount: &rpc.UiTokenAmount{Amount: strconv.FormatUint(amount, 10), Decimals: 6},
+	}
+}
+
+// aggregatorSellPair builds the creator ATA tx of a creator selling `preAmount - postAmount` tokens
+// through an aggregator. the only top-level instruction belongs to the aggregator, and tokens leave
+// the creator ATA through an inner TransferChecked (which detectTransfer doesn't decode)
+func aggregatorSellPair(t *testing.T, f *launchFixture, preAmount, postAmount uint64) instPair {
+	route := solana.NewInstruction(jupiterProgramID, solana.AccountMetaSlice{
+		solana.Meta(f.creator).SIGNER().WRITE(),
+		solana.Meta(f.creatorATA).WRITE(),
+		solana.Meta(f.associatedBondingCurve).WRITE(),
+		solana.Meta(f.mint),
+		solana.Meta(solana.TokenProgramID),
+		solana.Meta(pumpProgramID),
+	}, []byte{0xe5, 0x17, 0xcb, 0x97, 0x7a, 0xe3, 0xad, 0x2a})
+
+	tx := newTestTx(t, f.creator, route)
+
+	transfer := token.NewTransferCheckedInstruction(preAmount-postAmount, 6, f.creatorATA, f.mint, f.associatedBondingCurve, f.creator, nil).Build()
+
+	var creatorATAIndex uint16
+	for i, key := range tx.Message.AccountKeys {
+		if key.Equals(f.creatorATA) {
+			creatorATAIndex = uint16(i)
+		}
+	}
+
+	meta := &rpc.TransactionMeta{
+		InnerInstructions: []rpc.InnerInstruction{{Index: 0, Instructions: []solana.CompiledInstruction{compileInner(t, tx, transfer)}}},
+		PreTokenBalances:  []rpc.TokenBalance{tokenBalance(creatorATAIndex, f.mint, f.creator, preAmount)},
+		PostTokenBalances: []rpc.TokenBalance{tokenBalance(creatorATAIndex, f.mint, f.creator, postAmount)},
+	}
+
+	return instPair{tx: tx, meta: meta, insts: decodeInstructions(tx)}
+}
+
+// fakeSearcher stands in for jito's searcher service, only serving tip accounts
+type fakeSearcher struct {
+	jitoproto.SearcherServiceClient
+	tipAccounts []string
+}
+
+func (f *fakeSearcher) GetTipAccounts(ctx context.Context, in *jitoproto.GetTipAccountsRequest, opts ...grpc.CallOption) (*jitoproto.GetTipAccountsResponse, error) {
+	return &jitoproto.GetTipAccountsResponse{Accounts: f.tipAccounts}, nil
+}
+
+// newTestJitoManager returns a JitoManager whose current slot leader is (or isn't) running jito,
+// tipping to `tipAccount`
+func newTestJitoManager(t *testing.T, jitoLeader bool, tipAccount solana.PublicKey) *JitoManager {
+	leader := solana.NewWallet().PublicKey()
+	vote := solana.NewWallet().PublicKey()
+
+	return &JitoManager{
+		privateKey: solana.NewWallet().PrivateKey,
+		jitoClient: &searcher_client.Client{
+			SearcherService: &fakeSearcher{tipAccounts: []string{tipAccount.String()}},
+			Auth:            &jitoutil.AuthenticationService{GrpcCtx: context.Background()},
+		},
+
+		currentSlot:         100,
+		slotLeader:          map[uint64]string{100: leader.String()},
+		voteAccounts:        map[string]string{leader.String(): vote.String()},
+		jitoValidators:      map[string]bool{vote.String(): jitoLeader},
+		validatorsFetchedAt: time.Now(),
+		minTipLamports:      100000,
+
+		lock: &sync.Mutex{},
+	}
+}
+
+// checkCoinsToSell runs checkCoinToSell on every pending coin once, returning the coins to sell, like a
+// pass over all the coins' sell checks
+func checkCoinsToSell(b *Bot) []*Coin {
+	b.pendingCoinsLock.Lock()
+	defer b.pendingCoinsLock.Unlock()
+
+	var coinsToSell []*Coin
+	for _, coin := range b.pendingCoins {
+		if sell, _ := b.checkCoinToSell(coin); sell {
+			coinsToSell = append(coinsToSell, coin)
+		}
+	}
+
+	return coinsToSell
+}
+
+// memoryStoreWithCreators is a memoryStore in which each of `creators` has created a coin before
+func memoryStoreWithCreators(creators ...string) *memoryStore {
+	s := newMemoryStore()
+	for _, creator := range creators {
+		s.RecordCoins([]*CreatedCoin{{Mint: solana.NewWallet().PublicKey().String(), Creator: creator}})
+	}
+
+	return s
+}
+
+// createdCoins is every coin the store remembers, oldest first
+func (s *memoryStore) createdCoins() []*CreatedCoin {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*CreatedCoin(nil), s.coinOrder...)
+}
+
+// recordingStore is a memoryStore keeping the trades & legs recorded, which memoryStore only logs
+type recordingStore struct {
+	*memoryStore
+
+	lock   sync.Mutex
+	trades []*AtomicBuySell
+	legs   []*TradeLeg
+}
+
+func newRecordingStore() *recordingStore {
+	return &recordingStore{memoryStore: newMemoryStore()}
+}
+
+func (s *recordingStore) RecordTrade(trade *AtomicBuySell) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.trades = append(s.trades, trade)
+	return nil
+}
+
+func (s *recordingStore) RecordTradeLeg(leg *TradeLeg) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.legs = append(s.legs, leg)
+	return nil
+}
+
+// TradeSummary nets out the legs of every mint with a sell leg, recorded legs carry no time
+func (s *recordingStore) TradeSummary(wallet string, since time.Time) (*TradeSummary, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pnls := make(map[string]int64)
+	sold := make(map[string]bool)
+	for _, leg := range s.legs {
+		if leg.Wallet != wallet {
+			continue
+		}
+
+		pnls[leg.Mint] += int64(leg.LamportsReceived) - int64(leg.LamportsSpent+leg.FeeLamports+leg.TipLamports)
+		sold[leg.Mint] = sold[leg.Mint] || leg.Side == tradeSideSell
+	}
+
+	var closed []int64
+	for mint, pnl := range pnls {
+		if sold[mint] {
+			closed = append(closed, pnl)
+		}
+	}
+
+	return summarizePositions(closed), nil
+}
+
+// loadTxFixture reads a getTransaction result from testdata. create-tx.json & rug-tx.json are built by hand
+// in the shape mainnet returns, not recorded; `--record-tx` records a real tx to swap in
+func loadTxFixture(t *testing.T, name string) json.RawMessage {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	return json.RawMessage(data)
+}
+
+// decodeTxFixture loads a getTransaction result from testdata and decodes its transaction
+func decodeTxFixture(t *testing.T, name string) (*rpc.GetTransactionResult, *solana.Transaction) {
+	var result rpc.GetTransactionResult
+	require.NoError(t, json.Unmarshal(loadTxFixture(t, name), &result))
+
+	tx, err := result.Transaction.GetTransaction()
+	require.NoError(t, err)
+
+	return &result, tx
+}
+
+// txResult wraps `tx` the way getTransaction returns it, with an empty meta
+func txResult(t *testing.T, tx *solana.Transaction) map[string]interface{} {
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	return map[string]interface{}{
+		"slot":        1,
+		"transaction": []string{base64.StdEncoding.EncodeToString(data), "base64"},
+		"meta":        map[string]interface{}{"err": nil, "fee": 5000, "preBalances": []uint64{}, "postBalances": []uint64{}},
+	}
+}
+
+// mockWSHandler returns the notification results pushed to a new subscription
+type mockWSHandler func(params []json.RawMessage) []interface{}
+
+// mockWS is a tiny solana websocket server. subscribing to a handled method gets a
+// subscription id back, followed by whatever notifications the handler returns
+type mockWS struct {
+	server *httptest.Server
+
+	lock     sync.Mutex
+	handlers map[string]mockWSHandler
+	nextID   uint64
+	conns    []*websocket.Conn
+}
+
+func newMockWS(t *testing.T) *mockWS {
+	m := &mockWS{handlers: make(map[string]mockWSHandler)}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveWS))
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockWS) handle(method string, handler mockWSHandler) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.handlers[method] = handler
+}
+
+func (m *mockWS) url() string {
+	return "ws" + strings.TrimPrefix(m.server.URL, "http")
+}
+
+func (m *mockWS) client(t *testing.T) *ws.Client {
+	client, err := ws.Connect(context.Background(), m.url())
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+// dropConnections closes every connection made so far, failing all of their subscriptions
+func (m *mockWS) dropConnections() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+}
+
+func (m *mockWS) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	m.lock.Lock()
+	m.conns = append(m.conns, conn)
+	m.lock.Unlock()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// request ids are random uint64s, which float64 can't hold
+		var req mockRPCRequest
+		decoder := json.NewDecoder(bytes.NewReader(message))
+		decoder.UseNumber()
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+
+		m.lock.Lock()
+		handler, ok := m.handlers[req.Method]
+		m.nextID++
+		subID := m.nextID
+		m.lock.Unlock()
+
+		// unsubscribes and unknown methods go unanswered
+		if !ok {
+			continue
+		}
+
+		if err := conn.WriteJSON(mockRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: subID}); err != nil {
+			return
+		}
+
+		notification := strings.TrimSuffix(req.Method, "Subscribe") + "Notification"
+		for _, result := range handler(req.Params) {
+			if err := conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  notification,
+				"params":  map[string]interface{}{"result": result, "subscription": subID},
+			}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/clients/searcher_client"
 	util "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/pkg"
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
@@ -20,6 +23,19 @@ type validatorAPIResponse struct {
 	Validators []*jitoValidator `json:"validators"`
 }
 
+const (
+	jitoValidatorsFetchAttempts = 3
+	// refreshed every 10 minutes, so anything older means multiple refreshes have failed
+	jitoValidatorsMaxAge = 30 * time.Minute
+
+	// when the slot subscription is down we poll epoch info about once a slot, retrying the
+	// subscription every `slotSubscribeRetryInterval`
+	slotPollInterval           = 400 * time.Millisecond
+	slotSubscribeRetryInterval = time.Minute
+)
+
+var errNoWSClient = errors.New("No WS Client")
+
 type jitoValidator struct {
 	VoteAccount string `json:"vote_account"`
 	RunningJito bool   `json:"running_jito"`
@@ -31,16 +47,27 @@ type jitoValidator struct {
 type JitoManager struct {
 	client    *http.Client
 	rpcClient *rpc.Client
+	wsPool    *WsPool
 
 	privateKey solana.PrivateKey
 
-	slotIndex uint64
-	epoch     uint64
+	// currentSlot is the latest absolute slot we have observed
+	currentSlot    uint64
+	epoch          uint64
+	epochFirstSlot uint64
+	slotsInEpoch   uint64
+
+	// scheduleEpoch is the epoch our slotLeader map was built for
+	scheduleEpoch uint64
 
 	// jitoValidators is a map of validator IDs that are running Jito.
 	jitoValidators map[string]bool
+	// validatorsURL is the endpoint we fetch jito validators from
+	validatorsURL string
+	// validatorsFetchedAt is when jitoValidators was last successfully refreshed
+	validatorsFetchedAt time.Time
 
-	// slotLeader maps slot to validator ID.
+	// slotLeader maps absolute slot to validator ID.
 	slotLeader map[uint64]string
 
 	// voteAccounts maps nodeAccount to voteAccount
@@ -49,27 +76,32 @@ type JitoManager struct {
 	lock *sync.Mutex
 
 	// tipInfo maps the latest tip information from Jito.
-	tipInfo    *util.TipStreamInfo
-	jitoClient *searcher_client.Client
+	tipInfo *util.TipStreamInfo
+	// minTipLamports is the smallest tip we will ever send
+	minTipLamports uint64
+
+	// jitoClient is replaced by ensureSearcherClient once its connection drops, read it through
+	// searcherClient. cancelClient closes its connection
+	clientLock   sync.Mutex
+	jitoClient   *searcher_client.Client
+	cancelClient context.CancelFunc
+
+	// failed reconnects back off until nextReconnectAt, returning lastReconnectErr meanwhile.
+	// dialSearcher replaces dialSearcherClient when set
+	reconnectBackoff time.Duration
+	nextReconnectAt  time.Time
+	lastReconnectErr error
+	dialSearcher     func() (*searcher_client.Client, context.CancelFunc, error)
 }
 
-func newJitoManager(rpcClient *rpc.Client, privateKey solana.PrivateKey) (*JitoManager, error) {
-	jitoClient, err := searcher_client.New(
-		context.Background(),
-		jito_go.NewYork.BlockEngineURL,
-		rpcClient,
-		rpcClient,
-		privateKey,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
+func newJitoManager(rpcClient *rpc.Client, wsPool *WsPool, privateKey solana.PrivateKey) (*JitoManager, error) {
+	j := &JitoManager{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		rpcClient: rpcClient,
+		wsPool:    wsPool,
 
-	return &JitoManager{
-		client:     &http.Client{},
-		rpcClient:  rpcClient,
-		jitoClient: jitoClient,
+		validatorsURL:  jitoValidatorsURL,
+		minTipLamports: minTipLamports,
 
 		jitoValidators: make(map[string]bool),
 		slotLeader:     make(map[uint64]string),
@@ -78,21 +110,69 @@ func newJitoManager(rpcClient *rpc.Client, privateKey solana.PrivateKey) (*JitoM
 		lock: &sync.Mutex{},
 
 		privateKey: privateKey,
-	}, nil
+	}
+
+	jitoClient, cancel, err := j.dialSearcherClient()
+	if err != nil {
+		return nil, err
+	}
+
+	j.jitoClient, j.cancelClient = jitoClient, cancel
+	return j, nil
 }
 
 func (j *JitoManager) status(msg string) {
-	log.Println("Jito Manager", msg)
+	logStatus(levelInfo, "jito", "", "Jito Manager", msg)
 }
 
 func (j *JitoManager) statusr(msg string) {
-	log.Println("Jito Manager (R)", msg)
+	logStatus(levelError, "jito", "", "Jito Manager (R)", msg)
 }
 
 func (j *JitoManager) generateTipInstruction() (solana.Instruction, error) {
 	tipAmount := j.generateTipAmount()
 	j.status(fmt.Sprintf("Generating tip instruction for %.5f SOL", float64(tipAmount)/1e9))
-	return j.jitoClient.GenerateTipRandomAccountInstruction(tipAmount, j.privateKey.PublicKey())
+	return j.searcherClient().GenerateTipRandomAccountInstruction(tipAmount, j.privateKey.PublicKey())
+}
+
+// addJitoTip appends a jito tip to `instructions` if tipping is enabled for this side of the trade and
+// the current leader runs jito. returns the new instructions & whether the tx should be sent through jito
+func (b *Bot) addJitoTip(coin *Coin, instructions []solana.Instruction, tipEnabled bool) ([]solana.Instruction, bool) {
+	if !tipEnabled || !b.jitoManager.isJitoLeader() {
+		return instructions, false
+	}
+
+	coin.status("Jito leader, setting tip & removing priority fee inst")
+	tipInst, err := b.jitoManager.generateTipInstruction()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instructions = append(instructions, tipInst)
+
+	// IMPORTANT: remove priority fee when we jito tip
+	return instructions[1:], true
+}
+
+// jitoTipLamports is how many lamports `wallet` tipped in a tx, through transfers to jito's tip accounts
+func jitoTipLamports(tx *solana.Transaction, wallet solana.PublicKey) uint64 {
+	var tipped uint64
+	for _, inst := range decodeInstructions(tx) {
+		if inst.system == nil {
+			continue
+		}
+
+		transfer, ok := inst.system.Impl.(*system.Transfer)
+		if !ok || transfer.Lamports == nil || !transfer.GetFundingAccount().PublicKey.Equals(wallet) {
+			continue
+		}
+
+		if slices.Contains(jito_go.MainnetTipAccounts, transfer.GetRecipientAccount().PublicKey) {
+			tipped += *transfer.Lamports
+		}
+	}
+
+	return tipped
 }
 
 func (j *JitoManager) generateTipAmount() uint64 {
@@ -100,7 +180,13 @@ func (j *JitoManager) generateTipAmount() uint64 {
 		return 2000000
 	}
 
-	return uint64(j.tipInfo.LandedTips75ThPercentile * 1e9)
+	// quiet periods can drive the percentile close to 0, which won't land
+	tipAmount := uint64(j.tipInfo.LandedTips75ThPercentile * 1e9)
+	if tipAmount < j.minTipLamports {
+		return j.minTipLamports
+	}
+
+	return tipAmount
 }
 
 func (j *JitoManager) manageTipStream() {
@@ -131,7 +217,7 @@ func (j *JitoManager) subscribeTipStream() error {
 }
 
 func (j *JitoManager) start() error {
-	if j.jitoClient == nil {
+	if j.searcherClient() == nil {
 		return nil
 	}
 
@@ -141,42 +227,31 @@ func (j *JitoManager) start() error {
 		return err
 	}
 
-	if err := j.fetchLeaderSchedule(); err != nil {
-		return err
-	}
-
 	if err := j.fetchVoteAccounts(); err != nil {
 		return err
 	}
 
+	// fetchEpochInfo also builds the leader schedule for the current epoch
 	if err := j.fetchEpochInfo(); err != nil {
 		return err
 	}
 
-	go func() {
-		for {
-			if err := j.fetchEpochInfo(); err != nil {
-				fmt.Println("Failed to fetch epoch info: ", err)
-			}
-
-			time.Sleep(10 * time.Millisecond)
-		}
-	}()
+	go j.trackSlots()
 
 	go func() {
 		for {
-			if err := j.fetchLeaderSchedule(); err != nil {
-				fmt.Println("Failed to fetch epoch info: ", err)
-			}
-
 			time.Sleep(10 * time.Minute)
+
+			if err := j.refreshLeaderSchedule(); err != nil {
+				fmt.Println("Failed to fetch leader schedule: ", err)
+			}
 		}
 	}()
 
 	go func() {
 		for {
 			if err := j.fetchJitoValidators(); err != nil {
-				fmt.Println("Failed to fetch epoch info: ", err)
+				fmt.Println("Failed to fetch jito validators: ", err)
 			}
 
 			time.Sleep(10 * time.Minute)
@@ -196,44 +271,72 @@ func (j *JitoManager) start() error {
 	return nil
 }
 
+// slot is the latest absolute slot we have observed
+func (j *JitoManager) slot() uint64 {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.currentSlot
+}
+
 func (j *JitoManager) isJitoLeader() bool {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
-	validator, ok := j.slotLeader[j.slotIndex]
+	validator, ok := j.slotLeader[j.currentSlot]
 	if !ok {
 		return false
 	}
 
+	if age := time.Since(j.validatorsFetchedAt); age > jitoValidatorsMaxAge {
+		j.statusr(fmt.Sprintf("Jito validator list is stale (age=%s)", age.Round(time.Second)))
+	}
+
 	j.status("Checking if validator is a Jito leader: " + validator)
 	isLeader := j.jitoValidators[j.voteAccounts[validator]]
 
 	return isLeader
 }
 
-func (j *JitoManager) fetchLeaderSchedule() error {
-	j.status("Fetching leader schedule")
+// fetchLeaderSchedule fetches the leader schedule of the epoch starting at `epochFirstSlot`.
+// the RPC returns slots relative to the start of the epoch, so we key the schedule by absolute slot
+func (j *JitoManager) fetchLeaderSchedule(epoch, epochFirstSlot uint64) error {
+	j.status(fmt.Sprintf("Fetching leader schedule (epoch=%d)", epoch))
 
-	scheduleResult, err := j.rpcClient.GetLeaderSchedule(context.Background())
+	scheduleResult, err := j.rpcClient.GetLeaderScheduleWithOpts(context.Background(), &rpc.GetLeaderScheduleOpts{
+		Epoch: &epochFirstSlot,
+	})
 	if err != nil {
 		return err
 	}
 
-	j.buildLeaderSchedule(&scheduleResult)
+	j.buildLeaderSchedule(&scheduleResult, epoch, epochFirstSlot)
 
 	return nil
 }
 
-func (j *JitoManager) buildLeaderSchedule(scheduleResult *rpc.GetLeaderScheduleResult) {
+// refreshLeaderSchedule re-fetches the schedule for the epoch we are currently in
+func (j *JitoManager) refreshLeaderSchedule() error {
+	j.lock.Lock()
+	epoch := j.epoch
+	epochFirstSlot := j.epochFirstSlot
+	j.lock.Unlock()
+
+	return j.fetchLeaderSchedule(epoch, epochFirstSlot)
+}
+
+func (j *JitoManager) buildLeaderSchedule(scheduleResult *rpc.GetLeaderScheduleResult, epoch, epochFirstSlot uint64) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
 	j.slotLeader = make(map[uint64]string)
 	for validator, slots := range *scheduleResult {
-		for _, slot := range slots {
-			j.slotLeader[slot] = validator.String()
+		for _, slotIndex := range slots {
+			j.slotLeader[epochFirstSlot+slotIndex] = validator.String()
 		}
 	}
+
+	j.scheduleEpoch = epoch
 }
 
 func (j *JitoManager) fetchVoteAccounts() error {
@@ -259,60 +362,173 @@ func (j *JitoManager) buildVoteAccounts(voteAccounts []rpc.VoteAccountsResult) {
 }
 
 func (j *JitoManager) fetchEpochInfo() error {
-	schedule, err := j.rpcClient.GetEpochInfo(context.Background(), rpc.CommitmentFinalized)
+	epochInfo, err := j.rpcClient.GetEpochInfo(context.Background(), rpc.CommitmentFinalized)
 	if err != nil {
 		return err
 	}
 
-	j.slotIndex = schedule.SlotIndex
-	if j.epoch != schedule.Epoch {
-		if err = j.fetchLeaderSchedule(); err != nil {
-			return err
-		}
+	epochFirstSlot := epochInfo.AbsoluteSlot - epochInfo.SlotIndex
+
+	j.lock.Lock()
+	j.currentSlot = epochInfo.AbsoluteSlot
+	j.epoch = epochInfo.Epoch
+	j.epochFirstSlot = epochFirstSlot
+	j.slotsInEpoch = epochInfo.SlotsInEpoch
+	scheduleStale := len(j.slotLeader) == 0 || j.scheduleEpoch != epochInfo.Epoch
+	j.lock.Unlock()
+
+	// immediately swap in the new epoch's schedule on rollover, otherwise we
+	// would look up slots against the previous epoch's leaders
+	if scheduleStale {
+		return j.fetchLeaderSchedule(epochInfo.Epoch, epochFirstSlot)
+	}
+
+	return nil
+}
+
+// fetchEpochInfoWithCache moves us to `slot` using the epoch boundaries from the last fetchEpochInfo,
+// working out rollovers into the next epoch ourselves. only calls fetchEpochInfo if the slot is outside
+// the cached epoch & the one after it, and only fetches the leader schedule when the epoch changes
+func (j *JitoManager) fetchEpochInfoWithCache(slot uint64) error {
+	j.lock.Lock()
+
+	epoch := j.epoch
+	epochFirstSlot := j.epochFirstSlot
+	slotsInEpoch := j.slotsInEpoch
+
+	if slotsInEpoch == 0 || slot < epochFirstSlot || slot >= epochFirstSlot+2*slotsInEpoch {
+		j.lock.Unlock()
+		return j.fetchEpochInfo()
+	}
 
-		j.epoch = schedule.Epoch
+	if slot >= epochFirstSlot+slotsInEpoch {
+		epoch++
+		epochFirstSlot += slotsInEpoch
+	}
+
+	j.currentSlot = slot
+	j.epoch = epoch
+	j.epochFirstSlot = epochFirstSlot
+	scheduleStale := len(j.slotLeader) == 0 || j.scheduleEpoch != epoch
+	j.lock.Unlock()
+
+	if scheduleStale {
+		return j.fetchLeaderSchedule(epoch, epochFirstSlot)
 	}
 
 	return nil
 }
 
+// trackSlots keeps currentSlot up to date from a slot subscription. while the subscription
+// is down, we fall back to polling fetchEpochInfo every `slotPollInterval`
+func (j *JitoManager) trackSlots() {
+	for {
+		if err := j.subscribeSlots(); err != nil {
+			j.statusr("Slot subscription failed, polling epoch info: " + err.Error())
+		}
+
+		deadline := time.Now().Add(slotSubscribeRetryInterval)
+		for time.Now().Before(deadline) {
+			if err := j.fetchEpochInfo(); err != nil {
+				fmt.Println("Failed to fetch epoch info: ", err)
+			}
+
+			time.Sleep(slotPollInterval)
+		}
+	}
+}
+
+// subscribeSlots applies every slot update to currentSlot, returning when the subscription fails
+func (j *JitoManager) subscribeSlots() error {
+	if j.wsPool == nil {
+		return errNoWSClient
+	}
+
+	conn := j.wsPool.assign()
+	client := j.wsPool.client(conn)
+
+	sub, err := client.SlotSubscribe()
+	if err != nil {
+		return err
+	}
+
+	defer sub.Unsubscribe()
+
+	for {
+		slot, err := sub.Recv()
+		if err != nil {
+			// redial the dropped connection, so we resubscribe on a live one
+			if _, err := j.wsPool.reconnect(conn, client); err != nil {
+				fmt.Println("Failed to reconnect websocket: ", err)
+			}
+
+			return err
+		}
+
+		if err := j.fetchEpochInfoWithCache(slot.Slot); err != nil {
+			fmt.Println("Failed to update slot: ", err)
+		}
+	}
+}
+
 // fetchJitoValidators fetches the list of validators from the Jito network.
+// on failure we keep serving the previously fetched validators
 func (j *JitoManager) fetchJitoValidators() error {
 	j.status("Fetching jito-enabled validators")
 
-	req, err := http.NewRequest("GET", "https://kobe.mainnet.jito.network/api/v1/validators", nil)
+	var err error
+	for attempt := 0; attempt < jitoValidatorsFetchAttempts; attempt++ {
+		if attempt > 0 {
+			// back off 1s, 2s, ... between attempts
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		var validators []*jitoValidator
+		validators, err = j.requestJitoValidators()
+		if err != nil {
+			j.statusr(fmt.Sprintf("Failed to fetch jito validators (attempt %d): %s", attempt+1, err))
+			continue
+		}
+
+		j.buildJitoValidators(validators)
+		return nil
+	}
+
+	return err
+}
+
+func (j *JitoManager) requestJitoValidators() ([]*jitoValidator, error) {
+	req, err := http.NewRequest("GET", j.validatorsURL, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("accept", "application/json")
 
 	resp, err := j.client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to fetch validators: %s", resp.Status)
+		return nil, fmt.Errorf("failed to fetch validators: %s", resp.Status)
 	}
 
 	var validators validatorAPIResponse
-	err = json.NewDecoder(resp.Body).Decode(&validators)
-	if err != nil {
-		return err
+	if err = json.NewDecoder(resp.Body).Decode(&validators); err != nil {
+		return nil, err
 	}
 
-	j.buildJitoValidators(validators.Validators)
-
-	return nil
+	return validators.Validators, nil
 }
 
 func (j *JitoManager) buildJitoValidators(validators []*jitoValidator) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 	j.jitoValidators = make(map[string]bool)
+	j.validatorsFetchedAt = time.Now()
 
 	for i := range validators {
 		if validators[i].RunningJito {
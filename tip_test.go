@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	util "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go/pkg"
+	"github.com/gagliardetto/solana-go"
+	cb "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJitoLeaderAcrossEpochRollover(t *testing.T) {
+	jitoLeader := solana.NewWallet().PublicKey()
+	vanillaLeader := solana.NewWallet().PublicKey()
+	jitoVote := solana.NewWallet().PublicKey()
+	vanillaVote := solana.NewWallet().PublicKey()
+
+	// epoch 10 starts at slot 1000, epoch 11 at slot 2000. both schedules use the
+	// same relative slot indices but with the leaders swapped
+	schedules := map[uint64]map[string][]uint64{
+		1000: {jitoLeader.String(): {0, 1, 2, 3}, vanillaLeader.String(): {4, 5, 6, 7}},
+		2000: {vanillaLeader.String(): {0, 1, 2, 3}, jitoLeader.String(): {4, 5, 6, 7}},
+	}
+
+	var epochInfo map[string]interface{}
+
+	mock := newMockRPC(t)
+	mock.handle("getEpochInfo", func(params []json.RawMessage) (interface{}, error) {
+		return epochInfo, nil
+	})
+	mock.handle("getLeaderSchedule", func(params []json.RawMessage) (interface{}, error) {
+		var firstSlot uint64
+		if err := json.Unmarshal(params[0], &firstSlot); err != nil {
+			return nil, err
+		}
+
+		return schedules[firstSlot], nil
+	})
+
+	j := &JitoManager{
+		rpcClient:      mock.client(),
+		lock:           &sync.Mutex{},
+		jitoValidators: map[string]bool{jitoVote.String(): true},
+		slotLeader:     make(map[uint64]string),
+		voteAccounts: map[string]string{
+			jitoLeader.String():    jitoVote.String(),
+			vanillaLeader.String(): vanillaVote.String(),
+		},
+	}
+
+	setSlot := func(epoch, absoluteSlot, slotIndex uint64) {
+		epochInfo = map[string]interface{}{
+			"absoluteSlot": absoluteSlot,
+			"epoch":        epoch,
+			"slotIndex":    slotIndex,
+			"slotsInEpoch": 1000,
+		}
+		require.NoError(t, j.fetchEpochInfo())
+	}
+
+	setSlot(10, 1002, 2)
+	require.True(t, j.isJitoLeader())
+
+	setSlot(10, 1005, 5)
+	require.False(t, j.isJitoLeader())
+	require.Len(t, mock.callsTo("getLeaderSchedule"), 1)
+
+	// rollover: relative slot 1 of epoch 11 is led by the vanilla validator,
+	// even though relative slot 1 of epoch 10 was a jito leader
+	setSlot(11, 2001, 1)
+	require.False(t, j.isJitoLeader())
+	require.Len(t, mock.callsTo("getLeaderSchedule"), 2)
+
+	setSlot(11, 2006, 6)
+	require.True(t, j.isJitoLeader())
+
+	// slots outside the fetched schedule never report a leader
+	setSlot(11, 2999, 999)
+	require.False(t, j.isJitoLeader())
+}
+
+func TestFetchEpochInfoWithCache(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getEpochInfo", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"absoluteSlot": 1002, "epoch": 10, "slotIndex": 2, "slotsInEpoch": 1000}, nil
+	})
+	mock.handle("getLeaderSchedule", func(params []json.RawMessage) (interface{}, error) {
+		return map[string][]uint64{solana.NewWallet().PublicKey().String(): {0}}, nil
+	})
+
+	j := &JitoManager{rpcClient: mock.client(), lock: &sync.Mutex{}, slotLeader: make(map[uint64]string)}
+
+	// nothing cached yet, so the first slot falls back to getEpochInfo
+	require.NoError(t, j.fetchEpochInfoWithCache(1003))
+	require.Len(t, mock.callsTo("getEpochInfo"), 1)
+	require.Len(t, mock.callsTo("getLeaderSchedule"), 1)
+
+	// slots inside the cached epoch never hit the RPC
+	for slot := uint64(1004); slot < 1010; slot++ {
+		require.NoError(t, j.fetchEpochInfoWithCache(slot))
+	}
+	require.Equal(t, uint64(1009), j.currentSlot)
+	require.Len(t, mock.callsTo("getEpochInfo"), 1)
+	require.Len(t, mock.callsTo("getLeaderSchedule"), 1)
+
+	// rolling into the next epoch only fetches its schedule
+	require.NoError(t, j.fetchEpochInfoWithCache(2000))
+	require.Equal(t, uint64(11), j.epoch)
+	require.Equal(t, uint64(2000), j.epochFirstSlot)
+	require.Len(t, mock.callsTo("getEpochInfo"), 1)
+
+	calls := mock.callsTo("getLeaderSchedule")
+	require.Len(t, calls, 2)
+	require.JSONEq(t, "2000", string(calls[1].Params[0]))
+
+	// too far ahead to work out ourselves
+	require.NoError(t, j.fetchEpochInfoWithCache(5000))
+	require.Len(t, mock.callsTo("getEpochInfo"), 2)
+}
+
+func TestGenerateTipAmountFloor(t *testing.T) {
+	j := &JitoManager{minTipLamports: 100000}
+
+	// no tip stream yet
+	require.Equal(t, uint64(2000000), j.generateTipAmount())
+
+	j.tipInfo = &util.TipStreamInfo{LandedTips75ThPercentile: 0.000001}
+	require.Equal(t, uint64(100000), j.generateTipAmount())
+
+	j.tipInfo = &util.TipStreamInfo{LandedTips75ThPercentile: 0.001}
+	require.Equal(t, uint64(1000000), j.generateTipAmount())
+}
+
+func TestTipOnlyOnEnabledSide(t *testing.T) {
+	tipAccount := solana.NewWallet().PublicKey()
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey()}
+
+	b := &Bot{
+		jitoManager: newTestJitoManager(t, true, tipAccount),
+		tipOnBuy:    true,
+		tipOnSell:   false,
+	}
+
+	// priority fee, compute limit, trade
+	instructions := func() []solana.Instruction {
+		return []solana.Instruction{
+			cb.NewSetComputeUnitPriceInstruction(1).Build(),
+			cb.NewSetComputeUnitLimitInstruction(1).Build(),
+			system.NewTransferInstruction(1, solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()).Build(),
+		}
+	}
+
+	hasTip := func(insts []solana.Instruction) bool {
+		for _, inst := range insts {
+			for _, account := range inst.Accounts() {
+				if account.PublicKey.Equals(tipAccount) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	buyInsts, buyJito := b.addJitoTip(coin, instructions(), b.tipOnBuy)
+	require.True(t, buyJito)
+	require.True(t, hasTip(buyInsts))
+	require.Len(t, buyInsts, 3) // priority fee swapped for the tip
+
+	sellInsts, sellJito := b.addJitoTip(coin, instructions(), b.tipOnSell)
+	require.False(t, sellJito)
+	require.False(t, hasTip(sellInsts))
+	require.Len(t, sellInsts, 3)
+
+	// enabled side still goes vanilla when the leader isn't running jito
+	b.jitoManager = newTestJitoManager(t, false, tipAccount)
+	buyInsts, buyJito = b.addJitoTip(coin, instructions(), b.tipOnBuy)
+	require.False(t, buyJito)
+	require.False(t, hasTip(buyInsts))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// size of an SPL token mint account: mint authority option (4) & key (32), supply (8),
+	// decimals (1), is initialized (1), freeze authority option (4) & key (32)
+	splMintSize = 82
+
+	// every pump coin has 6 decimals
+	pumpTokenDecimals = 6
+
+	// token 2022 pads a mint with extensions to a token account's size (165), then stores the account type (1 for
+	// a mint) and the extensions as type (u16) / length (u16) / value entries
+	token2022AccountTypeOffset = 165
+	token2022AccountTypeMint   = 1
+	token2022TransferFeeConfig = 1
+
+	// TransferFeeConfig: config & withdraw authorities (32 each), withheld amount (8), then the older & newer
+	// fees as epoch (8), maximum fee (8) & basis points (2)
+	transferFeeConfigSize    = 108
+	olderTransferFeeBpsStart = 88
+	newerTransferFeeBpsStart = 106
+)
+
+var (
+	errNotTokenMint      = errors.New("Account Isn't An SPL Token Mint")
+	errBadMintExtensions = errors.New("Malformed Token 2022 Mint Extensions")
+)
+
+// TokenomicsResult is a coin's mint account, with whether each part of it looks like a pump launch.
+// pump revokes both authorities in `Create`, so a mint which still has one isn't a plain pump coin
+type TokenomicsResult struct {
+	MintAuthority   *solana.PublicKey // nil once revoked
+	FreezeAuthority *solana.PublicKey // nil if never set
+	Supply          uint64
+	Decimals        uint8
+	IsInitialized   bool
+	Token2022       bool   // owned by token 2022, which our buys & sells don't support
+	TransferFeeBps  uint16 // token 2022 transfer fee, the higher of the current & scheduled ones
+	HasTransferFee  bool
+
+	MintAuthorityRevoked   bool // nobody can mint more tokens
+	FreezeAuthorityRevoked bool // nobody can freeze our token account
+	DecimalsValid          bool
+	SupplyValid            bool // exactly pump's total supply
+}
+
+// rejectReason is why the tokenomics fail our checks, empty if they pass
+func (r *TokenomicsResult) rejectReason() string {
+	switch {
+	case !r.IsInitialized:
+		return "mint not initialized"
+	case !r.MintAuthorityRevoked:
+		return "mint authority not revoked"
+	case !r.FreezeAuthorityRevoked:
+		return "freeze authority set"
+	case !r.DecimalsValid:
+		return fmt.Sprintf("unexpected decimals (%d)", r.Decimals)
+	case !r.SupplyValid:
+		return fmt.Sprintf("unexpected supply (%d)", r.Supply)
+	// our buys & sells only take SPL token accounts, so token 2022 mints are never bought, whatever their transfer fee
+	case r.Token2022:
+		return "token 2022 mint"
+	}
+
+	return ""
+}
+
+// validateTokenomics fetches a coin's mint account once, checking its authorities, decimals & supply,
+// and its transfer fee if it's a token 2022 mint
+func (b *Bot) validateTokenomics(ctx context.Context, mint solana.PublicKey) (*TokenomicsResult, error) {
+	accountInfo, err := b.rpcClient.GetAccountInfoWithOpts(ctx, mint, &rpc.GetAccountInfoOpts{Encoding: solana.EncodingBase64, Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mint account: %w", err)
+	}
+
+	data := accountInfo.Value.Data.GetBinary()
+	switch owner := accountInfo.Value.Owner; {
+	case owner.Equals(solana.TokenProgramID):
+		return b.checkTokenomics(data)
+	case owner.Equals(solana.Token2022ProgramID):
+		return b.checkToken2022Tokenomics(data)
+	default:
+		return nil, fmt.Errorf("%w: owned by %s", errNotTokenMint, owner)
+	}
+}
+
+// checkToken2022Tokenomics is checkTokenomics for a token 2022 mint, whose base layout is an SPL mint's
+// followed by its extensions
+func (b *Bot) checkToken2022Tokenomics(data []byte) (*TokenomicsResult, error) {
+	if len(data) < splMintSize {
+		return nil, fmt.Errorf("%w: %d bytes", errNotTokenMint, len(data))
+	}
+
+	result, err := b.checkTokenomics(data[:splMintSize])
+	if err != nil {
+		return nil, err
+	}
+
+	result.Token2022 = true
+	result.HasTransferFee, result.TransferFeeBps, err = parseTransferFeeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parseTransferFeeConfig finds the TransferFeeConfig extension of token 2022 mint account data, returning the
+// higher of its older & newer fees since the newer one takes over at an epoch we don't track
+func parseTransferFeeConfig(data []byte) (hasFee bool, feeBps uint16, err error) {
+	// a mint without extensions is just the base layout
+	if len(data) == splMintSize {
+		return false, 0, nil
+	}
+
+	if len(data) <= token2022AccountTypeOffset || data[token2022AccountTypeOffset] != token2022AccountTypeMint {
+		return false, 0, fmt.Errorf("%w: not a mint (%d bytes)", errBadMintExtensions, len(data))
+	}
+
+	for offset := token2022AccountTypeOffset + 1; offset+4 <= len(data); {
+		extensionType := binary.LittleEndian.Uint16(data[offset:])
+		length := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		value := data[offset+4:]
+		if length > len(value) {
+			return false, 0, fmt.Errorf("%w: extension %d overruns the account", errBadMintExtensions, extensionType)
+		}
+
+		if extensionType == token2022TransferFeeConfig {
+			if length < transferFeeConfigSize {
+				return false, 0, fmt.Errorf("%w: TransferFeeConfig is %d bytes", errBadMintExtensions, length)
+			}
+
+			older := binary.LittleEndian.Uint16(value[olderTransferFeeBpsStart:])
+			newer := binary.LittleEndian.Uint16(value[newerTransferFeeBpsStart:])
+			return true, max(older, newer), nil
+		}
+
+		offset += 4 + length
+	}
+
+	return false, 0, nil
+}
+
+// checkTokenomics decodes mint account data & checks it against pump's launch parameters
+func (b *Bot) checkTokenomics(data []byte) (*TokenomicsResult, error) {
+	if len(data) != splMintSize {
+		return nil, fmt.Errorf("%w: %d bytes", errNotTokenMint, len(data))
+	}
+
+	var mint token.Mint
+	if err := mint.UnmarshalWithDecoder(bin.NewBinDecoder(data)); err != nil {
+		return nil, fmt.Errorf("failed to decode mint account: %w", err)
+	}
+
+	return &TokenomicsResult{
+		MintAuthority:   mint.MintAuthority,
+		FreezeAuthority: mint.FreezeAuthority,
+		Supply:          mint.Supply,
+		Decimals:        mint.Decimals,
+		IsInitialized:   mint.IsInitialized,
+
+		MintAuthorityRevoked:   mint.MintAuthority == nil,
+		FreezeAuthorityRevoked: mint.FreezeAuthority == nil,
+		DecimalsValid:          mint.Decimals == pumpTokenDecimals,
+		SupplyValid:            mint.Supply == b.currentTokenTotalSupply(),
+	}, nil
+}
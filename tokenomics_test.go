@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/stretchr/testify/require"
+)
+
+// mintAccount is a getAccountInfo result holding `mint`, owned by the token program
+func mintAccount(t *testing.T, mint token.Mint) map[string]interface{} {
+	return ownedAccount(solana.TokenProgramID, encodeMint(t, mint))
+}
+
+// token2022MintAccount is a getAccountInfo result holding `mint` with a TransferFeeConfig charging `olderBps`
+// then `newerBps` (none if both are nil), owned by token 2022
+func token2022MintAccount(t *testing.T, mint token.Mint, olderBps, newerBps *uint16) map[string]interface{} {
+	data := encodeMint(t, mint)
+	if olderBps == nil && newerBps == nil {
+		return ownedAccount(solana.Token2022ProgramID, data)
+	}
+
+	data = append(data, make([]byte, token2022AccountTypeOffset-splMintSize)...)
+	data = append(data, token2022AccountTypeMint)
+
+	// an extension we don't care about comes first
+	data = binary.LittleEndian.AppendUint16(data, 3)
+	data = binary.LittleEndian.AppendUint16(data, 32)
+	data = append(data, make([]byte, 32)...)
+
+	config := make([]byte, transferFeeConfigSize)
+	if olderBps != nil {
+		binary.LittleEndian.PutUint16(config[olderTransferFeeBpsStart:], *olderBps)
+	}
+	if newerBps != nil {
+		binary.LittleEndian.PutUint16(config[newerTransferFeeBpsStart:], *newerBps)
+	}
+
+	data = binary.LittleEndian.AppendUint16(data, token2022TransferFeeConfig)
+	data = binary.LittleEndian.AppendUint16(data, transferFeeConfigSize)
+	data = append(data, config...)
+
+	return ownedAccount(solana.Token2022ProgramID, data)
+}
+
+func encodeMint(t *testing.T, mint token.Mint) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, mint.MarshalWithEncoder(bin.NewBinEncoder(&buf)))
+	require.Len(t, buf.Bytes(), splMintSize)
+	return buf.Bytes()
+}
+
+func ownedAccount(owner solana.PublicKey, data []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": 1},
+		"value": map[string]interface{}{
+			"lamports":   1,
+			"owner":      owner.String(),
+			"data":       []string{base64.StdEncoding.EncodeToString(data), "base64"},
+			"executable": false,
+			"rentEpoch":  0,
+		},
+	}
+}
+
+func pumpMint() token.Mint {
+	return token.Mint{Supply: tokenTotalSupply, Decimals: pumpTokenDecimals, IsInitialized: true}
+}
+
+func TestValidateTokenomics(t *testing.T) {
+	authority := solana.NewWallet().PublicKey()
+
+	tests := []struct {
+		name         string
+		mint         func(mint *token.Mint)
+		rejectReason string
+	}{
+		{name: "pump launch", mint: func(mint *token.Mint) {}},
+		{name: "mint authority kept", mint: func(mint *token.Mint) { mint.MintAuthority = &authority }, rejectReason: "mint authority not revoked"},
+		{name: "freeze authority set", mint: func(mint *token.Mint) { mint.FreezeAuthority = &authority }, rejectReason: "freeze authority set"},
+		{name: "9 decimals", mint: func(mint *token.Mint) { mint.Decimals = 9 }, rejectReason: "unexpected decimals (9)"},
+		{name: "extra supply", mint: func(mint *token.Mint) { mint.Supply++ }, rejectReason: "unexpected supply (1000000000000001)"},
+		{name: "uninitialized", mint: func(mint *token.Mint) { mint.IsInitialized = false }, rejectReason: "mint not initialized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mint := pumpMint()
+			tt.mint(&mint)
+
+			mock := newMockRPC(t)
+			mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+				return mintAccount(t, mint), nil
+			})
+
+			b := &Bot{rpcClient: mock.client()}
+			result, err := b.validateTokenomics(context.Background(), solana.NewWallet().PublicKey())
+			require.NoError(t, err)
+			require.Equal(t, tt.rejectReason, result.rejectReason())
+			require.Len(t, mock.callsTo("getAccountInfo"), 1)
+		})
+	}
+}
+
+func TestValidateTokenomicsRejectsOtherAccounts(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return bondingCurveAccount(t, curveAfterCreatorBuy(0)), nil
+	})
+
+	b := &Bot{rpcClient: mock.client()}
+	_, err := b.validateTokenomics(context.Background(), solana.NewWallet().PublicKey())
+	require.ErrorIs(t, err, errNotTokenMint)
+
+	_, err = b.checkTokenomics(make([]byte, splMintSize-1))
+	require.ErrorIs(t, err, errNotTokenMint)
+}
+
+func TestValidateTokenomicsToken2022(t *testing.T) {
+	bps := func(bps uint16) *uint16 { return &bps }
+
+	tests := []struct {
+		name     string
+		olderBps *uint16
+		newerBps *uint16
+		hasFee   bool
+		feeBps   uint16
+	}{
+		{name: "no extensions"},
+		{name: "zero fee", olderBps: bps(0), newerBps: bps(0), hasFee: true},
+		{name: "fee", olderBps: bps(250), newerBps: bps(250), hasFee: true, feeBps: 250},
+		{name: "fee scheduled", olderBps: bps(0), newerBps: bps(1000), hasFee: true, feeBps: 1000},
+		{name: "fee lowered", olderBps: bps(500), newerBps: bps(10), hasFee: true, feeBps: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockRPC(t)
+			mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+				return token2022MintAccount(t, pumpMint(), tt.olderBps, tt.newerBps), nil
+			})
+
+			b := &Bot{rpcClient: mock.client()}
+			result, err := b.validateTokenomics(context.Background(), solana.NewWallet().PublicKey())
+			require.NoError(t, err)
+			require.True(t, result.Token2022)
+			require.Equal(t, tt.hasFee, result.HasTransferFee)
+			require.Equal(t, tt.feeBps, result.TransferFeeBps)
+			require.Equal(t, "token 2022 mint", result.rejectReason())
+		})
+	}
+
+	// an extension running past the account's end
+	data := append(encodeMint(t, pumpMint()), make([]byte, token2022AccountTypeOffset-splMintSize)...)
+	data = append(data, token2022AccountTypeMint, token2022TransferFeeConfig, 0, transferFeeConfigSize, 0)
+	_, _, err := parseTransferFeeConfig(data)
+	require.ErrorIs(t, err, errBadMintExtensions)
+}
+
+func TestShouldBuyCoinChecksTokenomics(t *testing.T) {
+	coin := fixtureCoin(t)
+	mock := newFunderMockRPC(t, coin.creator, solana.NewWallet().PublicKey())
+
+	authority := solana.NewWallet().PublicKey()
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		mint := pumpMint()
+		mint.FreezeAuthority = &authority
+		return mintAccount(t, mint), nil
+	})
+
+	b := &Bot{
+		rpcClient:           mock.client(),
+		jrpcClient:          mock.jsonrpcClient(),
+		funderLookbackSigs:  30,
+		store:               newMemoryStore(),
+		checkMintTokenomics: true,
+
+		creatorMaxRugRate:        0.5,
+		creatorMinMedianSellTime: time.Minute,
+	}
+
+	require.False(t, b.shouldBuyCoin(coin))
+	require.Equal(t, "freeze authority set", coin.rejectReason)
+
+	// the funders are never looked up
+	require.Empty(t, mock.callsTo("getSignaturesForAddress"))
+}
+
+func TestShouldBuyCoinRejectsToken2022(t *testing.T) {
+	coin := fixtureCoin(t)
+	mock := newFunderMockRPC(t, coin.creator, solana.NewWallet().PublicKey())
+
+	fee := uint16(100)
+	mock.handle("getAccountInfo", func(params []json.RawMessage) (interface{}, error) {
+		return token2022MintAccount(t, pumpMint(), &fee, &fee), nil
+	})
+
+	b := &Bot{
+		rpcClient:           mock.client(),
+		jrpcClient:          mock.jsonrpcClient(),
+		funderLookbackSigs:  30,
+		store:               newMemoryStore(),
+		checkMintTokenomics: true,
+
+		creatorMaxRugRate:        0.5,
+		creatorMinMedianSellTime: time.Minute,
+	}
+
+	require.False(t, b.shouldBuyCoin(coin))
+	require.Equal(t, "token 2022 mint", coin.rejectReason)
+}
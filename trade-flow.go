@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const (
+	// trades older than this are dropped from the tape windowed flow is computed over
+	tradeFlowRetention = time.Minute
+
+	// how often a watched coin logs its flow
+	tradeFlowStatusInterval = 10 * time.Second
+)
+
+// TradeFlow is the buy / sell flow on a coin's curve since our entry, excluding our own trades.
+// safe for concurrent use, the trade tape records while sell strategies read
+type TradeFlow struct {
+	lock sync.Mutex
+
+	solIn, solOut   uint64 // lamports
+	buys, sells     int
+	buyers, sellers map[solana.PublicKey]bool
+
+	recent []flowTrade // trades within `tradeFlowRetention`, oldest first
+}
+
+type flowTrade struct {
+	at    time.Time
+	user  solana.PublicKey
+	sol   uint64
+	isBuy bool
+}
+
+// TradeFlowSnapshot is the flow over some period, see TradeFlow.total & TradeFlow.window
+type TradeFlowSnapshot struct {
+	SolIn         uint64 // lamports bought in
+	SolOut        uint64 // lamports sold out
+	Buys          int
+	Sells         int
+	UniqueBuyers  int
+	UniqueSellers int
+}
+
+// NetLamports is SOL bought in less SOL sold out, negative when sellers dominate
+func (s TradeFlowSnapshot) NetLamports() int64 {
+	return int64(s.SolIn) - int64(s.SolOut)
+}
+
+func (s TradeFlowSnapshot) String() string {
+	return fmt.Sprintf("in %.4f SOL (%d buys, %d buyers), out %.4f SOL (%d sells, %d sellers), net %+.4f SOL",
+		float64(s.SolIn)/float64(solana.LAMPORTS_PER_SOL), s.Buys, s.UniqueBuyers,
+		float64(s.SolOut)/float64(solana.LAMPORTS_PER_SOL), s.Sells, s.UniqueSellers,
+		float64(s.NetLamports())/float64(solana.LAMPORTS_PER_SOL),
+	)
+}
+
+// record adds a trade seen at `at`
+func (f *TradeFlow) record(event *TradeEvent, at time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.buyers == nil {
+		f.buyers = make(map[solana.PublicKey]bool)
+		f.sellers = make(map[solana.PublicKey]bool)
+	}
+
+	if event.IsBuy {
+		f.solIn += event.SolAmount
+		f.buys++
+		f.buyers[event.User] = true
+	} else {
+		f.solOut += event.SolAmount
+		f.sells++
+		f.sellers[event.User] = true
+	}
+
+	f.recent = append(f.recent, flowTrade{at: at, user: event.User, sol: event.SolAmount, isBuy: event.IsBuy})
+
+	// trades arrive roughly in order, so expired ones are at the front
+	expired := 0
+	for expired < len(f.recent) && at.Sub(f.recent[expired].at) > tradeFlowRetention {
+		expired++
+	}
+	f.recent = f.recent[expired:]
+}
+
+// total is the flow since our entry
+func (f *TradeFlow) total() TradeFlowSnapshot {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return TradeFlowSnapshot{
+		SolIn:         f.solIn,
+		SolOut:        f.solOut,
+		Buys:          f.buys,
+		Sells:         f.sells,
+		UniqueBuyers:  len(f.buyers),
+		UniqueSellers: len(f.sellers),
+	}
+}
+
+// window is the flow over the trades seen in the last `d` before `now`, at most `tradeFlowRetention`
+func (f *TradeFlow) window(d time.Duration, now time.Time) TradeFlowSnapshot {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var snapshot TradeFlowSnapshot
+	buyers := make(map[solana.PublicKey]bool)
+	sellers := make(map[solana.PublicKey]bool)
+
+	for _, trade := range f.recent {
+		if now.Sub(trade.at) > d {
+			continue
+		}
+
+		if trade.isBuy {
+			snapshot.SolIn += trade.sol
+			snapshot.Buys++
+			buyers[trade.user] = true
+		} else {
+			snapshot.SolOut += trade.sol
+			snapshot.Sells++
+			sellers[trade.user] = true
+		}
+	}
+
+	snapshot.UniqueBuyers, snapshot.UniqueSellers = len(buyers), len(sellers)
+	return snapshot
+}
+
+// recordTradeFlow counts a trade towards the coin's flow, skipping trades before our entry and our own
+func (b *Bot) recordTradeFlow(coin *Coin, event *TradeEvent) {
+	if !coin.botPurchased || b.isOwnTrade(coin, event) {
+		return
+	}
+
+	coin.flow.record(event, time.Now())
+}
+
+// isOwnTrade reports whether we sent `event`, by signer or by our buy / sell signature
+func (b *Bot) isOwnTrade(coin *Coin, event *TradeEvent) bool {
+	if event.User.Equals(b.privateKey.PublicKey()) {
+		return true
+	}
+
+	// our sells set their signature while the tape is still streaming
+	b.pendingCoinsLock.Lock()
+	sigs := []*solana.Signature{coin.buyTransactionSignature, coin.sellTransactionSignature}
+	b.pendingCoinsLock.Unlock()
+
+	for _, sig := range sigs {
+		if sig != nil && sig.Equals(event.Signature) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sellOnNetOutflow triggers an exit once more SOL was sold out of the coin than bought in over
+// the last `netOutflowExitWindow`. other exit triggers may fire first, the first reason is kept
+func (b *Bot) sellOnNetOutflow(coin *Coin) bool {
+	if b.netOutflowExitWindow <= 0 || !coin.botPurchased || !coin.botHoldsTokens() {
+		return false
+	}
+
+	flow := coin.flow.window(b.netOutflowExitWindow, time.Now())
+	if flow.NetLamports() >= 0 {
+		return false
+	}
+
+	b.status(fmt.Sprintf("Net outflow on %s over %s (%s), Marking to sell", coin.mintAddr.String(), b.netOutflowExitWindow, flow))
+	b.triggerExit(coin, exitReasonNetOutflow)
+	return true
+}
+
+// curveStatus describes how far the coin's curve is toward migration, as of the latest trade
+func curveStatus(coin *Coin) string {
+	curve := coin.curve.Load()
+	if curve == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(", curve %.1f%% to migration (complete=%t)", curve.Progress(), curve.Complete)
+}
+
+// reportTradeFlow logs the coin's flow (and whether its creator listener still protects it) every `tradeFlowStatusInterval` until ctx is done
+func (b *Bot) reportTradeFlow(ctx context.Context, coin *Coin) {
+	ticker := time.NewTicker(tradeFlowStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if coin.botPurchased {
+				coin.status(fmt.Sprintf("Flow since entry: %s, creator listener %s%s", coin.flow.total(), b.creatorListenerState(coin), curveStatus(coin)))
+			}
+		}
+	}
+}
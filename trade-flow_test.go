@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTradeFlow(t *testing.T) {
+	alice, bob := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	start := time.Now()
+
+	var flow TradeFlow
+	flow.record(&TradeEvent{User: alice, SolAmount: 300, IsBuy: true}, start)
+	flow.record(&TradeEvent{User: alice, SolAmount: 100, IsBuy: true}, start.Add(5*time.Second))
+	flow.record(&TradeEvent{User: bob, SolAmount: 250}, start.Add(8*time.Second))
+	flow.record(&TradeEvent{User: alice, SolAmount: 150}, start.Add(12*time.Second))
+
+	require.Equal(t, TradeFlowSnapshot{SolIn: 400, SolOut: 400, Buys: 2, Sells: 2, UniqueBuyers: 1, UniqueSellers: 2}, flow.total())
+
+	// the first buy falls out of the last 10 seconds, sellers now dominate
+	recent := flow.window(10*time.Second, start.Add(12*time.Second))
+	require.Equal(t, TradeFlowSnapshot{SolIn: 100, SolOut: 400, Buys: 1, Sells: 2, UniqueBuyers: 1, UniqueSellers: 2}, recent)
+	require.EqualValues(t, -300, recent.NetLamports())
+
+	// expired trades are dropped from the tape, but still count towards the total
+	flow.record(&TradeEvent{User: bob, SolAmount: 50, IsBuy: true}, start.Add(tradeFlowRetention+6*time.Second))
+	require.Len(t, flow.recent, 3)
+	require.Equal(t, 3, flow.total().Buys)
+}
+
+func TestRecordTradeFlowSkipsOwnTrades(t *testing.T) {
+	wallet := solana.NewWallet().PrivateKey
+	buySig := solana.Signature{1}
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), buyTransactionSignature: &buySig}
+	b := &Bot{privateKey: wallet}
+
+	// before our entry nothing counts
+	b.recordTradeFlow(coin, &TradeEvent{User: solana.NewWallet().PublicKey(), SolAmount: 10, IsBuy: true})
+	require.Zero(t, coin.flow.total().Buys)
+
+	coin.botPurchased = true
+	b.recordTradeFlow(coin, &TradeEvent{Signature: buySig, User: solana.NewWallet().PublicKey(), SolAmount: 10, IsBuy: true})
+	b.recordTradeFlow(coin, &TradeEvent{User: wallet.PublicKey(), SolAmount: 10})
+	b.recordTradeFlow(coin, &TradeEvent{User: solana.NewWallet().PublicKey(), SolAmount: 20, IsBuy: true})
+
+	require.Equal(t, TradeFlowSnapshot{SolIn: 20, Buys: 1, UniqueBuyers: 1}, coin.flow.total())
+}
+
+func TestSellOnNetOutflow(t *testing.T) {
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	b := &Bot{netOutflowExitWindow: 10 * time.Second, pendingCoins: map[string]*Coin{coin.mintAddr.String(): coin}}
+
+	coin.flow.record(&TradeEvent{User: solana.NewWallet().PublicKey(), SolAmount: 100, IsBuy: true}, time.Now())
+	require.False(t, b.sellOnNetOutflow(coin))
+
+	coin.flow.record(&TradeEvent{User: solana.NewWallet().PublicKey(), SolAmount: 150}, time.Now())
+	require.True(t, b.sellOnNetOutflow(coin))
+	require.Equal(t, exitReasonNetOutflow, coin.exitReason)
+}
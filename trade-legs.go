@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	tradeSideBuy  = "buy"
+	tradeSideSell = "sell"
+
+	// base fee of every signature a tx carries, anything the fee is above it went to priority
+	lamportsPerSignature = 5000
+)
+
+// TradeLeg is one of our buys or sells which landed, as stored in the trade_legs table. where the round trips in
+// `trades` net a position out, legs keep what every tx of it got us, cost us and how quickly it went through
+type TradeLeg struct {
+	Mint      string
+	Wallet    string
+	Side      string // tradeSideBuy or tradeSideSell
+	Signature string
+	Slot      uint64
+
+	// from the TradeEvents pump logged for our trades of the mint in the tx
+	TokenAmount uint64
+
+	// our wallet's lamport change over the tx, less the tx fee & tip, so pump's fee and any rent paid are in.
+	// from the TradeEvents' SOL amounts when the wallet's balances aren't in the tx meta
+	LamportsSpent    uint64 // buys
+	LamportsReceived uint64 // sells
+
+	FeeLamports         uint64 // the tx fee, base & priority
+	PriorityFeeLamports uint64 // part of FeeLamports above the base fee
+	TipLamports         uint64 // jito tip
+
+	SendPath   string // jito or vanilla, see sendRoute
+	ExitReason string // of the coin when a sell was sent, empty for buys
+
+	DetectToSend  time.Duration // from picking the coin up to sending, 0 for sells
+	SendToConfirm time.Duration
+}
+
+// TradeSummary sums up the positions we closed over a period, see summarizePositions
+type TradeSummary struct {
+	Positions   int
+	Wins        int
+	PnLLamports int64 // net of fees & tips
+}
+
+// WinRate is the share (0-1) of positions closed in profit, 0 without any
+func (s *TradeSummary) WinRate() float64 {
+	if s.Positions == 0 {
+		return 0
+	}
+
+	return float64(s.Wins) / float64(s.Positions)
+}
+
+// summarizePositions sums up the net P&L (lamports) of each position we closed
+func summarizePositions(pnls []int64) *TradeSummary {
+	summary := &TradeSummary{Positions: len(pnls)}
+	for _, pnl := range pnls {
+		summary.PnLLamports += pnl
+		if pnl > 0 {
+			summary.Wins++
+		}
+	}
+
+	return summary
+}
+
+// recordTradeLeg fetches one of our txs of the coin which landed, storing it as a leg of `side`. runs off the hot path
+func (b *Bot) recordTradeLeg(coin *Coin, side string, sig solana.Signature, detectToSend, sendToConfirm time.Duration) {
+	if !b.recordTrades || !b.positionCounts(coin) {
+		return
+	}
+
+	result, err := b.fetchConfirmedTxResult(sig)
+	if err != nil {
+		b.statusr(fmt.Sprintf("Failed to fetch %s leg %s of %s: %s", side, sig, coin.mintAddr.String(), err))
+		return
+	}
+
+	tx, err := result.Transaction.GetTransaction()
+	if err != nil {
+		b.statusr(fmt.Sprintf("Failed to decode %s leg %s of %s: %s", side, sig, coin.mintAddr.String(), err))
+		return
+	}
+
+	leg := tradeLegFromTx(coin.mintAddr, b.privateKey.PublicKey(), side, tx, result.Meta)
+	leg.Signature = sig.String()
+	leg.Slot = result.Slot
+	leg.DetectToSend = detectToSend
+	leg.SendToConfirm = sendToConfirm
+
+	if side == tradeSideSell {
+		b.pendingCoinsLock.Lock()
+		leg.ExitReason = coin.exitReason
+		b.pendingCoinsLock.Unlock()
+	}
+
+	if err := b.store.RecordTradeLeg(leg); err != nil {
+		b.statusr("Failed to record trade leg: " + err.Error())
+	}
+}
+
+// tradeLegFromTx builds the `side` leg of our (`wallet`) trade of `mint` in a landed tx, but for its signature & slot
+func tradeLegFromTx(mint, wallet solana.PublicKey, side string, tx *solana.Transaction, meta *rpc.TransactionMeta) *TradeLeg {
+	leg := &TradeLeg{
+		Mint:        mint.String(),
+		Wallet:      wallet.String(),
+		Side:        side,
+		FeeLamports: meta.Fee,
+		TipLamports: jitoTipLamports(tx, wallet),
+	}
+
+	if baseFee := lamportsPerSignature * uint64(tx.Message.Header.NumRequiredSignatures); meta.Fee > baseFee {
+		leg.PriorityFeeLamports = meta.Fee - baseFee
+	}
+
+	leg.SendPath = sendRoute(leg.TipLamports > 0)
+
+	for _, trade := range parseTradeEvents(meta.LogMessages) {
+		if !trade.Mint.Equals(mint) || !trade.User.Equals(wallet) || trade.IsBuy != (side == tradeSideBuy) {
+			continue
+		}
+
+		leg.TokenAmount += trade.TokenAmount
+		if trade.IsBuy {
+			leg.LamportsSpent += trade.SolAmount
+		} else {
+			leg.LamportsReceived += trade.SolAmount
+		}
+	}
+
+	// the events leave out pump's fee on buys & whatever else the tx moved, what the wallet lost or gained is what counts
+	if change, err := walletLamportsChange(tx, meta, wallet); err == nil {
+		change += int64(leg.FeeLamports + leg.TipLamports)
+		leg.LamportsSpent, leg.LamportsReceived = 0, 0
+
+		if side == tradeSideBuy && change < 0 {
+			leg.LamportsSpent = uint64(-change)
+		} else if side == tradeSideSell && change > 0 {
+			leg.LamportsReceived = uint64(change)
+		}
+	}
+
+	return leg
+}
+
+// fetchConfirmedTxResult fetches a tx at confirmed commitment, retrying while it isn't served yet
+func (b *Bot) fetchConfirmedTxResult(sig solana.Signature) (*rpc.GetTransactionResult, error) {
+	var err error
+	for attempt := 0; attempt < tradeTxFetchAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(tradeTxFetchDelay)
+		}
+
+		var result *rpc.GetTransactionResult
+		result, err = b.getTransaction(context.TODO(), sig, rpc.CommitmentConfirmed)
+		if err != nil {
+			continue
+		}
+
+		if result.Meta == nil {
+			return nil, fmt.Errorf("no meta for %s", sig)
+		}
+
+		return result, nil
+	}
+
+	return nil, err
+}
+
+// LogTradeSummary runs as goroutine, logging the positions we closed today (UTC), their win rate
+// and P&L from the trade legs every `tradeSummaryInterval`
+func (b *Bot) LogTradeSummary(ctx context.Context) {
+	ticker := time.NewTicker(b.tradeSummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.logTradeSummary(time.Now()); err != nil {
+			b.statusr("Failed to summarize trades: " + err.Error())
+		}
+	}
+}
+
+func (b *Bot) logTradeSummary(now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	summary, err := b.store.TradeSummary(b.privateKey.PublicKey().String(), today)
+	if err != nil {
+		return err
+	}
+
+	b.status(fmt.Sprintf("Today: %d positions closed, %d won (%.0f%%), P&L %s",
+		summary.Positions, summary.Wins, 100*summary.WinRate(), formatSol(summary.PnLLamports, b.solUSD())))
+	return nil
+}
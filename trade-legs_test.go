@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	jito_go "github.com/1fge/pump-fun-sniper-bot/pkg/jito-go"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTradeLegs(t *testing.T) {
+	wallet := solana.NewWallet().PrivateKey
+	mint := solana.NewWallet().PublicKey()
+	buySig, sellSig := solana.Signature{1}, solana.Signature{2}
+
+	// the buy is sent vanilla, the sell through jito
+	buyTx, err := solana.NewTransaction([]solana.Instruction{
+		system.NewTransferInstruction(1, wallet.PublicKey(), solana.NewWallet().PublicKey()).Build(),
+	}, solana.Hash{}, solana.TransactionPayer(wallet.PublicKey()))
+	require.NoError(t, err)
+
+	sellTx, err := solana.NewTransaction([]solana.Instruction{
+		system.NewTransferInstruction(100_000, wallet.PublicKey(), jito_go.MainnetTipAccounts[0]).Build(),
+	}, solana.Hash{}, solana.TransactionPayer(wallet.PublicKey()))
+	require.NoError(t, err)
+
+	other := solana.NewWallet().PublicKey()
+	logs := map[solana.Signature][]string{
+		buySig: pumpLogs(
+			tradeEventLog(&TradeEvent{Mint: mint, User: other, SolAmount: 7, TokenAmount: 7, IsBuy: true}),
+			tradeEventLog(&TradeEvent{Mint: mint, User: wallet.PublicKey(), SolAmount: 100_000_000, TokenAmount: 3_000_000_000, IsBuy: true}),
+		),
+		sellSig: pumpLogs(
+			tradeEventLog(&TradeEvent{Mint: mint, User: wallet.PublicKey(), SolAmount: 150_000_000, TokenAmount: 3_000_000_000}),
+		),
+	}
+
+	// the wallet pays pump's 1% fee on top of the buy's event amount, the sell's 1% comes out of its event amount
+	preBalances := []uint64{1_000_000_000, 0, 1}
+	postBalances := map[solana.Signature][]uint64{
+		buySig:  {1_000_000_000 - 101_000_000 - 25_000, 1, 1},
+		sellSig: {1_000_000_000 + 148_500_000 - 25_000 - 100_000, 100_000, 1},
+	}
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		var sig solana.Signature
+		require.NoError(t, json.Unmarshal(params[0], &sig))
+
+		tx := buyTx
+		if sig == sellSig {
+			tx = sellTx
+		}
+
+		result := txResult(t, tx)
+		result["slot"] = 42
+		result["meta"] = map[string]interface{}{
+			"err": nil, "fee": 25_000, "preBalances": preBalances, "postBalances": postBalances[sig], "logMessages": logs[sig],
+		}
+		return result, nil
+	})
+
+	store := newRecordingStore()
+	b := &Bot{rpcClient: mock.client(), privateKey: wallet, store: store, recordTrades: true}
+	coin := &Coin{mintAddr: mint, exitReason: exitReasonCreatorSold, positionOpen: true}
+
+	b.recordTradeLeg(coin, tradeSideBuy, buySig, 150*time.Millisecond, 800*time.Millisecond)
+	b.recordTradeLeg(coin, tradeSideSell, sellSig, 0, time.Second)
+
+	require.Equal(t, []*TradeLeg{
+		{
+			Mint:                mint.String(),
+			Wallet:              wallet.PublicKey().String(),
+			Side:                tradeSideBuy,
+			Signature:           buySig.String(),
+			Slot:                42,
+			TokenAmount:         3_000_000_000,
+			LamportsSpent:       101_000_000,
+			FeeLamports:         25_000,
+			PriorityFeeLamports: 20_000,
+			SendPath:            "vanilla",
+			DetectToSend:        150 * time.Millisecond,
+			SendToConfirm:       800 * time.Millisecond,
+		},
+		{
+			Mint:                mint.String(),
+			Wallet:              wallet.PublicKey().String(),
+			Side:                tradeSideSell,
+			Signature:           sellSig.String(),
+			Slot:                42,
+			TokenAmount:         3_000_000_000,
+			LamportsReceived:    148_500_000,
+			FeeLamports:         25_000,
+			PriorityFeeLamports: 20_000,
+			TipLamports:         100_000,
+			SendPath:            "jito",
+			ExitReason:          exitReasonCreatorSold,
+			SendToConfirm:       time.Second,
+		},
+	}, store.legs)
+
+	// a position still held isn't counted
+	store.legs = append(store.legs, &TradeLeg{Mint: "held", Wallet: wallet.PublicKey().String(), Side: tradeSideBuy, LamportsSpent: 1})
+
+	summary, err := store.TradeSummary(wallet.PublicKey().String(), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, &TradeSummary{Positions: 1, Wins: 1, PnLLamports: 47_350_000}, summary)
+	require.Equal(t, 1.0, summary.WinRate())
+}
+
+func TestSummarizePositions(t *testing.T) {
+	summary := summarizePositions([]int64{10, -30, 0, 5})
+	require.Equal(t, &TradeSummary{Positions: 4, Wins: 2, PnLLamports: -15}, summary)
+	require.Equal(t, 0.5, summary.WinRate())
+
+	require.Zero(t, summarizePositions(nil).WinRate())
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+const (
+	// trades waiting for the sell strategies of a coin, further trades are dropped
+	tradeTapeBufferSize = 64
+
+	// how many times in a row we try to resubscribe to a coin's trades after the subscription fails
+	tradeTapeResubscribeAttempts = 5
+)
+
+var errTradeEventTooShort = errors.New("Trade Event Too Short")
+
+// tradeEventDiscriminator prefixes every TradeEvent pump logs, per anchor's `event:<name>` convention
+var tradeEventDiscriminator = anchorEventDiscriminator("TradeEvent")
+
+// mint(32) + solAmount(8) + tokenAmount(8) + isBuy(1) + user(32) + timestamp(8) + virtualSolReserves(8) + virtualTokenReserves(8)
+const tradeEventSize = 105
+
+// TradeEvent is a buy or sell on a pump.fun bonding curve, decoded from the program's logs
+type TradeEvent struct {
+	Signature solana.Signature
+
+	Mint                 solana.PublicKey
+	User                 solana.PublicKey
+	SolAmount            uint64 // lamports
+	TokenAmount          uint64
+	IsBuy                bool
+	Timestamp            int64
+	VirtualSolReserves   uint64 // after the trade
+	VirtualTokenReserves uint64 // after the trade
+}
+
+func anchorEventDiscriminator(name string) [8]byte {
+	var discriminator [8]byte
+	hash := sha256.Sum256([]byte("event:" + name))
+	copy(discriminator[:], hash[:8])
+
+	return discriminator
+}
+
+// pumpOwnLogs returns the entries of a tx's logs which pump itself logged. any program invoked in the tx
+// can log pump-shaped lines, so the invoke stack is followed and only entries logged while pump is the
+// program executing are kept
+func pumpOwnLogs(logs []string) []string {
+	var stack []string
+	var entries []string
+
+	for _, logEntry := range logs {
+		// `Program <id> invoke [<depth>]`, then `Program <id> success` or `Program <id> failed: <err>`
+		fields := strings.Fields(logEntry)
+		if len(fields) >= 3 && fields[0] == "Program" {
+			switch {
+			case fields[2] == "invoke":
+				stack = append(stack, fields[1])
+				continue
+			case (fields[2] == "success" || strings.HasPrefix(fields[2], "failed")) && len(stack) > 0:
+				stack = stack[:len(stack)-1]
+				continue
+			}
+		}
+
+		if len(stack) > 0 && stack[len(stack)-1] == pumpProgramID.String() {
+			entries = append(entries, logEntry)
+		}
+	}
+
+	return entries
+}
+
+// pumpProgramData decodes the `Program data:` entries pump itself logged in a tx's logs, see pumpOwnLogs.
+// garbage is skipped
+func pumpProgramData(logs []string) [][]byte {
+	var entries [][]byte
+
+	for _, logEntry := range pumpOwnLogs(logs) {
+		encoded, ok := strings.CutPrefix(logEntry, "Program data: ")
+		if !ok {
+			continue
+		}
+
+		if data, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			entries = append(entries, data)
+		}
+	}
+
+	return entries
+}
+
+// parseTradeEvents decodes every TradeEvent pump logged in a tx's logs, see pumpProgramData
+func parseTradeEvents(logs []string) []*TradeEvent {
+	var events []*TradeEvent
+
+	for _, data := range pumpProgramData(logs) {
+		if len(data) < 8 || [8]byte(data[:8]) != tradeEventDiscriminator {
+			continue
+		}
+
+		event, err := decodeTradeEvent(data[8:])
+		if err != nil {
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func decodeTradeEvent(data []byte) (*TradeEvent, error) {
+	if len(data) < tradeEventSize {
+		return nil, errTradeEventTooShort
+	}
+
+	return &TradeEvent{
+		Mint:                 solana.PublicKeyFromBytes(data[0:32]),
+		SolAmount:            binary.LittleEndian.Uint64(data[32:40]),
+		TokenAmount:          binary.LittleEndian.Uint64(data[40:48]),
+		IsBuy:                data[48] == 1,
+		User:                 solana.PublicKeyFromBytes(data[49:81]),
+		Timestamp:            int64(binary.LittleEndian.Uint64(data[81:89])),
+		VirtualSolReserves:   binary.LittleEndian.Uint64(data[89:97]),
+		VirtualTokenReserves: binary.LittleEndian.Uint64(data[97:105]),
+	}, nil
+}
+
+// WatchTrades streams every trade on the coin's bonding curve to `coin.trades` while we hold it, for
+// sell strategies which need the full trade tape. At most `maxTradeTapes` coins are watched at once.
+// the subscription is retried if it fails, and stops once the coin is removed or we no longer hold it
+func (b *Bot) WatchTrades(coin *Coin) {
+	if active := b.activeTradeTapes.Add(1); active > int64(b.maxTradeTapes) {
+		b.activeTradeTapes.Add(-1)
+		coin.status(fmt.Sprintf("Not watching trades, already watching %d coins", b.maxTradeTapes))
+		return
+	}
+	defer b.activeTradeTapes.Add(-1)
+
+	ctx, cancel := context.WithCancel(coin.context())
+	defer cancel()
+
+	trades := make(chan *TradeEvent, tradeTapeBufferSize)
+	defer close(trades)
+
+	b.pendingCoinsLock.Lock()
+	coin.trades = trades
+	coin.stopTrades = cancel
+	b.pendingCoinsLock.Unlock()
+
+	go b.reportTradeFlow(ctx, coin)
+
+	conn := b.wsPool.assign()
+	client := b.wsPool.client(conn)
+
+	for attempt := 1; ; attempt++ {
+		received, err := b.streamTrades(ctx, client, coin, trades)
+		if err == nil {
+			return
+		}
+
+		if received {
+			attempt = 1
+		}
+
+		if attempt >= tradeTapeResubscribeAttempts {
+			log.Printf("Giving up on trades of %s: %v\n", coin.mintAddr.String(), err)
+			return
+		}
+
+		log.Printf("Trade subscription of %s failed, resubscribing: %v\n", coin.mintAddr.String(), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		}
+
+		// the connection most likely dropped, redial it (once, across all of its subscriptions)
+		if reconnected, err := b.wsPool.reconnect(conn, client); err == nil {
+			client = reconnected
+		}
+	}
+}
+
+// streamTrades publishes trades from a single subscription until it fails, returning a nil error once
+// we should stop watching. received reports whether the subscription delivered anything before failing
+func (b *Bot) streamTrades(ctx context.Context, client *ws.Client, coin *Coin, trades chan<- *TradeEvent) (received bool, err error) {
+	sub, err := client.LogsSubscribeMentions(coin.tokenBondingCurve, rpc.CommitmentConfirmed)
+	if err != nil {
+		return false, err
+	}
+
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case err := <-sub.Err():
+			return received, err
+		case msg := <-sub.Response():
+			received = true
+
+			if coin.botPurchased && !coin.botHoldsTokens() || !b.isPendingCoin(coin) {
+				return received, nil
+			}
+
+			if msg.Value.Err != nil {
+				continue
+			}
+
+			for _, event := range parseTradeEvents(msg.Value.Logs) {
+				if !event.Mint.Equals(coin.mintAddr) {
+					continue
+				}
+
+				event.Signature = msg.Value.Signature
+				b.updateCurve(coin, b.curveAfterTrade(event))
+				b.recordTradeFlow(coin, event)
+				b.sellOnMaxHoldValue(coin, event)
+				b.sellOnNetOutflow(coin)
+				b.checkCurveExits(coin)
+				publishTrade(trades, event)
+			}
+		}
+	}
+}
+
+// updateCurve stores `curve` as the coin's latest bonding curve, from its trade tape or the curve poller
+func (b *Bot) updateCurve(coin *Coin, curve *BondingCurveData) {
+	coin.curve.Store(curve)
+	coin.curveUpdatedAt.Store(time.Now().UnixNano())
+	b.recordPrice(coin, curve)
+}
+
+// checkCurveExits runs the exit triggers which only need the coin's latest bonding curve
+func (b *Bot) checkCurveExits(coin *Coin) {
+	b.sellOnCurveProgress(coin)
+	b.runStrategyPreset(coin)
+}
+
+// publishTrade hands a trade to the coin's sell strategies without ever blocking the subscription
+func publishTrade(trades chan<- *TradeEvent, event *TradeEvent) {
+	select {
+	case trades <- event:
+	default:
+		tradeEventsDropped.Inc()
+	}
+}
+
+// stopWatchingTrades ends the coin's trade subscription, if any. callers hold pendingCoinsLock
+func (c *Coin) stopWatchingTrades() {
+	if c.stopTrades != nil {
+		c.stopTrades()
+	}
+}
+
+// stop cancels the coin's context, ending every goroutine still working on it. callers hold pendingCoinsLock
+func (c *Coin) stop() {
+	c.stopWatchingTrades()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// context is the coin's context, never cancelled for coins which were never added to pendingCoins
+func (c *Coin) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// done is closed once the coin is removed from pendingCoins, nil (never closed) if it was never added
+func (c *Coin) done() <-chan struct{} {
+	if c.ctx == nil {
+		return nil
+	}
+
+	return c.ctx.Done()
+}
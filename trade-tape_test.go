@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+// tradeEventLog encodes `event` the way pump logs it
+func tradeEventLog(event *TradeEvent) string {
+	data := append([]byte{}, tradeEventDiscriminator[:]...)
+	data = append(data, event.Mint.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, event.SolAmount)
+	data = binary.LittleEndian.AppendUint64(data, event.TokenAmount)
+	if event.IsBuy {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	data = append(data, event.User.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(event.Timestamp))
+	data = binary.LittleEndian.AppendUint64(data, event.VirtualSolReserves)
+	data = binary.LittleEndian.AppendUint64(data, event.VirtualTokenReserves)
+
+	return "Program data: " + base64.StdEncoding.EncodeToString(data)
+}
+
+// pumpLogs wraps `entries` in an invoke of pump, as logged by a tx calling it
+func pumpLogs(entries ...string) []string {
+	logs := []string{"Program " + pumpProgramID.String() + " invoke [1]"}
+	logs = append(logs, entries...)
+	return append(logs, "Program "+pumpProgramID.String()+" success")
+}
+
+func TestParseTradeEvents(t *testing.T) {
+	// the discriminator seen on chain, `vdt/007mYe` in base64
+	require.Equal(t, [8]byte{0xbd, 0xdb, 0x7f, 0xd3, 0x4e, 0xe6, 0x61, 0xee}, tradeEventDiscriminator)
+
+	event := &TradeEvent{
+		Mint:                 solana.NewWallet().PublicKey(),
+		User:                 solana.NewWallet().PublicKey(),
+		SolAmount:            500_000_000,
+		TokenAmount:          17_000_000_000000,
+		IsBuy:                true,
+		Timestamp:            1718000000,
+		VirtualSolReserves:   31_500_000_000,
+		VirtualTokenReserves: 1_020_000_000_000000,
+	}
+
+	events := parseTradeEvents([]string{
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P invoke [1]",
+		"Program log: Instruction: Buy",
+		tradeEventLog(event),
+		// other events & garbage are skipped
+		"Program data: " + base64.StdEncoding.EncodeToString([]byte("not a trade event")),
+		"Program data: !!!",
+		"Program 6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P success",
+	})
+
+	require.Len(t, events, 1)
+	require.Equal(t, event, events[0])
+}
+
+func TestWatchTrades(t *testing.T) {
+	f := newLaunchFixture(t)
+	coin := &Coin{mintAddr: f.mint, tokenBondingCurve: f.bondingCurve, botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+
+	buy := &TradeEvent{Mint: f.mint, User: solana.NewWallet().PublicKey(), SolAmount: 1e9, IsBuy: true}
+	otherMint := &TradeEvent{Mint: solana.NewWallet().PublicKey(), User: solana.NewWallet().PublicKey(), SolAmount: 1e9, IsBuy: true}
+	sig := solana.Signature{7}
+
+	wsMock := newMockWS(t)
+	wsMock.handle("logsSubscribe", func(params []json.RawMessage) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   map[string]interface{}{"signature": sig.String(), "err": nil, "logs": pumpLogs(tradeEventLog(otherMint), tradeEventLog(buy))},
+		}}
+	})
+
+	b := &Bot{
+		privateKey:    solana.NewWallet().PrivateKey,
+		wsPool:        newWsPoolFromClients(wsMock.client(t)),
+		maxTradeTapes: 1,
+		pendingCoins:  map[string]*Coin{f.mint.String(): coin},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.WatchTrades(coin)
+		close(done)
+	}()
+
+	var trades chan *TradeEvent
+	require.Eventually(t, func() bool {
+		b.pendingCoinsLock.Lock()
+		defer b.pendingCoinsLock.Unlock()
+
+		trades = coin.trades
+		return trades != nil
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case trade := <-trades:
+		require.Equal(t, sig, trade.Signature)
+		require.Equal(t, buy.User, trade.User)
+	case <-time.After(time.Second):
+		t.Fatal("no trade published")
+	}
+
+	// the cap is reached, so a second coin isn't watched
+	other := &Coin{mintAddr: solana.NewWallet().PublicKey()}
+	b.WatchTrades(other)
+	require.Nil(t, other.trades)
+
+	// removing the coin ends the subscription & closes the tape
+	b.pendingCoinsLock.Lock()
+	coin.stopWatchingTrades()
+	delete(b.pendingCoins, f.mint.String())
+	b.pendingCoinsLock.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("trade watcher didn't stop")
+	}
+
+	_, open := <-trades
+	require.False(t, open)
+	require.Zero(t, b.activeTradeTapes.Load())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// recordTxFixture fetches tx `sig` the way the bot does and writes the getTransaction result to `outPath`,
+// for the tests to load in place of a hand-built tx (testdata/create-tx.json & rug-tx.json)
+func (b *Bot) recordTxFixture(ctx context.Context, sig solana.Signature, outPath string) error {
+	tx, err := b.getTransaction(ctx, sig, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", sig, err)
+	}
+
+	data, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	b.status(fmt.Sprintf("Recorded %s to %s", sig, outPath))
+	return os.WriteFile(outPath, append(data, '\n'), 0644)
+}
+
+// startTxFixtureRecording records tx `sig` through `rpcEndpoint` to `outPath`
+func startTxFixtureRecording(rpcEndpoint, sig, outPath string) error {
+	signature, err := solana.SignatureFromBase58(sig)
+	if err != nil {
+		return fmt.Errorf("bad signature %q: %w", sig, err)
+	}
+
+	b := &Bot{rpcClient: rpc.New(rpcEndpoint)}
+	return b.recordTxFixture(context.Background(), signature, outPath)
+}
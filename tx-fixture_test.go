@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTxFixture(t *testing.T) {
+	_, tx := decodeTxFixture(t, "create-tx.json")
+
+	mock := newMockRPC(t)
+	mock.handle("getTransaction", func(params []json.RawMessage) (interface{}, error) {
+		return loadTxFixture(t, "create-tx.json"), nil
+	})
+
+	out := filepath.Join(t.TempDir(), "tx.json")
+	b := &Bot{rpcClient: mock.client()}
+	require.NoError(t, b.recordTxFixture(context.Background(), tx.Signatures[0], out))
+
+	// the recording decodes like the fixtures do
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+
+	var recorded rpc.GetTransactionResult
+	require.NoError(t, json.Unmarshal(data, &recorded))
+
+	recordedTx, err := recorded.Transaction.GetTransaction()
+	require.NoError(t, err)
+	require.Equal(t, tx, recordedTx)
+}
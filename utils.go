@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"strings"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
 )
 
 // increase lookup time for funders with some common exchange addresses
@@ -28,6 +30,9 @@ var exchangeAddresses = map[string]interface{}{
 	"2AQdpHJ2JpcEgPiATUXjQxA8QmafFegfQwSLWSprPicm": nil,
 }
 
+// errBundleRejected wraps the error of a jito bundle which didn't make it to the block engine
+var errBundleRejected = errors.New("Jito Bundle Rejected")
+
 func isExchangeAddress(address string) bool {
 	_, ok := exchangeAddresses[address]
 	return ok
@@ -36,7 +41,11 @@ func isExchangeAddress(address string) bool {
 // signAndSendTx sends off a transaction and listens for completion
 // it allows optional context to trigger fellow goroutines to stop sending / listening
 // if one has already completed
-func (b *Bot) signAndSendTx(tx *solana.Transaction, enableJito bool) (*solana.Signature, error) {
+func (b *Bot) signAndSendTx(ctx context.Context, tx *solana.Transaction, enableJito bool) (*solana.Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	txSig, err := tx.Sign(
 		func(key solana.PublicKey) *solana.PrivateKey {
 			if b.privateKey.PublicKey().Equals(key) {
@@ -54,12 +63,16 @@ func (b *Bot) signAndSendTx(tx *solana.Transaction, enableJito bool) (*solana.Si
 	if enableJito {
 		b.statusy("Sending transaction (Jito) " + txSig[0].String())
 
-		_, err = b.jitoManager.jitoClient.BroadcastBundle([]*solana.Transaction{tx})
-		if err != nil {
-			return nil, err
+		if err = b.jitoManager.BroadcastBundle(ctx, []*solana.Transaction{tx}); err != nil {
+			if bundleRejected(err) {
+				return nil, fmt.Errorf("%w: %w", errBundleRejected, err)
+			}
+
+			// the bundle may be in anyway, sending the fallback too could buy / sell twice, so it's waited on as if sent
+			b.statusy(fmt.Sprintf("Sending bundle %s failed after it may have reached the block engine, waiting on it: %v", txSig[0], err))
 		}
 
-		if err = b.waitForTransactionComplete(txSig[0]); err != nil {
+		if err = b.waitForTransactionComplete(ctx, txSig[0]); err != nil {
 			return nil, err
 		}
 
@@ -69,13 +82,43 @@ func (b *Bot) signAndSendTx(tx *solana.Transaction, enableJito bool) (*solana.Si
 		return &txSig[0], nil
 	}
 
-	return b.sendTxVanilla(tx)
+	return b.sendTxVanilla(ctx, tx)
+}
+
+// signAndSendTxWithFallback is signAndSendTx, sending `fallback` as a vanilla tx instead if jito rejects the bundle
+// (see bundleRejected). returns the signature of whichever tx was sent
+func (b *Bot) signAndSendTxWithFallback(ctx context.Context, tx *solana.Transaction, enableJito bool, fallback *solana.Transaction) (*solana.Signature, error) {
+	sig, err := b.signAndSendTx(ctx, tx, enableJito)
+	if fallback == nil || !errors.Is(err, errBundleRejected) {
+		return sig, err
+	}
+
+	b.statusy("Sending vanilla tx with priority fee instead, " + err.Error())
+	return b.signAndSendTx(ctx, fallback, false)
 }
 
-func (b *Bot) sendTxVanilla(tx *solana.Transaction) (*solana.Signature, error) {
+// createJitoFallbackTx builds the vanilla tx sent if jito rejects a bundle, from `vanillaInstructions` (the
+// instructions before addJitoTip, priority fee included). nil unless `enableJito`, there's nothing to fall back from
+func (b *Bot) createJitoFallbackTx(enableJito bool, vanillaInstructions []solana.Instruction) (*solana.Transaction, error) {
+	if !enableJito {
+		return nil, nil
+	}
+
+	return b.createTransaction(vanillaInstructions...)
+}
+
+func (b *Bot) sendTxVanilla(ctx context.Context, tx *solana.Transaction) (*solana.Signature, error) {
 	var txSig = tx.Signatures[0]
 	var retries uint
 	b.statusy("Sending Vanilla TX to Dedicated & Free RPCs: " + txSig.String())
+
+	// free RPC sends still waiting out `freeRPCSendDelay` are dropped once we return
+	done := make(chan struct{})
+	defer close(done)
+
+	// every RPC's send returning is tracked, to credit the first one if the tx lands
+	sends := &rpcSends{}
+
 	// send off tx with our dedicated rpc aka `b.rpcClient`
 	go func() {
 		if _, err := b.rpcClient.SendTransactionWithOpts(
@@ -87,27 +130,49 @@ func (b *Bot) sendTxVanilla(tx *solana.Transaction) (*solana.Signature, error) {
 			},
 		); err != nil {
 			fmt.Println("Error Sending Vanilla TX (Dedicated RPC)", err)
+			return
 		}
+
+		sends.add(rpcSend{endpoint: dedicatedRPCEndpoint, slot: b.currentSlot(), at: time.Now()})
 	}()
 
-	// use our free / alternate RPCs to send txs
+	// use our free / alternate RPCs to send txs, giving the dedicated send a head start. RPCs which
+	// never return first are held back further, see TxLandingRateByRPC
 	for _, rpcClient := range b.sendTxClients {
-		go func(client *rpc.Client) {
-			if err := b.sendOneVanillaTX(tx, client); err != nil {
+		go func(client sendTxClient) {
+			delay := b.freeRPCSendDelay
+			if b.txLanding.deprioritized(client.endpoint) {
+				delay += deprioritizedRPCSendDelay
+			}
+
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-done:
+					return
+				}
+			}
+
+			if err := b.sendOneVanillaTX(tx, client.Client); err != nil {
 				if strings.Contains(err.Error(), "429") {
 					fmt.Println("Error Sending 1 Vanilla TX (Free RPC) (Ratelimited)")
 				} else {
 					fmt.Println("Error Sending 1 Vanilla TX (Free RPC)", err)
 				}
 
+				return
 			}
+
+			sends.add(rpcSend{endpoint: client.endpoint, slot: b.currentSlot(), at: time.Now()})
 		}(rpcClient)
 	}
 
-	if err := b.waitForTransactionComplete(txSig); err != nil {
+	landedSlot, err := b.waitForTransactionSlot(ctx, txSig)
+	if err != nil {
 		return nil, err
 	}
 
+	b.recordLanding(sends, landedSlot)
 	return &txSig, nil
 }
 
@@ -131,42 +196,164 @@ func (b *Bot) fetchNLastTrans(numberSigs int, address string, optCtx ...context.
 		ctx = optCtx[0]
 	}
 
+	start := time.Now()
+	_, responses, err := b.fetchTransUntil(ctx, numberSigs, address, solana.Signature{})
+
+	// a fetch cut off by its deadline took at least that long. leaving it out would keep the P95, and so the
+	// deadlines derived from it, too low for a slowing RPC to ever catch up with
+	if err == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		b.funderFetchLatency.record(time.Since(start))
+	}
+
+	return responses, err
+}
+
+// fetchTransUntil fetches up to `numberSigs` of the latest transactions of `address`, stopping at
+// (and excluding) `until` unless it's empty. The signatures are returned newest first alongside the txs
+func (b *Bot) fetchTransUntil(ctx context.Context, numberSigs int, address string, until solana.Signature) ([]*rpc.TransactionSignature, jsonrpc.RPCResponses, error) {
 	signatures, err := b.rpcClient.GetSignaturesForAddressWithOpts(
 		ctx,
 		solana.MustPublicKeyFromBase58(address),
 		&rpc.GetSignaturesForAddressOpts{
 			Commitment: rpc.CommitmentConfirmed,
 			Limit:      &numberSigs,
+			Until:      until,
 		},
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "context deadline") {
 			fmt.Println("Context timeout for", address)
-			return nil, errors.New("context timeout")
+			return nil, nil, errors.New("context timeout")
 		}
 
 		log.Printf("Failed to fetch transactions for %s: %v\n", address, err)
-		return nil, err
+		return nil, nil, err
+	}
+
+	// nothing new since `until`
+	if len(signatures) == 0 {
+		return nil, nil, nil
 	}
 
-	requests := make([]*jsonrpc.RPCRequest, len(signatures)) // Initializing an empty slice of pointers to RPCRequest structs
+	responses, err := b.jrpcClient.CallBatch(ctx, b.getTransactionRequests(signatures))
+	if err != nil {
+		b.statusr(err)
+		return nil, nil, err
+	}
+
+	if b.rejectedTxVersion(responses) {
+		responses, err = b.jrpcClient.CallBatch(ctx, b.getTransactionRequests(signatures))
+		if err != nil {
+			b.statusr(err)
+			return nil, nil, err
+		}
+	}
+
+	return signatures, responses, nil
+}
+
+// getTransactionRequests builds the batched getTransaction requests of `signatures`
+func (b *Bot) getTransactionRequests(signatures []*rpc.TransactionSignature) []*jsonrpc.RPCRequest {
+	requests := make([]*jsonrpc.RPCRequest, len(signatures))
 
 	for i, sig := range signatures {
+		opts := map[string]interface{}{"commitment": rpc.CommitmentConfirmed}
+		if version := b.txVersionParam(); version != nil {
+			opts["maxSupportedTransactionVersion"] = *version
+		}
+
 		requests[i] = &jsonrpc.RPCRequest{
 			JSONRPC: "2.0",
 			ID:      i + 1,
 			Method:  "getTransaction",
-			Params:  []interface{}{sig.Signature, map[string]interface{}{"commitment": rpc.CommitmentConfirmed, "maxSupportedTransactionVersion": 0}},
+			Params:  []interface{}{sig.Signature, opts},
+		}
+	}
+
+	return requests
+}
+
+// rejectedTxVersion checks batched getTransaction responses for the RPC rejecting the version
+// parameter, in which case it's omitted from now on and the batch should be sent again
+func (b *Bot) rejectedTxVersion(responses jsonrpc.RPCResponses) bool {
+	if b.txVersionParam() == nil {
+		return false
+	}
+
+	for _, resp := range responses {
+		if resp != nil && resp.Error != nil && isUnsupportedTxVersionErr(resp.Error) {
+			b.omitTxVersionFromNowOn()
+			return true
 		}
 	}
 
-	responses, err := b.jrpcClient.CallBatch(context.TODO(), requests)
+	return false
+}
+
+// txVersionParam is the maxSupportedTransactionVersion we send with getTransaction, nil to omit it
+func (b *Bot) txVersionParam() *uint64 {
+	if b.omitTxVersion || b.txVersionRejected.Load() {
+		return nil
+	}
+
+	version := uint64(0)
+	return &version
+}
+
+func (b *Bot) omitTxVersionFromNowOn() {
+	if !b.txVersionRejected.Swap(true) {
+		b.statusy("RPC rejected maxSupportedTransactionVersion, omitting it from getTransaction from now on")
+	}
+}
+
+// isUnsupportedTxVersionErr checks if an RPC rejected getTransaction's maxSupportedTransactionVersion,
+// as custom & older RPCs which don't know the parameter do
+func isUnsupportedTxVersionErr(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "maxsupportedtransactionversion") || strings.Contains(msg, "unsupported version")
+}
+
+// getTransaction fetches a tx with our version parameter, retrying without it if the RPC rejects it
+func (b *Bot) getTransaction(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType) (*rpc.GetTransactionResult, error) {
+	opts := &rpc.GetTransactionOpts{
+		MaxSupportedTransactionVersion: b.txVersionParam(),
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     commitment,
+	}
+
+	tx, err := b.rpcClient.GetTransaction(ctx, sig, opts)
+	if err != nil && opts.MaxSupportedTransactionVersion != nil && isUnsupportedTxVersionErr(err) {
+		b.omitTxVersionFromNowOn()
+
+		opts.MaxSupportedTransactionVersion = nil
+		return b.rpcClient.GetTransaction(ctx, sig, opts)
+	}
+
+	return tx, err
+}
+
+// fetchTokenBalance fetches the raw token balance of a token account, at confirmed commitment
+func (b *Bot) fetchTokenBalance(ctx context.Context, account solana.PublicKey) (*big.Int, error) {
+	balance, err := b.rpcClient.GetTokenAccountBalance(ctx, account, rpc.CommitmentConfirmed)
 	if err != nil {
-		b.statusr(err)
 		return nil, err
 	}
 
-	return responses, nil
+	if balance.Value == nil {
+		return nil, errNoTokenAccountData
+	}
+
+	held, ok := new(big.Int).SetString(balance.Value.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid token balance %q", balance.Value.Amount)
+	}
+
+	return held, nil
+}
+
+// isAccountNotFoundErr checks if an RPC reported the account we asked about doesn't exist (e.g. a closed token account)
+func isAccountNotFoundErr(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "could not find account")
 }
 
 // botHoldsTokens is a way for the bot to immediately check if we hold tokens
@@ -183,37 +370,101 @@ func (c *Coin) botHoldsTokens() bool {
 	return heldTokensInt > 100
 }
 
-func (b *Bot) waitForTransactionComplete(sig solana.Signature) error {
+// waitForTransactionComplete waits for `sig` to confirm, returning early if `ctx` is cancelled
+// (e.g. another tx of the same sell already confirmed). confirmed signatures are cached,
+// so waiting on a signature we've already seen confirm never subscribes again
+func (b *Bot) waitForTransactionComplete(ctx context.Context, sig solana.Signature) error {
+	_, err := b.waitForTransactionSlot(ctx, sig)
+	return err
+}
+
+// waitForTransactionSlot is waitForTransactionComplete, returning the slot the tx landed in
+// (0 if it was already cached as confirmed)
+func (b *Bot) waitForTransactionSlot(ctx context.Context, sig solana.Signature) (uint64, error) {
+	if _, confirmed := b.confirmedSigs.Load(sig); confirmed {
+		return 0, nil
+	}
+
 	b.statusy("Waiting for transaction " + sig.String() + " to complete")
 
-	signatureSubscription, err := b.wsClient.SignatureSubscribe(sig, rpc.CommitmentConfirmed)
+	slot, err := b.waitForCommitmentSlot(ctx, sig, rpc.CommitmentConfirmed)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	defer signatureSubscription.Unsubscribe()
+	b.markSigConfirmed(sig)
+	return slot, nil
+}
 
-	result, err := signatureSubscription.RecvWithTimeout(time.Duration(120) * time.Second)
+// waitForCommitment waits for `sig` to reach `commitment`, returning early if `ctx` is cancelled
+func (b *Bot) waitForCommitment(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType) error {
+	_, err := b.waitForCommitmentSlot(ctx, sig, commitment)
+	return err
+}
+
+// waitForCommitmentSlot is waitForCommitment, returning the slot of the notification `sig` reached `commitment` in
+func (b *Bot) waitForCommitmentSlot(ctx context.Context, sig solana.Signature, commitment rpc.CommitmentType) (uint64, error) {
+	conn := b.wsPool.assign()
+	client := b.wsPool.client(conn)
+
+	signatureSubscription, err := client.SignatureSubscribe(sig, commitment)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if result.Value.Err != nil {
-		return fmt.Errorf("Error in transaction: %v", result.Value.Err)
+	defer signatureSubscription.Unsubscribe()
+
+	timeout := time.NewTimer(120 * time.Second)
+	defer timeout.Stop()
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timeout.C:
+		return 0, ws.ErrTimeout
+	case err := <-signatureSubscription.Err():
+		// redial the dropped connection, so retries (and its other subscriptions) get a live one
+		b.wsPool.reconnect(conn, client)
+		return 0, err
+	case result := <-signatureSubscription.Response():
+		if result.Value.Err != nil {
+			return 0, fmt.Errorf("Error in transaction: %v", result.Value.Err)
+		}
+
+		return result.Context.Slot, nil
 	}
+}
+
+// markSigConfirmed caches a confirmed signature for a few minutes, long enough to
+// cover any duplicate sends of the same tx
+func (b *Bot) markSigConfirmed(sig solana.Signature) {
+	b.confirmedSigs.Store(sig, true)
 
-	return nil
+	time.AfterFunc(5*time.Minute, func() {
+		b.confirmedSigs.Delete(sig)
+	})
 }
 
-// lateToBuy compares the virtual sol reserves held in
-// bonding curve compared to how much user bought of the coin,
-// letting us know if we would be second buyer with current bonding curve
-func (c *Coin) lateToBuy(bcd *BondingCurveData) bool {
-	reservesLamports, _ := bcd.VirtualSolReserves.Float64()
-	reservesSol := reservesLamports / float64(solana.LAMPORTS_PER_SOL)
-	reservesLessCreatorSol := reservesSol - c.creatorPurchaseSol
+// externalSolBeforeEntry is how much SOL (in lamports) others put into `bcd` beyond pump's launch
+// reserves and the creator's buy, i.e. what buyers ahead of us paid. negative once the creator sold
+func (b *Bot) externalSolBeforeEntry(coin *Coin, bcd *BondingCurveData) int64 {
+	launchVirtualTokens, launchVirtualSol, _ := b.currentLaunchReserves()
+
+	// the curve right after the creator's buy, from the tokens they got
+	afterCreator := new(big.Int).SetUint64(launchVirtualSol)
+	if creatorTokens := coin.creatorPeakBalance; creatorTokens > 0 && creatorTokens < launchVirtualTokens {
+		invariant := new(big.Int).Mul(new(big.Int).SetUint64(launchVirtualTokens), afterCreator)
+		afterCreator = invariant.Div(invariant, new(big.Int).SetUint64(launchVirtualTokens-creatorTokens))
+	} else if coin.creatorPurchased {
+		afterCreator.Add(afterCreator, big.NewInt(int64(coin.creatorPurchaseSol*float64(solana.LAMPORTS_PER_SOL))))
+	}
+
+	return new(big.Int).Sub(bcd.VirtualSolReserves, afterCreator).Int64()
+}
 
-	// consider data stale if someone in with more than 0.1
-	// NOTE: we deduct 30 solana since that's already in bonding curve, provided by pump.fun
-	return reservesLessCreatorSol-30 > 0.1
+// lateToBuy checks if others already put more than `maxExternalSolBeforeEntry` into the curve
+// after the creator, meaning we wouldn't be the second buyer. returns the SOL they put in
+func (b *Bot) lateToBuy(coin *Coin, bcd *BondingCurveData) (externalSol float64, late bool) {
+	externalSol = float64(b.externalSolBeforeEntry(coin, bcd)) / float64(solana.LAMPORTS_PER_SOL)
+	return externalSol, externalSol > b.maxExternalSolBeforeEntry
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	pump "github.com/1fge/pump-fun-sniper-bot/pump"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForTransactionCompleteCached(t *testing.T) {
+	// no ws client, so any attempt to subscribe would panic
+	b := &Bot{}
+	sig := solana.Signature{1}
+
+	b.markSigConfirmed(sig)
+	require.NoError(t, b.waitForTransactionComplete(context.Background(), sig))
+}
+
+func TestSignAndSendTxCancelledSession(t *testing.T) {
+	b := &Bot{privateKey: solana.NewWallet().PrivateKey}
+	b.blockhash.Store(&solana.Hash{})
+
+	tx, err := b.createTransaction(solana.NewInstruction(solana.SystemProgramID, solana.AccountMetaSlice{solana.Meta(b.privateKey.PublicKey()).SIGNER().WRITE()}, nil))
+	require.NoError(t, err)
+
+	// a sell in the same session already confirmed, nothing gets sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = b.signAndSendTx(ctx, tx, false)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSendTxVanillaStaggersFreeRPCs(t *testing.T) {
+	sendTimes := func(mock *mockRPC) <-chan time.Time {
+		sent := make(chan time.Time, 1)
+		mock.handle("sendTransaction", func(params []json.RawMessage) (interface{}, error) {
+			sent <- time.Now()
+			return solana.Signature{}.String(), nil
+		})
+		return sent
+	}
+
+	dedicated, free := newMockRPC(t), newMockRPC(t)
+	dedicatedSent, freeSent := sendTimes(dedicated), sendTimes(free)
+
+	// never confirms, so the send only ends with its context
+	wsMock := newMockWS(t)
+	wsMock.handle("signatureSubscribe", func(params []json.RawMessage) []interface{} { return nil })
+
+	b := &Bot{
+		rpcClient:        dedicated.client(),
+		sendTxClients:    []sendTxClient{{Client: free.client(), endpoint: "free"}},
+		wsPool:           newWsPoolFromClients(wsMock.client(t)),
+		privateKey:       solana.NewWallet().PrivateKey,
+		freeRPCSendDelay: 150 * time.Millisecond,
+	}
+	b.blockhash.Store(&solana.Hash{})
+
+	tx, err := b.createTransaction(solana.NewInstruction(solana.SystemProgramID, solana.AccountMetaSlice{solana.Meta(b.privateKey.PublicKey()).SIGNER().WRITE()}, nil))
+	require.NoError(t, err)
+	_, err = tx.Sign(func(solana.PublicKey) *solana.PrivateKey { return &b.privateKey })
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = b.sendTxVanilla(ctx, tx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	dedicatedAt, freeAt := <-dedicatedSent, <-freeSent
+	require.GreaterOrEqual(t, freeAt.Sub(dedicatedAt), 100*time.Millisecond)
+
+	// a send which ends before the delay is up never reaches the free RPCs
+	b.freeRPCSendDelay = 300 * time.Millisecond
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = b.sendTxVanilla(ctx, tx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	<-dedicatedSent
+	select {
+	case <-freeSent:
+		t.Fatal("free RPC sent to after the send ended")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestLateToBuy(t *testing.T) {
+	coin := fixtureCoin(t)
+	curve := curveAfterCreatorBuy(coin.creatorTokenBalance)
+	b := &Bot{maxExternalSolBeforeEntry: 0.1}
+
+	// only the creator has bought
+	externalSol, late := b.lateToBuy(coin, curve)
+	require.False(t, late)
+	require.Zero(t, externalSol)
+
+	// someone else got in ahead of us
+	curve.VirtualSolReserves.Add(curve.VirtualSolReserves, big.NewInt(500_000_000))
+	externalSol, late = b.lateToBuy(coin, curve)
+	require.True(t, late)
+	require.InDelta(t, 0.5, externalSol, 1e-9)
+
+	// a tolerance above what they bought
+	b.maxExternalSolBeforeEntry = 1
+	_, late = b.lateToBuy(coin, curve)
+	require.False(t, late)
+}
+
+func TestLateToBuyFollowsLaunchReserves(t *testing.T) {
+	coin := &Coin{}
+	b := &Bot{maxExternalSolBeforeEntry: 0.1}
+
+	// pump launching curves with 40 SOL of virtual reserves instead of 30
+	b.globalParams.Store(&pump.Global{InitialVirtualTokenReserves: initialVirtualTokenReserves, InitialVirtualSolReserves: 40_000_000_000, InitialRealTokenReserves: initialRealTokenReserves})
+	curve := &BondingCurveData{VirtualSolReserves: big.NewInt(40_050_000_000)}
+
+	externalSol, late := b.lateToBuy(coin, curve)
+	require.False(t, late)
+	require.InDelta(t, 0.05, externalSol, 1e-9)
+}
+
+func TestFetchTransUntilRetriesWithoutTxVersion(t *testing.T) {
+	mock := newMockRPC(t)
+	mock.handle("getSignaturesForAddress", func(params []json.RawMessage) (interface{}, error) {
+		return []map[string]interface{}{{"signature": solana.Signature{2}.String(), "slot": 1}, {"signature": solana.Signature{3}.String(), "slot": 1}}, nil
+	})
+	mock.handle("getTransaction", rejectTxVersionHandler(t))
+
+	b := &Bot{rpcClient: mock.client(), jrpcClient: mock.jsonrpcClient()}
+	_, responses, err := b.fetchTransUntil(context.Background(), 2, solana.NewWallet().PublicKey().String(), solana.Signature{})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	for _, resp := range responses {
+		require.Nil(t, resp.Error)
+	}
+
+	// one batch with the version, one without
+	require.Len(t, mock.callsTo("getTransaction"), 4)
+	require.True(t, b.txVersionRejected.Load())
+}
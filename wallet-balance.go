@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// how long a wallet balance fetch may take before the refresh gives up on it
+const walletBalanceFetchTimeout = 2 * time.Second
+
+// buySpend is the most a buy we're sending can take from the wallet. `doneAt` is set once the send returned,
+// zero while it's in flight
+type buySpend struct {
+	lamports uint64
+	doneAt   time.Time
+}
+
+// walletBalance caches our SOL balance so checkWalletReserve never waits on an RPC. buys hold their most possible
+// spend against the cached balance from the reserve check on, until a balance fetched after their send returned
+// accounts for whatever they spent
+type walletBalance struct {
+	lock     sync.Mutex
+	lamports uint64
+	spends   []*buySpend
+}
+
+// update stores `lamports`, our balance fetched starting at `fetchedAt`, dropping the spends of buys done before then
+func (w *walletBalance) update(lamports uint64, fetchedAt time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.lamports = lamports
+
+	pending := w.spends[:0]
+	for _, spend := range w.spends {
+		if spend.doneAt.IsZero() || !spend.doneAt.Before(fetchedAt) {
+			pending = append(pending, spend)
+		}
+	}
+	w.spends = pending
+}
+
+// available is what's left of the cached balance above `reserve` once the spends of pending buys are taken out
+func (w *walletBalance) available(reserve uint64) uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.availableLocked(reserve)
+}
+
+// availableLocked is available, callers hold lock
+func (w *walletBalance) availableLocked(reserve uint64) uint64 {
+	held := reserve
+	for _, spend := range w.spends {
+		held += spend.lamports
+	}
+
+	if w.lamports <= held {
+		return 0
+	}
+
+	return w.lamports - held
+}
+
+// hold sets `lamports` aside for a buy if they're available above `reserve`, returning the func to call once the
+// buy's send returned. false if the buy can't afford it
+func (w *walletBalance) hold(lamports, reserve uint64) (func(), bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if lamports > w.availableLocked(reserve) {
+		return nil, false
+	}
+
+	spend := &buySpend{lamports: lamports}
+	w.spends = append(w.spends, spend)
+
+	return func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+
+		spend.doneAt = time.Now()
+	}, true
+}
+
+// refreshWalletBalance fetches our SOL balance into `walletBalance`
+func (b *Bot) refreshWalletBalance() error {
+	ctx, cancel := context.WithTimeout(context.Background(), walletBalanceFetchTimeout)
+	defer cancel()
+
+	fetchedAt := time.Now()
+	balance, err := b.rpcClient.GetBalance(ctx, b.privateKey.PublicKey(), rpc.CommitmentProcessed)
+	if err != nil {
+		return err
+	}
+
+	b.walletBalance.update(balance.Value, fetchedAt)
+	return nil
+}
+
+// RefreshWalletBalance runs as goroutine, refetching our SOL balance every `walletBalanceRefreshInterval`
+// for checkWalletReserve. a failed fetch keeps the last balance, with every buy since still held against it
+func (b *Bot) RefreshWalletBalance(ctx context.Context) {
+	ticker := time.NewTicker(b.walletBalanceRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.refreshWalletBalance(); err != nil {
+			b.statusr(fmt.Sprintf("Failed to refresh wallet balance: %v", err))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errWsPingTimeout = errors.New("WebSocket Ping Timed Out")
+
+// ping subscribes to slots on connection `conn`, failing unless a slot arrives within `timeout`. a connection
+// the server stopped serving without closing it never errors its subscriptions, only this notices
+func (p *WsPool) ping(conn int, timeout time.Duration) error {
+	sub, err := p.client(conn).SlotSubscribe()
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case <-sub.Response():
+		return nil
+	case err := <-sub.Err():
+		return err
+	case <-time.After(timeout):
+		return errWsPingTimeout
+	}
+}
+
+// wsHealthMonitor runs as goroutine, pinging every pool connection each `wsPingInterval` and redialing the ones
+// not answering within `wsPingTimeout`. closing the dead client fails every subscription on it, so mint detection
+// and the listeners of the coins we hold resubscribe on the new connection as they would after any drop
+func (b *Bot) wsHealthMonitor(ctx context.Context) {
+	ticker := time.NewTicker(b.wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for conn := range b.wsPool.conns {
+			b.checkWsConn(conn)
+		}
+	}
+}
+
+// checkWsConn pings connection `conn`, redialing it if it's dead
+func (b *Bot) checkWsConn(conn int) {
+	client := b.wsPool.client(conn)
+
+	err := b.wsPool.ping(conn, b.wsPingTimeout)
+	if err == nil {
+		return
+	}
+
+	wsHealthReconnects.Inc()
+	msg := fmt.Sprintf("WebSocket connection %d failed its ping (%v), reconnecting", conn, err)
+	b.statusr(msg)
+	b.notify(msg)
+
+	if _, err := b.wsPool.reconnect(conn, client); err != nil {
+		b.statusr(fmt.Sprintf("Failed to reconnect WebSocket connection %d: %v", conn, err))
+		return
+	}
+
+	b.statusg(fmt.Sprintf("Reconnected WebSocket connection %d", conn))
+}
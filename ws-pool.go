@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// mintConn is the pool connection reserved for the pump program logs we detect mints from
+const mintConn = 0
+
+var errWsPoolCantRedial = errors.New("WebSocket Pool Has No URL To Redial")
+
+// WsPool holds several websocket connections to our RPC, so the notifications of coins we hold never
+// share a connection with mint detection. connection `mintConn` only carries the pump program logs,
+// per-coin subscriptions (creator ATA / wallet, graduation, trades, signatures) are assigned round-robin
+// to the others. a dropped connection is redialed on its own, only its subscriptions need re-establishing
+type WsPool struct {
+	url string
+
+	lock  sync.RWMutex
+	conns []*ws.Client
+
+	// held while redialing a connection, so its subscriptions noticing the drop together only redial once
+	dialLocks []sync.Mutex
+
+	next atomic.Uint64
+}
+
+// newWsPool dials `size` connections to `url`
+func newWsPool(ctx context.Context, url string, size int) (*WsPool, error) {
+	clients := make([]*ws.Client, 0, max(size, 1))
+	for len(clients) < cap(clients) {
+		client, err := ws.Connect(ctx, url)
+		if err != nil {
+			for _, client := range clients {
+				client.Close()
+			}
+			return nil, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	p := newWsPoolFromClients(clients...)
+	p.url = url
+	return p, nil
+}
+
+// newWsPoolFromClients wraps connected clients, the first serving mint detection. without a url,
+// dropped connections can't be redialed
+func newWsPoolFromClients(clients ...*ws.Client) *WsPool {
+	return &WsPool{
+		conns:     clients,
+		dialLocks: make([]sync.Mutex, len(clients)),
+	}
+}
+
+// assign picks the connection for a new per-coin subscription. with a single connection, everything shares it
+func (p *WsPool) assign() int {
+	if len(p.conns) == 1 {
+		return mintConn
+	}
+
+	return 1 + int((p.next.Add(1)-1)%uint64(len(p.conns)-1))
+}
+
+// client returns the current client of connection `conn`
+func (p *WsPool) client(conn int) *ws.Client {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.conns[conn]
+}
+
+// reconnect redials connection `conn` if `failed` is still its client, returning the client to resubscribe on.
+// if another subscription already redialed it, the new client is returned as is
+func (p *WsPool) reconnect(conn int, failed *ws.Client) (*ws.Client, error) {
+	p.dialLocks[conn].Lock()
+	defer p.dialLocks[conn].Unlock()
+
+	if current := p.client(conn); current != failed {
+		return current, nil
+	}
+
+	if p.url == "" {
+		return nil, errWsPoolCantRedial
+	}
+
+	client, err := ws.Connect(context.Background(), p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	p.conns[conn] = client
+	p.lock.Unlock()
+
+	failed.Close()
+	return client, nil
+}
+
+// resubscribeAccount redials connection `conn` after `failed` dropped, then subscribes to `account` on it again
+func (p *WsPool) resubscribeAccount(conn int, failed *ws.Client, account solana.PublicKey) (*ws.Client, *ws.AccountSubscription, error) {
+	client, err := p.reconnect(conn, failed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := client.AccountSubscribe(account, rpc.CommitmentConfirmed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, sub, nil
+}
+
+// resubscribeLogs redials connection `conn` after `failed` dropped, then subscribes to logs mentioning `address` on it again
+func (p *WsPool) resubscribeLogs(conn int, failed *ws.Client, address solana.PublicKey) (*ws.Client, *ws.LogSubscription, error) {
+	client, err := p.reconnect(conn, failed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := client.LogsSubscribeMentions(address, rpc.CommitmentConfirmed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, sub, nil
+}
+
+// Close closes every connection of the pool
+func (p *WsPool) Close() {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, client := range p.conns {
+		client.Close()
+	}
+}
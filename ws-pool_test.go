@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWsPoolAssign(t *testing.T) {
+	// per-coin subscriptions never land on the mint connection
+	p := newWsPoolFromClients(&ws.Client{}, &ws.Client{}, &ws.Client{})
+	for _, want := range []int{1, 2, 1, 2} {
+		require.Equal(t, want, p.assign())
+	}
+
+	// a single connection carries everything
+	require.Equal(t, mintConn, newWsPoolFromClients(&ws.Client{}).assign())
+}
+
+func accountNotification(lamports uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": 1},
+		"value": map[string]interface{}{
+			"lamports":   lamports,
+			"owner":      solana.SystemProgramID.String(),
+			"data":       []string{"", "base64"},
+			"executable": false,
+			"rentEpoch":  0,
+		},
+	}
+}
+
+func TestWsPoolReconnectsOnlyDroppedConnection(t *testing.T) {
+	mintWS, coinWS := newMockWS(t), newMockWS(t)
+
+	// the creator drains their wallet while we're disconnected, showing in the first
+	// notification of the new subscription
+	var subscriptions atomic.Int32
+	coinWS.handle("accountSubscribe", func(params []json.RawMessage) []interface{} {
+		if subscriptions.Add(1) == 1 {
+			return nil
+		}
+		return []interface{}{accountNotification(0)}
+	})
+
+	mock := newMockRPC(t)
+	mock.handle("getBalance", func(params []json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": 5 * solana.LAMPORTS_PER_SOL}, nil
+	})
+
+	mintClient := mintWS.client(t)
+	pool := newWsPoolFromClients(mintClient, coinWS.client(t))
+	pool.url = coinWS.url()
+	t.Cleanup(pool.Close)
+
+	coin := &Coin{mintAddr: solana.NewWallet().PublicKey(), creator: solana.NewWallet().PublicKey(), botPurchased: true, tokensHeld: big.NewInt(1_000_000)}
+	b := &Bot{
+		rpcClient:               mock.client(),
+		wsPool:                  pool,
+		pendingCoins:            map[string]*Coin{coin.mintAddr.String(): coin},
+		creatorWalletInflowSol:  1,
+		creatorWalletDrainedSol: 0.01,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.listenCreatorWallet(coin)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return subscriptions.Load() == 1 }, time.Second, 10*time.Millisecond)
+	droppedClient := pool.client(1)
+	coinWS.dropConnections()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("creator wallet listener didn't resubscribe")
+	}
+
+	require.Equal(t, exitReasonCreatorDrained, coin.exitReason)
+	require.NotSame(t, droppedClient, pool.client(1))
+	require.Same(t, mintClient, pool.client(mintConn))
+
+	// the connection is only redialed once, however many subscriptions notice the drop
+	redialed := pool.client(1)
+	client, err := pool.reconnect(1, droppedClient)
+	require.NoError(t, err)
+	require.Same(t, redialed, client)
+}
+
+func TestWsHealthMonitorRedialsUnresponsiveConnection(t *testing.T) {
+	mock := newMockWS(t)
+
+	var responsive atomic.Bool
+	responsive.Store(true)
+	mock.handle("slotSubscribe", func(params []json.RawMessage) []interface{} {
+		if !responsive.Load() {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"parent": 1, "root": 0, "slot": 2}}
+	})
+	mock.handle("accountSubscribe", func(params []json.RawMessage) []interface{} { return nil })
+
+	mintClient := mock.client(t)
+	pool := newWsPoolFromClients(mintClient, mock.client(t))
+	pool.url = mock.url()
+	t.Cleanup(pool.Close)
+
+	b := &Bot{wsPool: pool, wsPingTimeout: 100 * time.Millisecond}
+
+	// answered pings leave the connection be
+	healthy := pool.client(1)
+	b.checkWsConn(1)
+	require.Same(t, healthy, pool.client(1))
+
+	sub, err := healthy.AccountSubscribe(solana.NewWallet().PublicKey(), "")
+	require.NoError(t, err)
+
+	// the server stops answering without closing the connection
+	responsive.Store(false)
+	b.checkWsConn(1)
+	require.NotSame(t, healthy, pool.client(1))
+	require.Same(t, mintClient, pool.client(mintConn))
+
+	// subscriptions on the dead connection fail, so their listeners resubscribe
+	_, err = sub.Recv()
+	require.Error(t, err)
+
+	responsive.Store(true)
+	require.NoError(t, pool.ping(1, time.Second))
+}